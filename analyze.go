@@ -0,0 +1,351 @@
+package sqlite
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/elordeiro/SQLite-DBReader/btree"
+	"github.com/elordeiro/SQLite-DBReader/parser"
+	"github.com/elordeiro/SQLite-DBReader/record"
+)
+
+// Constants ------------------------------------------------------------------
+
+// Statistics of a read-only database are kept next to it in a file with this
+// suffix, valid while the database's change counter is unchanged
+const statsFileSuffix = "-stats"
+
+// ----------------------------------------------------------------------------
+
+// Custom Types ---------------------------------------------------------------
+
+// statRow is a row of sqlite_stat1. idx is "" for the row counting a table
+// without indexes.
+type statRow struct {
+	tbl, idx, stat string
+}
+
+// ----------------------------------------------------------------------------
+
+// ANALYZE --------------------------------------------------------------------
+
+// execAnalyze counts the rows of tables and the average rows sharing each key
+// prefix of their indexes, replacing the statistics of the tables and
+// indexes analyzed. They go into sqlite_stat1, or into the stats file when
+// the database is read-only.
+func (db *DB) execAnalyze(stmt *parser.AnalyzeStatement) (*Result, error) {
+	tables, index, err := db.analyzeTargets(stmt.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := make([]statRow, 0)
+	for _, table := range tables {
+		indexes := db.GetIndexes(table)
+		if index != nil {
+			indexes = []*Table{index}
+		} else if len(indexes) == 0 {
+			n, err := db.countRows(table)
+			if err != nil {
+				return nil, err
+			}
+			if n > 0 {
+				rows = append(rows, statRow{tbl: table.Name, stat: strconv.FormatInt(n, 10)})
+			}
+		}
+		for _, idx := range indexes {
+			stat, err := db.analyzeIndex(idx)
+			if err != nil {
+				return nil, err
+			}
+			if stat != "" {
+				rows = append(rows, statRow{tbl: table.Name, idx: idx.Name, stat: stat})
+			}
+		}
+	}
+
+	// Statistics replaced by this run
+	replaced := func(r statRow) bool {
+		if index != nil {
+			return strings.EqualFold(r.idx, index.Name)
+		}
+		for _, table := range tables {
+			if strings.EqualFold(r.tbl, table.Name) {
+				return true
+			}
+		}
+		return false
+	}
+	if db.bt.Pager.ReadOnly() {
+		err = db.writeStatsFile(rows, replaced)
+	} else {
+		err = db.writeStat1(rows, tables, index)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Plans made with the old statistics are made again
+	db.planStats = nil
+	db.schemaVersion++
+	return &Result{}, nil
+}
+
+// analyzeTargets resolves the name given to ANALYZE to the tables to
+// analyze, or to an index and its table. No name, or the schema name main,
+// analyzes every table.
+func (db *DB) analyzeTargets(name string) ([]*Table, *Table, error) {
+	analyzable := func(t *Table) bool {
+		return t.Type == TableTypeTable && !t.Virtual && !t.WithoutRowID &&
+			!strings.HasPrefix(strings.ToLower(t.Name), "sqlite_")
+	}
+
+	tables := make([]*Table, 0)
+	if name == "" || strings.EqualFold(name, "main") {
+		for _, t := range db.tables {
+			if analyzable(t) {
+				tables = append(tables, t)
+			}
+		}
+		return tables, nil, nil
+	}
+
+	obj := db.GetTable(name)
+	switch {
+	case obj == nil || obj.Type == TableTypeView || obj.Type == TableTypeTrigger:
+		return nil, nil, fmt.Errorf("no such table or index: %s", name)
+	case obj.Type == TableTypeIndex:
+		table := db.GetTable(obj.TblName)
+		if table == nil || !analyzable(table) {
+			return tables, nil, nil
+		}
+		return []*Table{table}, obj, nil
+	case analyzable(obj):
+		tables = append(tables, obj)
+	}
+	return tables, nil, nil
+}
+
+// countRows counts the cells of a table b-tree
+func (db *DB) countRows(table *Table) (int64, error) {
+	n := int64(0)
+	c := db.bt.NewCursor(table.PageNum)
+	ok, err := c.First()
+	for ; ok && err == nil; ok, err = c.Next() {
+		n++
+	}
+	return n, err
+}
+
+// analyzeIndex returns the stat of an index: its number of entries followed
+// by the average entries sharing a prefix of 1, 2, ... key columns, rounded
+// up. NULLs count as equal. An empty index gives "".
+func (db *DB) analyzeIndex(index *Table) (string, error) {
+	colls, _, err := db.IndexKeyOrder(index)
+	if err != nil {
+		return "", err
+	}
+
+	n := len(index.IndexColumns)
+	distinct := make([]int64, n)
+	entries := int64(0)
+	var prev []any
+	c := db.bt.NewCursor(index.PageNum)
+	ok, err := c.First()
+	for ; ok && err == nil; ok, err = c.Next() {
+		rec := c.Cell().Record
+		key := make([]any, n)
+		for i := range key {
+			key[i] = rec.Value(i)
+		}
+
+		// Entries are sorted, so a prefix is new when a column of it differs
+		// from the entry before
+		same := 0
+		for prev != nil && same < n && record.CompareValues(key[same], prev[same], colls[same]) == 0 {
+			same++
+		}
+		for i := same; i < n; i++ {
+			distinct[i]++
+		}
+		prev = key
+		entries++
+	}
+	if err != nil || entries == 0 {
+		return "", err
+	}
+
+	stat := strconv.FormatInt(entries, 10)
+	for _, d := range distinct {
+		stat += " " + strconv.FormatInt((entries+d-1)/d, 10)
+	}
+	return stat, nil
+}
+
+// writeStat1 replaces the rows of sqlite_stat1 for the tables, or for the
+// index when it is set, creating the table if needed. Stale rows in the
+// other statistics tables are removed with them.
+func (db *DB) writeStat1(rows []statRow, tables []*Table, index *Table) error {
+	if db.GetTable("sqlite_stat1") == nil {
+		root, err := db.bt.CreateTree(btree.LeafTablePage)
+		if err != nil {
+			return err
+		}
+		err = db.insertSchemaRow("table", "sqlite_stat1", "sqlite_stat1", root, "CREATE TABLE sqlite_stat1(tbl,idx,stat)")
+		if err != nil {
+			return err
+		}
+		if err := db.schemaChanged(); err != nil {
+			return err
+		}
+	}
+
+	if index != nil {
+		if err := db.deleteStatRows(1, index.Name); err != nil {
+			return err
+		}
+	}
+	for _, table := range tables {
+		if index == nil {
+			if err := db.deleteStatRows(0, table.Name); err != nil {
+				return err
+			}
+		}
+	}
+
+	stat1 := db.GetTable("sqlite_stat1")
+	for _, r := range rows {
+		rowID, err := db.newRowID(stat1)
+		if err != nil {
+			return err
+		}
+		row := &Row{RowID: rowID, Values: []any{r.tbl, nil, r.stat}}
+		if r.idx != "" {
+			row.Values[1] = r.idx
+		}
+		if _, err := db.writeRow(stat1, nil, row, nil, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ----------------------------------------------------------------------------
+
+// Stats File -----------------------------------------------------------------
+/*
+The stats file holds the rows of sqlite_stat1 for a database that can not be
+written, as CSV after a line giving the change counter of the database they
+were gathered from:
+
+	change-counter 12
+	apples,apples_color,6 3
+	oranges,,4
+*/
+
+// statRows returns the rows of sqlite_stat1, or those of the stats file
+// when it is up to date
+func (db *DB) statRows() []statRow {
+	if rows, ok := db.readStatsFile(); ok {
+		return rows
+	}
+	rows := make([]statRow, 0)
+	db.readStatTable("sqlite_stat1", func(row *Row) {
+		tbl, _ := row.Values[0].(string)
+		idx, _ := row.Values[1].(string)
+		rows = append(rows, statRow{tbl: tbl, idx: idx, stat: FormatValue(row.Values[2])})
+	})
+	return rows
+}
+
+// changeCounter reads the file change counter from the database header
+func (db *DB) changeCounter() (uint32, error) {
+	header, err := db.bt.Pager.ReadPage(1)
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint32(header[24:]), nil
+}
+
+// readStatsFile reads the stats file, reporting false when there is none or
+// the database has changed since it was written
+func (db *DB) readStatsFile() ([]statRow, bool) {
+	if db.path == "" {
+		return nil, false
+	}
+	file, err := db.bt.Pager.VFS().OpenFile(db.path+statsFileSuffix, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, false
+	}
+	defer file.Close()
+
+	r := bufio.NewReader(io.NewSectionReader(file, 0, 1<<62))
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, false
+	}
+	counter, err := db.changeCounter()
+	if err != nil || strings.TrimSpace(line) != fmt.Sprintf("change-counter %d", counter) {
+		return nil, false
+	}
+
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, false
+	}
+	rows := make([]statRow, 0, len(records))
+	for _, rec := range records {
+		if len(rec) == 3 {
+			rows = append(rows, statRow{tbl: rec[0], idx: rec[1], stat: rec[2]})
+		}
+	}
+	return rows, true
+}
+
+// writeStatsFile replaces the rows of the stats file that were analyzed
+// again, starting from sqlite_stat1 when the file is missing or stale
+func (db *DB) writeStatsFile(rows []statRow, replaced func(statRow) bool) error {
+	if db.path == "" {
+		return ErrReadOnly
+	}
+	counter, err := db.changeCounter()
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "change-counter %d\n", counter)
+	w := csv.NewWriter(&buf)
+	for _, r := range db.statRows() {
+		if !replaced(r) {
+			w.Write([]string{r.tbl, r.idx, r.stat})
+		}
+	}
+	for _, r := range rows {
+		w.Write([]string{r.tbl, r.idx, r.stat})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+
+	path := db.path + statsFileSuffix
+	file, err := db.bt.Pager.VFS().OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("unable to write statistics to %s: %w", path, err)
+	}
+	if _, err := file.WriteAt(buf.Bytes(), 0); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// ----------------------------------------------------------------------------
@@ -0,0 +1,117 @@
+package sqlite
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+// analyzeSetup has indexes on one, two and a computed column, a unique and
+// a partial index, a table without indexes and an empty one
+const analyzeSetup = `
+create table fruit(id integer primary key, name text, color text, size integer, note);
+create index fruit_color on fruit(color);
+create index fruit_color_size on fruit(color, size);
+create unique index fruit_name on fruit(name);
+create index fruit_note on fruit(note) where note is not null;
+create index fruit_upper on fruit(upper(color));
+create table plain(a, b);
+create table empty(a);
+create index empty_a on empty(a);
+insert into fruit(name, color, size, note) with recursive c(i) as (select 1 union all select i + 1 from c where i < 97) select 'f' || i, case i % 5 when 0 then 'red' when 1 then 'green' when 2 then 'Red' when 3 then null else 'yellow' end, i % 7, case when i % 10 = 0 then 'n' || (i % 3) end from c;
+insert into plain with recursive c(i) as (select 1 union all select i + 1 from c where i < 13) select i, i % 2 from c;`
+
+// TestAnalyze compares the statistics stored in sqlite_stat1 with those
+// sqlite3 stores for the same data
+func TestAnalyze(t *testing.T) {
+	runSQLTests(t, analyzeSetup, []sqlTest{
+		{"everything", `analyze;
+select tbl, idx, stat from sqlite_stat1 order by tbl, idx`, "fruit|fruit_color|97 20\nfruit|fruit_color_size|97 20 3\nfruit|fruit_name|97 1\nfruit|fruit_note|9 3\nfruit|fruit_upper|97 25\nplain||13\n"},
+		{"main", `analyze main;
+select tbl, idx, stat from sqlite_stat1 order by tbl, idx`, "fruit|fruit_color|97 20\nfruit|fruit_color_size|97 20 3\nfruit|fruit_name|97 1\nfruit|fruit_note|9 3\nfruit|fruit_upper|97 25\nplain||13\n"},
+		{"one table", `analyze plain;
+select tbl, idx, stat from sqlite_stat1 order by tbl, idx`, "plain||13\n"},
+		{"one index", `analyze fruit_color_size;
+select tbl, idx, stat from sqlite_stat1 order by tbl, idx`, "fruit|fruit_color_size|97 20 3\n"},
+		{"again after changes", `analyze;
+delete from fruit where id > 40;
+insert into plain values (1, 1);
+analyze fruit;
+select tbl, idx, stat from sqlite_stat1 order by tbl, idx`, "fruit|fruit_color|40 8\nfruit|fruit_color_size|40 8 2\nfruit|fruit_name|40 1\nfruit|fruit_note|4 2\nfruit|fruit_upper|40 10\nplain||13\n"},
+		{"index then table", `analyze fruit_name;
+analyze plain;
+select tbl, idx, stat from sqlite_stat1 order by tbl, idx`, "fruit|fruit_name|97 1\nplain||13\n"},
+		{"emptied table", `analyze;
+delete from plain;
+analyze plain;
+select tbl, idx, stat from sqlite_stat1 order by tbl, idx`, "fruit|fruit_color|97 20\nfruit|fruit_color_size|97 20 3\nfruit|fruit_name|97 1\nfruit|fruit_note|9 3\nfruit|fruit_upper|97 25\n"},
+		{"column types", `analyze;
+select typeof(tbl), typeof(idx), typeof(stat) from sqlite_stat1 where tbl = 'plain'`, "text|null|text\n"},
+	})
+}
+
+// TestAnalyzeReadOnly analyzes a database that can not be written, keeping
+// the statistics in the stats file until the database changes
+func TestAnalyzeReadOnly(t *testing.T) {
+	db := openTest(t, `
+create table t(a, b);
+create index ta on t(a);
+insert into t with recursive c(i) as (select 1 union all select i + 1 from c where i < 100) select 1, i from c;
+create table u(x);
+insert into u values (1), (2);
+analyze u`)
+	path := db.path
+	db.Close()
+
+	openReadOnly := func() *DB {
+		t.Helper()
+		db, err := Open(path, &Options{ReadOnly: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+		return db
+	}
+	const plan = "explain query plan select * from t where a = 1"
+	const search, scan = "QUERY PLAN\n`--SEARCH t USING INDEX ta (a=?)\n", "QUERY PLAN\n`--SCAN t\n"
+
+	ro := openReadOnly()
+	if got := query(t, ro, plan); got != search {
+		t.Errorf("before ANALYZE:\n%s\nwant:\n%s", got, search)
+	}
+	query(t, ro, "analyze t")
+	if got := query(t, ro, plan); got != scan {
+		t.Errorf("after ANALYZE:\n%s\nwant:\n%s", got, scan)
+	}
+	counter, err := ro.changeCounter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path + statsFileSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The statistics already in sqlite_stat1 are kept
+	want := fmt.Sprintf("change-counter %d\nu,,2\nt,ta,100 100\n", counter)
+	if string(data) != want {
+		t.Errorf("stats file:\n%s\nwant:\n%s", data, want)
+	}
+	if got := query(t, ro, "select tbl, idx, stat from sqlite_stat1"); got != "u||2\n" {
+		t.Errorf("sqlite_stat1 was written: %q", got)
+	}
+
+	// The statistics last while the database is unchanged
+	ro.Close()
+	if got := query(t, openReadOnly(), plan); got != scan {
+		t.Errorf("reopened:\n%s\nwant:\n%s", got, scan)
+	}
+	rw, err := Open(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query(t, rw, "insert into u values (3)")
+	rw.Close()
+	if got := query(t, openReadOnly(), plan); got != search {
+		t.Errorf("after a write:\n%s\nwant:\n%s", got, search)
+	}
+}
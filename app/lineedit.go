@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// Constants ------------------------------------------------------------------
+
+const MaxHistory = 1000 // Lines kept in the history file
+
+// ErrInterrupt is returned by ReadLine when Ctrl-C is pressed
+var ErrInterrupt = errors.New("interrupt")
+
+// ----------------------------------------------------------------------------
+
+// Custom Types ---------------------------------------------------------------
+
+// LineReader reads lines from a terminal with line editing and history, or
+// plainly from any other input
+type LineReader struct {
+	in       *bufio.Reader
+	fd       int
+	out      io.Writer
+	terminal bool
+	history  []string
+	histPath string // File the history is loaded from and saved to
+}
+
+// lineEdit is the state of the line being edited
+type lineEdit struct {
+	prompt  string
+	buf     []rune
+	pos     int    // Cursor position in buf
+	histIdx int    // Entry of the history shown, len(history) for the new line
+	draft   []rune // New line, kept while browsing the history
+	out     io.Writer
+	history []string
+}
+
+// ----------------------------------------------------------------------------
+
+// NewLineReader reads from in, loading the history from histPath when in is
+// a terminal
+func NewLineReader(in *os.File, out io.Writer, histPath string) *LineReader {
+	lr := &LineReader{
+		in:       bufio.NewReader(in),
+		fd:       int(in.Fd()),
+		out:      out,
+		histPath: histPath,
+	}
+	lr.terminal = isTerminal(lr.fd)
+	if lr.terminal && histPath != "" {
+		if data, err := os.ReadFile(histPath); err == nil {
+			lr.history = strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+		}
+	}
+	return lr
+}
+
+func (lr *LineReader) IsTerminal() bool {
+	return lr.terminal
+}
+
+// ReadLine returns the next line without its line ending, showing prompt
+// first on a terminal. Returns io.EOF at the end of the input.
+func (lr *LineReader) ReadLine(prompt string) (string, error) {
+	if !lr.terminal {
+		line, err := lr.in.ReadString('\n')
+		if err == io.EOF && line != "" {
+			err = nil
+		}
+		return strings.TrimRight(line, "\r\n"), err
+	}
+
+	restore, err := makeRaw(lr.fd)
+	if err != nil {
+		return "", err
+	}
+	defer restore()
+
+	e := &lineEdit{prompt: prompt, out: lr.out, history: lr.history, histIdx: len(lr.history)}
+	e.refresh()
+	for {
+		r, _, err := lr.in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+
+		switch r {
+		case '\r', '\n':
+			fmt.Fprint(lr.out, "\r\n")
+			return string(e.buf), nil
+		case 3: // Ctrl-C
+			fmt.Fprint(lr.out, "^C\r\n")
+			return "", ErrInterrupt
+		case 4: // Ctrl-D
+			if len(e.buf) == 0 {
+				fmt.Fprint(lr.out, "\r\n")
+				return "", io.EOF
+			}
+			e.delete()
+		case 1: // Ctrl-A
+			e.pos = 0
+		case 5: // Ctrl-E
+			e.pos = len(e.buf)
+		case 2: // Ctrl-B
+			e.pos = max(e.pos-1, 0)
+		case 6: // Ctrl-F
+			e.pos = min(e.pos+1, len(e.buf))
+		case 8, 127: // Ctrl-H, Backspace
+			if e.pos > 0 {
+				e.pos--
+				e.delete()
+			}
+		case 11: // Ctrl-K
+			e.buf = e.buf[:e.pos]
+		case 21: // Ctrl-U
+			e.buf = e.buf[e.pos:]
+			e.pos = 0
+		case 23: // Ctrl-W
+			start := e.pos
+			for start > 0 && unicode.IsSpace(e.buf[start-1]) {
+				start--
+			}
+			for start > 0 && !unicode.IsSpace(e.buf[start-1]) {
+				start--
+			}
+			e.buf = append(e.buf[:start], e.buf[e.pos:]...)
+			e.pos = start
+		case 16: // Ctrl-P
+			e.browse(-1)
+		case 14: // Ctrl-N
+			e.browse(1)
+		case 27: // Escape sequence
+			lr.readEscape(e)
+		default:
+			if unicode.IsPrint(r) || r == '\t' {
+				e.buf = append(e.buf[:e.pos], append([]rune{r}, e.buf[e.pos:]...)...)
+				e.pos++
+			}
+		}
+		e.refresh()
+	}
+}
+
+// readEscape handles the arrow, Home, End and Delete keys
+func (lr *LineReader) readEscape(e *lineEdit) {
+	r, _, err := lr.in.ReadRune()
+	if err != nil || (r != '[' && r != 'O') {
+		return
+	}
+	seq := ""
+	for {
+		r, _, err := lr.in.ReadRune()
+		if err != nil {
+			return
+		}
+		seq += string(r)
+		if r < '0' || r > '9' {
+			break
+		}
+	}
+
+	switch seq {
+	case "A":
+		e.browse(-1)
+	case "B":
+		e.browse(1)
+	case "C":
+		e.pos = min(e.pos+1, len(e.buf))
+	case "D":
+		e.pos = max(e.pos-1, 0)
+	case "H", "1~", "7~":
+		e.pos = 0
+	case "F", "4~", "8~":
+		e.pos = len(e.buf)
+	case "3~":
+		e.delete()
+	}
+}
+
+// AddHistory records an entered line, skipping blank lines and repeats of
+// the previous line
+func (lr *LineReader) AddHistory(line string) {
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+	if n := len(lr.history); n > 0 && lr.history[n-1] == line {
+		return
+	}
+	lr.history = append(lr.history, line)
+}
+
+// Close saves the history
+func (lr *LineReader) Close() error {
+	if !lr.terminal || lr.histPath == "" || len(lr.history) == 0 {
+		return nil
+	}
+	history := lr.history[max(len(lr.history)-MaxHistory, 0):]
+	return os.WriteFile(lr.histPath, []byte(strings.Join(history, "\n")+"\n"), 0600)
+}
+
+// Line Editing ---------------------------------------------------------------
+
+// refresh redraws the prompt and line and places the cursor
+func (e *lineEdit) refresh() {
+	fmt.Fprintf(e.out, "\r%s%s\x1b[K", e.prompt, string(e.buf))
+	if back := len(e.buf) - e.pos; back > 0 {
+		fmt.Fprintf(e.out, "\x1b[%dD", back)
+	}
+}
+
+// delete removes the character under the cursor
+func (e *lineEdit) delete() {
+	if e.pos < len(e.buf) {
+		e.buf = append(e.buf[:e.pos], e.buf[e.pos+1:]...)
+	}
+}
+
+// browse replaces the line with an older or newer history entry
+func (e *lineEdit) browse(step int) {
+	idx := e.histIdx + step
+	if idx < 0 || idx > len(e.history) {
+		return
+	}
+	if e.histIdx == len(e.history) {
+		e.draft = e.buf
+	}
+	e.histIdx = idx
+	if idx == len(e.history) {
+		e.buf = e.draft
+	} else {
+		e.buf = []rune(e.history[idx])
+	}
+	e.pos = len(e.buf)
+}
+
+// ----------------------------------------------------------------------------
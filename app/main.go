@@ -1,40 +1,71 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"log"
 	"os"
-	"strings"
+	"path/filepath"
+
+	sqlite "github.com/elordeiro/SQLite-DBReader"
 )
 
-// Usage: your_program.sh sample.db .dbinfo
+// Usage: sqlite [--mode MODE] [--headers] DBPATH [SQL]
+//
+// Without SQL, statements and dot-commands are read from the terminal or
+// standard input.
 func main() {
-	databaseFilePath := os.Args[1]
-	command := os.Args[2]
+	mode := flag.String("mode", ModeList, "output mode: list, csv, tabs, json, ndjson, markdown, box or line")
+	headers := flag.Bool("headers", false, "print column names before the rows")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: sqlite [--mode MODE] [--headers] DBPATH [SQL]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() < 1 || flag.NArg() > 2 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	databaseFilePath := flag.Arg(0)
 
-	db := NewSQLite(databaseFilePath)
-	defer db.file.Close()
+	db, err := sqlite.Open(databaseFilePath, nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+	sh := NewShell(db, nil, os.Stdout, os.Stderr)
+	defer sh.Close()
+	if err := sh.SetMode(*mode); err != nil {
+		sh.Close()
+		log.Fatal(err)
+	}
+	sh.SetHeaders(*headers)
 
-	switch command {
-	case ".dbinfo":
-		fmt.Printf("database page size: %v\n", db.GetPageSize())
-		fmt.Printf("number of tables: %v\n", db.GetTableCount())
-	case ".tables":
-		tables := db.GetTableNames()
-		for _, table := range tables {
-			if strings.Contains(table, "sqlite_") {
-				continue
-			}
-			fmt.Printf("%v ", table)
-		}
-		fmt.Println()
-	default:
-		result, err := HandleCommand(command, db)
+	if flag.NArg() == 1 {
+		lr := NewLineReader(os.Stdin, os.Stdout, historyPath())
+		err := sh.Interactive(lr)
+		lr.Close()
 		if err != nil {
+			sh.Close()
 			log.Fatal(err)
 		}
-		for _, res := range result {
-			fmt.Println(res)
-		}
+		return
+	}
+
+	if err := sh.Run(flag.Arg(1)); err != nil && err != errQuit {
+		sh.Close()
+		log.Fatal(err)
+	}
+}
+
+// historyPath returns the file the interactive history is kept in,
+// $SQLITE_HISTORY or ~/.sqlite_history
+func historyPath() string {
+	if path := os.Getenv("SQLITE_HISTORY"); path != "" {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
 	}
+	return filepath.Join(home, ".sqlite_history")
 }
@@ -0,0 +1,375 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"unicode/utf8"
+
+	sqlite "github.com/elordeiro/SQLite-DBReader"
+)
+
+// Constants ------------------------------------------------------------------
+
+// Output modes, selected with --mode or .mode
+const (
+	ModeList     = "list"     // Values separated by "|"
+	ModeCSV      = "csv"      // RFC 4180 comma-separated values
+	ModeTabs     = "tabs"     // Values separated by tabs, also called tsv
+	ModeJSON     = "json"     // One JSON array of objects per result
+	ModeNDJSON   = "ndjson"   // One JSON object per line
+	ModeMarkdown = "markdown" // Markdown pipe table
+	ModeBox      = "box"      // Table drawn with box characters
+	ModeLine     = "line"     // One "name = value" line per column
+)
+
+var outputModes = []string{ModeList, ModeCSV, ModeTabs, ModeJSON, ModeNDJSON, ModeMarkdown, ModeBox, ModeLine}
+
+// ----------------------------------------------------------------------------
+
+// Custom Types ---------------------------------------------------------------
+
+// resultWriter prints the rows of a result. Headers only affects the modes
+// that can leave out the column names.
+type resultWriter func(w io.Writer, result *sqlite.Result, headers bool)
+
+// ----------------------------------------------------------------------------
+
+// lookupMode returns the writer for an output mode
+func lookupMode(mode string) (resultWriter, string, bool) {
+	switch strings.ToLower(mode) {
+	case ModeList:
+		return writeSeparated("|", "\n", nil), ModeList, true
+	case ModeCSV:
+		return writeSeparated(",", "\r\n", csvQuote), ModeCSV, true
+	case ModeTabs, "tsv":
+		return writeSeparated("\t", "\n", nil), ModeTabs, true
+	case ModeJSON:
+		return writeJSON, ModeJSON, true
+	case ModeNDJSON:
+		return writeNDJSON, ModeNDJSON, true
+	case ModeMarkdown:
+		return writeMarkdown, ModeMarkdown, true
+	case ModeBox:
+		return writeBox, ModeBox, true
+	case ModeLine:
+		return writeLine, ModeLine, true
+	}
+	return nil, "", false
+}
+
+// Separated Values -----------------------------------------------------------
+
+// writeSeparated joins the values of each row with sep, quoting them with
+// quote when it is set
+func writeSeparated(sep, eol string, quote func(v any) string) resultWriter {
+	if quote == nil {
+		quote = sqlite.FormatValue
+	}
+	return func(w io.Writer, result *sqlite.Result, headers bool) {
+		if len(result.Rows) == 0 {
+			return
+		}
+		fields := make([]string, len(result.Columns))
+		if headers {
+			for i, name := range result.Columns {
+				fields[i] = quote(name)
+			}
+			io.WriteString(w, strings.Join(fields, sep)+eol)
+		}
+		for _, row := range result.Rows {
+			for i, v := range row {
+				fields[i] = quote(v)
+			}
+			io.WriteString(w, strings.Join(fields, sep)+eol)
+		}
+	}
+}
+
+// csvQuote renders a value as a CSV field. Text is quoted as sqlite3 quotes
+// it, when it holds a comma, a quote, a space, a control character or any
+// byte outside ASCII, and when it is empty, so it can be told apart from
+// NULL.
+func csvQuote(v any) string {
+	switch v.(type) {
+	case nil, int64, float64:
+		return sqlite.FormatValue(v)
+	}
+	s := sqlite.FormatValue(v)
+	quote := s == ""
+	for i := 0; i < len(s) && !quote; i++ {
+		c := s[i]
+		quote = c <= ' ' || c == '"' || c == '\'' || c == ',' || c >= 0x7f
+	}
+	if !quote {
+		return s
+	}
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
+
+// ----------------------------------------------------------------------------
+
+// JSON -----------------------------------------------------------------------
+func writeJSON(w io.Writer, result *sqlite.Result, headers bool) {
+	for i, row := range result.Rows {
+		prefix, suffix := "", ",\n"
+		if i == 0 {
+			prefix = "["
+		}
+		if i == len(result.Rows)-1 {
+			suffix = "]\n"
+		}
+		io.WriteString(w, prefix+jsonObject(result.Columns, row)+suffix)
+	}
+}
+
+func writeNDJSON(w io.Writer, result *sqlite.Result, headers bool) {
+	for _, row := range result.Rows {
+		io.WriteString(w, jsonObject(result.Columns, row)+"\n")
+	}
+}
+
+// jsonObject renders a row as a JSON object keyed by column name. Numbers
+// stay numbers, NULL becomes null and text and blobs become strings.
+func jsonObject(columns []string, row []any) string {
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, v := range row {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(jsonString(columns[i]))
+		b.WriteByte(':')
+		switch x := v.(type) {
+		case nil:
+			b.WriteString("null")
+		case int64:
+			b.WriteString(sqlite.FormatValue(x))
+		case float64:
+			// JSON has no infinity, SQLite writes a number too large to parse
+			switch {
+			case math.IsInf(x, 1):
+				b.WriteString("9.0e+999")
+			case math.IsInf(x, -1):
+				b.WriteString("-9.0e+999")
+			default:
+				b.WriteString(sqlite.FormatValue(x))
+			}
+		default:
+			b.WriteString(jsonString(sqlite.FormatValue(x)))
+		}
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// jsonString quotes text as a JSON string. Bytes that are not valid UTF-8
+// are written as the code points of the same value.
+func jsonString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for len(s) > 0 {
+		r, n := utf8.DecodeRuneInString(s)
+		if r == utf8.RuneError && n == 1 {
+			r = rune(s[0])
+		}
+		s = s[n:]
+
+		switch {
+		case r == '"':
+			b.WriteString(`\"`)
+		case r == '\\':
+			b.WriteString(`\\`)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r == '\b':
+			b.WriteString(`\b`)
+		case r == '\f':
+			b.WriteString(`\f`)
+		case r < 0x20 || n == 1 && r >= utf8.RuneSelf:
+			fmt.Fprintf(&b, `\u%04x`, r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// ----------------------------------------------------------------------------
+
+// Tables ---------------------------------------------------------------------
+
+// textTable is a result laid out in aligned columns. Values holding line
+// breaks span several lines of their row.
+type textTable struct {
+	header []string
+	rows   [][][]string // Lines of each value of each row
+	widths []int
+	tall   bool // Some value spans several lines
+}
+
+func newTextTable(result *sqlite.Result) *textTable {
+	t := &textTable{header: result.Columns, widths: make([]int, len(result.Columns))}
+	for i, name := range result.Columns {
+		t.widths[i] = utf8.RuneCountInString(name)
+	}
+	for _, row := range result.Rows {
+		cells := make([][]string, len(row))
+		for i, v := range row {
+			cells[i] = strings.Split(expandTabs(sqlite.FormatValue(v)), "\n")
+			t.tall = t.tall || len(cells[i]) > 1
+			for _, line := range cells[i] {
+				t.widths[i] = max(t.widths[i], utf8.RuneCountInString(line))
+			}
+		}
+		t.rows = append(t.rows, cells)
+	}
+	return t
+}
+
+// write prints the column names, centered, then rule and the rows, with
+// left, mid and right drawn between the values. When between is set it is
+// drawn between rows if a value spans several lines.
+func (t *textTable) write(w io.Writer, rule tableRule, between *tableRule, left, mid, right string) {
+	header := make([]string, len(t.header))
+	for i, name := range t.header {
+		pad := t.widths[i] - utf8.RuneCountInString(name)
+		header[i] = strings.Repeat(" ", pad/2) + name + strings.Repeat(" ", pad-pad/2)
+	}
+	io.WriteString(w, left+strings.Join(header, mid)+right+"\n")
+	t.writeRule(w, rule)
+
+	for r, cells := range t.rows {
+		if r > 0 && t.tall && between != nil {
+			t.writeRule(w, *between)
+		}
+		height := 1
+		for _, lines := range cells {
+			height = max(height, len(lines))
+		}
+		for n := range height {
+			fields := make([]string, len(cells))
+			for i, lines := range cells {
+				line := ""
+				if n < len(lines) {
+					line = lines[n]
+				}
+				fields[i] = line + strings.Repeat(" ", t.widths[i]-utf8.RuneCountInString(line))
+			}
+			io.WriteString(w, left+strings.Join(fields, mid)+right+"\n")
+		}
+	}
+}
+
+// tableRule is the strings a horizontal line across a table is drawn with
+type tableRule struct {
+	left, line, mid, right string
+}
+
+// writeRule prints a horizontal line across the table
+func (t *textTable) writeRule(w io.Writer, rule tableRule) {
+	segments := make([]string, len(t.widths))
+	for i, width := range t.widths {
+		segments[i] = strings.Repeat(rule.line, width+2)
+	}
+	io.WriteString(w, rule.left+strings.Join(segments, rule.mid)+rule.right+"\n")
+}
+
+func writeMarkdown(w io.Writer, result *sqlite.Result, headers bool) {
+	if len(result.Rows) == 0 {
+		return
+	}
+	t := newTextTable(result)
+	t.write(w, tableRule{"|", "-", "|", "|"}, nil, "| ", " | ", " |")
+}
+
+func writeBox(w io.Writer, result *sqlite.Result, headers bool) {
+	if len(result.Rows) == 0 {
+		return
+	}
+	t := newTextTable(result)
+	t.writeRule(w, tableRule{"┌", "─", "┬", "┐"})
+	rule := tableRule{"├", "─", "┼", "┤"}
+	t.write(w, rule, &rule, "│ ", " │ ", " │")
+	t.writeRule(w, tableRule{"└", "─", "┴", "┘"})
+}
+
+// expandTabs replaces tabs with spaces up to the next multiple of 8 columns
+func expandTabs(s string) string {
+	if !strings.Contains(s, "\t") {
+		return s
+	}
+	var b strings.Builder
+	col := 0
+	for _, r := range s {
+		switch r {
+		case '\t':
+			n := 8 - col%8
+			b.WriteString(strings.Repeat(" ", n))
+			col += n
+		case '\n':
+			b.WriteRune(r)
+			col = 0
+		default:
+			b.WriteRune(r)
+			col++
+		}
+	}
+	return b.String()
+}
+
+// ----------------------------------------------------------------------------
+
+// Line -----------------------------------------------------------------------
+func writeLine(w io.Writer, result *sqlite.Result, headers bool) {
+	width := 5
+	for _, name := range result.Columns {
+		width = max(width, utf8.RuneCountInString(name))
+	}
+	for i, row := range result.Rows {
+		if i > 0 {
+			io.WriteString(w, "\n")
+		}
+		for j, v := range row {
+			fmt.Fprintf(w, "%*s = %s\n", width, result.Columns[j], sqlite.FormatValue(v))
+		}
+	}
+}
+
+// ----------------------------------------------------------------------------
+
+// Query Plans ----------------------------------------------------------------
+
+// writeQueryPlan draws the rows of EXPLAIN QUERY PLAN as a tree, the way
+// sqlite3 does in every output mode
+func writeQueryPlan(w io.Writer, result *sqlite.Result) {
+	io.WriteString(w, "QUERY PLAN\n")
+	writePlanNodes(w, result.Rows, 0, "")
+}
+
+// writePlanNodes draws the steps whose parent is the given id, and the
+// steps below each of them
+func writePlanNodes(w io.Writer, rows [][]any, parent int64, prefix string) {
+	children := make([][]any, 0)
+	for _, row := range rows {
+		if row[1] == parent {
+			children = append(children, row)
+		}
+	}
+	for i, row := range children {
+		branch, indent := "|--", "|  "
+		if i == len(children)-1 {
+			branch, indent = "`--", "   "
+		}
+		fmt.Fprintf(w, "%s%s%s\n", prefix, branch, sqlite.FormatValue(row[3]))
+		writePlanNodes(w, rows, row[0].(int64), prefix+indent)
+	}
+}
+
+// ----------------------------------------------------------------------------
@@ -0,0 +1,62 @@
+package main
+
+import "testing"
+
+// modeQuery covers NULL, numbers, blobs, non-ASCII text and the characters
+// each mode has to quote or escape
+const modeQuery = `select 1 as n, 2.5 as r, 'a,b' as s, 'say "hi"' as q, null as z, x'0a41' as b, 'é ünï' as u union all select -3, 1e20, 'line
+break', '', 'tab	x', 'x', 'ok'`
+
+// TestModes compares each output mode with sqlite3's
+func TestModes(t *testing.T) {
+	tests := []struct {
+		mode    string
+		headers bool
+		want    string
+	}{
+		{"list", true, "n|r|s|q|z|b|u\n1|2.5|a,b|say \"hi\"||\nA|é ünï\n-3|1.0e+20|line\nbreak||tab\tx|x|ok\n"},
+		{"list", false, "1|2.5|a,b|say \"hi\"||\nA|é ünï\n-3|1.0e+20|line\nbreak||tab\tx|x|ok\n"},
+		{"csv", true, "n,r,s,q,z,b,u\r\n1,2.5,\"a,b\",\"say \"\"hi\"\"\",,\"\nA\",\"é ünï\"\r\n-3,1.0e+20,\"line\nbreak\",\"\",\"tab\tx\",x,ok\r\n"},
+		{"csv", false, "1,2.5,\"a,b\",\"say \"\"hi\"\"\",,\"\nA\",\"é ünï\"\r\n-3,1.0e+20,\"line\nbreak\",\"\",\"tab\tx\",x,ok\r\n"},
+		{"tabs", true, "n\tr\ts\tq\tz\tb\tu\n1\t2.5\ta,b\tsay \"hi\"\t\t\nA\té ünï\n-3\t1.0e+20\tline\nbreak\t\ttab\tx\tx\tok\n"},
+		{"tabs", false, "1\t2.5\ta,b\tsay \"hi\"\t\t\nA\té ünï\n-3\t1.0e+20\tline\nbreak\t\ttab\tx\tx\tok\n"},
+		{"json", true, "[{\"n\":1,\"r\":2.5,\"s\":\"a,b\",\"q\":\"say \\\"hi\\\"\",\"z\":null,\"b\":\"\\nA\",\"u\":\"é ünï\"},\n{\"n\":-3,\"r\":1.0e+20,\"s\":\"line\\nbreak\",\"q\":\"\",\"z\":\"tab\\tx\",\"b\":\"x\",\"u\":\"ok\"}]\n"},
+		{"json", false, "[{\"n\":1,\"r\":2.5,\"s\":\"a,b\",\"q\":\"say \\\"hi\\\"\",\"z\":null,\"b\":\"\\nA\",\"u\":\"é ünï\"},\n{\"n\":-3,\"r\":1.0e+20,\"s\":\"line\\nbreak\",\"q\":\"\",\"z\":\"tab\\tx\",\"b\":\"x\",\"u\":\"ok\"}]\n"},
+		{"markdown", true, "| n  |    r    |   s   |    q     |     z     | b |   u   |\n|----|---------|-------|----------|-----------|---|-------|\n| 1  | 2.5     | a,b   | say \"hi\" |           |   | é ünï |\n|    |         |       |          |           | A |       |\n| -3 | 1.0e+20 | line  |          | tab     x | x | ok    |\n|    |         | break |          |           |   |       |\n"},
+		{"markdown", false, "| n  |    r    |   s   |    q     |     z     | b |   u   |\n|----|---------|-------|----------|-----------|---|-------|\n| 1  | 2.5     | a,b   | say \"hi\" |           |   | é ünï |\n|    |         |       |          |           | A |       |\n| -3 | 1.0e+20 | line  |          | tab     x | x | ok    |\n|    |         | break |          |           |   |       |\n"},
+		{"box", true, "┌────┬─────────┬───────┬──────────┬───────────┬───┬───────┐\n│ n  │    r    │   s   │    q     │     z     │ b │   u   │\n├────┼─────────┼───────┼──────────┼───────────┼───┼───────┤\n│ 1  │ 2.5     │ a,b   │ say \"hi\" │           │   │ é ünï │\n│    │         │       │          │           │ A │       │\n├────┼─────────┼───────┼──────────┼───────────┼───┼───────┤\n│ -3 │ 1.0e+20 │ line  │          │ tab     x │ x │ ok    │\n│    │         │ break │          │           │   │       │\n└────┴─────────┴───────┴──────────┴───────────┴───┴───────┘\n"},
+		{"box", false, "┌────┬─────────┬───────┬──────────┬───────────┬───┬───────┐\n│ n  │    r    │   s   │    q     │     z     │ b │   u   │\n├────┼─────────┼───────┼──────────┼───────────┼───┼───────┤\n│ 1  │ 2.5     │ a,b   │ say \"hi\" │           │   │ é ünï │\n│    │         │       │          │           │ A │       │\n├────┼─────────┼───────┼──────────┼───────────┼───┼───────┤\n│ -3 │ 1.0e+20 │ line  │          │ tab     x │ x │ ok    │\n│    │         │ break │          │           │   │       │\n└────┴─────────┴───────┴──────────┴───────────┴───┴───────┘\n"},
+		{"line", true, "    n = 1\n    r = 2.5\n    s = a,b\n    q = say \"hi\"\n    z = \n    b = \nA\n    u = é ünï\n\n    n = -3\n    r = 1.0e+20\n    s = line\nbreak\n    q = \n    z = tab\tx\n    b = x\n    u = ok\n"},
+		{"line", false, "    n = 1\n    r = 2.5\n    s = a,b\n    q = say \"hi\"\n    z = \n    b = \nA\n    u = é ünï\n\n    n = -3\n    r = 1.0e+20\n    s = line\nbreak\n    q = \n    z = tab\tx\n    b = x\n    u = ok\n"},
+		{"ndjson", false, "{\"n\":1,\"r\":2.5,\"s\":\"a,b\",\"q\":\"say \\\"hi\\\"\",\"z\":null,\"b\":\"\\nA\",\"u\":\"é ünï\"}\n{\"n\":-3,\"r\":1.0e+20,\"s\":\"line\\nbreak\",\"q\":\"\",\"z\":\"tab\\tx\",\"b\":\"x\",\"u\":\"ok\"}\n"},
+	}
+	for _, tt := range tests {
+		sh, out, _ := openShell(t)
+		if err := sh.SetMode(tt.mode); err != nil {
+			t.Fatal(err)
+		}
+		sh.SetHeaders(tt.headers)
+		if err := sh.Run(modeQuery); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != tt.want {
+			t.Errorf("%s, headers %v:\ngot:\n%s\nwant:\n%s", tt.mode, tt.headers, out, tt.want)
+		}
+	}
+}
+
+// TestModesEmpty checks that no rows print nothing, not even headers, as in
+// sqlite3
+func TestModesEmpty(t *testing.T) {
+	for _, mode := range outputModes {
+		sh, out, _ := openShell(t)
+		sh.SetMode(mode)
+		sh.SetHeaders(true)
+		if err := sh.Run("select 1 as a where 0"); err != nil {
+			t.Fatal(err)
+		}
+		if out.Len() > 0 {
+			t.Errorf("%s: got %q", mode, out)
+		}
+	}
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	sqlite "github.com/elordeiro/SQLite-DBReader"
+	"github.com/elordeiro/SQLite-DBReader/parser"
+)
+
+// Custom Types ---------------------------------------------------------------
+
+// Shell runs SQL and dot-commands given on the command line or typed at the
+// interactive prompt
+type Shell struct {
+	db      *sqlite.DB
+	opts    *sqlite.Options
+	out     io.Writer
+	errOut  io.Writer
+	mode    string
+	write   resultWriter // Prints results in the output mode
+	headers bool         // Print column names before the rows
+	timer   bool         // Print how long each statement took
+}
+
+// ----------------------------------------------------------------------------
+
+// errQuit is returned by the .quit and .exit dot-commands
+var errQuit = errors.New("quit")
+
+func NewShell(db *sqlite.DB, opts *sqlite.Options, out, errOut io.Writer) *Shell {
+	sh := &Shell{db: db, opts: opts, out: out, errOut: errOut}
+	sh.SetMode(ModeList)
+	return sh
+}
+
+// SetMode selects how results are printed, one of the Mode constants
+func (sh *Shell) SetMode(mode string) error {
+	write, name, ok := lookupMode(mode)
+	if !ok {
+		return fmt.Errorf("mode should be one of: %s", strings.Join(outputModes, " "))
+	}
+	sh.write, sh.mode = write, name
+	return nil
+}
+
+// SetHeaders turns the column names printed before the rows on or off
+func (sh *Shell) SetHeaders(on bool) {
+	sh.headers = on
+}
+
+// Run executes a dot-command, or one or more SQL statements
+func (sh *Shell) Run(input string) error {
+	if strings.HasPrefix(strings.TrimSpace(input), ".") {
+		return sh.dotCommand(input)
+	}
+	return sh.execSQL(input)
+}
+
+// Interactive reads SQL and dot-commands until .quit or the end of the input.
+// SQL may span several lines and runs once a line ends with a semicolon.
+func (sh *Shell) Interactive(lr *LineReader) error {
+	if lr.IsTerminal() {
+		fmt.Fprintln(sh.out, `Enter ".help" for usage hints.`)
+	}
+
+	var pending strings.Builder
+	for {
+		prompt := "sqlite> "
+		if pending.Len() > 0 {
+			prompt = "   ...> "
+		}
+		line, err := lr.ReadLine(prompt)
+		if errors.Is(err, ErrInterrupt) {
+			pending.Reset()
+			continue
+		}
+		if err == io.EOF {
+			if strings.TrimSpace(pending.String()) != "" {
+				sh.report(sh.execSQL(pending.String()))
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		lr.AddHistory(line)
+
+		if pending.Len() == 0 {
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			if strings.HasPrefix(strings.TrimSpace(line), ".") {
+				if err := sh.dotCommand(line); err == errQuit {
+					return nil
+				} else {
+					sh.report(err)
+				}
+				continue
+			}
+		}
+
+		pending.WriteString(line)
+		pending.WriteString("\n")
+		if IsComplete(pending.String()) {
+			sh.report(sh.execSQL(pending.String()))
+			pending.Reset()
+		}
+	}
+}
+
+// IsComplete reports whether sql ends with a semicolon outside of any
+// string, identifier or comment
+func IsComplete(sql string) bool {
+	tokens, err := parser.Tokenize(sql)
+	if err != nil || len(tokens) < 2 {
+		return false
+	}
+	last := tokens[len(tokens)-2] // Before TokenEOF
+	if last.Kind != parser.TokenOp || last.Text != ";" {
+		return false
+	}
+
+	// Tokenize drops a comment left open at the end
+	rest := sql[last.End:]
+	open := strings.LastIndex(rest, "/*")
+	return open == -1 || strings.Contains(rest[open+2:], "*/")
+}
+
+func (sh *Shell) report(err error) {
+	if err != nil && err != errQuit {
+		fmt.Fprintf(sh.errOut, "Error: %v\n", err)
+	}
+}
+
+// SQL ------------------------------------------------------------------------
+func (sh *Shell) execSQL(sql string) error {
+	start := time.Now()
+	results, err := sh.db.Execute(sql)
+	for _, result := range results {
+		if result.QueryPlan {
+			writeQueryPlan(sh.out, result)
+			continue
+		}
+		sh.write(sh.out, result, sh.headers)
+	}
+	if sh.timer {
+		fmt.Fprintf(sh.out, "Run Time: real %.3f\n", time.Since(start).Seconds())
+	}
+	return err
+}
+
+// ----------------------------------------------------------------------------
+
+// Dot-Commands ---------------------------------------------------------------
+const shellHelp = `.dbinfo                  Show information about the database
+.dbstat                  Show the pages used by each table and index
+.exit                    Exit this program
+.freelist                List the pages on the freelist
+.headers on|off          Turn display of column names on or off
+.help                    Show this message
+.indexes [TABLE]         List the indexes of tables matching a LIKE pattern
+.integrity_check         Verify the b-trees and the freelist
+.mode [MODE]             Set or show the output mode: list, csv, tabs,
+                         json, ndjson, markdown, box or line
+.open FILE               Close the database and open FILE
+.quit                    Exit this program
+.schema [PATTERN]        Show the CREATE statements of tables matching PATTERN
+.tables                  List the tables
+.timer on|off            Turn the timing of statements on or off`
+
+func (sh *Shell) dotCommand(line string) error {
+	args, err := splitArgs(strings.TrimPrefix(strings.TrimSpace(line), "."))
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return errors.New("unknown command: .")
+	}
+
+	switch cmd, args := args[0], args[1:]; cmd {
+	case "dbinfo":
+		fmt.Fprintf(sh.out, "database page size: %v\n", sh.db.GetPageSize())
+		fmt.Fprintf(sh.out, "number of tables: %v\n", sh.db.GetTableCount())
+	case "tables":
+		for _, table := range sh.db.GetTableNames() {
+			if strings.Contains(table, "sqlite_") {
+				continue
+			}
+			fmt.Fprintf(sh.out, "%v ", table)
+		}
+		fmt.Fprintln(sh.out)
+	case "schema":
+		return sh.schema(args)
+	case "indexes", "indices":
+		return sh.indexes(args)
+	case "integrity_check":
+		return sh.printLines(sh.db.IntegrityCheck())
+	case "freelist":
+		return sh.printLines(sh.db.FreelistReport())
+	case "dbstat":
+		return sh.printLines(sh.db.PageUsageReport())
+	case "headers":
+		return setFlag(&sh.headers, cmd, args)
+	case "timer":
+		return setFlag(&sh.timer, cmd, args)
+	case "mode":
+		if len(args) == 0 {
+			fmt.Fprintf(sh.out, "current output mode: %s\n", sh.mode)
+			return nil
+		}
+		return sh.SetMode(args[0])
+	case "open":
+		if len(args) != 1 {
+			return errors.New("usage: .open FILE")
+		}
+		db, err := sqlite.Open(args[0], sh.opts)
+		if err != nil {
+			return fmt.Errorf("unable to open database \"%s\": %w", args[0], err)
+		}
+		sh.db.Close()
+		sh.db = db
+	case "help":
+		fmt.Fprintln(sh.out, shellHelp)
+	case "quit", "exit":
+		return errQuit
+	default:
+		return fmt.Errorf("unknown command or invalid arguments: \"%s\". Enter \".help\" for help", cmd)
+	}
+	return nil
+}
+
+// schema prints the CREATE statements stored in sqlite_schema for the
+// objects of the tables whose names match a LIKE pattern, or of every table
+func (sh *Shell) schema(args []string) error {
+	if len(args) > 1 {
+		return errors.New("usage: .schema [PATTERN]")
+	}
+	for _, obj := range sh.db.Schema() {
+		if obj.SQL != "" && matchTable(obj.TblName, args) {
+			fmt.Fprintf(sh.out, "%s;\n", obj.SQL)
+		}
+	}
+	return nil
+}
+
+// indexes lists the indexes of the tables whose names match a LIKE pattern,
+// or of every table, with the columns they cover
+func (sh *Shell) indexes(args []string) error {
+	if len(args) > 1 {
+		return errors.New("usage: .indexes [TABLE]")
+	}
+
+	indexes := make([]*sqlite.Table, 0)
+	width := 0
+	for _, obj := range sh.db.Schema() {
+		if obj.Type == sqlite.TableTypeIndex && matchTable(obj.TblName, args) {
+			indexes = append(indexes, obj)
+			width = max(width, len(obj.Name))
+		}
+	}
+
+	for _, index := range indexes {
+		cols := make([]string, len(index.IndexColumns))
+		for i, col := range index.IndexColumns {
+			cols[i] = col.Text
+			if cols[i] == "" {
+				cols[i] = col.Name
+			}
+		}
+		line := fmt.Sprintf("%-*s  %s(%s)", width, index.Name, index.TblName, strings.Join(cols, ", "))
+		if index.Unique {
+			line += " UNIQUE"
+		}
+		if index.Where != nil {
+			line += " PARTIAL"
+		}
+		fmt.Fprintln(sh.out, line)
+	}
+	return nil
+}
+
+// Close closes the database open in the shell
+func (sh *Shell) Close() error {
+	return sh.db.Close()
+}
+
+// ----------------------------------------------------------------------------
+
+// Helpers --------------------------------------------------------------------
+func (sh *Shell) printLines(lines []string, err error) error {
+	if err != nil {
+		return err
+	}
+	for _, line := range lines {
+		fmt.Fprintln(sh.out, line)
+	}
+	return nil
+}
+
+// matchTable reports whether a table name matches the optional LIKE pattern
+// argument of a dot-command
+func matchTable(name string, args []string) bool {
+	return len(args) == 0 || sqlite.Like(args[0], name)
+}
+
+// setFlag sets a shell setting from the on/off argument of a dot-command
+func setFlag(flag *bool, cmd string, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: .%s on|off", cmd)
+	}
+	switch strings.ToLower(args[0]) {
+	case "on", "yes", "true", "1":
+		*flag = true
+	case "off", "no", "false", "0":
+		*flag = false
+	default:
+		return fmt.Errorf("not a boolean value: %s", args[0])
+	}
+	return nil
+}
+
+// splitArgs splits the arguments of a dot-command on whitespace. Arguments
+// may be quoted with single or double quotes to include whitespace.
+func splitArgs(line string) ([]string, error) {
+	args := make([]string, 0)
+	for {
+		line = strings.TrimLeft(line, " \t")
+		if line == "" {
+			return args, nil
+		}
+
+		if quote := line[0]; quote == '\'' || quote == '"' {
+			end := strings.IndexByte(line[1:], quote)
+			if end == -1 {
+				return nil, fmt.Errorf("unterminated quoted argument: %s", line)
+			}
+			args = append(args, line[1:end+1])
+			line = line[end+2:]
+			continue
+		}
+
+		end := strings.IndexAny(line, " \t")
+		if end == -1 {
+			end = len(line)
+		}
+		args = append(args, line[:end])
+		line = line[end:]
+	}
+}
+
+// ----------------------------------------------------------------------------
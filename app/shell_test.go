@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	sqlite "github.com/elordeiro/SQLite-DBReader"
+)
+
+// openShell opens a shell on a new database, writing to the buffers returned
+func openShell(t *testing.T) (*Shell, *bytes.Buffer, *bytes.Buffer) {
+	t.Helper()
+	db, err := sqlite.Open(filepath.Join(t.TempDir(), "test.db"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out, errOut bytes.Buffer
+	sh := NewShell(db, nil, &out, &errOut)
+	t.Cleanup(func() { sh.Close() })
+	return sh, &out, &errOut
+}
+
+// interact feeds script to the shell the way sqlite3 reads it from a pipe
+func interact(t *testing.T, sh *Shell, script string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "script.sql")
+	if err := os.WriteFile(path, []byte(script), 0644); err != nil {
+		t.Fatal(err)
+	}
+	in, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	if err := sh.Interactive(NewLineReader(in, sh.out, "")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInteractive(t *testing.T) {
+	sh, out, errOut := openShell(t)
+	interact(t, sh, `create table t(a, b);
+insert into t values (1, 'one;'),
+  (2, 'two');
+
+select * from t
+  where a > 1;
+select 'x' -- comment; with a semicolon
+;
+/* block; comment */ select 3;
+.headers on
+select a as "first;col" from t;
+select nope from t;
+.mode csv
+select * from t order by a desc;
+.headers off
+select 'tail'
+`)
+
+	// The output of sqlite3 given the same script
+	want := "2|two\nx\n3\nfirst;col\n1\n2\na,b\r\n2,two\r\n1,one;\r\ntail\r\n"
+	if out.String() != want {
+		t.Errorf("got %q, want %q", out, want)
+	}
+	if got, want := errOut.String(), "Error: no such column: nope\n"; got != want {
+		t.Errorf("got error output %q, want %q", got, want)
+	}
+}
+
+func TestInteractiveQuit(t *testing.T) {
+	sh, out, _ := openShell(t)
+	interact(t, sh, "select 1;\n.quit\nselect 2;\n")
+	if got := out.String(); got != "1\n" {
+		t.Errorf("got %q, want %q", got, "1\n")
+	}
+}
+
+func TestDotCommandErrors(t *testing.T) {
+	tests := []struct {
+		cmd string
+		err string
+	}{
+		{".foo", `unknown command or invalid arguments: "foo". Enter ".help" for help`},
+		{".headers maybe", "not a boolean value: maybe"},
+		{".headers", "usage: .headers on|off"},
+		{".mode nope", "mode should be one of: list csv tabs json ndjson markdown box line"},
+		{".open", "usage: .open FILE"},
+		{".schema a b", "usage: .schema [PATTERN]"},
+		{".tables 'open", "unterminated quoted argument: 'open"},
+	}
+	for _, tt := range tests {
+		sh, _, _ := openShell(t)
+		if err := sh.Run(tt.cmd); err == nil || err.Error() != tt.err {
+			t.Errorf("%s: got error %v, want %s", tt.cmd, err, tt.err)
+		}
+	}
+}
+
+func TestDotOpen(t *testing.T) {
+	sh, out, _ := openShell(t)
+	path := filepath.Join(t.TempDir(), "other.db")
+	for _, cmd := range []string{"create table t(a); insert into t values ('first')", ".open '" + path + "'", "create table t(a); insert into t values ('other')", "select a from t"} {
+		if err := sh.Run(cmd); err != nil {
+			t.Fatalf("%s: %v", cmd, err)
+		}
+	}
+	if got := out.String(); got != "other\n" {
+		t.Errorf("got %q, want %q", got, "other\n")
+	}
+}
+
+// TestIsComplete compares with sqlite3_complete
+func TestIsComplete(t *testing.T) {
+	tests := []struct {
+		sql  string
+		want bool
+	}{
+		{"select 1", false},
+		{"select 1;", true},
+		{"select 1; ", true},
+		{"select ';'", false},
+		{"select ';';", true},
+		{"select 1 -- c;", false},
+		{"select 1 -- c\n;", true},
+		{"select 1 /* ; */", false},
+		{"select 1; /* open", false},
+		{"select 1; /* closed */", true},
+		{`select "a;b"`, false},
+		{`select "a;b";`, true},
+		{"select [a;b];", true},
+		{";", true},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := IsComplete(tt.sql); got != tt.want {
+			t.Errorf("IsComplete(%q) = %v, want %v", tt.sql, got, tt.want)
+		}
+	}
+}
+
+const schemaSetup = `CREATE TABLE apples(id integer primary key, name text, color text);
+CREATE TABLE "order items"(k, v);
+create index apples_name on apples(name);
+create unique index apples_nc on apples (name, color collate nocase);
+create index apples_expr on apples(lower(name)) where color = 'red';
+create table pears(a unique);`
+
+// TestSchema compares with the output of sqlite3, which differs only by
+// adding IF NOT EXISTS to tables with quoted names
+func TestSchema(t *testing.T) {
+	tests := []struct {
+		cmd  string
+		want string
+	}{
+		{".schema", `CREATE TABLE apples(id integer primary key, name text, color text);
+CREATE TABLE "order items"(k, v);
+CREATE INDEX apples_name on apples(name);
+CREATE UNIQUE INDEX apples_nc on apples (name, color collate nocase);
+CREATE INDEX apples_expr on apples(lower(name)) where color = 'red';
+CREATE TABLE pears(a unique);
+`},
+		{".schema apples", `CREATE TABLE apples(id integer primary key, name text, color text);
+CREATE INDEX apples_name on apples(name);
+CREATE UNIQUE INDEX apples_nc on apples (name, color collate nocase);
+CREATE INDEX apples_expr on apples(lower(name)) where color = 'red';
+`},
+		{".schema 'order%'", "CREATE TABLE \"order items\"(k, v);\n"},
+		{".schema P%", "CREATE TABLE pears(a unique);\n"},
+		{".schema nope", ""},
+	}
+	for _, tt := range tests {
+		sh, out, _ := openShell(t)
+		if err := sh.Run(schemaSetup); err != nil {
+			t.Fatal(err)
+		}
+		if err := sh.Run(tt.cmd); err != nil {
+			t.Fatalf("%s: %v", tt.cmd, err)
+		}
+		if out.String() != tt.want {
+			t.Errorf("%s: got:\n%s\nwant:\n%s", tt.cmd, out, tt.want)
+		}
+	}
+}
+
+func TestIndexes(t *testing.T) {
+	tests := []struct {
+		cmd  string
+		want string
+	}{
+		{".indexes", `apples_name               apples(name)
+apples_nc                 apples(name, color collate nocase) UNIQUE
+apples_expr               apples(lower(name)) PARTIAL
+sqlite_autoindex_pears_1  pears(a) UNIQUE
+`},
+		{".indexes apples", `apples_name  apples(name)
+apples_nc    apples(name, color collate nocase) UNIQUE
+apples_expr  apples(lower(name)) PARTIAL
+`},
+		{".indices pe%", "sqlite_autoindex_pears_1  pears(a) UNIQUE\n"},
+		{".indexes 'order items'", ""},
+	}
+	for _, tt := range tests {
+		sh, out, _ := openShell(t)
+		if err := sh.Run(schemaSetup); err != nil {
+			t.Fatal(err)
+		}
+		if err := sh.Run(tt.cmd); err != nil {
+			t.Fatalf("%s: %v", tt.cmd, err)
+		}
+		if out.String() != tt.want {
+			t.Errorf("%s: got:\n%s\nwant:\n%s", tt.cmd, out, tt.want)
+		}
+	}
+}
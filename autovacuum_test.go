@@ -0,0 +1,127 @@
+package sqlite
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/elordeiro/SQLite-DBReader/pager"
+)
+
+// autoVacuumDB has sqlite3 write an incremental auto-vacuum database with
+// small pages, so that it has several pointer map pages and a freelist
+func autoVacuumDB(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "autovacuum.db")
+	sql := "pragma page_size = 1024; pragma auto_vacuum = incremental; " +
+		"create table t(a integer primary key, b text); create index t_b on t(b); " +
+		"insert into t with recursive n(i) as (select 1 union all select i + 1 from n where i < 2000) " +
+		"select i, hex(zeroblob(i % 9 * 100)) from n; " +
+		"delete from t where a % 4 = 0"
+	if out, err := sqlite3Command(t, path, sql).CombinedOutput(); err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	return path
+}
+
+func TestAutoVacuum(t *testing.T) {
+	path := autoVacuumDB(t)
+	db, err := Open(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	const sql = "select count(*), sum(length(b)) from t; select a from t where b = '' order by a limit 3"
+	want, err := sqlite3Command(t, path, sql).CombinedOutput()
+	if err != nil {
+		t.Fatalf("%v: %s", err, want)
+	}
+	got := query(t, db, "select count(*), sum(length(b)) from t") + query(t, db, "select a from t where b = '' order by a limit 3")
+	if got != string(want) {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	checkIntegrity(t, db)
+	if _, err := queryErr(db, "insert into t values (null, 'x')"); !errors.Is(err, pager.ErrReadOnly) {
+		t.Errorf("write: got %v, want %v", err, pager.ErrReadOnly)
+	}
+}
+
+// TestAutoVacuumPageUsage checks that every page is accounted for, with the
+// pointer map pages where sqlite3 puts them
+func TestAutoVacuumPageUsage(t *testing.T) {
+	path := autoVacuumDB(t)
+	db, err := Open(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	pages, err := db.PageUsage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got strings.Builder
+	free, ptrmaps := 0, make([]string, 0)
+	for _, page := range pages {
+		switch page.Type {
+		case PageTypeFreelistTrunk, PageTypeFreelistLeaf:
+			free++
+		case PageTypePtrmap:
+			ptrmaps = append(ptrmaps, fmt.Sprint(page.PageNum))
+		case PageTypeUnreferenced:
+			t.Errorf("page %d is unreferenced", page.PageNum)
+		default:
+			fmt.Fprintf(&got, "%d|%s|%s|%d|%d|%d\n", page.PageNum, page.Owner, page.Type, page.Cells, page.Payload, page.Unused)
+		}
+	}
+	fmt.Fprintf(&got, "%d\n", free)
+	want, err := sqlite3Command(t, path, "select pageno, name, pagetype, ncell, payload, unused from dbstat order by pageno; pragma freelist_count").CombinedOutput()
+	if err != nil {
+		t.Fatalf("%v: %s", err, want)
+	}
+	if got.String() != string(want) {
+		t.Errorf("got:\n%s\nwant:\n%s", got.String(), want)
+	}
+
+	// A pointer map page maps the 1024/5 pages after it
+	if got, want := strings.Join(ptrmaps, " "), "2 207 412 617 822 1027 1232 1437 1642 1847 2052 2257 2462 2667 2872 3077 3282 3487 3692 3897 4102 4307"; got != want {
+		t.Errorf("pointer map pages: got %s, want %s", got, want)
+	}
+}
+
+// TestAutoVacuumBadEntry corrupts a pointer map entry and checks that the
+// integrity check reports it as sqlite3 does
+func TestAutoVacuumBadEntry(t *testing.T) {
+	path := autoVacuumDB(t)
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The entry of page 13 on the pointer map at page 2
+	if _, err := file.WriteAt([]byte{5, 0, 0, 0, 9}, 1024+5*10); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	db, err := Open(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	got, err := db.IntegrityCheck()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := sqlite3Command(t, path, "pragma integrity_check").CombinedOutput()
+	if err != nil {
+		t.Fatalf("%v: %s", err, want)
+	}
+	if strings.Join(got, "\n")+"\n" != string(want) {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), want)
+	}
+}
@@ -0,0 +1,640 @@
+// Package btree reads and writes the table and index b-trees of a database
+// file, page by page through a pager.
+package btree
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/elordeiro/SQLite-DBReader/pager"
+	"github.com/elordeiro/SQLite-DBReader/record"
+)
+
+// Constants ------------------------------------------------------------------
+
+const (
+	LCPLen       = 4 // Left child pointer length
+	MaxTreeDepth = 20
+)
+
+const (
+	InteriorIndexPage = 0x02
+	InteriorTablePage = 0x05
+	LeafIndexPage     = 0x0a
+	LeafTablePage     = 0x0d
+)
+
+// Auto-vacuum modes, set by header offsets 52 and 64
+type AutoVacuum uint8
+
+const (
+	AutoVacuumNone AutoVacuum = iota
+	AutoVacuumFull
+	AutoVacuumIncremental
+)
+
+// ----------------------------------------------------------------------------
+
+// Custom Types----------------------------------------------------------------
+// BTree reads and writes the b-trees of a database file
+type BTree struct {
+	Pager        *pager.Pager
+	PageSize     int64
+	UsableSize   int64 // Page size minus the reserved space at the end of each page
+	Encoding     record.TextEncoding
+	SchemaFormat uint32     // Format 4 stores the integers 0 and 1 without a body
+	AutoVacuum   AutoVacuum // Pointer map pages are present unless AutoVacuumNone
+}
+
+type Page struct {
+	Num      int64
+	Header   *Header
+	CellPtrs []int
+	Cells    []*Cell
+	Pages    []*Page
+}
+
+type Header struct {
+	Type             uint8
+	CellCount        int
+	RightMostPointer uint32 // Only for interior table b-tree and interior index b-tree
+}
+
+type Cell struct {
+	LeftChildPointer uint32 // Used for: TableInteriorCell, IndexInteriorCell
+	RowID            uint64 // Used for: TableLeafCell, TableInteriorCell
+	PayloadSize      uint64 // Used for: TableLeafCell, IndexLeafCell, IndexInteriorCell
+	Payload          []byte // Raw record, used for the same cells as PayloadSize
+	Record           *record.Record
+}
+
+// Location of a cell's content on its page
+type CellExtent struct {
+	Size         int    // Bytes the cell occupies on the page
+	PayloadOff   int    // Offset of the local payload within the page
+	PayloadSize  uint64 // Total payload size, including any overflow
+	Local        int    // Payload bytes stored on the page
+	OverflowPage uint32 // First overflow page, 0 when the payload fits on the page
+}
+
+// ----------------------------------------------------------------------------
+
+// Parser functions -----------------------------------------------------------
+func ParseHeader(buf []byte) (*Header, error) {
+	if len(buf) < 8 {
+		return nil, errors.New("page header extends past end of page")
+	}
+
+	// Read page type
+	pageType := buf[0]
+	switch pageType {
+	case InteriorIndexPage, InteriorTablePage, LeafIndexPage, LeafTablePage:
+	default:
+		return nil, fmt.Errorf("invalid page type 0x%02x", pageType)
+	}
+
+	// Read cell count
+	var cc uint16
+	binary.Read(bytes.NewReader(buf[3:5]), binary.BigEndian, &cc)
+	cellCount := int(cc)
+
+	// Read right most pointer
+	var rightMostPointer uint32
+	if pageType == InteriorTablePage || pageType == InteriorIndexPage {
+		binary.Read(bytes.NewReader(buf[8:12]), binary.BigEndian, &rightMostPointer)
+	}
+
+	return &Header{
+		pageType,
+		cellCount,
+		rightMostPointer,
+	}, nil
+}
+
+// Len returns the size of the page header, 12 bytes for interior pages and 8
+// for leaf pages
+func (h *Header) Len() int {
+	if h.Type == InteriorTablePage || h.Type == InteriorIndexPage {
+		return 12
+	}
+	return 8
+}
+
+func ParseCellPtrs(buf []byte, header *Header) []int {
+	// Read cell pointers
+	cellPtrs := make([]int, header.CellCount)
+	offset := int64(8)
+	if header.Type == InteriorTablePage || header.Type == InteriorIndexPage {
+		offset += 4
+	}
+
+	for i := 0; i < header.CellCount; i++ {
+		var cellPtr uint16
+		binary.Read(bytes.NewReader(buf[offset:]), binary.BigEndian, &cellPtr)
+		cellPtrs[i] = int(cellPtr)
+		offset += 2
+	}
+
+	return cellPtrs
+}
+
+/*
+Table B-Tree Interior Cell (header 0x05):
+
+	A 4-byte big-endian page number which is the left child pointer.
+	A varint which is the integer key
+*/
+func (page *Page) ParseInteriorTableCells(pageBuf []byte) error {
+	for i := 0; i < page.Header.CellCount; i++ {
+		off := page.CellPtrs[i]
+
+		cell := &Cell{}
+
+		// Read left child pointer
+		if off+LCPLen > len(pageBuf) {
+			return pager.CorruptCell(page.Num, i, "left child pointer extends past end of page")
+		}
+		binary.Read(bytes.NewReader(pageBuf[off:off+LCPLen]), binary.BigEndian, &cell.LeftChildPointer)
+		off += LCPLen
+
+		// Read row ID
+		var n int
+		cell.RowID, n = record.ParseVarInt(pageBuf[off:])
+		if n == 0 {
+			return pager.CorruptCell(page.Num, i, "truncated row ID")
+		}
+
+		// Append cell to page cells
+		page.Cells = append(page.Cells, cell)
+	}
+
+	page.Cells = append(page.Cells, &Cell{
+		LeftChildPointer: page.Header.RightMostPointer,
+	})
+	return nil
+}
+
+/*
+Table B-Tree Leaf Cell (header 0x0d):
+
+	A varint which is the total number of bytes of payload, including any overflow
+	A varint which is the integer key, a.k.a. "rowid"
+	The initial portion of the payload that does not spill to overflow pages.
+	A 4-byte big-endian integer page number for the first page of the overflow page list - omitted if all payload fits on the b-tree page.
+*/
+func (page *Page) ParseLeafTableCells(bt *BTree, pageBuf []byte) error {
+	for i := 0; i < page.Header.CellCount; i++ {
+		off := page.CellPtrs[i]
+
+		cell := &Cell{}
+
+		// Read payload size
+		payloadSize, n := record.ParseVarInt(pageBuf[off:])
+		if n == 0 {
+			return pager.CorruptCell(page.Num, i, "truncated payload size")
+		}
+		cell.PayloadSize = payloadSize
+		off += n
+
+		// Read row ID
+		cell.RowID, n = record.ParseVarInt(pageBuf[off:])
+		if n == 0 {
+			return pager.CorruptCell(page.Num, i, "truncated row ID")
+		}
+		off += n
+
+		// Read Record
+		payload, err := bt.ReadPayload(page, i, pageBuf, off, payloadSize)
+		if err != nil {
+			return err
+		}
+		cell.Payload = payload
+		cell.Record, err = record.ReadRecord(payload, bt.Encoding)
+		if err != nil {
+			return pager.CorruptCell(page.Num, i, "%v", err)
+		}
+
+		// Append cell to page cells
+		page.Cells = append(page.Cells, cell)
+	}
+	return nil
+}
+
+/*
+Index B-Tree Interior Cell (header 0x02):
+
+	A 4-byte big-endian page number which is the left child pointer.
+	A varint which is the total number of bytes of key payload, including any overflow
+	The initial portion of the payload that does not spill to overflow pages.
+	A 4-byte big-endian integer page number for the first page of the overflow page list - omitted if all payload fits on the b-tree page.
+*/
+func (page *Page) ParseInteriorIndexCells(bt *BTree, pageBuf []byte) error {
+	for i := 0; i < page.Header.CellCount; i++ {
+		off := page.CellPtrs[i]
+
+		cell := &Cell{}
+
+		// Read left child pointer
+		if off+LCPLen > len(pageBuf) {
+			return pager.CorruptCell(page.Num, i, "left child pointer extends past end of page")
+		}
+		binary.Read(bytes.NewReader(pageBuf[off:off+LCPLen]), binary.BigEndian, &cell.LeftChildPointer)
+		off += LCPLen
+
+		// Read payload size
+		payloadSize, n := record.ParseVarInt(pageBuf[off:])
+		if n == 0 {
+			return pager.CorruptCell(page.Num, i, "truncated payload size")
+		}
+		cell.PayloadSize = payloadSize
+		off += n
+
+		// Read payload
+		payload, err := bt.ReadPayload(page, i, pageBuf, off, payloadSize)
+		if err != nil {
+			return err
+		}
+		cell.Payload = payload
+		cell.Record, err = record.ReadRecord(payload, bt.Encoding)
+		if err != nil {
+			return pager.CorruptCell(page.Num, i, "%v", err)
+		}
+
+		// Append cell to page cells
+		page.Cells = append(page.Cells, cell)
+	}
+	return nil
+}
+
+/*
+Index B-Tree Leaf Cell (header 0x0a):
+
+	A varint which is the total number of bytes of key payload, including any overflow
+	The initial portion of the payload that does not spill to overflow pages.
+	A 4-byte big-endian integer page number for the first page of the overflow page list - omitted if all payload fits on the b-tree page.
+*/
+func (page *Page) ParseLeafIndexCells(bt *BTree, pageBuf []byte) error {
+	for i := 0; i < page.Header.CellCount; i++ {
+		off := page.CellPtrs[i]
+
+		cell := &Cell{}
+
+		// Read payload size
+		payloadSize, n := record.ParseVarInt(pageBuf[off:])
+		if n == 0 {
+			return pager.CorruptCell(page.Num, i, "truncated payload size")
+		}
+		cell.PayloadSize = payloadSize
+		off += n
+
+		// Read payload
+		payload, err := bt.ReadPayload(page, i, pageBuf, off, payloadSize)
+		if err != nil {
+			return err
+		}
+		cell.Payload = payload
+		cell.Record, err = record.ReadRecord(payload, bt.Encoding)
+		if err != nil {
+			return pager.CorruptCell(page.Num, i, "%v", err)
+		}
+
+		// Append cell to page cells
+		page.Cells = append(page.Cells, cell)
+	}
+	return nil
+}
+
+// ReadCell decodes cell cellIdx of a page of any type, reading its record
+// when the cell has a payload
+func (bt *BTree) ReadCell(page *Page, pageBuf []byte, cellIdx int) (*Cell, error) {
+	off := page.CellPtrs[cellIdx]
+	buf := pageBuf[:bt.UsableSize]
+	cell := &Cell{}
+
+	if page.Header.Type == InteriorTablePage || page.Header.Type == InteriorIndexPage {
+		if off+LCPLen > len(buf) {
+			return nil, pager.CorruptCell(page.Num, cellIdx, "left child pointer extends past end of page")
+		}
+		cell.LeftChildPointer = binary.BigEndian.Uint32(buf[off:])
+		off += LCPLen
+	}
+
+	if page.Header.Type != InteriorTablePage {
+		payloadSize, n := record.ParseVarInt(buf[off:])
+		if n == 0 {
+			return nil, pager.CorruptCell(page.Num, cellIdx, "truncated payload size")
+		}
+		cell.PayloadSize = payloadSize
+		off += n
+	}
+
+	if page.Header.Type == InteriorTablePage || page.Header.Type == LeafTablePage {
+		var n int
+		cell.RowID, n = record.ParseVarInt(buf[off:])
+		if n == 0 {
+			return nil, pager.CorruptCell(page.Num, cellIdx, "truncated row ID")
+		}
+		off += n
+	}
+
+	if page.Header.Type != InteriorTablePage {
+		payload, err := bt.ReadPayload(page, cellIdx, pageBuf, off, cell.PayloadSize)
+		if err != nil {
+			return nil, err
+		}
+		cell.Payload = payload
+		cell.Record, err = record.ReadRecord(payload, bt.Encoding)
+		if err != nil {
+			return nil, pager.CorruptCell(page.Num, cellIdx, "%v", err)
+		}
+	}
+
+	return cell, nil
+}
+
+// ParseCellExtent decodes the size and payload layout of the cell at off
+// without reading the payload itself
+func (bt *BTree) ParseCellExtent(pageType uint8, pageBuf []byte, off int) (*CellExtent, error) {
+	start := off
+	buf := pageBuf[:bt.UsableSize]
+	if off >= len(buf) {
+		return nil, errors.New("cell starts past end of page")
+	}
+
+	if pageType == InteriorTablePage || pageType == InteriorIndexPage {
+		off += LCPLen
+	}
+
+	extent := &CellExtent{}
+	if pageType != InteriorTablePage {
+		// Read payload size
+		payloadSize, n := record.ParseVarInt(buf[min(off, len(buf)):])
+		if n == 0 {
+			return nil, errors.New("truncated payload size")
+		}
+		extent.PayloadSize = payloadSize
+		off += n
+	}
+
+	if pageType == InteriorTablePage || pageType == LeafTablePage {
+		// Skip row ID
+		_, n := record.ParseVarInt(buf[min(off, len(buf)):])
+		if n == 0 {
+			return nil, errors.New("truncated row ID")
+		}
+		off += n
+	}
+
+	if pageType != InteriorTablePage {
+		extent.PayloadOff = off
+		extent.Local = bt.localPayloadSize(extent.PayloadSize, pageType)
+		off += extent.Local
+		if uint64(extent.Local) < extent.PayloadSize {
+			if off+4 > len(buf) {
+				return nil, errors.New("overflow pointer extends past end of page")
+			}
+			extent.OverflowPage = binary.BigEndian.Uint32(buf[off:])
+			off += 4
+		}
+	}
+
+	// Cells always occupy at least 4 bytes so they can become freeblocks
+	extent.Size = max(off-start, 4)
+	return extent, nil
+}
+
+// ----------------------------------------------------------------------------
+
+// Tree Parsing ---------------------------------------------------------------
+// ParseTablePage reads a whole table b-tree into memory
+func (bt *BTree) ParseTablePage(pageNum int64) (*Page, error) {
+	return bt.parseTablePage(pageNum, 0)
+}
+
+func (bt *BTree) parseTablePage(pageNum int64, depth int) (*Page, error) {
+	if depth > MaxTreeDepth {
+		return nil, pager.CorruptPage(pageNum, "b-tree is too deep")
+	}
+
+	// Load page into memory
+	page, pageBuf, err := bt.LoadPage(pageNum)
+	if err != nil {
+		return nil, err
+	}
+
+	switch page.Header.Type {
+	case LeafTablePage:
+		err = page.ParseLeafTableCells(bt, pageBuf)
+		return page, err
+	case InteriorTablePage:
+		err = page.ParseInteriorTableCells(pageBuf)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, pager.CorruptPage(pageNum, "expected table b-tree page, found type 0x%02x", page.Header.Type)
+	}
+
+	for _, cell := range page.Cells {
+		childPage, err := bt.parseTablePage(int64(cell.LeftChildPointer), depth+1)
+		if err != nil {
+			return nil, err
+		}
+		page.Pages = append(page.Pages, childPage)
+	}
+
+	return page, nil
+}
+
+// ParseIndexPage reads a whole index b-tree into memory
+func (bt *BTree) ParseIndexPage(pageNum int64) (*Page, error) {
+	return bt.parseIndexPage(pageNum, 0)
+}
+
+func (bt *BTree) parseIndexPage(pageNum int64, depth int) (*Page, error) {
+	if depth > MaxTreeDepth {
+		return nil, pager.CorruptPage(pageNum, "b-tree is too deep")
+	}
+
+	// Load page into memory
+	page, pageBuf, err := bt.LoadPage(pageNum)
+	if err != nil {
+		return nil, err
+	}
+
+	switch page.Header.Type {
+	case LeafIndexPage:
+		err = page.ParseLeafIndexCells(bt, pageBuf)
+		return page, err
+	case InteriorIndexPage:
+		err = page.ParseInteriorIndexCells(bt, pageBuf)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, pager.CorruptPage(pageNum, "expected index b-tree page, found type 0x%02x", page.Header.Type)
+	}
+
+	// Interior index cells hold keys, so the right-most child has no cell
+	childNums := make([]int64, 0, len(page.Cells)+1)
+	for _, cell := range page.Cells {
+		childNums = append(childNums, int64(cell.LeftChildPointer))
+	}
+	childNums = append(childNums, int64(page.Header.RightMostPointer))
+	for _, childNum := range childNums {
+		childPage, err := bt.parseIndexPage(childNum, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		page.Pages = append(page.Pages, childPage)
+	}
+
+	return page, nil
+}
+
+// LoadPage reads a single b-tree page and parses its header and cell pointers
+func (bt *BTree) LoadPage(pageNum int64) (*Page, []byte, error) {
+	pageBuf, err := bt.Pager.ReadPage(pageNum)
+	if err != nil {
+		return nil, nil, err
+	}
+	hdrOff := HeaderOffset(pageNum)
+
+	header, err := ParseHeader(pageBuf[hdrOff:])
+	if err != nil {
+		return nil, nil, pager.CorruptPage(pageNum, "%v", err)
+	}
+
+	// The cell pointer array must fit between the page header and the
+	// reserved space, and every cell must start after it
+	ptrsEnd := hdrOff + header.Len() + 2*header.CellCount
+	if int64(ptrsEnd) > bt.UsableSize {
+		return nil, nil, pager.CorruptPage(pageNum, "cell count %d too large", header.CellCount)
+	}
+
+	cellPtrs := ParseCellPtrs(pageBuf[hdrOff:], header)
+	for i, ptr := range cellPtrs {
+		if ptr < ptrsEnd || int64(ptr) >= bt.UsableSize {
+			return nil, nil, pager.CorruptCell(pageNum, i, "cell pointer %d out of range", ptr)
+		}
+	}
+
+	page := &Page{
+		Num:      pageNum,
+		Header:   header,
+		CellPtrs: cellPtrs,
+	}
+	return page, pageBuf, nil
+}
+
+// ReadPayload returns the payload of the cell whose local content starts at
+// off, following the overflow page chain when it spills off the page
+func (bt *BTree) ReadPayload(page *Page, cellIdx int, pageBuf []byte, off int, payloadSize uint64) ([]byte, error) {
+	local := bt.localPayloadSize(payloadSize, page.Header.Type)
+	if int64(off+local) > bt.UsableSize {
+		return nil, pager.CorruptCell(page.Num, cellIdx, "payload extends past end of page")
+	}
+	if uint64(local) == payloadSize {
+		return pageBuf[off : off+local], nil
+	}
+	if int64(off+local+4) > bt.UsableSize {
+		return nil, pager.CorruptCell(page.Num, cellIdx, "overflow pointer extends past end of page")
+	}
+
+	payload := make([]byte, 0, payloadSize)
+	payload = append(payload, pageBuf[off:off+local]...)
+	next := binary.BigEndian.Uint32(pageBuf[off+local:])
+
+	for uint64(len(payload)) < payloadSize {
+		if next == 0 {
+			return nil, pager.CorruptCell(page.Num, cellIdx, "overflow chain ends early")
+		}
+		overflowBuf, err := bt.Pager.ReadPage(int64(next))
+		if err != nil {
+			return nil, err
+		}
+
+		n := min(payloadSize-uint64(len(payload)), uint64(bt.UsableSize-4))
+		payload = append(payload, overflowBuf[4:4+n]...)
+		next = binary.BigEndian.Uint32(overflowBuf[0:4])
+	}
+
+	return payload, nil
+}
+
+// ----------------------------------------------------------------------------
+
+// Getters --------------------------------------------------------------------
+func (page *Page) GetLeafCells() []*Cell {
+	if page.Header.Type == LeafTablePage || page.Header.Type == LeafIndexPage {
+		return page.Cells
+	}
+
+	result := make([]*Cell, 0)
+	for _, p := range page.Pages {
+		result = append(result, p.GetLeafCells()...)
+	}
+	return result
+}
+
+// GetIndexCells returns the cells of an index b-tree in key order, taking
+// each interior cell between the subtrees to its left and right
+func (page *Page) GetIndexCells() []*Cell {
+	if page.Header.Type == LeafIndexPage {
+		return page.Cells
+	}
+
+	result := make([]*Cell, 0)
+	for i, p := range page.Pages {
+		result = append(result, p.GetIndexCells()...)
+		if i < len(page.Cells) {
+			result = append(result, page.Cells[i])
+		}
+	}
+	return result
+}
+
+// ----------------------------------------------------------------------------
+
+// Helpers --------------------------------------------------------------------
+// HeaderOffset returns the offset of the b-tree page header, which on page 1
+// follows the 100-byte database header
+func HeaderOffset(pageNum int64) int {
+	if pageNum == 1 {
+		return 100
+	}
+	return 0
+}
+
+/*
+Payload stored on a b-tree page, with U the usable page size and P the payload size:
+
+	X is U-35 for table b-tree leaf pages or ((U-12)*64/255)-23 for index pages.
+	M is always ((U-12)*32/255)-23.
+	Let K be M+((P-M)%(U-4)).
+	If P<=X then all P bytes of payload are stored directly on the b-tree page without overflow.
+	If P>X and K<=X then the first K bytes of P are stored on the b-tree page and the remaining P-K bytes are stored on overflow pages.
+	If P>X and K>X then the first M bytes of P are stored on the b-tree page and the remaining P-M bytes are stored on overflow pages.
+*/
+func (bt *BTree) localPayloadSize(payloadSize uint64, pageType uint8) int {
+	u := uint64(bt.UsableSize)
+	x := u - 35
+	if pageType != LeafTablePage {
+		x = ((u-12)*64)/255 - 23
+	}
+	m := ((u-12)*32)/255 - 23
+	k := m + (payloadSize-m)%(u-4)
+
+	switch {
+	case payloadSize <= x:
+		return int(payloadSize)
+	case k <= x:
+		return int(k)
+	default:
+		return int(m)
+	}
+}
+
+// ----------------------------------------------------------------------------
@@ -0,0 +1,874 @@
+package btree
+
+import (
+	"encoding/binary"
+	"slices"
+
+	"github.com/elordeiro/SQLite-DBReader/pager"
+	"github.com/elordeiro/SQLite-DBReader/record"
+)
+
+// Custom Types ---------------------------------------------------------------
+// KeyCompare orders an index record against a key, with the collations and
+// sort orders of the index
+type KeyCompare func(rec *record.Record, key []any) int
+
+// btreeNode is an editable copy of the cells of a b-tree page. Writing it
+// back lays the cells out afresh, leaving no freeblocks or fragments.
+type btreeNode struct {
+	pageNum  int64
+	pageType uint8
+	cells    [][]byte // Raw cells, including the left child pointer
+	right    uint32   // Right-most pointer of interior pages
+}
+
+// Position within an interior page on the path from the root to a leaf
+type treePath struct {
+	pageNum int64
+	idx     int // Child the path descends into
+}
+
+// ----------------------------------------------------------------------------
+
+// Insertion ------------------------------------------------------------------
+// InsertRow adds a row to a table b-tree. The rowid must not be in use.
+func (bt *BTree) InsertRow(root int64, rowID int64, payload []byte) error {
+	cell, err := bt.BuildCell(LeafTablePage, rowID, payload)
+	if err != nil {
+		return err
+	}
+	return bt.insertCell(root, cell, func(c *Cell) bool {
+		return int64(c.RowID) >= rowID
+	})
+}
+
+// ReplaceRow overwrites the record of an existing row of a table b-tree
+func (bt *BTree) ReplaceRow(root int64, rowID int64, payload []byte) error {
+	c := bt.NewCursor(root)
+	if err := c.seekLeaf(func(c *Cell) bool { return int64(c.RowID) >= rowID }); err != nil {
+		return err
+	}
+	leaf := c.top()
+	if leaf.idx >= leaf.page.Header.CellCount {
+		return pager.CorruptPage(leaf.page.Num, "row %d not found", rowID)
+	}
+
+	node, err := bt.readNode(leaf.page.Num)
+	if err != nil {
+		return err
+	}
+	old := node.cells[leaf.idx]
+	if cellRowID(old) != rowID {
+		return pager.CorruptPage(leaf.page.Num, "row %d not found", rowID)
+	}
+	if err := bt.freeOverflow(node.pageType, old); err != nil {
+		return err
+	}
+	if node.cells[leaf.idx], err = bt.BuildCell(LeafTablePage, rowID, payload); err != nil {
+		return err
+	}
+
+	return bt.balance(node, c.path())
+}
+
+// InsertIndexEntry adds a key, whose last value is the rowid, to an index
+// b-tree ordered by cmp
+func (bt *BTree) InsertIndexEntry(root int64, key []any, cmp KeyCompare) error {
+	cell, err := bt.BuildCell(LeafIndexPage, 0, bt.MakeRecord(key))
+	if err != nil {
+		return err
+	}
+	return bt.insertCell(root, cell, func(c *Cell) bool {
+		return cmp(c.Record, key) >= 0
+	})
+}
+
+// insertCell places a cell on the leaf where atOrAfter first holds, then
+// splits pages up the tree as needed
+func (bt *BTree) insertCell(root int64, cell []byte, atOrAfter func(*Cell) bool) error {
+	c := bt.NewCursor(root)
+	if err := c.seekLeaf(atOrAfter); err != nil {
+		return err
+	}
+	leaf := c.top()
+
+	node, err := bt.readNode(leaf.page.Num)
+	if err != nil {
+		return err
+	}
+	node.cells = slices.Insert(node.cells, leaf.idx, cell)
+	return bt.balance(node, c.path())
+}
+
+// ----------------------------------------------------------------------------
+
+// Deletion -------------------------------------------------------------------
+// DeleteRow removes a row from a table b-tree, freeing its overflow pages
+func (bt *BTree) DeleteRow(root int64, rowID int64) error {
+	c := bt.NewCursor(root)
+	if err := c.seekLeaf(func(c *Cell) bool { return int64(c.RowID) >= rowID }); err != nil {
+		return err
+	}
+	leaf := c.top()
+
+	node, err := bt.readNode(leaf.page.Num)
+	if err != nil {
+		return err
+	}
+	if leaf.idx >= len(node.cells) || cellRowID(node.cells[leaf.idx]) != rowID {
+		return pager.CorruptPage(leaf.page.Num, "row %d not found", rowID)
+	}
+	return bt.removeCell(node, leaf.idx, c.path())
+}
+
+// DeleteIndexEntry removes a key, whose last value is the rowid, from an
+// index b-tree ordered by cmp
+func (bt *BTree) DeleteIndexEntry(root int64, key []any, cmp KeyCompare) error {
+	seek := func(rec *record.Record) int {
+		return cmp(rec, key)
+	}
+
+	c := bt.NewCursor(root)
+	found, err := c.SeekKey(seek)
+	if err != nil {
+		return err
+	}
+	if !found || seek(c.Cell().Record) != 0 {
+		return pager.CorruptPage(root, "index has no entry for row %v", key[len(key)-1])
+	}
+	top := c.top()
+	node, err := bt.readNode(top.page.Num)
+	if err != nil {
+		return err
+	}
+	if isLeafPage(node.pageType) {
+		return bt.removeCell(node, top.idx, c.path())
+	}
+
+	// An entry on an interior page is replaced by its predecessor, the last
+	// entry of the subtree to its left, which then leaves its leaf
+	for frame := top; ; frame = c.top() {
+		if _, err := c.push(c.child(frame, frame.idx)); err != nil {
+			return err
+		}
+		if isLeafPage(c.top().page.Header.Type) {
+			break
+		}
+		c.top().idx = c.top().page.Header.CellCount
+	}
+	leaf := c.top()
+	if leaf.page.Header.CellCount == 0 {
+		return pager.CorruptPage(leaf.page.Num, "empty leaf page")
+	}
+	leaf.idx = leaf.page.Header.CellCount - 1
+	if _, err := c.load(); err != nil {
+		return err
+	}
+	pred := c.Cell().Record
+	predCell, err := bt.readCellBytes(leaf.page.Num, leaf.idx)
+	if err != nil {
+		return err
+	}
+
+	old := node.cells[top.idx]
+	if err := bt.freeOverflow(node.pageType, old); err != nil {
+		return err
+	}
+	node.cells[top.idx] = append(slices.Clone(old[:LCPLen]), predCell...)
+	c.stack = c.stack[:slices.Index(c.stack, top)+1]
+	if err := bt.balance(node, c.path()); err != nil {
+		return err
+	}
+
+	// The interior copy now holds the entry, so seeking the predecessor's
+	// key descends to the leaf copy left of it
+	predKey := make([]any, len(pred.ColumnTypes))
+	for i := range predKey {
+		predKey[i] = pred.Value(i)
+	}
+	if err := c.seekLeaf(func(cell *Cell) bool {
+		return cmp(cell.Record, predKey) >= 0
+	}); err != nil {
+		return err
+	}
+	leaf = c.top()
+	if node, err = bt.readNode(leaf.page.Num); err != nil {
+		return err
+	}
+	if leaf.idx >= len(node.cells) {
+		return pager.CorruptPage(leaf.page.Num, "index lost an entry")
+	}
+
+	// The entry moved up the tree, so its overflow pages stay in use
+	node.cells = slices.Delete(node.cells, leaf.idx, leaf.idx+1)
+	return bt.balance(node, c.path())
+}
+
+// removeCell deletes a cell from a leaf, freeing its overflow pages
+func (bt *BTree) removeCell(node *btreeNode, idx int, path []treePath) error {
+	if err := bt.freeOverflow(node.pageType, node.cells[idx]); err != nil {
+		return err
+	}
+	node.cells = slices.Delete(node.cells, idx, idx+1)
+	return bt.balance(node, path)
+}
+
+// FreeTree puts every page of a b-tree on the freelist, along with the
+// overflow pages of its cells
+func (bt *BTree) FreeTree(root int64) error {
+	return bt.freeTree(root, 0)
+}
+
+func (bt *BTree) freeTree(pageNum int64, depth int) error {
+	if depth > MaxTreeDepth {
+		return pager.CorruptPage(pageNum, "b-tree is too deep")
+	}
+	node, err := bt.readNode(pageNum)
+	if err != nil {
+		return err
+	}
+
+	interior := pageHeaderLen(node.pageType) == 12
+	for i, cell := range node.cells {
+		if err := bt.freeOverflow(node.pageType, cell); err != nil {
+			return err
+		}
+		if interior {
+			if err := bt.freeTree(node.child(i), depth+1); err != nil {
+				return err
+			}
+		}
+	}
+	if interior {
+		if err := bt.freeTree(int64(node.right), depth+1); err != nil {
+			return err
+		}
+	}
+	return bt.FreePage(pageNum)
+}
+
+// ----------------------------------------------------------------------------
+
+// Balancing ------------------------------------------------------------------
+// balance writes a node back, splitting it when its cells no longer fit and
+// merging it into a sibling when it is less than a third full, or sharing
+// the sibling's cells when the two do not fit on one page. Splits add
+// dividers to the parent, merges remove one and sharing replaces one, so the
+// parent may in turn need balancing. A full root moves its cells to a new
+// child so the root keeps its page.
+func (bt *BTree) balance(node *btreeNode, path []treePath) error {
+	for {
+		fits := bt.nodeFits(node)
+		if fits && (len(path) == 0 || !bt.nodeUnderfull(node)) {
+			return bt.writeNode(node)
+		}
+
+		if len(path) == 0 {
+			childNum, err := bt.AllocatePage()
+			if err != nil {
+				return err
+			}
+			parent := &btreeNode{
+				pageNum:  node.pageNum,
+				pageType: interiorPageType(node.pageType),
+				right:    uint32(childNum),
+			}
+			node.pageNum = childNum
+
+			if parent.cells, err = bt.splitNode(node); err != nil {
+				return err
+			}
+			node = parent
+			continue
+		}
+
+		last := path[len(path)-1]
+		path = path[:len(path)-1]
+		parent, err := bt.readNode(last.pageNum)
+		if err != nil {
+			return err
+		}
+
+		if !fits {
+			dividers, err := bt.splitNode(node)
+			if err != nil {
+				return err
+			}
+			parent.cells = slices.Insert(parent.cells, last.idx, dividers...)
+		} else {
+			merged, err := bt.mergeNode(node, parent, last.idx, len(path) == 0)
+			if err != nil {
+				return err
+			}
+			if !merged {
+				return bt.writeNode(node)
+			}
+		}
+		node = parent
+	}
+}
+
+// mergeNode combines a node with its left sibling, or its right one when it
+// is the first child. When their cells and the divider between them fit on a
+// single page the parent loses the divider, and when that leaves a root with
+// no cells, the merged node becomes the root. Otherwise the cells are split
+// afresh across the two, like sqlite's balance_nonroot, so that neither is
+// left empty, and the parent's divider is replaced.
+func (bt *BTree) mergeNode(node, parent *btreeNode, idx int, parentIsRoot bool) (bool, error) {
+	if len(parent.cells) == 0 {
+		return false, nil
+	}
+
+	div := idx - 1 // Divider between the two, indexed like the left child
+	if idx == 0 {
+		div = 0
+	}
+	siblingIdx := div
+	if idx == 0 {
+		siblingIdx = 1
+	}
+	sibling, err := bt.readNode(parent.child(siblingIdx))
+	if err != nil {
+		return false, err
+	}
+	if sibling.pageType != node.pageType {
+		return false, pager.CorruptPage(sibling.pageNum, "unexpected page type 0x%02x", sibling.pageType)
+	}
+	left, right := sibling, node
+	if idx == 0 {
+		left, right = node, sibling
+	}
+
+	merged := &btreeNode{
+		pageNum:  right.pageNum,
+		pageType: node.pageType,
+		cells:    slices.Clip(left.cells),
+		right:    right.right,
+	}
+	divider := parent.cells[div]
+	switch node.pageType {
+	case LeafIndexPage:
+		merged.cells = append(merged.cells, divider[LCPLen:])
+	case InteriorTablePage, InteriorIndexPage:
+		cell := binary.BigEndian.AppendUint32(nil, left.right)
+		merged.cells = append(merged.cells, append(cell, divider[LCPLen:]...))
+	}
+	merged.cells = append(merged.cells, right.cells...)
+
+	collapse := parentIsRoot && len(parent.cells) == 1
+	if collapse {
+		merged.pageNum = parent.pageNum
+	}
+	if err := bt.FreePage(left.pageNum); err != nil {
+		return false, err
+	}
+	if !bt.nodeFits(merged) {
+		merged.pageNum = right.pageNum
+		dividers, err := bt.splitNode(merged)
+		if err != nil {
+			return false, err
+		}
+		parent.cells = slices.Replace(parent.cells, div, div+1, dividers...)
+		return true, nil
+	}
+	if collapse {
+		if err := bt.FreePage(right.pageNum); err != nil {
+			return false, err
+		}
+		*parent = *merged
+		return true, nil
+	}
+
+	parent.cells = slices.Delete(parent.cells, div, div+1)
+	return true, bt.writeNode(merged)
+}
+
+// splitNode writes the cells of an overfull node across several pages and
+// returns the divider cells for the parent. The last piece keeps the node's
+// page number, so the parent's existing pointer to it stays valid.
+func (bt *BTree) splitNode(node *btreeNode) ([][]byte, error) {
+	var groups [][][]byte
+	var removed [][]byte
+	bt.partitionCells(node.pageType, node.cells, &groups, &removed)
+
+	pieces := make([]*btreeNode, len(groups))
+	for i, cells := range groups {
+		pieces[i] = &btreeNode{pageType: node.pageType, cells: cells}
+		if i == len(groups)-1 {
+			pieces[i].pageNum = node.pageNum
+			pieces[i].right = node.right
+			continue
+		}
+
+		pageNum, err := bt.AllocatePage()
+		if err != nil {
+			return nil, err
+		}
+		pieces[i].pageNum = pageNum
+	}
+
+	dividers := make([][]byte, 0, len(pieces)-1)
+	for i, piece := range pieces[:len(pieces)-1] {
+		div := binary.BigEndian.AppendUint32(nil, uint32(piece.pageNum))
+		switch node.pageType {
+		case LeafTablePage:
+			// Interior keys are the largest rowid of the subtree to their left
+			div = record.AppendVarInt(div, uint64(cellRowID(piece.cells[len(piece.cells)-1])))
+		case LeafIndexPage:
+			div = append(div, removed[i]...)
+		default:
+			// The removed cell's child becomes the piece's right-most child
+			piece.right = binary.BigEndian.Uint32(removed[i])
+			div = append(div, removed[i][LCPLen:]...)
+		}
+		dividers = append(dividers, div)
+	}
+
+	for _, piece := range pieces {
+		if err := bt.writeNode(piece); err != nil {
+			return nil, err
+		}
+	}
+	return dividers, nil
+}
+
+// partitionCells splits cells in half by size until every group fits on a
+// page. Pages other than table leaves give up the middle cell as a divider.
+func (bt *BTree) partitionCells(pageType uint8, cells [][]byte, groups *[][][]byte, removed *[][]byte) {
+	size := 0
+	for _, cell := range cells {
+		size += len(cell) + 2
+	}
+
+	minCells := 3
+	if pageType == LeafTablePage {
+		minCells = 2
+	}
+	if int64(size+pageHeaderLen(pageType)) <= bt.UsableSize || len(cells) < minCells {
+		*groups = append(*groups, cells)
+		return
+	}
+
+	mid, acc := 0, 0
+	for mid < len(cells) && acc+len(cells[mid])+2 <= size/2 {
+		acc += len(cells[mid]) + 2
+		mid++
+	}
+
+	if pageType == LeafTablePage {
+		mid = min(max(mid, 1), len(cells)-1)
+		bt.partitionCells(pageType, cells[:mid], groups, removed)
+		bt.partitionCells(pageType, cells[mid:], groups, removed)
+		return
+	}
+
+	mid = min(max(mid, 1), len(cells)-2)
+	bt.partitionCells(pageType, cells[:mid], groups, removed)
+	*removed = append(*removed, cells[mid])
+	bt.partitionCells(pageType, cells[mid+1:], groups, removed)
+}
+
+// ----------------------------------------------------------------------------
+
+// Bulk Loading ---------------------------------------------------------------
+// LoadTree fills the empty b-tree at root with the leaf cells returned by
+// next in key order, until it returns nil. Each page is packed full and
+// written before the next is started, so only the dividers of a level are
+// held in memory. A table leaf is divided from the next by its largest
+// rowid, while on other pages the first cell that did not fit moves up a
+// level to divide them. Levels are built bottom up until one fits on the
+// root page.
+func (bt *BTree) LoadTree(root int64, pageType uint8, next func() ([]byte, error)) error {
+	right := uint32(0)
+	for {
+		node := &btreeNode{pageType: pageType}
+		parents := make([][]byte, 0) // Cells of the level above
+		write := func() error {
+			var err error
+			if node.pageNum, err = bt.AllocatePage(); err != nil {
+				return err
+			}
+			return bt.writeNode(node)
+		}
+		// divide writes the node with its first n cells and adds the cell
+		// dividing it from the next page to the level above
+		divide := func(n int) error {
+			var div []byte
+			switch pageType {
+			case LeafTablePage:
+				div = record.AppendVarInt(nil, uint64(cellRowID(node.cells[n-1])))
+			case InteriorTablePage, InteriorIndexPage:
+				node.right = binary.BigEndian.Uint32(node.cells[n])
+				div = node.cells[n][LCPLen:]
+			default:
+				div = node.cells[n]
+			}
+			node.cells = node.cells[:n]
+			if err := write(); err != nil {
+				return err
+			}
+			parent := binary.BigEndian.AppendUint32(nil, uint32(node.pageNum))
+			parents = append(parents, append(parent, div...))
+			node = &btreeNode{pageType: pageType}
+			return nil
+		}
+
+		for {
+			cell, err := next()
+			if err != nil {
+				return err
+			}
+			if cell == nil {
+				break
+			}
+			if !bt.nodeFits(node) {
+				if err := divide(len(node.cells) - 1); err != nil {
+					return err
+				}
+			}
+			node.cells = append(node.cells, cell)
+			if pageType == LeafTablePage && !bt.nodeFits(node) {
+				if err := divide(len(node.cells) - 1); err != nil {
+					return err
+				}
+				node.cells = append(node.cells, cell)
+			}
+		}
+		// With no cell after it, a last cell that did not fit stays on the
+		// last page, and the one before it divides the pages instead
+		if !bt.nodeFits(node) {
+			last := node.cells[len(node.cells)-1]
+			if err := divide(len(node.cells) - 2); err != nil {
+				return err
+			}
+			node.cells = append(node.cells, last)
+		}
+		node.right = right
+
+		if len(parents) == 0 {
+			node.pageNum = root
+			return bt.writeNode(node)
+		}
+		if err := write(); err != nil {
+			return err
+		}
+
+		next = sliceCells(parents)
+		pageType = interiorPageType(pageType)
+		right = uint32(node.pageNum)
+	}
+}
+
+// sliceCells returns the cells one at a time, for LoadTree
+func sliceCells(cells [][]byte) func() ([]byte, error) {
+	return func() ([]byte, error) {
+		if len(cells) == 0 {
+			return nil, nil
+		}
+		cell := cells[0]
+		cells = cells[1:]
+		return cell, nil
+	}
+}
+
+// ----------------------------------------------------------------------------
+
+// Cells ----------------------------------------------------------------------
+// MakeRecord encodes values as a record in the database's text encoding and
+// schema format
+func (bt *BTree) MakeRecord(values []any) []byte {
+	return record.Encode(values, bt.Encoding, bt.SchemaFormat)
+}
+
+// BuildCell encodes a leaf cell, spilling the end of a large payload onto a
+// chain of overflow pages
+func (bt *BTree) BuildCell(pageType uint8, rowID int64, payload []byte) ([]byte, error) {
+	cell := record.AppendVarInt(nil, uint64(len(payload)))
+	if pageType == LeafTablePage {
+		cell = record.AppendVarInt(cell, uint64(rowID))
+	}
+
+	local := bt.localPayloadSize(uint64(len(payload)), pageType)
+	cell = append(cell, payload[:local]...)
+	if local == len(payload) {
+		// Cells take at least 4 bytes so they can become freeblocks
+		for len(cell) < 4 {
+			cell = append(cell, 0)
+		}
+		return cell, nil
+	}
+
+	first, err := bt.writeOverflow(payload[local:])
+	if err != nil {
+		return nil, err
+	}
+	return binary.BigEndian.AppendUint32(cell, first), nil
+}
+
+// writeOverflow stores data on a chain of overflow pages, each holding the
+// next page number followed by up to U-4 bytes
+func (bt *BTree) writeOverflow(data []byte) (uint32, error) {
+	chunk := int(bt.UsableSize - 4)
+	pageNums := make([]int64, (len(data)+chunk-1)/chunk)
+	for i := range pageNums {
+		var err error
+		if pageNums[i], err = bt.AllocatePage(); err != nil {
+			return 0, err
+		}
+	}
+
+	for i, pageNum := range pageNums {
+		buf, err := bt.Pager.WritablePage(pageNum)
+		if err != nil {
+			return 0, err
+		}
+		next := uint32(0)
+		if i+1 < len(pageNums) {
+			next = uint32(pageNums[i+1])
+		}
+		binary.BigEndian.PutUint32(buf, next)
+		copy(buf[4:], data[i*chunk:min((i+1)*chunk, len(data))])
+	}
+	return uint32(pageNums[0]), nil
+}
+
+// freeOverflow releases the overflow chain of a raw cell
+func (bt *BTree) freeOverflow(pageType uint8, cell []byte) error {
+	if pageType == InteriorTablePage {
+		return nil
+	}
+	if pageType == InteriorIndexPage {
+		cell = cell[LCPLen:]
+	}
+	payloadSize, _ := record.ParseVarInt(cell)
+	if bt.localPayloadSize(payloadSize, pageType) == int(payloadSize) {
+		return nil
+	}
+
+	// The overflow page number ends the cell
+	pageNum := int64(binary.BigEndian.Uint32(cell[len(cell)-4:]))
+	for n := 0; pageNum != 0; n++ {
+		if n > int(bt.Pager.PageCount()) {
+			return pager.CorruptPage(pageNum, "overflow chain loops")
+		}
+		buf, err := bt.Pager.ReadPage(pageNum)
+		if err != nil {
+			return err
+		}
+		next := int64(binary.BigEndian.Uint32(buf))
+		if err := bt.FreePage(pageNum); err != nil {
+			return err
+		}
+		pageNum = next
+	}
+	return nil
+}
+
+// cellRowID reads the rowid of a raw table leaf cell
+func cellRowID(cell []byte) int64 {
+	_, n := record.ParseVarInt(cell)
+	rowID, _ := record.ParseVarInt(cell[n:])
+	return int64(rowID)
+}
+
+// ----------------------------------------------------------------------------
+
+// Pages ----------------------------------------------------------------------
+func (bt *BTree) readNode(pageNum int64) (*btreeNode, error) {
+	page, buf, err := bt.LoadPage(pageNum)
+	if err != nil {
+		return nil, err
+	}
+
+	node := &btreeNode{
+		pageNum:  pageNum,
+		pageType: page.Header.Type,
+		cells:    make([][]byte, len(page.CellPtrs)),
+		right:    page.Header.RightMostPointer,
+	}
+	for i, ptr := range page.CellPtrs {
+		extent, err := bt.ParseCellExtent(page.Header.Type, buf, ptr)
+		if err != nil {
+			return nil, pager.CorruptCell(pageNum, i, "%v", err)
+		}
+		if int64(ptr+extent.Size) > bt.UsableSize {
+			return nil, pager.CorruptCell(pageNum, i, "cell extends past end of page")
+		}
+		node.cells[i] = slices.Clone(buf[ptr : ptr+extent.Size])
+	}
+	return node, nil
+}
+
+// writeNode lays out a node's cells packed against the end of the usable
+// space, with the cell pointer array following the page header
+func (bt *BTree) writeNode(node *btreeNode) error {
+	buf, err := bt.Pager.WritablePage(node.pageNum)
+	if err != nil {
+		return err
+	}
+
+	hdrOff := HeaderOffset(node.pageNum)
+	hdrLen := pageHeaderLen(node.pageType)
+	clear(buf[hdrOff:bt.UsableSize])
+
+	buf[hdrOff] = node.pageType
+	binary.BigEndian.PutUint16(buf[hdrOff+3:], uint16(len(node.cells)))
+	if hdrLen == 12 {
+		binary.BigEndian.PutUint32(buf[hdrOff+8:], node.right)
+	}
+
+	content := int(bt.UsableSize)
+	for i, cell := range node.cells {
+		content -= len(cell)
+		copy(buf[content:], cell)
+		binary.BigEndian.PutUint16(buf[hdrOff+hdrLen+2*i:], uint16(content))
+	}
+
+	// A content offset of 65536 is stored as 0
+	binary.BigEndian.PutUint16(buf[hdrOff+5:], uint16(content))
+	return nil
+}
+
+// readCellBytes returns a copy of one raw cell of a page
+func (bt *BTree) readCellBytes(pageNum int64, idx int) ([]byte, error) {
+	node, err := bt.readNode(pageNum)
+	if err != nil {
+		return nil, err
+	}
+	return node.cells[idx], nil
+}
+
+// child returns the page number of child i, where the child after the last
+// cell is the right-most pointer
+func (node *btreeNode) child(i int) int64 {
+	if i >= len(node.cells) {
+		return int64(node.right)
+	}
+	return int64(binary.BigEndian.Uint32(node.cells[i]))
+}
+
+func (bt *BTree) nodeFits(node *btreeNode) bool {
+	size := HeaderOffset(node.pageNum) + pageHeaderLen(node.pageType)
+	for _, cell := range node.cells {
+		size += len(cell) + 2
+	}
+	return int64(size) <= bt.UsableSize
+}
+
+// nodeUnderfull reports whether a node's cells fill less than a third of
+// its page
+func (bt *BTree) nodeUnderfull(node *btreeNode) bool {
+	size := 0
+	for _, cell := range node.cells {
+		size += len(cell) + 2
+	}
+	return int64(size)*3 < bt.UsableSize
+}
+
+func pageHeaderLen(pageType uint8) int {
+	return (&Header{Type: pageType}).Len()
+}
+
+func interiorPageType(pageType uint8) uint8 {
+	switch pageType {
+	case LeafTablePage:
+		return InteriorTablePage
+	case LeafIndexPage:
+		return InteriorIndexPage
+	default:
+		return pageType
+	}
+}
+
+// CreateTree allocates the root page of a new, empty b-tree
+func (bt *BTree) CreateTree(pageType uint8) (int64, error) {
+	root, err := bt.AllocatePage()
+	if err != nil {
+		return 0, err
+	}
+	return root, bt.writeNode(&btreeNode{pageNum: root, pageType: pageType})
+}
+
+// AllocatePage returns a zeroed page for writing, taken from the freelist
+// when it has one or else added to the end of the file
+func (bt *BTree) AllocatePage() (int64, error) {
+	header, err := bt.Pager.WritablePage(1)
+	if err != nil {
+		return 0, err
+	}
+
+	trunk := int64(binary.BigEndian.Uint32(header[32:]))
+	if trunk == 0 {
+		return bt.Pager.AppendPage()
+	}
+	if trunk > bt.Pager.PageCount() {
+		return 0, pager.CorruptPage(trunk, "freelist trunk page out of range")
+	}
+
+	trunkBuf, err := bt.Pager.WritablePage(trunk)
+	if err != nil {
+		return 0, err
+	}
+	freeCount := binary.BigEndian.Uint32(header[36:])
+	binary.BigEndian.PutUint32(header[36:], freeCount-1)
+
+	// Take the last leaf listed on the first trunk, or the trunk itself
+	// once it lists none
+	pageNum := trunk
+	leafCount := int64(binary.BigEndian.Uint32(trunkBuf[4:]))
+	if leafCount > bt.UsableSize/4-2 {
+		return 0, pager.CorruptPage(trunk, "freelist leaf count too big")
+	}
+	if leafCount > 0 {
+		pageNum = int64(binary.BigEndian.Uint32(trunkBuf[8+4*(leafCount-1):]))
+		binary.BigEndian.PutUint32(trunkBuf[4:], uint32(leafCount-1))
+		if pageNum < 2 || pageNum > bt.Pager.PageCount() {
+			return 0, pager.CorruptPage(trunk, "freelist leaf %d out of range", pageNum)
+		}
+	} else {
+		copy(header[32:36], trunkBuf[0:4])
+	}
+
+	buf, err := bt.Pager.WritablePage(pageNum)
+	if err != nil {
+		return 0, err
+	}
+	clear(buf)
+	return pageNum, nil
+}
+
+// FreePage adds a page to the freelist, as a leaf of the first trunk when it
+// has room or else as the new first trunk
+func (bt *BTree) FreePage(pageNum int64) error {
+	header, err := bt.Pager.WritablePage(1)
+	if err != nil {
+		return err
+	}
+	freeCount := binary.BigEndian.Uint32(header[36:])
+	binary.BigEndian.PutUint32(header[36:], freeCount+1)
+
+	trunk := int64(binary.BigEndian.Uint32(header[32:]))
+	if trunk != 0 {
+		trunkBuf, err := bt.Pager.WritablePage(trunk)
+		if err != nil {
+			return err
+		}
+		leafCount := int64(binary.BigEndian.Uint32(trunkBuf[4:]))
+		if leafCount < bt.UsableSize/4-8 {
+			binary.BigEndian.PutUint32(trunkBuf[8+4*leafCount:], uint32(pageNum))
+			binary.BigEndian.PutUint32(trunkBuf[4:], uint32(leafCount+1))
+			return nil
+		}
+	}
+
+	buf, err := bt.Pager.WritablePage(pageNum)
+	if err != nil {
+		return err
+	}
+	clear(buf)
+	binary.BigEndian.PutUint32(buf, uint32(trunk))
+	binary.BigEndian.PutUint32(header[32:], uint32(pageNum))
+	return nil
+}
+
+// ----------------------------------------------------------------------------
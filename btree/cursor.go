@@ -0,0 +1,277 @@
+package btree
+
+import (
+	"encoding/binary"
+	"sort"
+
+	"github.com/elordeiro/SQLite-DBReader/pager"
+	"github.com/elordeiro/SQLite-DBReader/record"
+)
+
+// Custom Types ---------------------------------------------------------------
+// Cursor walks the entries of one b-tree in key order. Table b-trees only
+// hold entries on their leaves, index b-trees also hold them on interior
+// pages between the subtrees.
+type Cursor struct {
+	bt    *BTree
+	root  int64
+	index bool
+	stack []*cursorFrame
+	cell  *Cell // Entry at the current position, nil past the end
+}
+
+// A page on the path from the root. On interior pages idx is the child the
+// cursor descended into, or the cell it is positioned on.
+type cursorFrame struct {
+	page *Page
+	buf  []byte
+	idx  int
+}
+
+// ----------------------------------------------------------------------------
+
+func (bt *BTree) NewCursor(root int64) *Cursor {
+	return &Cursor{bt: bt, root: root}
+}
+
+// First moves to the smallest entry and reports whether the tree has one
+func (c *Cursor) First() (bool, error) {
+	if err := c.reset(); err != nil {
+		return false, err
+	}
+	if err := c.descendLeft(); err != nil {
+		return false, err
+	}
+	return c.settle()
+}
+
+// Last moves to the largest entry and reports whether the tree has one
+func (c *Cursor) Last() (bool, error) {
+	if err := c.reset(); err != nil {
+		return false, err
+	}
+
+	for {
+		top := c.top()
+		if isLeafPage(top.page.Header.Type) {
+			top.idx = top.page.Header.CellCount - 1
+			if top.idx < 0 {
+				c.cell = nil
+				return false, nil
+			}
+			return c.load()
+		}
+
+		top.idx = top.page.Header.CellCount
+		if _, err := c.push(c.child(top, top.idx)); err != nil {
+			return false, err
+		}
+	}
+}
+
+// Next moves to the following entry and reports whether there is one
+func (c *Cursor) Next() (bool, error) {
+	if c.cell == nil {
+		return false, nil
+	}
+
+	top := c.top()
+	top.idx++
+	if !isLeafPage(top.page.Header.Type) {
+		// Move from an interior index entry into the subtree after it
+		if _, err := c.push(c.child(top, top.idx)); err != nil {
+			return false, err
+		}
+		if err := c.descendLeft(); err != nil {
+			return false, err
+		}
+	}
+	return c.settle()
+}
+
+// SeekRowID moves to the first entry of a table b-tree whose rowid is at
+// least rowID. Returns false when every rowid is smaller.
+func (c *Cursor) SeekRowID(rowID int64) (bool, error) {
+	return c.seek(func(cell *Cell) bool {
+		return int64(cell.RowID) >= rowID
+	})
+}
+
+// SeekKey moves to the first entry of an index b-tree for which cmp, the
+// comparison of the entry's record with the key sought, is not negative
+func (c *Cursor) SeekKey(cmp func(*record.Record) int) (bool, error) {
+	return c.seek(func(cell *Cell) bool {
+		return cmp(cell.Record) >= 0
+	})
+}
+
+func (c *Cursor) Cell() *Cell {
+	return c.cell
+}
+
+// Helpers --------------------------------------------------------------------
+// seek descends to the first entry satisfying atOrAfter, which must be false
+// for a prefix of the entries in key order and true for the rest
+func (c *Cursor) seek(atOrAfter func(*Cell) bool) (bool, error) {
+	if err := c.seekLeaf(atOrAfter); err != nil {
+		return false, err
+	}
+	return c.settle()
+}
+
+// seekLeaf descends to the leaf position where an entry satisfying
+// atOrAfter would be inserted, without moving on to the next entry when that
+// position is past the end of the leaf
+func (c *Cursor) seekLeaf(atOrAfter func(*Cell) bool) error {
+	if err := c.reset(); err != nil {
+		return err
+	}
+
+	for {
+		top := c.top()
+		var err error
+		top.idx = sort.Search(top.page.Header.CellCount, func(i int) bool {
+			if err != nil {
+				return true
+			}
+			var cell *Cell
+			cell, err = c.bt.ReadCell(top.page, top.buf, i)
+			return err == nil && atOrAfter(cell)
+		})
+		if err != nil {
+			return err
+		}
+
+		if isLeafPage(top.page.Header.Type) {
+			return nil
+		}
+		if _, err := c.push(c.child(top, top.idx)); err != nil {
+			return err
+		}
+	}
+}
+
+func (c *Cursor) reset() error {
+	c.stack = c.stack[:0]
+	c.cell = nil
+	frame, err := c.push(c.root)
+	if err != nil {
+		return err
+	}
+	switch frame.page.Header.Type {
+	case InteriorIndexPage, LeafIndexPage:
+		c.index = true
+	default:
+		c.index = false
+	}
+	return nil
+}
+
+func (c *Cursor) push(pageNum int64) (*cursorFrame, error) {
+	if len(c.stack) > MaxTreeDepth {
+		return nil, pager.CorruptPage(pageNum, "b-tree is too deep")
+	}
+
+	page, buf, err := c.bt.LoadPage(pageNum)
+	if err != nil {
+		return nil, err
+	}
+	if len(c.stack) > 0 {
+		isIndex := page.Header.Type == InteriorIndexPage || page.Header.Type == LeafIndexPage
+		if isIndex != c.index {
+			return nil, pager.CorruptPage(pageNum, "unexpected page type 0x%02x", page.Header.Type)
+		}
+	}
+
+	frame := &cursorFrame{page: page, buf: buf}
+	c.stack = append(c.stack, frame)
+	return frame, nil
+}
+
+// path lists the interior pages above the current page and the child taken
+// on each
+func (c *Cursor) path() []treePath {
+	path := make([]treePath, 0, len(c.stack)-1)
+	for _, frame := range c.stack[:len(c.stack)-1] {
+		path = append(path, treePath{frame.page.Num, frame.idx})
+	}
+	return path
+}
+
+func (c *Cursor) top() *cursorFrame {
+	return c.stack[len(c.stack)-1]
+}
+
+// child returns the page number of child i of an interior page, where the
+// child after the last cell is the right-most pointer
+func (c *Cursor) child(frame *cursorFrame, i int) int64 {
+	if i >= frame.page.Header.CellCount {
+		return int64(frame.page.Header.RightMostPointer)
+	}
+	ptr := frame.page.CellPtrs[i]
+	if int64(ptr+LCPLen) > c.bt.UsableSize {
+		return 0 // Rejected by LoadPage as out of range
+	}
+	return int64(binary.BigEndian.Uint32(frame.buf[ptr:]))
+}
+
+func (c *Cursor) descendLeft() error {
+	for top := c.top(); !isLeafPage(top.page.Header.Type); top = c.top() {
+		top.idx = 0
+		if _, err := c.push(c.child(top, 0)); err != nil {
+			return err
+		}
+	}
+	c.top().idx = 0
+	return nil
+}
+
+// settle loads the entry at the current position, climbing to the next
+// entry up the tree when the cursor has run off the end of a leaf
+func (c *Cursor) settle() (bool, error) {
+	top := c.top()
+	if top.idx < top.page.Header.CellCount {
+		return c.load()
+	}
+
+	for {
+		c.stack = c.stack[:len(c.stack)-1]
+		if len(c.stack) == 0 {
+			c.cell = nil
+			return false, nil
+		}
+
+		top = c.top()
+		if top.idx >= top.page.Header.CellCount {
+			continue
+		}
+		if c.index {
+			return c.load()
+		}
+
+		top.idx++
+		if _, err := c.push(c.child(top, top.idx)); err != nil {
+			return false, err
+		}
+		if err := c.descendLeft(); err != nil {
+			return false, err
+		}
+		return c.settle()
+	}
+}
+
+func (c *Cursor) load() (bool, error) {
+	top := c.top()
+	cell, err := c.bt.ReadCell(top.page, top.buf, top.idx)
+	if err != nil {
+		return false, err
+	}
+	c.cell = cell
+	return true, nil
+}
+
+func isLeafPage(pageType uint8) bool {
+	return pageType == LeafTablePage || pageType == LeafIndexPage
+}
+
+// ----------------------------------------------------------------------------
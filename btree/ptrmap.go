@@ -0,0 +1,88 @@
+package btree
+
+import (
+	"encoding/binary"
+
+	"github.com/elordeiro/SQLite-DBReader/pager"
+)
+
+// Constants ------------------------------------------------------------------
+
+// Pointer map entry types
+const (
+	PtrmapRootPage  = 1 // Root page of a b-tree, no parent
+	PtrmapFreePage  = 2 // Freelist page, no parent
+	PtrmapOverflow1 = 3 // First overflow page, parent is the b-tree page
+	PtrmapOverflow2 = 4 // Later overflow page, parent is the previous one
+	PtrmapBTree     = 5 // Non-root b-tree page, parent is its parent page
+)
+
+// PendingByte is the file offset of the byte used for locking. The page
+// holding it is never used, not even as a pointer map page.
+const PendingByte = 0x40000000
+
+// ----------------------------------------------------------------------------
+
+// Custom Types ---------------------------------------------------------------
+type PtrmapEntry struct {
+	Type   uint8
+	Parent int64
+}
+
+// ----------------------------------------------------------------------------
+
+// Pointer Map ----------------------------------------------------------------
+/*
+In an auto-vacuum database page 2 is a pointer map page, followed by the U/5
+pages it describes, then the next pointer map page and so on, with U the
+usable page size. Each entry is a 1-byte type and a 4-byte parent page.
+*/
+
+// ptrmapPage returns the pointer map page holding the entry for pageNum
+func (bt *BTree) ptrmapPage(pageNum int64) int64 {
+	perMap := bt.UsableSize/5 + 1
+	mapPage := (pageNum-2)/perMap*perMap + 2
+	if mapPage == PendingByte/bt.PageSize+1 {
+		mapPage++
+	}
+	return mapPage
+}
+
+// IsPtrmapPage reports whether a page of an auto-vacuum database belongs to
+// the pointer map
+func (bt *BTree) IsPtrmapPage(pageNum int64) bool {
+	return bt.AutoVacuum != AutoVacuumNone && pageNum >= 2 && bt.ptrmapPage(pageNum) == pageNum
+}
+
+// ReadPtrmap returns the pointer map entry for a page
+func (bt *BTree) ReadPtrmap(pageNum int64) (PtrmapEntry, error) {
+	if bt.AutoVacuum == AutoVacuumNone {
+		return PtrmapEntry{}, pager.CorruptPage(pageNum, "database has no pointer map")
+	}
+	mapPage := bt.ptrmapPage(pageNum)
+	off := 5 * (pageNum - mapPage - 1)
+	if pageNum < 2 || off < 0 {
+		return PtrmapEntry{}, pager.CorruptPage(pageNum, "page has no pointer map entry")
+	}
+
+	buf, err := bt.Pager.ReadPage(mapPage)
+	if err != nil {
+		return PtrmapEntry{}, err
+	}
+	entry := PtrmapEntry{
+		Type:   buf[off],
+		Parent: int64(binary.BigEndian.Uint32(buf[off+1:])),
+	}
+	if entry.Type < PtrmapRootPage || entry.Type > PtrmapBTree {
+		return PtrmapEntry{}, pager.CorruptPage(mapPage, "invalid pointer map entry type %d", entry.Type)
+	}
+	return entry, nil
+}
+
+// PtrmapEntries returns how many entries a pointer map page holds, fewer
+// than it has room for when the file ends before the pages it describes
+func (bt *BTree) PtrmapEntries(mapPage int64) int {
+	return int(min(bt.UsableSize/5, bt.Pager.PageCount()-mapPage))
+}
+
+// ----------------------------------------------------------------------------
@@ -0,0 +1,256 @@
+package sqlite
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/elordeiro/SQLite-DBReader/parser"
+)
+
+// Custom Types ---------------------------------------------------------------
+
+// compoundArm is one SELECT of a compound and how it combines with the rows
+// of the ones before it
+type compoundArm struct {
+	op   string // "" for the first, otherwise see parser.CompoundSelect
+	plan *selectPlan
+}
+
+// ----------------------------------------------------------------------------
+
+// Compound SELECT ------------------------------------------------------------
+
+// planCompound plans each SELECT of a compound in a scope of its own beside
+// sc. In the body of a recursive CTE, the SELECTs from the first that reads
+// the CTE on are its recursive steps.
+func (db *DB) planCompound(stmt *parser.SelectStatement, sc *scope) (*selectPlan, error) {
+	plan, c := &selectPlan{}, sc.cte
+	if c != nil {
+		plan = c.planning
+	}
+	plan.stmt = stmt
+
+	core := *stmt
+	core.With, core.Compound, core.OrderBy, core.Limit, core.Offset = nil, nil, nil, nil, nil
+	arms := append([]*parser.CompoundSelect{{Select: &core}}, stmt.Compound...)
+	for i, arm := range arms {
+		inner := sc.sibling()
+		if c != nil {
+			c.recursive, c.step = false, inner
+		}
+		armPlan, err := db.planQuery(arm.Select, inner)
+		if err != nil {
+			return nil, err
+		}
+		sc.readsOuter(inner)
+
+		switch {
+		case i == 0:
+			plan.exprs, plan.names, plan.types = armPlan.exprs, armPlan.names, armPlan.types
+			if c != nil {
+				if c.table, err = cteTable(c, plan); err != nil {
+					return nil, err
+				}
+			}
+		case len(armPlan.exprs) != len(plan.exprs):
+			return nil, fmt.Errorf("SELECTs to the left and right of %s do not have the same number of result columns", arm.Op)
+		}
+		if c != nil && c.recursive && plan.recursive == 0 {
+			if arm.Op != "UNION" && arm.Op != "UNION ALL" {
+				return nil, fmt.Errorf("circular reference: %s", c.def.Name)
+			}
+			plan.recursive = i
+		}
+		plan.arms = append(plan.arms, &compoundArm{op: arm.Op, plan: armPlan})
+	}
+	plan.correlated = sc.correlated
+
+	// ORDER BY names result columns, by position, alias or column name
+	for i, term := range stmt.OrderBy {
+		e, collation := term.Expr, ""
+		if x, ok := e.(*parser.CollateExpr); ok {
+			e, collation = x.X, x.Collation
+		}
+		col, err := compoundColumn(e, plan, int64(i+1))
+		if err != nil {
+			return nil, err
+		}
+		key := plan.exprs[col]
+		if collation != "" {
+			key = &parser.CollateExpr{X: key, Collation: collation}
+		}
+		plan.orderBy = append(plan.orderBy, key)
+		plan.orderCols = append(plan.orderCols, col)
+	}
+	// The rows of a recursive CTE come off a queue kept in ORDER BY order
+	plan.sorted = plan.recursive > 0
+	return plan, nil
+}
+
+// compoundColumn finds the result column the nth ORDER BY term of a compound
+// names
+func compoundColumn(e parser.Expr, plan *selectPlan, n int64) (int, error) {
+	switch x := e.(type) {
+	case *parser.Literal:
+		if v, ok := x.Value.(int64); ok {
+			if v < 1 || v > int64(len(plan.exprs)) {
+				return 0, fmt.Errorf("%d%s ORDER BY term out of range - should be between 1 and %d",
+					n, ordinalSuffix(n), len(plan.exprs))
+			}
+			return int(v - 1), nil
+		}
+	case *parser.ColumnRef:
+		for i, name := range plan.names {
+			if x.Table == "" && strings.EqualFold(name, x.Column) {
+				return i, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("%d%s ORDER BY term does not match any column in the result set", n, ordinalSuffix(n))
+}
+
+// compoundRows runs the SELECTs of a compound and combines their rows.
+// UNION, INTERSECT and EXCEPT leave no duplicates among the rows so far.
+func (db *DB) compoundRows(ctx *evalContext, plan *selectPlan, stopAfter int64) ([]*outputRow, error) {
+	if plan.recursive > 0 {
+		return db.recursiveRows(ctx, plan, stopAfter)
+	}
+
+	rows := make([][]any, 0)
+	for _, arm := range plan.arms {
+		result, err := db.runQuery(arm.plan, ctx.outer, ctx.results, -1)
+		if err != nil {
+			return nil, err
+		}
+		switch arm.op {
+		case "", "UNION ALL":
+			rows = append(rows, result.Rows...)
+		case "UNION":
+			rows = plan.distinct(append(rows, result.Rows...), nil, false)
+		case "INTERSECT":
+			rows = plan.distinct(rows, result.Rows, true)
+		case "EXCEPT":
+			rows = plan.distinct(rows, result.Rows, false)
+		}
+	}
+
+	out := make([]*outputRow, len(rows))
+	for i, values := range rows {
+		out[i] = plan.outputRow(values)
+	}
+	return out, nil
+}
+
+// distinct drops the duplicate rows, and the rows found in other unless keep
+// is set, in which case only those are kept
+func (plan *selectPlan) distinct(rows, other [][]any, keep bool) [][]any {
+	found := make(map[string]bool)
+	for _, values := range other {
+		found[rowKey(values, plan.exprs)] = true
+	}
+	seen := make(map[string]bool)
+	out := rows[:0]
+	for _, values := range rows {
+		key := rowKey(values, plan.exprs)
+		if seen[key] || found[key] != keep {
+			continue
+		}
+		seen[key] = true
+		out = append(out, values)
+	}
+	return out
+}
+
+// recursiveRows runs the SELECTs of a recursive CTE, keeping the first
+// stopAfter rows when it is not negative
+func (db *DB) recursiveRows(ctx *evalContext, plan *selectPlan, stopAfter int64) ([]*outputRow, error) {
+	out := make([]*outputRow, 0)
+	if stopAfter == 0 {
+		return out, nil
+	}
+	err := db.walkRecursive(ctx, plan, func(row *outputRow) (bool, error) {
+		out = append(out, row)
+		return stopAfter < 0 || int64(len(out)) < stopAfter, nil
+	})
+	return out, err
+}
+
+// walkRecursive runs the SELECTs of a recursive CTE, visiting its rows
+// until visit returns false. The rows of the setup SELECTs are queued, then
+// each row taken off the queue is visited and the recursive steps run with
+// the CTE holding just that row, queuing theirs. UNION queues no row twice.
+func (db *DB) walkRecursive(ctx *evalContext, plan *selectPlan, visit func(*outputRow) (bool, error)) error {
+	compare, err := db.rowComparer(plan.orderBy, plan.stmt.OrderBy)
+	if err != nil {
+		return err
+	}
+	union := plan.arms[plan.recursive].op == "UNION"
+	seen := make(map[string]bool)
+	queue := make([]*outputRow, 0)
+	run := func(arms []*compoundArm) error {
+		for _, arm := range arms {
+			result, err := db.runQuery(arm.plan, ctx.outer, ctx.results, -1)
+			if err != nil {
+				return err
+			}
+			for _, values := range result.Rows {
+				if union {
+					key := rowKey(values, plan.exprs)
+					if seen[key] {
+						continue
+					}
+					seen[key] = true
+				}
+				row := plan.outputRow(values)
+				i := len(queue)
+				if len(plan.orderBy) > 0 {
+					// After the rows it ties with, so they come off in turn
+					i, _ = slices.BinarySearchFunc(queue, row, func(a, b *outputRow) int {
+						if compare(a, b) <= 0 {
+							return -1
+						}
+						return 1
+					})
+				}
+				queue = slices.Insert(queue, i, row)
+			}
+		}
+		return nil
+	}
+
+	if err := run(plan.arms[:plan.recursive]); err != nil {
+		return err
+	}
+	for len(queue) > 0 {
+		if err := db.interrupted(); err != nil {
+			return err
+		}
+		row := queue[0]
+		queue = queue[1:]
+		if more, err := visit(row); err != nil || !more {
+			return err
+		}
+
+		// The CTE only holds the row while the steps run, since the
+		// visitor may read it afresh
+		ctx.results[plan] = &Result{Rows: [][]any{row.values}}
+		err := run(plan.arms[plan.recursive:])
+		delete(ctx.results, plan)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// outputRow pairs a row of a compound with the values it is sorted by
+func (plan *selectPlan) outputRow(values []any) *outputRow {
+	row := &outputRow{values: values, keys: make([]any, len(plan.orderCols))}
+	for i, col := range plan.orderCols {
+		row.keys[i] = values[col]
+	}
+	return row
+}
+
+// ----------------------------------------------------------------------------
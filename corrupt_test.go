@@ -0,0 +1,168 @@
+package sqlite
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/elordeiro/SQLite-DBReader/btree"
+	"github.com/elordeiro/SQLite-DBReader/pager"
+)
+
+const corruptSetup = `
+create table t(a integer primary key, b text);
+create index t_b on t(b);
+insert into t values (1, 'one'), (2, 'two'), (3, hex(zeroblob(5000)));
+create table big(a integer primary key, b text);
+insert into big with recursive n(i) as (select 1 union all select i + 1 from n where i < 200)
+select i, hex(randomblob(50)) from n;`
+
+// pageWrite is data to write at an offset of a page
+type pageWrite struct {
+	page, off int64
+	data      []byte
+}
+
+// damagePages writes over the pages of a closed database
+func damagePages(t *testing.T, path string, pageSize int64, writes ...pageWrite) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, w := range writes {
+		if _, err = f.WriteAt(w.data, (w.page-1)*pageSize+w.off); err != nil {
+			break
+		}
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// corruptLayout holds where the parts of the test database lie
+type corruptLayout struct {
+	table, index, big int64  // Root pages
+	payload           int64  // Offset of the payload of t's first cell
+	overflowPtr       int64  // Offset of the overflow pointer of t's third cell
+	overflow          int64  // First overflow page of t's third cell
+	bigCells          int    // Cells on big's interior root page
+	bigChild          uint32 // Left child of big's first cell
+}
+
+func readCorruptLayout(t *testing.T, db *DB) corruptLayout {
+	t.Helper()
+	l := corruptLayout{
+		table: db.GetTable("t").PageNum,
+		index: db.GetTable("t_b").PageNum,
+		big:   db.GetTable("big").PageNum,
+	}
+
+	page, buf, err := db.bt.LoadPage(l.table)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := db.bt.ParseCellExtent(page.Header.Type, buf, page.CellPtrs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.payload = int64(first.PayloadOff)
+	third, err := db.bt.ParseCellExtent(page.Header.Type, buf, page.CellPtrs[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if third.OverflowPage == 0 {
+		t.Fatal("the third row does not overflow")
+	}
+	l.overflowPtr = int64(third.PayloadOff + third.Local)
+	l.overflow = int64(third.OverflowPage)
+
+	page, buf, err = db.bt.LoadPage(l.big)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Header.Type != btree.InteriorTablePage {
+		t.Fatalf("big's root page has type 0x%02x", page.Header.Type)
+	}
+	l.bigCells = page.Header.CellCount
+	l.bigChild = binary.BigEndian.Uint32(buf[page.CellPtrs[0]:])
+	return l
+}
+
+// TestCorruptPages damages one page of a database at a time and checks that
+// reading it fails with a CorruptError naming the page and cell at fault
+func TestCorruptPages(t *testing.T) {
+	be16 := func(v uint16) []byte { return binary.BigEndian.AppendUint16(nil, v) }
+	be32 := func(v uint32) []byte { return binary.BigEndian.AppendUint32(nil, v) }
+
+	// Each test writes to a page and expects sql to fail at a page and cell,
+	// -1 for the whole page, both worked out from the layout
+	type fault struct {
+		page int64
+		cell int
+	}
+	tests := []struct {
+		name   string
+		damage func(l corruptLayout) pageWrite
+		sql    string
+		want   func(l corruptLayout) fault
+	}{
+		{"page type",
+			func(l corruptLayout) pageWrite { return pageWrite{l.table, 0, []byte{0x07}} },
+			"select * from t", func(l corruptLayout) fault { return fault{l.table, -1} }},
+		{"cell count",
+			func(l corruptLayout) pageWrite { return pageWrite{l.table, 3, be16(0xffff)} },
+			"select * from t", func(l corruptLayout) fault { return fault{l.table, -1} }},
+		{"cell pointer past page",
+			func(l corruptLayout) pageWrite { return pageWrite{l.table, 8 + 2, be16(0xffff)} },
+			"select * from t", func(l corruptLayout) fault { return fault{l.table, 1} }},
+		{"cell pointer into header",
+			func(l corruptLayout) pageWrite { return pageWrite{l.table, 8, be16(4)} },
+			"select * from t", func(l corruptLayout) fault { return fault{l.table, 0} }},
+		{"record header",
+			func(l corruptLayout) pageWrite { return pageWrite{l.table, l.payload, []byte{0x7f}} },
+			"select * from t", func(l corruptLayout) fault { return fault{l.table, 0} }},
+		{"overflow chain ends early",
+			func(l corruptLayout) pageWrite { return pageWrite{l.overflow, 0, be32(0)} },
+			"select length(b) from t where a = 3", func(l corruptLayout) fault { return fault{l.table, 2} }},
+		{"overflow page out of range",
+			func(l corruptLayout) pageWrite { return pageWrite{l.table, l.overflowPtr, be32(0xffffff)} },
+			"select length(b) from t where a = 3", func(l corruptLayout) fault { return fault{0xffffff, -1} }},
+		{"index page type",
+			func(l corruptLayout) pageWrite { return pageWrite{l.index, 0, []byte{0x07}} },
+			"select a from t where b = 'two'", func(l corruptLayout) fault { return fault{l.index, -1} }},
+		{"interior cell pointer",
+			func(l corruptLayout) pageWrite { return pageWrite{l.big, 12 + 2*int64(l.bigCells-1), be16(0xfff0)} },
+			"select count(*) from big", func(l corruptLayout) fault { return fault{l.big, l.bigCells - 1} }},
+		{"child page type",
+			func(l corruptLayout) pageWrite { return pageWrite{int64(l.bigChild), 0, []byte{btree.LeafIndexPage}} },
+			"select count(*) from big", func(l corruptLayout) fault { return fault{int64(l.bigChild), -1} }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTest(t, corruptSetup)
+			l := readCorruptLayout(t, db)
+			path, pageSize := db.path, db.bt.PageSize
+			db.Close()
+
+			damagePages(t, path, pageSize, tt.damage(l))
+			db, err := Open(path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			_, err = queryErr(db, tt.sql)
+			var corrupt *pager.CorruptError
+			if !errors.As(err, &corrupt) {
+				t.Fatalf("%s: got error %v, want a CorruptError", tt.sql, err)
+			}
+			if want := tt.want(l); corrupt.Page != want.page || corrupt.Cell != want.cell {
+				t.Errorf("%s: got %v, want page %d cell %d", tt.sql, err, want.page, want.cell)
+			}
+		})
+	}
+}
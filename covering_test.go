@@ -0,0 +1,73 @@
+package sqlite
+
+import (
+	"os"
+	"testing"
+)
+
+const coveringSetup = `
+create table apples(id integer primary key, color text collate nocase, weight real, grade integer, note text);
+create index apples_color on apples(color);
+create index apples_grade_weight on apples(grade desc, weight);
+create table wide(a, b, c, d, e);
+create index wide_c on wide(c);
+create index wide_cb on wide(c, b);
+insert into apples(color, weight, grade, note) values ('red', 1, 3, 'a'), ('Red', 2.5, 1, 'b'), ('green', 3, null, 'c'), (null, 4, 2, 'd'), ('RED', 5, 3, 'e'), ('yellow', null, 1, 'f');
+insert into wide values (1, 2, 3, 4, 5), (6, 7, 3, 9, 10), (11, 12, null, 14, 15);`
+
+func TestCovering(t *testing.T) {
+	runQueries(t, openTest(t, coveringSetup), []sqlTest{
+		{"equality", "select color from apples where color = 'red'", "red\nRed\nRED\n"},
+		{"equality plan", "explain query plan select color from apples where color = 'red'", "QUERY PLAN\n`--SEARCH apples USING COVERING INDEX apples_color (color=?)\n"},
+		{"rowid from index", "select id, color from apples where color = 'RED' order by id", "1|red\n2|Red\n5|RED\n"},
+		{"count", "select count(*) from apples", "6\n"},
+		{"count plan", "explain query plan select count(*) from apples", "QUERY PLAN\n`--SCAN apples USING COVERING INDEX apples_grade_weight\n"},
+		{"count smallest index", "explain query plan select count(*) from wide", "QUERY PLAN\n`--SCAN wide USING COVERING INDEX wide_c\n"},
+		{"real from index", "select grade, weight, typeof(weight) from apples where grade = 3", "3|1.0|real\n3|5.0|real\n"},
+		{"real plan", "explain query plan select grade, weight from apples where grade = 3", "QUERY PLAN\n`--SEARCH apples USING COVERING INDEX apples_grade_weight (grade=?)\n"},
+		{"desc range", "select grade, weight from apples where grade > 1 order by grade desc, weight", "3|1.0\n3|5.0\n2|4.0\n"},
+		{"nulls", "select color, count(*) from apples group by color order by color", "|1\ngreen|1\nred|3\nyellow|1\n"},
+		{"not covering", "explain query plan select color, note from apples where color = 'red'", "QUERY PLAN\n`--SEARCH apples USING INDEX apples_color (color=?)\n"},
+		{"two columns", "select c, b from wide where c = 3 order by b", "3|2\n3|7\n"},
+		{"two columns plan", "explain query plan select c, b from wide where c = 3", "QUERY PLAN\n`--SEARCH wide USING COVERING INDEX wide_cb (c=?)\n"},
+		{"aggregate", "select min(weight), max(weight), sum(weight), avg(grade) from apples where grade between 1 and 3", "1.0|5.0|12.5|2.0\n"},
+		{"join covering", "select a.grade, w.b from apples a join wide w on w.c = a.grade order by 1, 2", "3|2\n3|2\n3|7\n3|7\n"},
+		{"join covering plan", "explain query plan select a.grade, w.b from apples a join wide w on w.c = a.grade", "QUERY PLAN\n|--SCAN w USING COVERING INDEX wide_cb\n`--SEARCH a USING COVERING INDEX apples_grade_weight (grade=?)\n"},
+	})
+}
+
+// TestCoveringSkipsTable wipes the table's page and checks that queries an
+// index covers still run, since they never read it
+func TestCoveringSkipsTable(t *testing.T) {
+	db := openTest(t, coveringSetup)
+	path, page := db.path, db.GetTable("apples").PageNum
+	pageSize := db.bt.PageSize
+	db.Close()
+
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.WriteAt(make([]byte, pageSize), (int64(page)-1)*pageSize)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err = Open(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	runQueries(t, db, []sqlTest{
+		{"equality", "select color from apples where color = 'red'", "red\nRed\nRED\n"},
+		{"rowid from index", "select id, color from apples where color = 'RED' order by id", "1|red\n2|Red\n5|RED\n"},
+		{"count", "select count(*) from apples", "6\n"},
+		{"real from index", "select grade, weight, typeof(weight) from apples where grade = 3", "3|1.0|real\n3|5.0|real\n"},
+	})
+	if _, err := queryErr(db, "select note from apples where color = 'red'"); err == nil {
+		t.Error("reading the wiped table succeeded")
+	}
+}
@@ -0,0 +1,267 @@
+package sqlite
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/elordeiro/SQLite-DBReader/pager"
+)
+
+// Fault Injection ------------------------------------------------------------
+var errInjectedFault = errors.New("injected I/O fault")
+
+// faultVFS fails every write, sync, truncate and remove once the first
+// after of them have succeeded. With torn set the first failing write
+// still writes half its buffer, as a crash in the middle of it would.
+type faultVFS struct {
+	after int
+	torn  bool
+	ops   int
+}
+
+type faultFile struct {
+	pager.File
+	vfs *faultVFS
+}
+
+func (v *faultVFS) OpenFile(name string, flag int, perm os.FileMode) (pager.File, error) {
+	file, err := pager.DefaultOptions().GetVFS().OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return &faultFile{File: file, vfs: v}, nil
+}
+
+func (v *faultVFS) Remove(name string) error {
+	if err := v.fault(nil); err != nil {
+		return err
+	}
+	return os.Remove(name)
+}
+
+// fault counts an operation and reports whether it must fail. The first
+// failure runs torn when the VFS tears writes.
+func (v *faultVFS) fault(torn func()) error {
+	v.ops++
+	if v.ops <= v.after {
+		return nil
+	}
+	if v.torn && v.ops == v.after+1 && torn != nil {
+		torn()
+	}
+	return errInjectedFault
+}
+
+func (f *faultFile) WriteAt(buf []byte, off int64) (int, error) {
+	err := f.vfs.fault(func() {
+		f.File.WriteAt(buf[:len(buf)/2], off)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return f.File.WriteAt(buf, off)
+}
+
+func (f *faultFile) Sync() error {
+	if err := f.vfs.fault(nil); err != nil {
+		return err
+	}
+	return f.File.Sync()
+}
+
+func (f *faultFile) Truncate(size int64) error {
+	if err := f.vfs.fault(nil); err != nil {
+		return err
+	}
+	return f.File.Truncate(size)
+}
+
+// ----------------------------------------------------------------------------
+
+// Crash Test -----------------------------------------------------------------
+const crashSetup = `
+CREATE TABLE apples(id INTEGER PRIMARY KEY, name TEXT, color TEXT);
+INSERT INTO apples
+WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n WHERE i < 150)
+SELECT i, 'apple ' || i || ' ' || hex(zeroblob(40)), iif(i % 3, 'red', 'green') FROM n;
+CREATE INDEX apples_name ON apples(name);
+`
+
+// crashDump returns the rows of apples and the names in the schema
+func crashDump(db *DB) (string, error) {
+	rows, err := queryErr(db, "SELECT * FROM apples ORDER BY id")
+	return rows + strings.Join(db.GetTableNames(), "\n"), err
+}
+
+// TestCrash runs transactions while failing each write, sync, truncate and
+// remove in turn, and checks that reopening the database finds it intact
+// and as it was either before or after the transaction
+func TestCrash(t *testing.T) {
+	tests := []struct {
+		name string
+		sql  string
+	}{
+		{"delete", "BEGIN; DELETE FROM apples WHERE id % 4 = 0; COMMIT;"},
+		{"insert", "INSERT INTO apples SELECT id + 1000, name || ' again', color FROM apples"},
+		{"update", "UPDATE apples SET name = upper(name) WHERE color = 'green'"},
+		{"create index", "CREATE INDEX apples_color ON apples(color)"},
+		{"drop", "BEGIN; DROP INDEX apples_name; DELETE FROM apples WHERE id > 100; COMMIT;"},
+		{"vacuum", "DELETE FROM apples WHERE id > 50; VACUUM;"},
+	}
+
+	base := openTest(t, crashSetup)
+	base.Close()
+	basePath := base.path
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "outcome.db")
+			copyFile(t, basePath, path)
+			before, after := crashOutcomes(t, path, tt.sql)
+			if before == after {
+				t.Fatal("the transaction does not change the database")
+			}
+
+			for _, torn := range []bool{false, true} {
+				for n := 0; ; n++ {
+					path := filepath.Join(dir, fmt.Sprintf("fault-%v-%d.db", torn, n))
+					copyFile(t, basePath, path)
+					db, err := Open(path, &Options{VFS: &faultVFS{after: n, torn: torn}})
+					if err != nil {
+						t.Fatal(err)
+					}
+					_, err = db.Execute(tt.sql)
+					db.Close()
+					if err == nil {
+						break
+					}
+					if !errors.Is(err, errInjectedFault) {
+						t.Fatalf("fault %d: %v", n, err)
+					}
+					if err := crashVerify(path, before, after); err != nil {
+						t.Errorf("torn %v, fault %d: %v", torn, n, err)
+					}
+				}
+			}
+		})
+	}
+}
+
+// TestCrashSqlite3 leaves the journals of failed transactions for sqlite3
+// to roll back, checking that it reads them the way it reads its own
+func TestCrashSqlite3(t *testing.T) {
+	const sql = "BEGIN; DELETE FROM apples WHERE id % 4 = 0; UPDATE apples SET name = lower(name); COMMIT;"
+	const check = "SELECT count(*), sum(length(name)) FROM apples; PRAGMA integrity_check"
+
+	base := openTest(t, crashSetup)
+	base.Close()
+	dir := t.TempDir()
+	outcomes := make(map[string]bool)
+	for _, run := range []bool{false, true} {
+		path := filepath.Join(dir, fmt.Sprintf("outcome-%v.db", run))
+		copyFile(t, base.path, path)
+		if run {
+			crashOutcomes(t, path, sql)
+		}
+		out, err := sqlite3Command(t, path, check).CombinedOutput()
+		if err != nil {
+			t.Fatalf("%v: %s", err, out)
+		}
+		outcomes[string(out)] = true
+	}
+
+	for n := 0; ; n++ {
+		path := filepath.Join(dir, fmt.Sprintf("fault-%d.db", n))
+		copyFile(t, base.path, path)
+		db, err := Open(path, &Options{VFS: &faultVFS{after: n, torn: true}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = db.Execute(sql)
+		db.Close()
+		if err == nil {
+			break
+		}
+		out, err := sqlite3Command(t, path, check).CombinedOutput()
+		if err != nil || !outcomes[string(out)] {
+			t.Errorf("fault %d: %v\n%s", n, err, out)
+		}
+	}
+}
+
+// crashOutcomes returns the dump of the database at path before and after
+// running sql
+func crashOutcomes(t *testing.T, path, sql string) (string, string) {
+	db, err := Open(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	before, err := crashDump(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query(t, db, sql)
+	after, err := crashDump(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return before, after
+}
+
+// crashVerify reopens a database left by a failed transaction and checks
+// that it is intact and in one of the two states
+func crashVerify(path, before, after string) error {
+	db, err := Open(path, nil)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	got, err := crashDump(db)
+	if err != nil {
+		return err
+	}
+	if got != before && got != after {
+		return errors.New("partial transaction")
+	}
+	// An empty journal is not hot, sqlite3 leaves it too
+	if info, err := os.Stat(path + "-journal"); err == nil && info.Size() > 0 {
+		return errors.New("the hot journal was not deleted")
+	}
+	problems, err := db.IntegrityCheck()
+	if err != nil {
+		return err
+	}
+	if len(problems) != 1 || problems[0] != "ok" {
+		return fmt.Errorf("integrity check: %v", problems)
+	}
+	return nil
+}
+
+// ----------------------------------------------------------------------------
+
+func copyFile(t *testing.T, src, dst string) {
+	t.Helper()
+	in, err := os.Open(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		t.Fatal(err)
+	}
+	if err := out.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,268 @@
+package sqlite
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/elordeiro/SQLite-DBReader/btree"
+	"github.com/elordeiro/SQLite-DBReader/parser"
+	"github.com/elordeiro/SQLite-DBReader/record"
+)
+
+// CREATE TABLE ---------------------------------------------------------------
+func (db *DB) execCreateTable(stmt *parser.CreateTableStatement) (*Result, error) {
+	if err := checkObjectName(stmt.Name); err != nil {
+		return nil, err
+	}
+	if existing := db.GetTable(stmt.Name); existing != nil {
+		switch existing.Type {
+		case TableTypeIndex:
+			return nil, fmt.Errorf("there is already an index named %s", stmt.Name)
+		case TableTypeTable, TableTypeView:
+			if stmt.IfNotExists {
+				return &Result{}, nil
+			}
+			kind := "table"
+			if existing.Type == TableTypeView {
+				kind = "view"
+			}
+			return nil, fmt.Errorf("%s %s already exists", kind, stmt.Name)
+		}
+	}
+	if stmt.WithoutRowID {
+		return nil, fmt.Errorf("WITHOUT ROWID tables are not supported: %s", stmt.Name)
+	}
+
+	table := &Table{Type: TableTypeTable, Name: stmt.Name, TblName: stmt.Name, SQL: stmt.SQL}
+	if err := table.parseTableSchema(); err != nil {
+		return nil, err
+	}
+	if err := checkColumns(table, stmt); err != nil {
+		return nil, err
+	}
+
+	root, err := db.bt.CreateTree(btree.LeafTablePage)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.insertSchemaRow("table", table.Name, table.Name, root, table.SQL); err != nil {
+		return nil, err
+	}
+
+	// PRIMARY KEY and UNIQUE constraints get automatic indexes
+	for i := range table.uniqueConstraints {
+		root, err := db.bt.CreateTree(btree.LeafIndexPage)
+		if err != nil {
+			return nil, err
+		}
+		name := fmt.Sprintf("sqlite_autoindex_%s_%d", table.Name, i+1)
+		if err := db.insertSchemaRow("index", name, table.Name, root, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	if table.Autoincrement && db.GetTable("sqlite_sequence") == nil {
+		root, err := db.bt.CreateTree(btree.LeafTablePage)
+		if err != nil {
+			return nil, err
+		}
+		err = db.insertSchemaRow("table", "sqlite_sequence", "sqlite_sequence", root, "CREATE TABLE sqlite_sequence(name,seq)")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &Result{}, db.schemaChanged()
+}
+
+// checkColumns rejects column definitions SQLite refuses to create a table
+// with
+func checkColumns(table *Table, stmt *parser.CreateTableStatement) error {
+	for i, col := range table.Columns {
+		for _, other := range table.Columns[:i] {
+			if strings.EqualFold(col.Name, other.Name) {
+				return fmt.Errorf("duplicate column name: %s", col.Name)
+			}
+		}
+	}
+
+	primaryKeys, autoincrement := 0, false
+	for _, def := range stmt.Columns {
+		if def.PrimaryKey {
+			primaryKeys++
+		}
+		autoincrement = autoincrement || def.Autoincrement
+	}
+	for _, constraint := range stmt.Constraints {
+		if constraint.PrimaryKey {
+			primaryKeys++
+			autoincrement = autoincrement || constraint.Columns[0].Autoincrement
+		}
+	}
+	if primaryKeys > 1 {
+		return fmt.Errorf("table \"%s\" has more than one primary key", table.Name)
+	}
+	if autoincrement && !table.Autoincrement {
+		return errors.New("AUTOINCREMENT is only allowed on an INTEGER PRIMARY KEY")
+	}
+	return nil
+}
+
+// ----------------------------------------------------------------------------
+
+// CREATE INDEX ---------------------------------------------------------------
+func (db *DB) execCreateIndex(stmt *parser.CreateIndexStatement) (*Result, error) {
+	if err := checkObjectName(stmt.Name); err != nil {
+		return nil, err
+	}
+	table := db.GetTable(stmt.Table)
+	if table == nil || table.Type == TableTypeIndex || table.Type == TableTypeTrigger {
+		return nil, fmt.Errorf("%w: main.%s", ErrNotFound, stmt.Table)
+	}
+	switch {
+	case strings.HasPrefix(strings.ToLower(table.Name), "sqlite_"):
+		return nil, fmt.Errorf("table %s may not be indexed", table.Name)
+	case table.Type == TableTypeView:
+		return nil, errors.New("views may not be indexed")
+	case table.Virtual:
+		return nil, errors.New("virtual tables may not be indexed")
+	case table.WithoutRowID:
+		return nil, fmt.Errorf("WITHOUT ROWID tables are not supported: %s", table.Name)
+	}
+
+	if existing := db.GetTable(stmt.Name); existing != nil {
+		switch {
+		case existing.Type != TableTypeIndex:
+			return nil, fmt.Errorf("there is already a table named %s", stmt.Name)
+		case stmt.IfNotExists:
+			return &Result{}, nil
+		default:
+			return nil, fmt.Errorf("index %s already exists", stmt.Name)
+		}
+	}
+
+	index := &Table{Type: TableTypeIndex, Name: stmt.Name, TblName: table.Name, SQL: stmt.SQL, RowIDAlias: -1}
+	if err := db.parseIndexSchema(index); err != nil {
+		return nil, err
+	}
+
+	root, err := db.bt.CreateTree(btree.LeafIndexPage)
+	if err != nil {
+		return nil, err
+	}
+	index.PageNum = root
+	if err := db.insertSchemaRow("index", index.Name, table.Name, root, index.SQL); err != nil {
+		return nil, err
+	}
+	if err := db.buildIndex(table, index); err != nil {
+		return nil, err
+	}
+
+	return &Result{}, db.schemaChanged()
+}
+
+// buildIndex fills a new index with the entries of every row of its table.
+// The entries are sorted first and loaded into the b-tree in one pass.
+func (db *DB) buildIndex(table, index *Table) error {
+	colls, desc, err := db.IndexKeyOrder(index)
+	if err != nil {
+		return err
+	}
+
+	keys := make([][]any, 0)
+	c := db.bt.NewCursor(table.PageNum)
+	ok, err := c.First()
+	for ; ok && err == nil; ok, err = c.Next() {
+		row, err := db.tableRow(table, c.Cell())
+		if err != nil {
+			return err
+		}
+		key, err := db.indexKey(index, row)
+		if err != nil {
+			return err
+		}
+		if len(key) > 0 {
+			keys = append(keys, key)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	slices.SortFunc(keys, func(a, b []any) int {
+		return compareKeys(a, b, colls, desc)
+	})
+
+	i := 0
+	return db.bt.LoadTree(index.PageNum, btree.LeafIndexPage, func() ([]byte, error) {
+		if i == len(keys) {
+			return nil, nil
+		}
+		if i > 0 && index.Unique && duplicateKeys(keys[i-1], keys[i], colls, desc) {
+			return nil, uniqueError(table, index)
+		}
+		i++
+		return db.bt.BuildCell(btree.LeafIndexPage, 0, db.bt.MakeRecord(keys[i-1]))
+	})
+}
+
+// duplicateKeys reports whether two index entries have the same indexed
+// values, none of them NULL
+func duplicateKeys(a, b []any, colls []record.Collation, desc []bool) bool {
+	n := len(a) - 1
+	if slices.Contains(a[:n], nil) {
+		return false
+	}
+	return compareKeys(a[:n], b[:n], colls, desc) == 0
+}
+
+// ----------------------------------------------------------------------------
+
+// Schema Table ---------------------------------------------------------------
+// checkObjectName rejects names in the sqlite_ namespace
+func checkObjectName(name string) error {
+	if strings.HasPrefix(strings.ToLower(name), "sqlite_") {
+		return fmt.Errorf("object name reserved for internal use: %s", name)
+	}
+	return nil
+}
+
+// insertSchemaRow records a new object in sqlite_schema
+func (db *DB) insertSchemaRow(kind, name, tblName string, root int64, sql any) error {
+	schema := &Table{Name: "sqlite_schema", PageNum: 1}
+	rowID, err := db.newRowID(schema)
+	if err != nil {
+		return err
+	}
+	record := db.bt.MakeRecord([]any{kind, name, tblName, root, sql})
+	return db.bt.InsertRow(schema.PageNum, rowID, record)
+}
+
+// schemaChanged bumps the schema cookie, telling other connections to
+// reread the schema, and rereads it
+func (db *DB) schemaChanged() error {
+	header, err := db.bt.Pager.WritablePage(1)
+	if err != nil {
+		return err
+	}
+	cookie := binary.BigEndian.Uint32(header[40:]) + 1
+	binary.BigEndian.PutUint32(header[40:], cookie)
+	return db.reloadSchema()
+}
+
+// reloadSchema rereads sqlite_schema, keeping the old schema on failure
+func (db *DB) reloadSchema() error {
+	tables := db.tables
+	var err error
+	if db.tables, err = db.ParseSQLiteSchema(); err != nil {
+		db.tables = tables
+		return err
+	}
+	db.schemaVersion++
+	return nil
+}
+
+// ----------------------------------------------------------------------------
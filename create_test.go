@@ -0,0 +1,155 @@
+package sqlite
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCreate(t *testing.T) {
+	runSQLTests(t, "create table t(a integer primary key, b text, c); insert into t values (1, 'x', 3), (2, 'y', 1), (3, 'x', 2)", []sqlTest{
+		{"create table", `create table u(id integer primary key autoincrement, name text not null default 'n', unique(name));
+insert into u(name) values ('a'), ('b');
+select * from u`, "1|a\n2|b\n"},
+		{"create if not exists", `create table if not exists t(z);
+select count(*) from t`, "3\n"},
+		{"create index on existing rows", `create index t_b on t(b, c);
+select a from t where b = 'x' order by c`, "3\n1\n"},
+		{"unique index", `create unique index t_c on t(c);
+select c from t where c = 2`, "2\n"},
+		{"partial index", `create index t_p on t(c) where b = 'x';
+select a from t where b = 'x' and c > 2`, "1\n"},
+		{"index desc", `create index t_cd on t(c desc);
+select c from t order by c desc`, "3\n2\n1\n"},
+		{"index collate", `create table u(s text);
+insert into u values ('b'), ('A'), ('a'), ('B');
+create index u_s on u(s collate nocase);
+select s from u where s = 'a' collate nocase order by s`, "A\na\n"},
+		{"drop table", `create table u(x);
+insert into u values (1);
+drop table u;
+create table u(y);
+select count(*) from u`, "0\n"},
+		{"drop table with index", `create index t_b on t(b);
+drop table t;
+create table t(q);
+select count(*) from t`, "0\n"},
+		{"drop index", `create index t_b on t(b);
+drop index t_b;
+select a from t where b = 'y'`, "2\n"},
+		{"drop if exists", `drop table if exists nope;
+drop index if exists nope;
+drop view if exists nope;
+select count(*) from t`, "3\n"},
+		{"autoincrement after delete", `create table u(id integer primary key autoincrement, x);
+insert into u(x) values (1), (2);
+delete from u where id = 2;
+insert into u(x) values (3);
+select id from u`, "1\n3\n"},
+	})
+}
+
+func TestCreateErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		sql  string
+		err  string
+	}{
+		{"table exists", "create table x(a); create table x(b)", "table x already exists"},
+		{"index exists", "create table x(a); create index i on x(a); create index i on x(a)", "index i already exists"},
+		{"index no such table", "create index i on nope(a)", "no such table: main.nope"},
+		{"index no such column", "create table x(a); create index i on x(nope)", "no such column: nope"},
+		{"duplicate column", "create table x(a, a)", "duplicate column name: a"},
+		{"reserved name", "create table sqlite_x(a)", "object name reserved for internal use: sqlite_x"},
+		{"unique index on duplicates", "create table x(a); insert into x values (1), (1); create unique index i on x(a)", "UNIQUE constraint failed: x.a"},
+		{"create table as", "create table x as select 1", "CREATE TABLE ... AS SELECT is not supported"},
+		{"without rowid", "create table x(a primary key) without rowid", "WITHOUT ROWID tables are not supported: x"},
+		{"drop no such table", "drop table nope", "no such table: nope"},
+		{"drop no such index", "drop index nope", "no such index: nope"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTest(t, "")
+			if _, err := queryErr(db, tt.sql); err == nil || err.Error() != tt.err {
+				t.Errorf("got error %v, want %s", err, tt.err)
+			}
+		})
+	}
+}
+
+// TestDropFreesPages checks that every page of a dropped table and its
+// indexes goes onto the freelist, and is used again by the next table
+func TestDropFreesPages(t *testing.T) {
+	db := openTest(t, "create table t(a integer primary key, b text); create index t_b on t(b); "+
+		"insert into t with recursive n(i) as (select 1 union all select i + 1 from n where i < 1000) "+
+		"select i, hex(zeroblob(i % 50 * 100)) from n")
+	pageCount := db.bt.Pager.PageCount()
+
+	query(t, db, "drop table t")
+	checkIntegrity(t, db)
+	trunks, err := db.Freelist()
+	if err != nil {
+		t.Fatal(err)
+	}
+	free := int64(len(trunks))
+	for _, trunk := range trunks {
+		free += int64(len(trunk.Leaves))
+	}
+	if free != pageCount-1 {
+		t.Errorf("%d of %d pages freed", free, pageCount-1)
+	}
+
+	query(t, db, "create table u(a); insert into u select hex(zeroblob(1000)) from (select 1 union all select 2)")
+	if db.bt.Pager.PageCount() != pageCount {
+		t.Errorf("page count grew from %d to %d", pageCount, db.bt.Pager.PageCount())
+	}
+	checkIntegrity(t, db)
+}
+
+// TestCreateSchemaChange checks that a sqlite3 process with the database
+// open sees tables created and dropped after it read the schema
+func TestCreateSchemaChange(t *testing.T) {
+	db := openTest(t, "create table t(a); insert into t values (1)")
+	sh := startSqlite3(t, db.path)
+	if got := sh.run(t, "select a from t"); got != "1\n" {
+		t.Fatalf("got %q", got)
+	}
+
+	query(t, db, "create table u(b); insert into u values (2); create index t_a on t(a)")
+	if got := sh.run(t, "select b from u; select name from sqlite_schema where type = 'index'"); got != "2\nt_a\n" {
+		t.Errorf("after create: got %q", got)
+	}
+	query(t, db, "drop table t")
+	if got := sh.run(t, "select name from sqlite_schema"); got != "u\n" {
+		t.Errorf("after drop: got %q", got)
+	}
+	checkIntegrity(t, db)
+}
+
+// TestCreateMissingFile checks that opening a missing database only creates
+// its file once something is written to it
+func TestCreateMissingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing.db")
+	db, err := Open(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for _, sql := range []string{"select 1", "drop table if exists t", "vacuum"} {
+		query(t, db, sql)
+	}
+	if _, err := db.IntegrityCheck(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("reading created the file: %v", err)
+	}
+
+	query(t, db, "create table t(a); insert into t values (1)")
+	if got := query(t, db, "select a from t"); got != "1\n" {
+		t.Errorf("got %q", got)
+	}
+	checkIntegrity(t, db)
+}
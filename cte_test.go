@@ -0,0 +1,46 @@
+package sqlite
+
+import "testing"
+
+const cteSetup = `
+create table emp(id integer primary key, name text, boss integer, salary integer);
+create table cat(id integer primary key, parent integer, label text);
+insert into emp values (1, 'ada', null, 300), (2, 'bob', 1, 200), (3, 'cy', 1, 180), (4, 'di', 2, 120), (5, 'ed', 2, 110), (6, 'flo', 3, 100), (7, 'gus', 6, 90);
+insert into cat values (1, null, 'root'), (2, 1, 'books'), (3, 1, 'music'), (4, 2, 'fiction'), (5, 2, 'poetry'), (6, 4, 'crime'), (7, 3, 'jazz');`
+
+func TestCTEs(t *testing.T) {
+	runQueries(t, openTest(t, cteSetup), []sqlTest{
+		{"plain", "with rich as (select name, salary from emp where salary > 150) select name from rich order by salary desc", "ada\nbob\ncy\n"},
+		{"column names", "with r(n, s) as (select name, salary from emp where boss = 1) select n, s from r order by n", "bob|200\ncy|180\n"},
+		{"used twice", "with s as (select boss, sum(salary) as total from emp group by boss) select a.boss, a.total, b.total from s a join s b on b.boss = a.boss + 1 order by a.boss", "1|380|230\n2|230|100\n"},
+		{"chained", "with a as (select id, boss from emp where boss is not null), b as (select boss, count(*) as n from a group by boss) select boss, n from b order by n desc, boss", "1|2\n2|2\n3|1\n6|1\n"},
+		{"materialized", "with m as materialized (select id, name from emp where salary < 150) select name from m where id > 4 order by name", "ed\nflo\ngus\n"},
+		{"not materialized", "with m as not materialized (select id, name from emp where salary < 150) select count(*) from m", "4\n"},
+		{"in subquery", "select name from emp where id in (with b as (select boss from emp) select boss from b) order by id", "ada\nbob\ncy\nflo\n"},
+		{"later name", "with a as (select * from b), b as (select * from c), c as (select 3 as z) select * from a", "3\n"},
+		{"shadows table", "with emp as (select 1 as id) select * from emp", "1\n"},
+		{"counter", "with recursive c(i) as (select 1 union all select i + 1 from c where i < 5) select group_concat(i, ',') from c", "1,2,3,4,5\n"},
+		{"org chart", "with recursive chain(id, name, depth) as (select id, name, 0 from emp where boss is null union all select e.id, e.name, depth + 1 from emp e join chain on e.boss = chain.id) select name, depth from chain order by depth, name", "ada|0\nbob|1\ncy|1\ndi|2\ned|2\nflo|2\ngus|3\n"},
+		{"reports of", "with recursive sub(id) as (select 2 union all select emp.id from emp join sub on emp.boss = sub.id) select sum(salary) from emp where id in (select id from sub)", "430\n"},
+		{"path to root", "with recursive up(id, parent, path) as (select id, parent, label from cat where label = 'crime' union all select cat.id, cat.parent, cat.label || '/' || up.path from cat join up on cat.id = up.parent) select path from up where parent is null", "root/books/fiction/crime\n"},
+		{"category paths", "with recursive tree(id, path) as (select id, label from cat where parent is null union all select cat.id, tree.path || '/' || cat.label from cat join tree on cat.parent = tree.id) select path from tree order by path", "root\nroot/books\nroot/books/fiction\nroot/books/fiction/crime\nroot/books/poetry\nroot/music\nroot/music/jazz\n"},
+		{"union dedup", "with recursive c(i) as (select 1 union select i % 3 + 1 from c) select i from c order by i", "1\n2\n3\n"},
+		{"limit stops unbounded", "with recursive c(i) as (select 1 union all select i + 1 from c) select i from c limit 4", "1\n2\n3\n4\n"},
+		{"limit offset", "with recursive c(i) as (select 1 union all select i * 2 from c) select i from c limit 3 offset 5", "32\n64\n128\n"},
+		{"limit in cte", "with recursive c(i) as (select 1 union all select i + 1 from c limit 6) select sum(i) from c", "21\n"},
+		{"fibonacci", "with recursive fib(a, b) as (select 0, 1 union all select b, a + b from fib where b < 100) select group_concat(a, ' ') from fib", "0 1 1 2 3 5 8 13 21 34 55 89\n"},
+		{"depth first", "with recursive t(id, label, lvl) as (select id, label, 0 from cat where parent is null union all select cat.id, cat.label, lvl + 1 from cat join t on cat.parent = t.id order by 3 desc) select lvl, label from t", "0|root\n1|books\n2|fiction\n3|crime\n2|poetry\n1|music\n2|jazz\n"},
+		{"breadth first", "with recursive t(id, label, lvl) as (select id, label, 0 from cat where parent is null union all select cat.id, cat.label, lvl + 1 from cat join t on cat.parent = t.id order by 3) select lvl, label from t", "0|root\n1|books\n1|music\n2|fiction\n2|poetry\n2|jazz\n3|crime\n"},
+	})
+}
+
+func TestCTEErrors(t *testing.T) {
+	runSQLErrors(t, openTest(t, cteSetup), []sqlError{
+		{"with a as (select * from b), b as (select * from a) select * from a", "circular reference: a"},
+		{"with recursive c(i) as (select 1 union all select c.i from c, c as d) select * from c", "multiple references to recursive table: c"},
+		{"with c(i, j) as (select 1) select * from c", "table c has 1 values for 2 columns"},
+		{"with recursive c(i) as (select i from c) select * from c", "circular reference: c"},
+		{"with recursive c(i) as (select 1 union all select i + 1 from (select i from c) where i < 3) select * from c", "circular reference: c"},
+		{"with recursive c(i) as (select 1 union all select i + 1 from c where i < 3 and i in (select i from c)) select * from c", "multiple recursive references: c"},
+	})
+}
@@ -0,0 +1,40 @@
+package sqlite
+
+import (
+	"github.com/elordeiro/SQLite-DBReader/pager"
+	"github.com/elordeiro/SQLite-DBReader/parser"
+)
+
+// DELETE ---------------------------------------------------------------------
+func (db *DB) execDelete(stmt *parser.DeleteStatement) (*Result, error) {
+	src, err := db.targetSource(stmt.Table, stmt.Alias)
+	if err != nil {
+		return nil, err
+	}
+	table := src.table
+
+	rowIDs, err := db.matchingRowIDs(src, stmt.Where)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{}
+	indexes := db.GetIndexes(table)
+	for _, rowID := range rowIDs {
+		row, err := db.fetchRow(table, rowID)
+		if err != nil {
+			return nil, err
+		}
+		if row == nil {
+			return nil, pager.CorruptPage(table.PageNum, "row %d disappeared", rowID)
+		}
+		if err := db.deleteRow(table, indexes, row); err != nil {
+			return nil, err
+		}
+		result.RowsAffected++
+	}
+	db.changes = result.RowsAffected
+	return result, nil
+}
+
+// ----------------------------------------------------------------------------
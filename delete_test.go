@@ -0,0 +1,79 @@
+package sqlite
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestDelete(t *testing.T) {
+	runSQLTests(t, updateSetup, []sqlTest{
+		{"delete where", `delete from t where qty = 3;
+select * from t`, "1|apple|5\n3|cherry|7\n5|elder|\n"},
+		{"delete index", `delete from t where name >= 'c';
+select name from t order by name`, "apple\nbanana\n"},
+		{"delete index lookup", `delete from t where id = 3;
+select id from t where qty = 7`, ""},
+		{"delete all", `delete from t;
+select count(*) from t`, "0\n"},
+		{"delete subquery", `delete from t where qty < (select avg(qty) from t);
+select id from t order by id`, "1\n3\n5\n"},
+		{"delete then insert", `delete from t where id = 5;
+insert into t(name) values ('fig');
+select id, name from t where id > 3`, "4|date\n5|fig\n"},
+	})
+}
+
+// TestDeleteMerges deletes rows in patterns that leave pages underfull, so
+// that they are merged with or share cells with their siblings. Pages must
+// never be left empty and freed pages must all reach the freelist.
+func TestDeleteMerges(t *testing.T) {
+	tests := []struct {
+		name  string
+		where string
+		want  string
+	}{
+		{"every other row", "id % 2 = 0", "750|562500\n"},
+		{"leading range", "id <= 1400", "100|145050\n"},
+		{"trailing range", "id > 100", "100|5050\n"},
+		{"middle range", "id between 300 and 1200", "599|450000\n"},
+		{"all but edges", "id between 2 and 1499", "2|1501\n"},
+		{"indexed", "name < 'name 1000'", "501|626250\n"},
+		{"all", "1", "0|\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTest(t, "create table t(id integer primary key, name text, pad text); create index t_name on t(name)")
+			query(t, db, "insert into t with recursive n(i) as (select 1 union all select i + 1 from n where i < 1500) "+
+				"select i, 'name ' || substr('000' || i, -4), replace(zeroblob(i % 300), x'00', 'x') from n")
+			query(t, db, "delete from t where "+tt.where)
+			if got := query(t, db, "select count(*), sum(id) from t"); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			checkIntegrity(t, db)
+			checkNoEmptyPages(t, db)
+		})
+	}
+}
+
+// checkNoEmptyPages fails the test if a page other than a root holds no cells
+func checkNoEmptyPages(t *testing.T, db *DB) {
+	t.Helper()
+	roots := map[int64]bool{1: true}
+	for _, table := range db.Schema() {
+		roots[table.PageNum] = true
+	}
+	pages, err := db.PageUsage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var empty []string
+	for _, page := range pages {
+		if (page.Type == PageTypeLeaf || page.Type == PageTypeInternal) && page.Cells == 0 && !roots[page.PageNum] {
+			empty = append(empty, fmt.Sprintf("%d (%s)", page.PageNum, page.Owner))
+		}
+	}
+	if len(empty) > 0 {
+		t.Errorf("empty pages: %s", strings.Join(empty, ", "))
+	}
+}
@@ -0,0 +1,144 @@
+package sqlite
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/elordeiro/SQLite-DBReader/parser"
+)
+
+// DROP -----------------------------------------------------------------------
+func (db *DB) execDrop(stmt *parser.DropStatement) (*Result, error) {
+	// Tables and views share a namespace, indexes and triggers have their own
+	namespace := func(kind string) string {
+		if kind == "view" {
+			return "table"
+		}
+		return kind
+	}
+
+	kind := strings.ToLower(stmt.Kind)
+	obj := db.GetTable(stmt.Name)
+	if obj == nil || namespace(objectKind(obj)) != namespace(kind) {
+		if stmt.IfExists {
+			return &Result{}, nil
+		}
+		return nil, fmt.Errorf("no such %s: %s", kind, stmt.Name)
+	}
+	if objectKind(obj) != kind {
+		return nil, fmt.Errorf("use DROP %s to delete %s %s", strings.ToUpper(objectKind(obj)), objectKind(obj), obj.Name)
+	}
+
+	var err error
+	switch obj.Type {
+	case TableTypeTable:
+		err = db.dropTable(obj)
+	case TableTypeIndex:
+		err = db.dropIndex(obj)
+	default:
+		err = db.deleteMatchingRows(1, SchemaNameIdx, obj.Name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Result{}, db.schemaChanged()
+}
+
+func objectKind(obj *Table) string {
+	switch obj.Type {
+	case TableTypeIndex:
+		return "index"
+	case TableTypeView:
+		return "view"
+	case TableTypeTrigger:
+		return "trigger"
+	default:
+		return "table"
+	}
+}
+
+// dropTable frees the pages of a table and its indexes and removes them,
+// along with the table's triggers, from the schema
+func (db *DB) dropTable(table *Table) error {
+	name := strings.ToLower(table.Name)
+	if strings.HasPrefix(name, "sqlite_") && !strings.HasPrefix(name, "sqlite_stat") {
+		return fmt.Errorf("table %s may not be dropped", table.Name)
+	}
+	if table.Virtual {
+		return fmt.Errorf("virtual tables are not supported: %s", table.Name)
+	}
+
+	for _, index := range db.GetIndexes(table) {
+		if err := db.bt.FreeTree(index.PageNum); err != nil {
+			return err
+		}
+	}
+	if err := db.bt.FreeTree(table.PageNum); err != nil {
+		return err
+	}
+
+	if err := db.deleteMatchingRows(1, SchemaTblNameIdx, table.Name); err != nil {
+		return err
+	}
+	if seq := db.GetTable("sqlite_sequence"); seq != nil && table.Autoincrement {
+		if err := db.deleteMatchingRows(seq.PageNum, 0, table.Name); err != nil {
+			return err
+		}
+	}
+	return db.deleteStatRows(0, table.Name)
+}
+
+func (db *DB) dropIndex(index *Table) error {
+	if index.SQL == "" {
+		return errors.New("index associated with UNIQUE or PRIMARY KEY constraint cannot be dropped")
+	}
+	if err := db.bt.FreeTree(index.PageNum); err != nil {
+		return err
+	}
+	if err := db.deleteMatchingRows(1, SchemaNameIdx, index.Name); err != nil {
+		return err
+	}
+	return db.deleteStatRows(1, index.Name)
+}
+
+// deleteStatRows removes the statistics gathered by ANALYZE for a table,
+// matched on column 0 of the sqlite_stat tables, or for an index, column 1
+func (db *DB) deleteStatRows(col int, name string) error {
+	for _, stat := range []string{"sqlite_stat1", "sqlite_stat2", "sqlite_stat3", "sqlite_stat4"} {
+		table := db.GetTable(stat)
+		if table == nil || table.Type != TableTypeTable {
+			continue
+		}
+		if err := db.deleteMatchingRows(table.PageNum, col, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteMatchingRows removes the rows of a table b-tree whose column col
+// holds name, compared case-insensitively
+func (db *DB) deleteMatchingRows(root int64, col int, name string) error {
+	rowIDs := make([]int64, 0)
+	c := db.bt.NewCursor(root)
+	ok, err := c.First()
+	for ; ok && err == nil; ok, err = c.Next() {
+		value, _ := c.Cell().Record.Value(col).(string)
+		if strings.EqualFold(value, name) {
+			rowIDs = append(rowIDs, int64(c.Cell().RowID))
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, rowID := range rowIDs {
+		if err := db.bt.DeleteRow(root, rowID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ----------------------------------------------------------------------------
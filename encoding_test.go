@@ -0,0 +1,93 @@
+package sqlite
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const encodingSetup = `create table "tëxt"(a integer primary key, b text, c);
+create index "tëxt_b" on "tëxt"(b);
+insert into "tëxt" values (1, 'plain', 'x'), (2, 'café', 'é'), (3, '日本語', '語'),
+	(4, 'emoji 😀', ''), (5, 'Zebra', null), (6, 'Ābc', 'ā');`
+
+// encodingWrites changes the database in ways that encode new text
+const encodingWrites = `insert into "tëxt" values (7, 'ñandú 🦙', 'ü');
+update "tëxt" set c = 'ünïcode' where a = 1;
+delete from "tëxt" where a = 3`
+
+// TestUTF16 reads and writes databases that sqlite3 created in UTF-16,
+// comparing with sqlite3's output. Text sorts by its encoded bytes, so the
+// two byte orders put U+0100 in different places.
+func TestUTF16(t *testing.T) {
+	tests := []struct {
+		encoding string
+		queries  []sqlTest
+		written  string // sqlite3's view after encodingWrites
+	}{
+		{"UTF-16le", []sqlTest{
+			{"order by", `select b from "tëxt" order by b`, "Ābc\nZebra\ncafé\nemoji 😀\nplain\n日本語\n"},
+			{"index range", `select a from "tëxt" where b > 'b' order by b`, "2\n4\n1\n3\n"},
+			{"max min", `select max(b), min(b) from "tëxt"`, "日本語|Ābc\n"},
+			{"hex", `select length(b), upper(b), hex(b) from "tëxt" where a = 2`, "4|CAFé|630061006600E900\n"},
+			{"surrogate pair", `select hex(b) from "tëxt" where a = 4`, "65006D006F006A00690020003DD800DE\n"},
+		}, "1|plain|ünïcode|FC006E00EF0063006F0064006500\n7|ñandú 🦙|ü|FC00\n" +
+			"Ābc\nZebra\ncafé\nemoji 😀\nplain\nñandú 🦙\nok\n"},
+		{"UTF-16be", []sqlTest{
+			{"order by", `select b from "tëxt" order by b`, "Zebra\ncafé\nemoji 😀\nplain\nĀbc\n日本語\n"},
+			{"index range", `select a from "tëxt" where b > 'b' order by b`, "2\n4\n1\n6\n3\n"},
+			{"max min", `select max(b), min(b) from "tëxt"`, "日本語|Zebra\n"},
+			{"hex", `select length(b), upper(b), hex(b) from "tëxt" where a = 2`, "4|CAFé|00630061006600E9\n"},
+			{"surrogate pair", `select hex(b) from "tëxt" where a = 4`, "0065006D006F006A00690020D83DDE00\n"},
+		}, "1|plain|ünïcode|00FC006E00EF0063006F00640065\n7|ñandú 🦙|ü|00FC\n" +
+			"Zebra\ncafé\nemoji 😀\nplain\nñandú 🦙\nĀbc\nok\n"},
+	}
+	// The same in either encoding
+	common := []sqlTest{
+		{"select", `select a, b, c from "tëxt" order by a`, "1|plain|x\n2|café|é\n3|日本語|語\n4|emoji 😀|\n5|Zebra|\n6|Ābc|ā\n"},
+		{"index equality", `select a from "tëxt" where b = '日本語'`, "3\n"},
+		{"like", `select b from "tëxt" where b like 'CAF%'`, "café\n"},
+		{"substr", `select substr(b, 2, 2) from "tëxt" where a = 3`, "本語\n"},
+		{"concat", `select b || c from "tëxt" where a = 2`, "caféé\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.encoding, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "test.db")
+			sql := "pragma encoding = '" + tt.encoding + "'; " + encodingSetup
+			if out, err := sqlite3Command(t, path, sql).CombinedOutput(); err != nil {
+				t.Fatalf("%v\n%s", err, out)
+			}
+			db, err := Open(path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			runQueries(t, db, append(tt.queries, common...))
+
+			// sqlite3's .schema, which adds IF NOT EXISTS to quoted table
+			// names, prints the same statements
+			var schema strings.Builder
+			for _, obj := range db.Schema() {
+				schema.WriteString(obj.SQL + ";\n")
+			}
+			want := "CREATE TABLE \"tëxt\"(a integer primary key, b text, c);\nCREATE INDEX \"tëxt_b\" on \"tëxt\"(b);\n"
+			if schema.String() != want {
+				t.Errorf("schema: got:\n%s\nwant:\n%s", schema.String(), want)
+			}
+
+			query(t, db, encodingWrites)
+			out, err := sqlite3Command(t, path,
+				`select a, b, c, hex(c) from "tëxt" where a in (1, 7) or b = '日本語'`,
+				`select b from "tëxt" order by b`,
+				"pragma integrity_check").CombinedOutput()
+			if err != nil {
+				t.Fatalf("%v\n%s", err, out)
+			}
+			if string(out) != tt.written {
+				t.Errorf("after writing: got:\n%s\nwant:\n%s", out, tt.written)
+			}
+		})
+	}
+}
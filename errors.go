@@ -0,0 +1,15 @@
+package sqlite
+
+import (
+	"errors"
+
+	"github.com/elordeiro/SQLite-DBReader/pager"
+)
+
+// Errors the engine returns, to be matched with errors.Is
+var (
+	ErrCorrupt  = pager.ErrCorrupt
+	ErrNotADB   = pager.ErrNotADB
+	ErrReadOnly = pager.ErrReadOnly
+	ErrNotFound = errors.New("no such table")
+)
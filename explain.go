@@ -0,0 +1,252 @@
+package sqlite
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/elordeiro/SQLite-DBReader/parser"
+)
+
+// EXPLAIN QUERY PLAN ---------------------------------------------------------
+
+// execExplain plans a SELECT without running it and describes the plan the
+// way sqlite3 does, one row of id, parent, notused and detail per step
+func (db *DB) execExplain(stmt *parser.ExplainStatement) (*Result, error) {
+	plan, err := db.planSelect(stmt.Select)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &explainer{ids: make(map[*parser.SelectStatement]int), materialized: make(map[*selectPlan]bool)}
+	e.number(stmt.Select)
+	plan.explain(e, 0)
+	return &Result{
+		Columns:   []string{"id", "parent", "notused", "detail"},
+		Rows:      e.rows,
+		QueryPlan: true,
+	}, nil
+}
+
+// explainer collects the steps of a plan and names its subqueries by the
+// numbers sqlite3 gives their SELECTs
+type explainer struct {
+	rows         [][]any
+	ids          map[*parser.SelectStatement]int
+	lastID       int
+	materialized map[*selectPlan]bool // Subqueries in FROM already described
+}
+
+// number gives each SELECT of a statement the number sqlite3 does, in the
+// order they are parsed: each after the subqueries inside it, and a compound
+// the number of its last SELECT
+func (e *explainer) number(stmt *parser.SelectStatement) {
+	exprs := func(list ...parser.Expr) {
+		for _, x := range list {
+			walkExpr(x, func(x parser.Expr) error {
+				switch x := x.(type) {
+				case *parser.SubqueryExpr:
+					e.number(x.Select)
+				case *parser.ExistsExpr:
+					e.number(x.Select)
+				case *parser.InExpr:
+					if x.Select != nil {
+						e.number(x.Select)
+					}
+				}
+				return nil
+			})
+		}
+	}
+
+	if stmt.With != nil {
+		for _, cte := range stmt.With.CTEs {
+			e.number(cte.Select)
+		}
+	}
+	for _, col := range stmt.Columns {
+		exprs(col.Expr)
+	}
+	for _, ref := range stmt.From {
+		if ref.Subquery != nil {
+			e.number(ref.Subquery)
+		}
+		exprs(ref.On)
+	}
+	exprs(stmt.Where)
+	exprs(stmt.GroupBy...)
+	exprs(stmt.Having)
+	e.lastID++
+	e.ids[stmt] = e.lastID
+	for _, arm := range stmt.Compound {
+		e.number(arm.Select)
+		e.ids[stmt] = e.ids[arm.Select]
+	}
+	for _, term := range stmt.OrderBy {
+		exprs(term.Expr)
+	}
+	exprs(stmt.Limit, stmt.Offset)
+}
+
+// id returns the number of a subquery's SELECT, or a new number for the
+// subqueries sqlite3 adds to run window functions
+func (e *explainer) id(stmt *parser.SelectStatement) int {
+	if id, ok := e.ids[stmt]; ok && stmt != nil {
+		return id
+	}
+	e.lastID++
+	return e.lastID
+}
+
+// add appends a step under parent, 0 for the top level, returning its id
+func (e *explainer) add(parent int64, detail string) int64 {
+	id := int64(len(e.rows) + 2)
+	e.rows = append(e.rows, []any{id, parent, int64(0), detail})
+	return id
+}
+
+// explain lists the subqueries in FROM and the loops of a plan, outermost
+// first, followed by the sorting and de-duplication done once the rows are
+// read and the subqueries in its expressions. A subquery in FROM read more
+// than once, as a CTE may be, is described the first time.
+func (plan *selectPlan) explain(e *explainer, parent int64) {
+	if plan.arms != nil {
+		plan.explainCompound(e, parent)
+		return
+	}
+
+	plan.explainWindows(e, parent, plan.windows)
+	if plan.stmt.Distinct {
+		e.add(parent, "USE TEMP B-TREE FOR DISTINCT")
+	}
+	if len(plan.orderBy) > 0 && !plan.sorted {
+		e.add(parent, "USE TEMP B-TREE FOR ORDER BY")
+	}
+
+	for _, sub := range plan.subqueries {
+		detail := fmt.Sprintf("%s SUBQUERY %d", sub.kind, e.id(sub.sel))
+		if sub.plan.correlated {
+			detail = "CORRELATED " + detail
+		}
+		sub.plan.explain(e, e.add(parent, detail))
+	}
+}
+
+// explainWindows describes the windows of a plan as sqlite3 does, each read
+// from a co-routine that gives the rows of the windows after it, sorted for
+// the window. Inside the last are the loops that read the rows.
+func (plan *selectPlan) explainWindows(e *explainer, parent int64, windows []*window) {
+	if len(windows) > 0 {
+		name := fmt.Sprintf("(subquery-%d)", e.id(nil))
+		routine := e.add(parent, "CO-ROUTINE "+name)
+		plan.explainWindows(e, routine, windows[1:])
+		if spec := windows[0].spec; len(spec.PartitionBy) > 0 || len(spec.OrderBy) > 0 {
+			e.add(routine, "USE TEMP B-TREE FOR ORDER BY")
+		}
+		e.add(parent, "SCAN "+name)
+		return
+	}
+
+	names := make([]string, len(plan.sources))
+	for i, src := range plan.sources {
+		names[i] = src.name
+		if src.query == nil || e.materialized[src.query] {
+			continue
+		}
+		if names[i] == "" {
+			names[i] = fmt.Sprintf("(subquery-%d)", e.id(src.query.stmt))
+		}
+		e.materialized[src.query] = true
+		src.query.explain(e, e.add(parent, "MATERIALIZE "+names[i]))
+	}
+
+	if len(plan.join.loops) == 0 {
+		e.add(parent, "SCAN CONSTANT ROW")
+	}
+	for _, l := range plan.join.loops {
+		e.add(parent, l.explain(names[l.src]))
+	}
+
+	if len(plan.groupBy) > 0 {
+		e.add(parent, "USE TEMP B-TREE FOR GROUP BY")
+	}
+}
+
+// explainCompound lists the SELECTs of a compound under the operators that
+// combine them, or the setup and recursive steps of a recursive CTE
+func (plan *selectPlan) explainCompound(e *explainer, parent int64) {
+	if plan.recursive > 0 {
+		setup := e.add(parent, "SETUP")
+		for _, arm := range plan.arms[:plan.recursive] {
+			arm.plan.explain(e, setup)
+		}
+		step := e.add(parent, "RECURSIVE STEP")
+		for _, arm := range plan.arms[plan.recursive:] {
+			arm.plan.explain(e, step)
+		}
+		return
+	}
+
+	compound := e.add(parent, "COMPOUND QUERY")
+	for _, arm := range plan.arms {
+		detail := arm.op
+		switch arm.op {
+		case "":
+			detail = "LEFT-MOST SUBQUERY"
+		case "UNION", "INTERSECT", "EXCEPT":
+			detail += " USING TEMP B-TREE"
+		}
+		arm.plan.explain(e, e.add(compound, detail))
+	}
+	if len(plan.orderBy) > 0 {
+		e.add(parent, "USE TEMP B-TREE FOR ORDER BY")
+	}
+}
+
+// explain describes how a loop reads its table: SCAN for every row or index
+// entry, or SEARCH with the constraints it seeks on. Range bounds are written as > and
+// < whether or not they are inclusive, as sqlite3 writes them.
+func (l *scanPlan) explain(name string) string {
+	var b strings.Builder
+	terms := make([]string, 0)
+	col := "rowid"
+	switch {
+	case l.index != nil:
+		verb, kind := "SEARCH", "INDEX"
+		if len(l.eq) == 0 && l.lower == nil && l.upper == nil {
+			verb = "SCAN"
+		}
+		if l.covering {
+			kind = "COVERING INDEX"
+		}
+		fmt.Fprintf(&b, "%s %s USING %s %s", verb, name, kind, l.index.Name)
+		for i := range l.eq {
+			terms = append(terms, l.index.IndexColumns[i].Name+"=?")
+		}
+		if len(l.eq) < len(l.index.IndexColumns) {
+			col = l.index.IndexColumns[len(l.eq)].Name
+		}
+	case len(l.eq) > 0 || l.lower != nil || l.upper != nil:
+		fmt.Fprintf(&b, "SEARCH %s USING INTEGER PRIMARY KEY", name)
+		if len(l.eq) > 0 {
+			terms = append(terms, "rowid=?")
+		}
+	default:
+		fmt.Fprintf(&b, "SCAN %s", name)
+	}
+
+	if l.lower != nil {
+		terms = append(terms, col+">?")
+	}
+	if l.upper != nil {
+		terms = append(terms, col+"<?")
+	}
+	if len(terms) > 0 {
+		fmt.Fprintf(&b, " (%s)", strings.Join(terms, " AND "))
+	}
+	if l.left {
+		b.WriteString(" LEFT-JOIN")
+	}
+	return b.String()
+}
+
+// ----------------------------------------------------------------------------
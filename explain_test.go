@@ -0,0 +1,58 @@
+package sqlite
+
+import "testing"
+
+const explainSetup = `
+create table t(a integer primary key, b, c text, d);
+create index t_bc on t(b, c);
+create index t_d on t(d);
+create table u(x, y);
+create index u_x on u(x);
+insert into t values (1, 1, 'a', 10), (2, 1, 'b', 20), (3, 2, 'c', 30), (4, 2, 'a', null);
+insert into u values (1, 'one'), (2, 'two'), (5, 'five');`
+
+// TestExplain compares the plans described with sqlite3's, for queries
+// sqlite3 plans the same way
+func TestExplain(t *testing.T) {
+	runQueries(t, openTest(t, explainSetup), []sqlTest{
+		{"scan", "explain query plan select * from u", "QUERY PLAN\n`--SCAN u\n"},
+		{"two columns", "explain query plan select * from t where b = 1 and c = 'a'", "QUERY PLAN\n`--SEARCH t USING INDEX t_bc (b=? AND c=?)\n"},
+		{"prefix and range", "explain query plan select * from t where b = 1 and c > 'a'", "QUERY PLAN\n`--SEARCH t USING INDEX t_bc (b=? AND c>?)\n"},
+		{"range both ends", "explain query plan select * from t where b > 0 and b <= 2", "QUERY PLAN\n`--SEARCH t USING INDEX t_bc (b>? AND b<?)\n"},
+		{"is null", "explain query plan select * from t where d is null", "QUERY PLAN\n`--SEARCH t USING INDEX t_d (d=?)\n"},
+		{"order by", "explain query plan select * from u order by y", "QUERY PLAN\n|--SCAN u\n`--USE TEMP B-TREE FOR ORDER BY\n"},
+		{"order by partial", "explain query plan select * from u where x = 1 order by y", "QUERY PLAN\n|--SEARCH u USING INDEX u_x (x=?)\n`--USE TEMP B-TREE FOR ORDER BY\n"},
+		{"group by", "explain query plan select y, count(*) from u group by y", "QUERY PLAN\n|--SCAN u\n`--USE TEMP B-TREE FOR GROUP BY\n"},
+		{"distinct", "explain query plan select distinct y from u", "QUERY PLAN\n|--SCAN u\n`--USE TEMP B-TREE FOR DISTINCT\n"},
+		{"distinct and order", "explain query plan select distinct y from u order by y desc", "QUERY PLAN\n|--SCAN u\n|--USE TEMP B-TREE FOR DISTINCT\n`--USE TEMP B-TREE FOR ORDER BY\n"},
+		{"union all", "explain query plan select a from t union all select x from u", "QUERY PLAN\n`--COMPOUND QUERY\n   |--LEFT-MOST SUBQUERY\n   |  `--SCAN t USING COVERING INDEX t_d\n   `--UNION ALL\n      `--SCAN u USING COVERING INDEX u_x\n"},
+		{"union", "explain query plan select a from t union select x from u", "QUERY PLAN\n`--COMPOUND QUERY\n   |--LEFT-MOST SUBQUERY\n   |  `--SCAN t USING COVERING INDEX t_d\n   `--UNION USING TEMP B-TREE\n      `--SCAN u USING COVERING INDEX u_x\n"},
+		{"except", "explain query plan select a from t except select x from u", "QUERY PLAN\n`--COMPOUND QUERY\n   |--LEFT-MOST SUBQUERY\n   |  `--SCAN t USING COVERING INDEX t_d\n   `--EXCEPT USING TEMP B-TREE\n      `--SCAN u USING COVERING INDEX u_x\n"},
+		{"window", "explain query plan select x, sum(x) over (order by y) from u", "QUERY PLAN\n|--CO-ROUTINE (subquery-2)\n|  |--SCAN u\n|  `--USE TEMP B-TREE FOR ORDER BY\n`--SCAN (subquery-2)\n"},
+		{"left join order", "explain query plan select * from t left join u on u.x = t.b order by u.y", "QUERY PLAN\n|--SCAN t\n|--SEARCH u USING INDEX u_x (x=?) LEFT-JOIN\n`--USE TEMP B-TREE FOR ORDER BY\n"},
+		{"rowid in index search", "explain query plan select a from t where b = 2", "QUERY PLAN\n`--SEARCH t USING COVERING INDEX t_bc (b=?)\n"},
+		{"correlated scalar", "explain query plan select a, (select y from u where x = t.b) from t", "QUERY PLAN\n|--SCAN t USING COVERING INDEX t_bc\n`--CORRELATED SCALAR SUBQUERY 1\n   `--SEARCH u USING INDEX u_x (x=?)\n"},
+		{"exists", "explain query plan select * from t where exists (select 1 from u where u.x = t.b)", "QUERY PLAN\n|--SCAN t\n`--CORRELATED SCALAR SUBQUERY 1\n   `--SEARCH u USING COVERING INDEX u_x (x=?)\n"},
+		{"intersect", "explain query plan select a from t intersect select x from u", "QUERY PLAN\n`--COMPOUND QUERY\n   |--LEFT-MOST SUBQUERY\n   |  `--SCAN t USING COVERING INDEX t_d\n   `--INTERSECT USING TEMP B-TREE\n      `--SCAN u USING COVERING INDEX u_x\n"},
+		{"from subquery", "explain query plan select * from t cross join (select distinct y from u) s", "QUERY PLAN\n|--MATERIALIZE s\n|  |--SCAN u\n|  `--USE TEMP B-TREE FOR DISTINCT\n|--SCAN t\n`--SCAN s\n"},
+		{"materialized cte", "explain query plan with v as materialized (select x from u where x > 1) select * from v", "QUERY PLAN\n|--MATERIALIZE v\n|  `--SEARCH u USING COVERING INDEX u_x (x>?)\n`--SCAN v\n"},
+		{"cte twice", "explain query plan with v as materialized (select x from u where x > 1) select * from v cross join v as w", "QUERY PLAN\n|--MATERIALIZE v\n|  `--SEARCH u USING COVERING INDEX u_x (x>?)\n|--SCAN v\n`--SCAN w\n"},
+		{"recursive cte", "explain query plan with recursive c(i) as (select 1 union all select i + 1 from c where i < 5) select * from t cross join c", "QUERY PLAN\n|--MATERIALIZE c\n|  |--SETUP\n|  |  `--SCAN CONSTANT ROW\n|  `--RECURSIVE STEP\n|     `--SCAN c\n|--SCAN t\n`--SCAN c\n"},
+		{"compound subquery", "explain query plan select * from t where a = (select x from u where x = 1 union select 2)", "QUERY PLAN\n|--SEARCH t USING INTEGER PRIMARY KEY (rowid=?)\n`--SCALAR SUBQUERY 2\n   `--COMPOUND QUERY\n      |--LEFT-MOST SUBQUERY\n      |  `--SEARCH u USING COVERING INDEX u_x (x=?)\n      `--UNION USING TEMP B-TREE\n         `--SCAN CONSTANT ROW\n"},
+		{"scalar subquery", "explain query plan select a, (select y from u where x = 2) from t", "QUERY PLAN\n|--SCAN t USING COVERING INDEX t_d\n`--SCALAR SUBQUERY 1\n   `--SEARCH u USING INDEX u_x (x=?)\n"},
+		{"from subquery numbered", "explain query plan select * from t cross join (select y from u where x > 1 limit 2) cross join (select distinct y as z from u)", "QUERY PLAN\n|--MATERIALIZE (subquery-1)\n|  `--SEARCH u USING INDEX u_x (x>?)\n|--MATERIALIZE (subquery-2)\n|  |--SCAN u\n|  `--USE TEMP B-TREE FOR DISTINCT\n|--SCAN t\n|--SCAN (subquery-1)\n`--SCAN (subquery-2)\n"},
+		{"correlated list subquery", "explain query plan select (select count(*) from u where y in (select c from t as t2 where t2.a = u.x)) from t", "QUERY PLAN\n|--SCAN t USING COVERING INDEX t_d\n`--SCALAR SUBQUERY 2\n   |--SCAN u\n   `--CORRELATED LIST SUBQUERY 1\n      `--SEARCH t2 USING INTEGER PRIMARY KEY (rowid=?)\n"},
+		{"scalars numbered", "explain query plan select (select y from u where x = 1), (select y from u where x = 2) from t where b = 1", "QUERY PLAN\n|--SEARCH t USING COVERING INDEX t_bc (b=?)\n|--SCALAR SUBQUERY 1\n|  `--SEARCH u USING INDEX u_x (x=?)\n`--SCALAR SUBQUERY 2\n   `--SEARCH u USING INDEX u_x (x=?)\n"},
+		{"order by rowid", "explain query plan select * from t order by a", "QUERY PLAN\n`--SCAN t\n"},
+		{"order by rowid desc", "explain query plan select * from t where b = 1 order by a desc", "QUERY PLAN\n|--SEARCH t USING INDEX t_bc (b=?)\n`--USE TEMP B-TREE FOR ORDER BY\n"},
+		{"window in subquery", "explain query plan select (select sum(x) over () from u limit 1) from t", "QUERY PLAN\n|--SCAN t USING COVERING INDEX t_d\n`--SCALAR SUBQUERY 1\n   |--CO-ROUTINE (subquery-3)\n   |  `--SCAN u USING COVERING INDEX u_x\n   `--SCAN (subquery-3)\n"},
+	})
+}
+
+func TestExplainErrors(t *testing.T) {
+	runSQLErrors(t, openTest(t, explainSetup), []sqlError{
+		{"explain select * from t", "EXPLAIN is only supported as EXPLAIN QUERY PLAN"},
+		{"explain query plan delete from t", "EXPLAIN QUERY PLAN is only supported for SELECT"},
+		{"explain query plan select * from nope", "no such table: nope"},
+	})
+}
@@ -0,0 +1,1043 @@
+package sqlite
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/elordeiro/SQLite-DBReader/parser"
+	"github.com/elordeiro/SQLite-DBReader/record"
+)
+
+// Custom Types ---------------------------------------------------------------
+// A table or other row producer that column references resolve against
+type rowSource struct {
+	name  string // Alias or table name
+	table *Table
+	join  string          // How it joins the sources before it, see parser.TableRef
+	on    parser.Expr     // Join condition, including the columns matched by USING
+	using map[string]bool // Lower case names of the columns matched by USING
+	query *selectPlan     // Subquery in FROM the rows come from
+}
+
+// Row holds the values of one table row, indexed like the table's columns.
+// The rowid alias column holds the rowid.
+type Row struct {
+	RowID  int64
+	Values []any
+}
+
+type evalContext struct {
+	db         *DB
+	rows       []*Row                   // Current row of each source
+	aggs       map[*parser.FuncCall]any // Aggregate results of the current group
+	outer      *evalContext             // Query enclosing a subquery
+	subqueries []*subquery              // Subqueries in the query's expressions
+	results    map[*selectPlan]*Result  // Rows of subqueries run once per statement
+}
+
+// ----------------------------------------------------------------------------
+
+// Binding --------------------------------------------------------------------
+// scope holds the sources column references resolve against, and the scope
+// of the query enclosing it, which a correlated subquery reads from
+type scope struct {
+	sources    []*rowSource
+	outer      *scope
+	correlated bool                // A column of an enclosing query was read
+	outerRefs  []*parser.ColumnRef // Columns of the enclosing query read
+	ctes       []*cte              // Common table expressions FROM may name
+	cte        *cte                // CTE the query is the body of
+}
+
+// sibling returns a scope for a query planned beside the one of sc, such as a
+// subquery in its FROM, seeing the same enclosing queries and CTEs
+func (sc *scope) sibling() *scope {
+	return &scope{outer: sc.outer, ctes: sc.ctes}
+}
+
+// readsOuter makes sc read the columns of the enclosing queries a sibling
+// scope reads
+func (sc *scope) readsOuter(sibling *scope) {
+	if sibling.correlated {
+		sc.correlated = true
+		sc.outerRefs = append(sc.outerRefs, sibling.outerRefs...)
+	}
+}
+
+// bindExpr resolves every column reference in e against the sources
+func bindExpr(e parser.Expr, sources []*rowSource) error {
+	return (&scope{sources: sources}).bind(e)
+}
+
+// bind resolves every column reference in e, looking through the enclosing
+// queries when the scope's own sources have no such column. Each query
+// between the reference and its source becomes correlated.
+func (sc *scope) bind(e parser.Expr) error {
+	return walkExpr(e, func(e parser.Expr) error {
+		ref, ok := e.(*parser.ColumnRef)
+		if !ok || ref.Bound {
+			return nil
+		}
+
+		var inner *scope // Scope just inside s
+		for s, depth := sc, 0; s != nil; inner, s, depth = s, s.outer, depth+1 {
+			found, err := s.resolve(ref)
+			if err != nil {
+				return err
+			}
+			if !found {
+				continue
+			}
+			ref.Bound, ref.Depth = true, depth
+			if inner != nil {
+				outer := *ref
+				outer.Depth = 0
+				inner.outerRefs = append(inner.outerRefs, &outer)
+				for c := sc; c != s; c = c.outer {
+					c.correlated = true
+				}
+			}
+			return nil
+		}
+		return fmt.Errorf("no such column: %s", refName(ref))
+	})
+}
+
+// resolve binds ref to a column of the scope's own sources, reporting
+// whether one has it
+func (sc *scope) resolve(ref *parser.ColumnRef) (bool, error) {
+	found := false
+	for i, src := range sc.sources {
+		if ref.Table != "" && !strings.EqualFold(ref.Table, src.name) {
+			continue
+		}
+		col, ok := src.table.ColumnIndex(ref.Column)
+		if !ok {
+			continue
+		}
+		// A column matched by USING is read from the table on the left
+		if found && ref.Table == "" && src.using[strings.ToLower(ref.Column)] {
+			continue
+		}
+		if found {
+			return false, fmt.Errorf("ambiguous column name: %s", refName(ref))
+		}
+		found = true
+		bindSource(ref, i, src, col)
+	}
+	return found, nil
+}
+
+// bindSource binds ref to column col of src, the i-th source of its scope
+func bindSource(ref *parser.ColumnRef, i int, src *rowSource, col int) {
+	ref.Src, ref.Col = i, col
+	ref.Affinity, ref.Collate = parser.AffinityInteger, ""
+	if col >= 0 {
+		ref.Affinity = src.table.Columns[col].Affinity
+		ref.Collate = src.table.Columns[col].Collate
+		if col == src.table.RowIDAlias {
+			ref.Col = RowIDColumn
+		}
+	}
+}
+
+func refName(ref *parser.ColumnRef) string {
+	if ref.Table != "" {
+		return ref.Table + "." + ref.Column
+	}
+	return ref.Column
+}
+
+// walkExpr calls fn on e and every expression below it, parents first
+func walkExpr(e parser.Expr, fn func(parser.Expr) error) error {
+	if e == nil {
+		return nil
+	}
+	if err := fn(e); err != nil {
+		return err
+	}
+
+	var children []parser.Expr
+	switch x := e.(type) {
+	case *parser.UnaryExpr:
+		children = []parser.Expr{x.X}
+	case *parser.BinaryExpr:
+		children = []parser.Expr{x.L, x.R}
+	case *parser.FuncCall:
+		children = x.Args
+		if x.Over != nil {
+			children = append(slices.Clone(x.Args), x.Over.PartitionBy...)
+			for _, term := range x.Over.OrderBy {
+				children = append(children, term.Expr)
+			}
+			if x.Over.Frame != nil {
+				children = append(children, x.Over.Frame.Start.Offset, x.Over.Frame.End.Offset)
+			}
+		}
+	case *parser.InExpr:
+		children = append([]parser.Expr{x.X}, x.List...)
+		children = appendRefs(children, x.Outer)
+	case *parser.SubqueryExpr:
+		children = appendRefs(children, x.Outer)
+	case *parser.ExistsExpr:
+		children = appendRefs(children, x.Outer)
+	case *parser.BetweenExpr:
+		children = []parser.Expr{x.X, x.Lo, x.Hi}
+	case *parser.LikeExpr:
+		children = []parser.Expr{x.X, x.Pattern, x.Escape}
+	case *parser.IsNullExpr:
+		children = []parser.Expr{x.X}
+	case *parser.CastExpr:
+		children = []parser.Expr{x.X}
+	case *parser.CaseExpr:
+		children = []parser.Expr{x.Operand, x.Else}
+		for _, when := range x.Whens {
+			children = append(children, when.Cond, when.Result)
+		}
+	case *parser.CollateExpr:
+		children = []parser.Expr{x.X}
+	}
+
+	for _, child := range children {
+		if err := walkExpr(child, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rewriteExpr replaces, in place, each expression below e for which fn
+// returns a replacement, and returns e or the replacement for e itself.
+// Subqueries are left alone.
+func rewriteExpr(e parser.Expr, fn func(parser.Expr) parser.Expr) parser.Expr {
+	if e == nil {
+		return nil
+	}
+	if r := fn(e); r != nil {
+		return r
+	}
+
+	list := func(exprs []parser.Expr) {
+		for i := range exprs {
+			exprs[i] = rewriteExpr(exprs[i], fn)
+		}
+	}
+	switch x := e.(type) {
+	case *parser.UnaryExpr:
+		x.X = rewriteExpr(x.X, fn)
+	case *parser.BinaryExpr:
+		x.L, x.R = rewriteExpr(x.L, fn), rewriteExpr(x.R, fn)
+	case *parser.FuncCall:
+		list(x.Args)
+	case *parser.InExpr:
+		x.X = rewriteExpr(x.X, fn)
+		list(x.List)
+	case *parser.BetweenExpr:
+		x.X, x.Lo, x.Hi = rewriteExpr(x.X, fn), rewriteExpr(x.Lo, fn), rewriteExpr(x.Hi, fn)
+	case *parser.LikeExpr:
+		x.X, x.Pattern, x.Escape = rewriteExpr(x.X, fn), rewriteExpr(x.Pattern, fn), rewriteExpr(x.Escape, fn)
+	case *parser.IsNullExpr:
+		x.X = rewriteExpr(x.X, fn)
+	case *parser.CastExpr:
+		x.X = rewriteExpr(x.X, fn)
+	case *parser.CaseExpr:
+		x.Operand, x.Else = rewriteExpr(x.Operand, fn), rewriteExpr(x.Else, fn)
+		for _, when := range x.Whens {
+			when.Cond, when.Result = rewriteExpr(when.Cond, fn), rewriteExpr(when.Result, fn)
+		}
+	case *parser.CollateExpr:
+		x.X = rewriteExpr(x.X, fn)
+	}
+	return e
+}
+
+// appendRefs adds the columns of the enclosing query a subquery reads, so
+// walking an expression finds every column it depends on. The subquery
+// itself is planned on its own.
+func appendRefs(children []parser.Expr, refs []*parser.ColumnRef) []parser.Expr {
+	for _, ref := range refs {
+		children = append(children, ref)
+	}
+	return children
+}
+
+// exprAffinity returns the affinity of an expression, AffinityNone when it
+// has none
+func exprAffinity(e parser.Expr) parser.Affinity {
+	switch x := e.(type) {
+	case *parser.ColumnRef:
+		return x.Affinity
+	case *parser.CastExpr:
+		return parser.TypeAffinity(x.Type)
+	case *parser.CollateExpr:
+		return exprAffinity(x.X)
+	case *parser.SubqueryExpr:
+		if col := x.Select.Columns[0]; col.Expr != nil {
+			return exprAffinity(col.Expr)
+		}
+	}
+	return parser.AffinityNone
+}
+
+// exprCollation returns the collating sequence of an expression and whether
+// it was given explicitly with COLLATE
+func exprCollation(e parser.Expr) (string, bool) {
+	switch x := e.(type) {
+	case *parser.CollateExpr:
+		return x.Collation, true
+	case *parser.ColumnRef:
+		return x.Collate, false
+	case *parser.SubqueryExpr:
+		if col := x.Select.Columns[0]; col.Expr != nil {
+			return exprCollation(col.Expr)
+		}
+	}
+	return "", false
+}
+
+// ----------------------------------------------------------------------------
+
+// Evaluation -----------------------------------------------------------------
+func (ctx *evalContext) Eval(e parser.Expr) (any, error) {
+	switch x := e.(type) {
+	case *parser.Literal:
+		return x.Value, nil
+	case *parser.Param:
+		if x.Index > len(ctx.db.params) {
+			return nil, nil
+		}
+		return ctx.db.params[x.Index-1], nil
+	case *parser.ColumnRef:
+		if !x.Bound {
+			return nil, fmt.Errorf("no such column: %s", x.Column)
+		}
+		c := ctx
+		for i := 0; i < x.Depth; i++ {
+			c = c.outer
+		}
+		row := c.rows[x.Src]
+		switch {
+		case row == nil:
+			return nil, nil
+		case x.Col == RowIDColumn:
+			return row.RowID, nil
+		case x.Col < len(row.Values):
+			return row.Values[x.Col], nil
+		default:
+			return nil, nil
+		}
+	case *parser.UnaryExpr:
+		return ctx.evalUnary(x)
+	case *parser.BinaryExpr:
+		return ctx.evalBinary(x)
+	case *parser.FuncCall:
+		if value, ok := ctx.aggs[x]; ok {
+			return value, nil
+		}
+		return ctx.evalFunc(x)
+	case *parser.InExpr:
+		return ctx.evalIn(x)
+	case *parser.SubqueryExpr:
+		result, err := ctx.subquery(x.Select, 1)
+		if err != nil || len(result.Rows) == 0 {
+			return nil, err
+		}
+		return result.Rows[0][0], nil
+	case *parser.ExistsExpr:
+		result, err := ctx.subquery(x.Select, 1)
+		if err != nil {
+			return nil, err
+		}
+		return boolValue(len(result.Rows) > 0), nil
+	case *parser.BetweenExpr:
+		lo, err := ctx.compare(">=", x.X, x.Lo)
+		if err != nil {
+			return nil, err
+		}
+		hi, err := ctx.compare("<=", x.X, x.Hi)
+		if err != nil {
+			return nil, err
+		}
+		result := and(lo, hi)
+		if x.Not {
+			return not(result), nil
+		}
+		return result, nil
+	case *parser.LikeExpr:
+		return ctx.evalLike(x)
+	case *parser.IsNullExpr:
+		v, err := ctx.Eval(x.X)
+		if err != nil {
+			return nil, err
+		}
+		return boolValue((v == nil) != x.Not), nil
+	case *parser.CastExpr:
+		v, err := ctx.Eval(x.X)
+		if err != nil {
+			return nil, err
+		}
+		return castValue(v, x.Type), nil
+	case *parser.CaseExpr:
+		return ctx.evalCase(x)
+	case *parser.CollateExpr:
+		if _, err := ctx.db.GetCollation(x.Collation); err != nil {
+			return nil, err
+		}
+		return ctx.Eval(x.X)
+	}
+	return nil, fmt.Errorf("unsupported expression %T", e)
+}
+
+// EvalBool evaluates a condition, treating NULL as false
+func (ctx *evalContext) EvalBool(e parser.Expr) (bool, error) {
+	v, err := ctx.Eval(e)
+	if err != nil {
+		return false, err
+	}
+	b, _ := valueToBool(v).(bool)
+	return b, nil
+}
+
+func (ctx *evalContext) evalUnary(x *parser.UnaryExpr) (any, error) {
+	v, err := ctx.Eval(x.X)
+	if err != nil || v == nil {
+		return nil, err
+	}
+
+	switch x.Op {
+	case "NOT":
+		return not(v), nil
+	case "-":
+		switch n := toNumeric(v).(type) {
+		case int64:
+			if n == math.MinInt64 {
+				return -float64(n), nil
+			}
+			return -n, nil
+		case float64:
+			return -n, nil
+		}
+	case "+":
+		return v, nil
+	case "~":
+		return ^toInteger(v).(int64), nil
+	}
+	return nil, fmt.Errorf("unsupported operator %s", x.Op)
+}
+
+func (ctx *evalContext) evalBinary(x *parser.BinaryExpr) (any, error) {
+	switch x.Op {
+	case "AND", "OR":
+		l, err := ctx.Eval(x.L)
+		if err != nil {
+			return nil, err
+		}
+
+		// Short-circuit on a decisive left operand
+		lb := valueToBool(l)
+		if x.Op == "AND" && lb == false {
+			return int64(0), nil
+		}
+		if x.Op == "OR" && lb == true {
+			return int64(1), nil
+		}
+
+		r, err := ctx.Eval(x.R)
+		if err != nil {
+			return nil, err
+		}
+		if x.Op == "AND" {
+			return and(l, r), nil
+		}
+		return or(l, r), nil
+	case "=", "!=", "<", "<=", ">", ">=", "IS", "IS NOT":
+		return ctx.compare(x.Op, x.L, x.R)
+	}
+
+	l, err := ctx.Eval(x.L)
+	if err != nil {
+		return nil, err
+	}
+	r, err := ctx.Eval(x.R)
+	if err != nil {
+		return nil, err
+	}
+	if l == nil || r == nil {
+		return nil, nil
+	}
+
+	switch x.Op {
+	case "||":
+		return FormatValue(l) + FormatValue(r), nil
+	case "+", "-", "*", "/", "%":
+		return arithmetic(x.Op, toNumeric(l), toNumeric(r)), nil
+	case "&", "|", "<<", ">>":
+		return bitwise(x.Op, toInteger(l).(int64), toInteger(r).(int64)), nil
+	}
+	return nil, fmt.Errorf("unsupported operator %s", x.Op)
+}
+
+// compare evaluates a comparison, converting the operands by the affinity of
+// the columns involved and using their collating sequence
+func (ctx *evalContext) compare(op string, left, right parser.Expr) (any, error) {
+	l, err := ctx.Eval(left)
+	if err != nil {
+		return nil, err
+	}
+	r, err := ctx.Eval(right)
+	if err != nil {
+		return nil, err
+	}
+
+	l, r = applyComparisonAffinity(l, r, exprAffinity(left), exprAffinity(right))
+	coll, err := ctx.comparisonCollation(left, right)
+	if err != nil {
+		return nil, err
+	}
+
+	// IS and IS NOT treat NULLs as equal to each other
+	switch op {
+	case "IS":
+		return boolValue(record.CompareValues(l, r, coll) == 0), nil
+	case "IS NOT":
+		return boolValue(record.CompareValues(l, r, coll) != 0), nil
+	}
+	if l == nil || r == nil {
+		return nil, nil
+	}
+
+	c := record.CompareValues(l, r, coll)
+	switch op {
+	case "=":
+		return boolValue(c == 0), nil
+	case "!=":
+		return boolValue(c != 0), nil
+	case "<":
+		return boolValue(c < 0), nil
+	case "<=":
+		return boolValue(c <= 0), nil
+	case ">":
+		return boolValue(c > 0), nil
+	default:
+		return boolValue(c >= 0), nil
+	}
+}
+
+// comparisonCollation picks an explicit COLLATE on either operand, left
+// first, then the collation of a column operand
+func (ctx *evalContext) comparisonCollation(left, right parser.Expr) (record.Collation, error) {
+	lname, lexplicit := exprCollation(left)
+	rname, rexplicit := exprCollation(right)
+
+	name := lname
+	switch {
+	case lexplicit:
+	case rexplicit:
+		name = rname
+	case lname == "":
+		name = rname
+	}
+	return ctx.db.GetCollation(name)
+}
+
+/*
+Before a comparison:
+
+	If one operand has INTEGER, REAL or NUMERIC affinity and the other operand has TEXT or BLOB or no affinity then NUMERIC affinity is applied to other operand.
+	If one operand has TEXT affinity and the other has no affinity, then TEXT affinity is applied to the other operand.
+*/
+func applyComparisonAffinity(l, r any, la, ra parser.Affinity) (any, any) {
+	isNumeric := func(aff parser.Affinity) bool { return aff >= parser.AffinityNumeric }
+	switch {
+	case isNumeric(la) && !isNumeric(ra):
+		r = applyAffinity(r, parser.AffinityNumeric)
+	case isNumeric(ra) && !isNumeric(la):
+		l = applyAffinity(l, parser.AffinityNumeric)
+	case la == parser.AffinityText && ra == parser.AffinityNone:
+		r = applyAffinity(r, parser.AffinityText)
+	case ra == parser.AffinityText && la == parser.AffinityNone:
+		l = applyAffinity(l, parser.AffinityText)
+	}
+	return l, r
+}
+
+func (ctx *evalContext) evalIn(x *parser.InExpr) (any, error) {
+	v, err := ctx.Eval(x.X)
+	if err != nil {
+		return nil, err
+	}
+
+	// The values of a subquery are compared like its result column
+	items, values := x.List, []any(nil)
+	if x.Select != nil {
+		result, err := ctx.subquery(x.Select, -1)
+		if err != nil {
+			return nil, err
+		}
+		items = make([]parser.Expr, len(result.Rows))
+		values = make([]any, len(result.Rows))
+		for i, row := range result.Rows {
+			items[i], values[i] = x.Select.Columns[0].Expr, row[0]
+		}
+	}
+	if len(items) == 0 {
+		return boolValue(x.Not), nil
+	}
+	if v == nil {
+		return nil, nil
+	}
+
+	var rhs parser.Expr
+	if x.Select != nil {
+		rhs = x.Select.Columns[0].Expr
+	}
+	coll, err := ctx.comparisonCollation(x.X, rhs)
+	if err != nil {
+		return nil, err
+	}
+
+	var result any = int64(0)
+	for i, item := range items {
+		var w any
+		if values != nil {
+			w = values[i]
+		} else if w, err = ctx.Eval(item); err != nil {
+			return nil, err
+		}
+		if w == nil {
+			result = nil
+			continue
+		}
+		l, r := applyComparisonAffinity(v, w, exprAffinity(x.X), exprAffinity(item))
+		if record.CompareValues(l, r, coll) == 0 {
+			result = int64(1)
+			break
+		}
+	}
+
+	if x.Not {
+		return not(result), nil
+	}
+	return result, nil
+}
+
+func (ctx *evalContext) evalLike(x *parser.LikeExpr) (any, error) {
+	v, err := ctx.Eval(x.X)
+	if err != nil {
+		return nil, err
+	}
+	pattern, err := ctx.Eval(x.Pattern)
+	if err != nil {
+		return nil, err
+	}
+	var escape any
+	if x.Escape != nil {
+		if escape, err = ctx.Eval(x.Escape); err != nil {
+			return nil, err
+		}
+	}
+
+	result, err := matchPattern(x.Op, v, pattern, escape)
+	if err != nil || result == nil {
+		return nil, err
+	}
+	if x.Not {
+		return not(result), nil
+	}
+	return result, nil
+}
+
+func (ctx *evalContext) evalCase(x *parser.CaseExpr) (any, error) {
+	for _, when := range x.Whens {
+		var matched bool
+		if x.Operand != nil {
+			result, err := ctx.compare("=", x.Operand, when.Cond)
+			if err != nil {
+				return nil, err
+			}
+			matched, _ = valueToBool(result).(bool)
+		} else {
+			var err error
+			if matched, err = ctx.EvalBool(when.Cond); err != nil {
+				return nil, err
+			}
+		}
+		if matched {
+			return ctx.Eval(when.Result)
+		}
+	}
+
+	if x.Else != nil {
+		return ctx.Eval(x.Else)
+	}
+	return nil, nil
+}
+
+// ----------------------------------------------------------------------------
+
+// Operators ------------------------------------------------------------------
+// Integer arithmetic that overflows is redone in floating point
+func arithmetic(op string, l, r any) any {
+	a, aok := l.(int64)
+	b, bok := r.(int64)
+	if aok && bok {
+		switch op {
+		case "+":
+			if sum := a + b; (sum > a) == (b > 0) {
+				return sum
+			}
+		case "-":
+			if diff := a - b; (diff < a) == (b > 0) {
+				return diff
+			}
+		case "*":
+			if a == 0 || b == 0 {
+				return int64(0)
+			}
+			if prod := a * b; prod/b == a && !(a == -1 && b == math.MinInt64) && !(b == -1 && a == math.MinInt64) {
+				return prod
+			}
+		case "/":
+			if b == 0 {
+				return nil
+			}
+			if a != math.MinInt64 || b != -1 {
+				return a / b
+			}
+		case "%":
+			if b == 0 {
+				return nil
+			}
+			if b == -1 {
+				return int64(0)
+			}
+			return a % b
+		}
+	}
+
+	x, y := toFloat(l), toFloat(r)
+	switch op {
+	case "+":
+		return x + y
+	case "-":
+		return x - y
+	case "*":
+		return x * y
+	case "/":
+		if y == 0 {
+			return nil
+		}
+		return x / y
+	default:
+		// Remainder of the integer parts
+		a, b := toInteger(x).(int64), toInteger(y).(int64)
+		if b == 0 {
+			return nil
+		}
+		if b == -1 {
+			return 0.0
+		}
+		return float64(a % b)
+	}
+}
+
+func bitwise(op string, a, b int64) any {
+	switch op {
+	case "&":
+		return a & b
+	case "|":
+		return a | b
+	}
+
+	// Negative shifts go the other way
+	if op == ">>" {
+		b = -b
+	}
+	switch {
+	case b >= 64:
+		return int64(0)
+	case b <= -64:
+		if a < 0 {
+			return int64(-1)
+		}
+		return int64(0)
+	case b >= 0:
+		return a << b
+	default:
+		return a >> -b
+	}
+}
+
+func toFloat(v any) float64 {
+	switch x := v.(type) {
+	case int64:
+		return float64(x)
+	case float64:
+		return x
+	}
+	return 0
+}
+
+// castValue converts a value the way CAST(v AS typeName) does
+func castValue(v any, typeName string) any {
+	if v == nil {
+		return nil
+	}
+
+	switch parser.TypeAffinity(typeName) {
+	case parser.AffinityText:
+		return FormatValue(v)
+	case parser.AffinityInteger:
+		if s, ok := v.(string); ok {
+			return parseIntegerPrefix(s)
+		}
+		return toInteger(v)
+	case parser.AffinityReal:
+		return toReal(v)
+	case parser.AffinityNumeric:
+		switch x := toNumeric(v).(type) {
+		case float64:
+			if i, ok := floatToInt(x); ok {
+				return i
+			}
+			return x
+		default:
+			return x
+		}
+	default:
+		switch x := v.(type) {
+		case []byte:
+			return x
+		default:
+			return []byte(FormatValue(v))
+		}
+	}
+}
+
+// parseIntegerPrefix reads the leading [+-]digits of s, saturating on
+// overflow
+func parseIntegerPrefix(s string) int64 {
+	s = strings.TrimLeft(s, " \t\n\r\f")
+	neg := false
+	if s != "" && (s[0] == '+' || s[0] == '-') {
+		neg = s[0] == '-'
+		s = s[1:]
+	}
+
+	var n uint64
+	for i := 0; i < len(s) && isDigit(s[i]); i++ {
+		n = n*10 + uint64(s[i]-'0')
+		if n > math.MaxInt64+1 {
+			n = math.MaxInt64 + 1
+		}
+	}
+
+	switch {
+	case neg:
+		return -int64(n)
+	case n > math.MaxInt64:
+		return math.MaxInt64
+	default:
+		return int64(n)
+	}
+}
+
+// Three-valued logic, with nil as NULL ---------------------------------------
+func boolValue(b bool) any {
+	if b {
+		return int64(1)
+	}
+	return int64(0)
+}
+
+func not(v any) any {
+	b := valueToBool(v)
+	if b == nil {
+		return nil
+	}
+	return boolValue(!b.(bool))
+}
+
+func and(a, b any) any {
+	x, y := valueToBool(a), valueToBool(b)
+	if x == false || y == false {
+		return int64(0)
+	}
+	if x == nil || y == nil {
+		return nil
+	}
+	return int64(1)
+}
+
+func or(a, b any) any {
+	x, y := valueToBool(a), valueToBool(b)
+	if x == true || y == true {
+		return int64(1)
+	}
+	if x == nil || y == nil {
+		return nil
+	}
+	return int64(0)
+}
+
+// ----------------------------------------------------------------------------
+
+// Pattern Matching -----------------------------------------------------------
+// matchPattern implements LIKE, case-insensitive for ASCII with % and _
+// wildcards, and GLOB, case-sensitive with *, ? and [...] classes
+func matchPattern(op string, v, pattern, escape any) (any, error) {
+	if v == nil || pattern == nil {
+		return nil, nil
+	}
+	text, pat := FormatValue(v), FormatValue(pattern)
+
+	var esc rune = -1
+	if escape != nil {
+		e := FormatValue(escape)
+		if utf8.RuneCountInString(e) != 1 {
+			return nil, errors.New("ESCAPE expression must be a single character")
+		}
+		esc, _ = utf8.DecodeRuneInString(e)
+	}
+
+	if op == "GLOB" {
+		return boolValue(globMatch([]rune(pat), []rune(text))), nil
+	}
+	return boolValue(likeMatch([]rune(pat), []rune(text), esc)), nil
+}
+
+// Like reports whether text matches a LIKE pattern, where % matches any
+// run of characters and _ any one, ignoring the case of ASCII letters
+func Like(pattern, text string) bool {
+	return likeMatch([]rune(pattern), []rune(text), 0)
+}
+
+func likeMatch(pat, text []rune, esc rune) bool {
+	for len(pat) > 0 {
+		c := pat[0]
+		switch {
+		case c == esc && len(pat) > 1:
+			if len(text) == 0 || !equalFoldASCII(pat[1], text[0]) {
+				return false
+			}
+			pat, text = pat[2:], text[1:]
+		case c == '%':
+			for len(pat) > 0 && (pat[0] == '%' || pat[0] == '_') {
+				if pat[0] == '_' {
+					if len(text) == 0 {
+						return false
+					}
+					text = text[1:]
+				}
+				pat = pat[1:]
+			}
+			if len(pat) == 0 {
+				return true
+			}
+			for i := 0; i <= len(text); i++ {
+				if likeMatch(pat, text[i:], esc) {
+					return true
+				}
+			}
+			return false
+		case c == '_':
+			if len(text) == 0 {
+				return false
+			}
+			pat, text = pat[1:], text[1:]
+		default:
+			if len(text) == 0 || !equalFoldASCII(c, text[0]) {
+				return false
+			}
+			pat, text = pat[1:], text[1:]
+		}
+	}
+	return len(text) == 0
+}
+
+func globMatch(pat, text []rune) bool {
+	for len(pat) > 0 {
+		switch pat[0] {
+		case '*':
+			for len(pat) > 0 && pat[0] == '*' {
+				pat = pat[1:]
+			}
+			if len(pat) == 0 {
+				return true
+			}
+			for i := 0; i <= len(text); i++ {
+				if globMatch(pat, text[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(text) == 0 {
+				return false
+			}
+			pat, text = pat[1:], text[1:]
+		case '[':
+			if len(text) == 0 {
+				return false
+			}
+			n, ok := matchClass(pat, text[0])
+			if n == 0 || !ok {
+				return false
+			}
+			pat, text = pat[n:], text[1:]
+		default:
+			if len(text) == 0 || pat[0] != text[0] {
+				return false
+			}
+			pat, text = pat[1:], text[1:]
+		}
+	}
+	return len(text) == 0
+}
+
+// matchClass matches c against the [...] class at the start of pat and
+// returns the length of the class, 0 when it is unterminated
+func matchClass(pat []rune, c rune) (int, bool) {
+	i := 1
+	invert := false
+	if i < len(pat) && pat[i] == '^' {
+		invert = true
+		i++
+	}
+
+	matched := false
+	first := true
+	for ; i < len(pat); i++ {
+		if pat[i] == ']' && !first {
+			return i + 1, matched != invert
+		}
+		first = false
+		if i+2 < len(pat) && pat[i+1] == '-' && pat[i+2] != ']' {
+			if c >= pat[i] && c <= pat[i+2] {
+				matched = true
+			}
+			i += 2
+			continue
+		}
+		if pat[i] == c {
+			matched = true
+		}
+	}
+	return 0, false
+}
+
+func equalFoldASCII(a, b rune) bool {
+	if a >= 'A' && a <= 'Z' {
+		a += 'a' - 'A'
+	}
+	if b >= 'A' && b <= 'Z' {
+		b += 'a' - 'A'
+	}
+	return a == b
+}
+
+// ----------------------------------------------------------------------------
@@ -0,0 +1,680 @@
+package sqlite
+
+import (
+	"cmp"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/elordeiro/SQLite-DBReader/parser"
+	"github.com/elordeiro/SQLite-DBReader/record"
+)
+
+// Custom Types ---------------------------------------------------------------
+type scalarFunc struct {
+	minArgs int
+	maxArgs int // -1 for any number
+	fn      func(ctx *evalContext, args []any) (any, error)
+}
+
+// aggregator accumulates the rows of one group for an aggregate function
+type aggregator interface {
+	Step(args []any) error
+	Final() any
+}
+
+type aggregateFunc struct {
+	minArgs int
+	maxArgs int
+	new     func(coll record.Collation) aggregator
+}
+
+// ----------------------------------------------------------------------------
+
+var scalarFunctions map[string]*scalarFunc
+
+var aggregateFunctions = map[string]*aggregateFunc{
+	"count":        {0, 1, func(record.Collation) aggregator { return &countAgg{} }},
+	"sum":          {1, 1, func(record.Collation) aggregator { return &sumAgg{} }},
+	"total":        {1, 1, func(record.Collation) aggregator { return &sumAgg{total: true} }},
+	"avg":          {1, 1, func(record.Collation) aggregator { return &sumAgg{avg: true} }},
+	"min":          {1, 1, func(coll record.Collation) aggregator { return &minMaxAgg{coll: coll, sign: -1} }},
+	"max":          {1, 1, func(coll record.Collation) aggregator { return &minMaxAgg{coll: coll, sign: 1} }},
+	"group_concat": {1, 2, func(record.Collation) aggregator { return &groupConcatAgg{} }},
+	"string_agg":   {2, 2, func(record.Collation) aggregator { return &groupConcatAgg{} }},
+}
+
+func init() {
+	scalarFunctions = map[string]*scalarFunc{
+		"abs":               {1, 1, fnAbs},
+		"changes":           {0, 0, fnChanges},
+		"char":              {0, -1, fnChar},
+		"coalesce":          {2, -1, fnCoalesce},
+		"concat":            {1, -1, fnConcat},
+		"concat_ws":         {2, -1, fnConcatWS},
+		"current_date":      {0, 0, fnCurrentTime("2006-01-02")},
+		"current_time":      {0, 0, fnCurrentTime("15:04:05")},
+		"current_timestamp": {0, 0, fnCurrentTime("2006-01-02 15:04:05")},
+		"glob":              {2, 2, fnGlob},
+		"hex":               {1, 1, fnHex},
+		"ifnull":            {2, 2, fnCoalesce},
+		"iif":               {3, 3, fnIif},
+		"instr":             {2, 2, fnInstr},
+		"last_insert_rowid": {0, 0, fnLastInsertRowID},
+		"length":            {1, 1, fnLength},
+		"like":              {2, 3, fnLike},
+		"lower":             {1, 1, fnLower},
+		"ltrim":             {1, 2, fnTrim(true, false)},
+		"max":               {2, -1, fnMinMax(1)},
+		"min":               {2, -1, fnMinMax(-1)},
+		"nullif":            {2, 2, fnNullIf},
+		"quote":             {1, 1, fnQuote},
+		"random":            {0, 0, fnRandom},
+		"randomblob":        {1, 1, fnRandomBlob},
+		"replace":           {3, 3, fnReplace},
+		"round":             {1, 2, fnRound},
+		"rtrim":             {1, 2, fnTrim(false, true)},
+		"sign":              {1, 1, fnSign},
+		"substr":            {2, 3, fnSubstr},
+		"substring":         {2, 3, fnSubstr},
+		"trim":              {1, 2, fnTrim(true, true)},
+		"typeof":            {1, 1, fnTypeof},
+		"unicode":           {1, 1, fnUnicode},
+		"upper":             {1, 1, fnUpper},
+		"zeroblob":          {1, 1, fnZeroBlob},
+	}
+}
+
+// Function Calls -------------------------------------------------------------
+func (ctx *evalContext) evalFunc(call *parser.FuncCall) (any, error) {
+	if isAggregate(call) {
+		return nil, fmt.Errorf("misuse of aggregate function %s()", call.Name)
+	}
+	if _, ok := windowFunctions[call.Name]; ok || call.Over != nil {
+		return nil, fmt.Errorf("misuse of window function %s()", call.Name)
+	}
+
+	f, ok := scalarFunctions[call.Name]
+	if !ok {
+		return nil, fmt.Errorf("no such function: %s", call.Name)
+	}
+	if call.Star || call.Distinct || len(call.Args) < f.minArgs || (f.maxArgs >= 0 && len(call.Args) > f.maxArgs) {
+		return nil, fmt.Errorf("wrong number of arguments to function %s()", call.Name)
+	}
+
+	args := make([]any, len(call.Args))
+	for i, arg := range call.Args {
+		var err error
+		if args[i], err = ctx.Eval(arg); err != nil {
+			return nil, err
+		}
+	}
+	return f.fn(ctx, args)
+}
+
+// isAggregate reports whether a call is to an aggregate function. min() and
+// max() with more than one argument are scalar, and a call with OVER is a
+// window function.
+func isAggregate(call *parser.FuncCall) bool {
+	f, ok := aggregateFunctions[call.Name]
+	return ok && len(call.Args) <= f.maxArgs && call.Over == nil
+}
+
+// newAggregator validates an aggregate call and creates its accumulator
+func (db *DB) newAggregator(call *parser.FuncCall) (aggregator, error) {
+	f := aggregateFunctions[call.Name]
+	if call.Star != (call.Name == "count" && len(call.Args) == 0) || len(call.Args) < f.minArgs {
+		return nil, fmt.Errorf("wrong number of arguments to function %s()", call.Name)
+	}
+	if call.Distinct && len(call.Args) != 1 {
+		return nil, errors.New("DISTINCT aggregates must have exactly one argument")
+	}
+
+	var name string
+	if len(call.Args) > 0 {
+		name, _ = exprCollation(call.Args[0])
+	}
+	coll, err := db.GetCollation(name)
+	if err != nil {
+		return nil, err
+	}
+
+	agg := f.new(coll)
+	if call.Distinct {
+		agg = &distinctAgg{agg, name, make(map[string]bool)}
+	}
+	return agg, nil
+}
+
+// ----------------------------------------------------------------------------
+
+// Scalar Functions -----------------------------------------------------------
+func fnAbs(ctx *evalContext, args []any) (any, error) {
+	switch x := toNumeric(args[0]).(type) {
+	case int64:
+		if x == math.MinInt64 {
+			return nil, errors.New("integer overflow")
+		}
+		if x < 0 {
+			return -x, nil
+		}
+		return x, nil
+	case float64:
+		return math.Abs(x), nil
+	}
+	return nil, nil
+}
+
+func fnChanges(ctx *evalContext, args []any) (any, error) {
+	return ctx.db.changes, nil
+}
+
+func fnChar(ctx *evalContext, args []any) (any, error) {
+	var sb strings.Builder
+	for _, arg := range args {
+		r, _ := toInteger(arg).(int64)
+		if r < 0 || r > utf8.MaxRune {
+			r = utf8.RuneError
+		}
+		sb.WriteRune(rune(r))
+	}
+	return sb.String(), nil
+}
+
+func fnCoalesce(ctx *evalContext, args []any) (any, error) {
+	for _, arg := range args {
+		if arg != nil {
+			return arg, nil
+		}
+	}
+	return nil, nil
+}
+
+func fnConcat(ctx *evalContext, args []any) (any, error) {
+	var sb strings.Builder
+	for _, arg := range args {
+		sb.WriteString(FormatValue(arg))
+	}
+	return sb.String(), nil
+}
+
+func fnConcatWS(ctx *evalContext, args []any) (any, error) {
+	if args[0] == nil {
+		return nil, nil
+	}
+	parts := make([]string, 0, len(args)-1)
+	for _, arg := range args[1:] {
+		if arg != nil {
+			parts = append(parts, FormatValue(arg))
+		}
+	}
+	return strings.Join(parts, FormatValue(args[0])), nil
+}
+
+func fnCurrentTime(layout string) func(*evalContext, []any) (any, error) {
+	return func(ctx *evalContext, args []any) (any, error) {
+		return time.Now().UTC().Format(layout), nil
+	}
+}
+
+func fnGlob(ctx *evalContext, args []any) (any, error) {
+	return matchPattern("GLOB", args[1], args[0], nil)
+}
+
+func fnHex(ctx *evalContext, args []any) (any, error) {
+	var buf []byte
+	switch x := args[0].(type) {
+	case nil:
+	case []byte:
+		buf = x
+	default:
+		buf = ctx.db.bt.Encoding.Encode(FormatValue(x))
+	}
+	return strings.ToUpper(hex.EncodeToString(buf)), nil
+}
+
+func fnIif(ctx *evalContext, args []any) (any, error) {
+	if valueToBool(args[0]) == true {
+		return args[1], nil
+	}
+	return args[2], nil
+}
+
+func fnInstr(ctx *evalContext, args []any) (any, error) {
+	if args[0] == nil || args[1] == nil {
+		return nil, nil
+	}
+
+	haystack, hok := args[0].([]byte)
+	needle, nok := args[1].([]byte)
+	if hok && nok {
+		return int64(strings.Index(string(haystack), string(needle)) + 1), nil
+	}
+
+	s, sub := FormatValue(args[0]), FormatValue(args[1])
+	i := strings.Index(s, sub)
+	if i < 0 {
+		return int64(0), nil
+	}
+	return int64(utf8.RuneCountInString(s[:i]) + 1), nil
+}
+
+func fnLastInsertRowID(ctx *evalContext, args []any) (any, error) {
+	return ctx.db.lastInsertRowID, nil
+}
+
+func fnLength(ctx *evalContext, args []any) (any, error) {
+	switch x := args[0].(type) {
+	case nil:
+		return nil, nil
+	case []byte:
+		return int64(len(x)), nil
+	default:
+		return int64(utf8.RuneCountInString(FormatValue(x))), nil
+	}
+}
+
+func fnLike(ctx *evalContext, args []any) (any, error) {
+	var escape any
+	if len(args) == 3 {
+		escape = args[2]
+	}
+	return matchPattern("LIKE", args[1], args[0], escape)
+}
+
+func fnLower(ctx *evalContext, args []any) (any, error) {
+	if args[0] == nil {
+		return nil, nil
+	}
+	return asciiToLower(FormatValue(args[0])), nil
+}
+
+func fnUpper(ctx *evalContext, args []any) (any, error) {
+	if args[0] == nil {
+		return nil, nil
+	}
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' {
+			return r - 'a' + 'A'
+		}
+		return r
+	}, FormatValue(args[0])), nil
+}
+
+func fnTrim(left, right bool) func(*evalContext, []any) (any, error) {
+	return func(ctx *evalContext, args []any) (any, error) {
+		if args[0] == nil || (len(args) == 2 && args[1] == nil) {
+			return nil, nil
+		}
+		s, cutset := FormatValue(args[0]), " "
+		if len(args) == 2 {
+			cutset = FormatValue(args[1])
+		}
+		if left {
+			s = strings.TrimLeft(s, cutset)
+		}
+		if right {
+			s = strings.TrimRight(s, cutset)
+		}
+		return s, nil
+	}
+}
+
+// fnMinMax returns the smallest (sign -1) or largest (sign 1) argument, or
+// NULL when any argument is NULL
+func fnMinMax(sign int) func(*evalContext, []any) (any, error) {
+	return func(ctx *evalContext, args []any) (any, error) {
+		best := args[0]
+		for _, arg := range args {
+			if arg == nil {
+				return nil, nil
+			}
+			if record.CompareValues(arg, best, ctx.db.binaryCollation)*sign > 0 {
+				best = arg
+			}
+		}
+		return best, nil
+	}
+}
+
+func fnNullIf(ctx *evalContext, args []any) (any, error) {
+	if args[0] != nil && args[1] != nil && record.CompareValues(args[0], args[1], ctx.db.binaryCollation) == 0 {
+		return nil, nil
+	}
+	return args[0], nil
+}
+
+func fnQuote(ctx *evalContext, args []any) (any, error) {
+	switch x := args[0].(type) {
+	case nil:
+		return "NULL", nil
+	case string:
+		return "'" + strings.ReplaceAll(x, "'", "''") + "'", nil
+	case []byte:
+		return "X'" + strings.ToUpper(hex.EncodeToString(x)) + "'", nil
+	default:
+		return FormatValue(x), nil
+	}
+}
+
+func fnRandom(ctx *evalContext, args []any) (any, error) {
+	return int64(rand.Uint64()), nil
+}
+
+func fnRandomBlob(ctx *evalContext, args []any) (any, error) {
+	n, _ := toInteger(args[0]).(int64)
+	buf := make([]byte, max(n, 1))
+	for i := range buf {
+		buf[i] = byte(rand.Uint32())
+	}
+	return buf, nil
+}
+
+func fnReplace(ctx *evalContext, args []any) (any, error) {
+	if args[0] == nil || args[1] == nil || args[2] == nil {
+		return nil, nil
+	}
+	s, old := FormatValue(args[0]), FormatValue(args[1])
+	if old == "" {
+		return args[0], nil
+	}
+	return strings.ReplaceAll(s, old, FormatValue(args[2])), nil
+}
+
+func fnRound(ctx *evalContext, args []any) (any, error) {
+	if args[0] == nil || (len(args) == 2 && args[1] == nil) {
+		return nil, nil
+	}
+	x := toFloat(toReal(args[0]))
+	digits := int64(0)
+	if len(args) == 2 {
+		digits, _ = toInteger(args[1]).(int64)
+		digits = min(max(digits, 0), 30)
+	}
+
+	if digits == 0 {
+		return math.Round(x), nil
+	}
+	// FormatFloat rounds a value exactly halfway to even, where sqlite3
+	// rounds it away from zero, so such a value is moved off halfway first
+	if halfway(x, digits) {
+		x = math.Nextafter(x, math.Copysign(math.Inf(1), x))
+	}
+	rounded, _ := strconv.ParseFloat(strconv.FormatFloat(x, 'f', int(digits), 64), 64)
+	return rounded, nil
+}
+
+// halfway reports whether x lies exactly halfway between two numbers of the
+// given number of decimal places
+func halfway(x float64, digits int64) bool {
+	scaled := new(big.Rat).SetFloat64(x)
+	if scaled == nil {
+		return false
+	}
+	scaled.Mul(scaled, new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(digits), nil)))
+	whole := new(big.Int).Quo(scaled.Num(), scaled.Denom())
+	frac := scaled.Sub(scaled, new(big.Rat).SetInt(whole))
+	return frac.Abs(frac).Cmp(big.NewRat(1, 2)) == 0
+}
+
+func fnSign(ctx *evalContext, args []any) (any, error) {
+	switch x := args[0].(type) {
+	case int64:
+		return int64(cmp.Compare(x, 0)), nil
+	case float64:
+		return int64(cmp.Compare(x, 0)), nil
+	case string:
+		if n, ok := parseNumericText(x); ok {
+			return fnSign(ctx, []any{n})
+		}
+	}
+	return nil, nil
+}
+
+/*
+substr(X,Y,Z) returns a substring of input string X that begins with the
+Y-th character and which is Z characters long. The left-most character of X
+is number 1. If Y is negative then the first character of the substring is
+found by counting from the right rather than the left. If Z is negative then
+the abs(Z) characters preceding the Y-th character are returned. Characters
+are bytes for blobs.
+*/
+func fnSubstr(ctx *evalContext, args []any) (any, error) {
+	for _, arg := range args {
+		if arg == nil {
+			return nil, nil
+		}
+	}
+
+	blob, isBlob := args[0].([]byte)
+	var runes []rune
+	length := int64(len(blob))
+	if !isBlob {
+		runes = []rune(FormatValue(args[0]))
+		length = int64(len(runes))
+	}
+
+	start, _ := toInteger(args[1]).(int64)
+	count := length + 1
+	if len(args) == 3 {
+		count, _ = toInteger(args[2]).(int64)
+	}
+
+	switch {
+	case start < 0:
+		start = max(length+start, 0)
+	case start > 0:
+		start--
+	case count > 0:
+		// Position 0 is one before the first character
+		count--
+	}
+	if count < 0 {
+		begin := max(start+count, 0)
+		count = start - begin
+		start = begin
+	}
+	start = min(start, length)
+	end := min(start+count, length)
+
+	if isBlob {
+		return blob[start:end], nil
+	}
+	return string(runes[start:end]), nil
+}
+
+func fnTypeof(ctx *evalContext, args []any) (any, error) {
+	switch args[0].(type) {
+	case nil:
+		return "null", nil
+	case int64:
+		return "integer", nil
+	case float64:
+		return "real", nil
+	case string:
+		return "text", nil
+	default:
+		return "blob", nil
+	}
+}
+
+func fnUnicode(ctx *evalContext, args []any) (any, error) {
+	if args[0] == nil {
+		return nil, nil
+	}
+	s := FormatValue(args[0])
+	if s == "" {
+		return nil, nil
+	}
+	r, _ := utf8.DecodeRuneInString(s)
+	return int64(r), nil
+}
+
+func fnZeroBlob(ctx *evalContext, args []any) (any, error) {
+	n, _ := toInteger(args[0]).(int64)
+	return make([]byte, max(n, 0)), nil
+}
+
+// ----------------------------------------------------------------------------
+
+// Aggregate Functions --------------------------------------------------------
+type countAgg struct {
+	n int64
+}
+
+func (a *countAgg) Step(args []any) error {
+	if len(args) == 0 || args[0] != nil {
+		a.n++
+	}
+	return nil
+}
+
+func (a *countAgg) Final() any { return a.n }
+
+// sumAgg implements sum(), total() and avg(). sum() stays an integer until
+// it sees a non-integer value and fails on integer overflow.
+type sumAgg struct {
+	total, avg bool
+	count      int64
+	isum       int64
+	fsum       float64
+	isFloat    bool
+}
+
+func (a *sumAgg) Step(args []any) error {
+	if args[0] == nil {
+		return nil
+	}
+	a.count++
+
+	switch x := toNumeric(args[0]).(type) {
+	case int64:
+		if _, isText := args[0].(string); isText {
+			a.isFloat = true
+		}
+		if !a.isFloat {
+			sum := a.isum + x
+			if (sum > a.isum) != (x > 0) {
+				if !a.total && !a.avg {
+					return errors.New("integer overflow")
+				}
+				a.isFloat = true
+			} else {
+				a.isum = sum
+			}
+		}
+		a.fsum += float64(x)
+	case float64:
+		a.isFloat = true
+		a.fsum += x
+	}
+	return nil
+}
+
+func (a *sumAgg) Final() any {
+	switch {
+	case a.total:
+		return a.fsum
+	case a.count == 0:
+		return nil
+	case a.avg:
+		return a.fsum / float64(a.count)
+	case a.isFloat:
+		return a.fsum
+	default:
+		return a.isum
+	}
+}
+
+type minMaxAgg struct {
+	coll record.Collation
+	sign int
+	best any
+}
+
+func (a *minMaxAgg) Step(args []any) error {
+	if args[0] != nil && (a.best == nil || record.CompareValues(args[0], a.best, a.coll)*a.sign > 0) {
+		a.best = args[0]
+	}
+	return nil
+}
+
+func (a *minMaxAgg) Final() any { return a.best }
+
+type groupConcatAgg struct {
+	sb    strings.Builder
+	count int
+}
+
+func (a *groupConcatAgg) Step(args []any) error {
+	if args[0] == nil {
+		return nil
+	}
+	if a.count > 0 {
+		sep := ","
+		if len(args) == 2 {
+			sep = FormatValue(args[1])
+		}
+		a.sb.WriteString(sep)
+	}
+	a.sb.WriteString(FormatValue(args[0]))
+	a.count++
+	return nil
+}
+
+func (a *groupConcatAgg) Final() any {
+	if a.count == 0 {
+		return nil
+	}
+	return a.sb.String()
+}
+
+// distinctAgg passes each distinct non-NULL value to the wrapped aggregate
+// once, comparing values under the collation of the argument
+type distinctAgg struct {
+	aggregator
+	coll string
+	seen map[string]bool
+}
+
+func (a *distinctAgg) Step(args []any) error {
+	if args[0] == nil {
+		return nil
+	}
+	key := collationKey(args[0], a.coll)
+	if a.seen[key] {
+		return nil
+	}
+	a.seen[key] = true
+	return a.aggregator.Step(args)
+}
+
+// valueKey encodes a value so that values comparing equal under BINARY map
+// to the same key
+func valueKey(v any) string {
+	switch x := v.(type) {
+	case nil:
+		return "n"
+	case int64:
+		return "i" + strconv.FormatInt(x, 10)
+	case float64:
+		if i, ok := floatToInt(x); ok {
+			return "i" + strconv.FormatInt(i, 10)
+		}
+		return "f" + strconv.FormatFloat(x, 'g', -1, 64)
+	case string:
+		return "t" + x
+	case []byte:
+		return "b" + string(x)
+	}
+	return ""
+}
+
+// ----------------------------------------------------------------------------
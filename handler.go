@@ -0,0 +1,154 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+
+	"github.com/elordeiro/SQLite-DBReader/parser"
+)
+
+// Execute runs the statements in sql one after another. Outside of a
+// transaction the changes of each statement are committed before the next
+// starts. A failing statement leaves the database as it was before that
+// statement.
+func (db *DB) Execute(sql string) ([]*Result, error) {
+	stmts, err := parser.ParseStatements(sql)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*Result, 0, len(stmts))
+	for _, stmt := range stmts {
+		result, err := db.execTransaction(stmt, nil)
+		if err != nil {
+			return results, err
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// Query runs the statements in sql like Execute, with args bound to their
+// parameters, and returns the rows of the last one, all read into memory.
+// The context is checked before each statement starts and as rows are read,
+// so canceling it stops a long query.
+func (db *DB) Query(ctx context.Context, sql string, args ...any) (*Rows, error) {
+	s, err := db.Prepare(sql)
+	if err != nil {
+		return nil, err
+	}
+	return s.Query(ctx, args...)
+}
+
+// Exec runs the statements in sql like Query, returning the result of the
+// last one with the number of rows it changed
+func (db *DB) Exec(ctx context.Context, sql string, args ...any) (*Result, error) {
+	s, err := db.Prepare(sql)
+	if err != nil {
+		return nil, err
+	}
+	return s.Exec(ctx, args...)
+}
+
+// execTransaction runs a statement inside the open transaction, or in one
+// of its own when none was started with BEGIN. A SELECT keeps its plan in
+// plan when it is set.
+func (db *DB) execTransaction(stmt parser.Statement, plan **selectPlan) (*Result, error) {
+	// The lock taken by the first statement of a transaction is held
+	// until it ends
+	defer db.unlock()
+
+	switch stmt.(type) {
+	case *parser.BeginStatement:
+		if db.inTransaction {
+			return nil, errors.New("cannot start a transaction within a transaction")
+		}
+		db.inTransaction = true
+		return &Result{}, nil
+	case *parser.CommitStatement:
+		if !db.inTransaction {
+			return nil, errors.New("cannot commit - no transaction is active")
+		}
+		db.inTransaction = false
+		if err := db.commit(); err != nil {
+			db.rollback()
+			return nil, err
+		}
+		return &Result{}, nil
+	case *parser.RollbackStatement:
+		if !db.inTransaction {
+			return nil, errors.New("cannot rollback - no transaction is active")
+		}
+		db.inTransaction = false
+		if err := db.rollback(); err != nil {
+			return nil, err
+		}
+		return &Result{}, nil
+	}
+
+	if err := db.lock(); err != nil {
+		return nil, err
+	}
+	db.bt.Pager.BeginStatement()
+	result, err := db.execStatement(stmt, plan)
+	if err == nil && !db.inTransaction {
+		err = db.commit()
+	}
+	if err != nil {
+		if db.inTransaction && statementConflict(stmt) != "ROLLBACK" {
+			db.rollbackStatement()
+		} else {
+			db.inTransaction = false
+			db.rollback()
+		}
+		return nil, err
+	}
+	return result, nil
+}
+
+// statementConflict returns the OR clause of an INSERT or UPDATE
+func statementConflict(stmt parser.Statement) string {
+	switch stmt := stmt.(type) {
+	case *parser.InsertStatement:
+		return stmt.Conflict
+	case *parser.UpdateStatement:
+		return stmt.Conflict
+	}
+	return ""
+}
+
+func (db *DB) execStatement(stmt parser.Statement, plan **selectPlan) (*Result, error) {
+	switch stmt := stmt.(type) {
+	case *parser.SelectStatement:
+		if plan == nil {
+			return db.execSelect(stmt)
+		}
+		if *plan == nil {
+			var err error
+			if *plan, err = db.planSelect(stmt); err != nil {
+				return nil, err
+			}
+		}
+		return db.runSelect(*plan)
+	case *parser.InsertStatement:
+		return db.execInsert(stmt)
+	case *parser.UpdateStatement:
+		return db.execUpdate(stmt)
+	case *parser.DeleteStatement:
+		return db.execDelete(stmt)
+	case *parser.CreateTableStatement:
+		return db.execCreateTable(stmt)
+	case *parser.CreateIndexStatement:
+		return db.execCreateIndex(stmt)
+	case *parser.DropStatement:
+		return db.execDrop(stmt)
+	case *parser.VacuumStatement:
+		return db.execVacuum(stmt)
+	case *parser.AnalyzeStatement:
+		return db.execAnalyze(stmt)
+	case *parser.ExplainStatement:
+		return db.execExplain(stmt)
+	default:
+		return nil, errors.New("statement not supported")
+	}
+}
@@ -0,0 +1,253 @@
+package sqlite
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/elordeiro/SQLite-DBReader/parser"
+)
+
+// INSERT ---------------------------------------------------------------------
+func (db *DB) execInsert(stmt *parser.InsertStatement) (*Result, error) {
+	table, err := db.lookupTable(stmt.Table)
+	if err != nil {
+		return nil, err
+	}
+	if isInternalTable(table.Name) {
+		return nil, fmt.Errorf("table %s may not be modified", table.Name)
+	}
+
+	// Table columns the values go into, in order
+	cols := make([]int, 0, len(table.Columns))
+	if stmt.Columns == nil {
+		for i, col := range table.Columns {
+			if col.Generated == nil {
+				cols = append(cols, i)
+			}
+		}
+	}
+	for _, name := range stmt.Columns {
+		i, ok := table.ColumnIndex(name)
+		if !ok {
+			return nil, fmt.Errorf("table %s has no column named %s", table.Name, name)
+		}
+		if i >= 0 && table.Columns[i].Generated != nil {
+			return nil, fmt.Errorf("cannot INSERT into generated column \"%s\"", table.Columns[i].Name)
+		}
+		cols = append(cols, i)
+	}
+
+	// Evaluate every row before writing, so INSERT ... SELECT does not read
+	// the rows it inserts
+	var rows [][]any
+	switch {
+	case stmt.DefaultValues:
+		rows, cols = [][]any{{}}, nil
+	case stmt.Select != nil:
+		result, err := db.execSelect(stmt.Select)
+		if err != nil {
+			return nil, err
+		}
+		if len(result.Columns) != len(cols) {
+			return nil, valueCountError(table, stmt, len(result.Columns), len(cols))
+		}
+		rows = result.Rows
+	default:
+		ctx := &evalContext{db: db, results: make(map[*selectPlan]*Result)}
+		for _, exprs := range stmt.Values {
+			if len(exprs) != len(cols) {
+				return nil, valueCountError(table, stmt, len(exprs), len(cols))
+			}
+			for _, e := range exprs {
+				if err := bindExpr(e, nil); err != nil {
+					return nil, err
+				}
+			}
+			if ctx.subqueries, err = db.planSubqueries(&scope{}, exprs...); err != nil {
+				return nil, err
+			}
+
+			values := make([]any, len(exprs))
+			for i, e := range exprs {
+				if values[i], err = ctx.Eval(e); err != nil {
+					return nil, err
+				}
+			}
+			rows = append(rows, values)
+		}
+	}
+
+	result := &Result{}
+	// Like SQLite, check the most recently created index first
+	indexes := db.GetIndexes(table)
+	slices.Reverse(indexes)
+	for _, values := range rows {
+		inserted, err := db.insertRow(table, indexes, cols, values, stmt.Conflict)
+		if err != nil {
+			return nil, err
+		}
+		if inserted {
+			result.RowsAffected++
+		}
+	}
+	db.changes = result.RowsAffected
+	return result, nil
+}
+
+func valueCountError(table *Table, stmt *parser.InsertStatement, values, cols int) error {
+	if stmt.Columns == nil {
+		return fmt.Errorf("table %s has %d columns but %d values were supplied", table.Name, cols, values)
+	}
+	return fmt.Errorf("%d values for %d columns", values, cols)
+}
+
+// isInternalTable reports whether a table belongs to SQLite itself and may
+// not be written by statements
+func isInternalTable(name string) bool {
+	name = strings.ToLower(name)
+	return strings.HasPrefix(name, "sqlite_") && name != "sqlite_sequence" && !strings.HasPrefix(name, "sqlite_stat")
+}
+
+// insertRow adds one row to a table and its indexes. Returns false when the
+// row was skipped by OR IGNORE.
+func (db *DB) insertRow(table *Table, indexes []*Table, cols []int, values []any, conflict string) (bool, error) {
+	row := &Row{Values: make([]any, len(table.Columns))}
+	given := make([]bool, len(table.Columns))
+	var rowID any
+	for i, col := range cols {
+		if col == RowIDColumn || col == table.RowIDAlias {
+			rowID = values[i]
+		}
+		if col >= 0 {
+			row.Values[col] = values[i]
+			given[col] = true
+		}
+	}
+
+	ctx := &evalContext{db: db}
+	for i, col := range table.Columns {
+		if i == table.RowIDAlias || col.Generated != nil {
+			continue
+		}
+		if !given[i] && col.Default != nil {
+			v, err := ctx.Eval(col.Default)
+			if err != nil {
+				return false, err
+			}
+			row.Values[i] = v
+		}
+		row.Values[i] = applyAffinity(row.Values[i], col.Affinity)
+	}
+
+	// Pick the rowid
+	if rowID != nil {
+		id, ok := applyAffinity(rowID, parser.AffinityInteger).(int64)
+		if !ok {
+			return false, errors.New("datatype mismatch")
+		}
+		row.RowID = id
+	} else {
+		id, err := db.newRowID(table)
+		if err != nil {
+			return false, err
+		}
+		row.RowID = id
+	}
+	if table.RowIDAlias >= 0 {
+		row.Values[table.RowIDAlias] = row.RowID
+	}
+
+	if err := db.computeGeneratedColumns(table, row, true); err != nil {
+		return false, err
+	}
+
+	written, err := db.writeRow(table, indexes, row, nil, conflict)
+	if err != nil || !written {
+		return false, err
+	}
+	if table.Autoincrement {
+		if err := db.updateSequence(table, row.RowID); err != nil {
+			return false, err
+		}
+	}
+
+	db.lastInsertRowID = row.RowID
+	return true, nil
+}
+
+// newRowID picks the rowid for a row inserted without one: one more than
+// the largest rowid in use, or ever used for AUTOINCREMENT tables
+func (db *DB) newRowID(table *Table) (int64, error) {
+	largest := int64(0)
+	c := db.bt.NewCursor(table.PageNum)
+	found, err := c.Last()
+	if err != nil {
+		return 0, err
+	}
+	if found {
+		largest = int64(c.Cell().RowID)
+	}
+
+	if table.Autoincrement {
+		seq, _, err := db.readSequence(table)
+		if err != nil {
+			return 0, err
+		}
+		largest = max(largest, seq)
+	}
+
+	if largest == math.MaxInt64 {
+		return 0, errors.New("database or disk is full")
+	}
+	return largest + 1, nil
+}
+
+// readSequence returns the largest rowid recorded for an AUTOINCREMENT table
+// in sqlite_sequence and the rowid of the row recording it, 0 if none does
+func (db *DB) readSequence(table *Table) (int64, int64, error) {
+	seqTable := db.GetTable("sqlite_sequence")
+	if seqTable == nil {
+		return 0, 0, fmt.Errorf("%w: sqlite_sequence", ErrNotFound)
+	}
+
+	c := db.bt.NewCursor(seqTable.PageNum)
+	ok, err := c.First()
+	for ; ok && err == nil; ok, err = c.Next() {
+		rec := c.Cell().Record
+		name, _ := rec.Value(0).(string)
+		if strings.EqualFold(name, table.Name) {
+			seq, _ := toInteger(rec.Value(1)).(int64)
+			return seq, int64(c.Cell().RowID), nil
+		}
+	}
+	return 0, 0, err
+}
+
+// updateSequence records rowID in sqlite_sequence when it is the largest
+// rowid used so far
+func (db *DB) updateSequence(table *Table, rowID int64) error {
+	seq, seqRowID, err := db.readSequence(table)
+	if err != nil {
+		return err
+	}
+	record := db.bt.MakeRecord([]any{table.Name, rowID})
+
+	seqTable := db.GetTable("sqlite_sequence")
+	if seqRowID != 0 {
+		if seq >= rowID {
+			return nil
+		}
+		return db.bt.ReplaceRow(seqTable.PageNum, seqRowID, record)
+	}
+
+	newID, err := db.newRowID(seqTable)
+	if err != nil {
+		return err
+	}
+	return db.bt.InsertRow(seqTable.PageNum, newID, record)
+}
+
+// ----------------------------------------------------------------------------
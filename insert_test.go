@@ -0,0 +1,153 @@
+package sqlite
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestInsert(t *testing.T) {
+	runSQLTests(t, "", []sqlTest{
+		{"values", `create table t(a integer primary key, b text, c real, d);
+insert into t(b, c, d) values ('x', 1, x'0102'), ('y', 2.5, null);
+select a, b, c, typeof(c), hex(d) from t`, "1|x|1.0|real|0102\n2|y|2.5|real|\n"},
+		{"column order", `create table t(a, b, c default 'dflt');
+insert into t(c, a) values (3, 1);
+insert into t(b) values (2);
+select * from t`, "1||3\n|2|dflt\n"},
+		{"default values", `create table t(a integer primary key, b default (1 + 2), c default 'z');
+insert into t default values;
+insert into t default values;
+select * from t`, "1|3|z\n2|3|z\n"},
+		{"explicit rowid", `create table t(a);
+insert into t(rowid, a) values (10, 'ten');
+insert into t values ('next');
+select rowid, a from t`, "10|ten\n11|next\n"},
+		{"insert select", `create table s(x);
+insert into s values (1), (2), (3);
+create table t(x, y);
+insert into t select x, x * x from s where x > 1;
+select * from t`, "2|4\n3|9\n"},
+		{"insert select self", `create table t(x);
+insert into t values (1), (2);
+insert into t select x + 10 from t;
+select * from t`, "1\n2\n11\n12\n"},
+		{"integer affinity", `create table t(a integer, b int);
+insert into t values ('12', '3.0'), ('1e2', ' 7'), ('abc', 4.5);
+select a, typeof(a), b, typeof(b) from t`, "12|integer|3|integer\n100|integer|7|integer\nabc|text|4.5|real\n"},
+		{"real affinity", `create table t(a real);
+insert into t values (1), ('2'), (3.5), ('x');
+select a, typeof(a) from t`, "1.0|real\n2.0|real\n3.5|real\nx|text\n"},
+		{"real affinity arithmetic", `create table t(a real);
+insert into t values (2);
+select a, a / 4, a * 3 from t`, "2.0|0.5|6.0\n"},
+		{"numeric affinity", `create table t(a numeric);
+insert into t values ('10'), ('2.50'), ('3.0'), ('x'), (x'41');
+select a, typeof(a) from t`, "10|integer\n2.5|real\n3|integer\nx|text\nA|blob\n"},
+		{"text affinity", `create table t(a text);
+insert into t values (1), (2.5), (null);
+select a, typeof(a) from t`, "1|text\n2.5|text\n|null\n"},
+		{"replace", `create table t(a integer primary key, b);
+insert into t values (1, 'one');
+insert or replace into t values (1, 'uno');
+select * from t`, "1|uno\n"},
+		{"ignore", `create table t(a unique, b);
+insert into t values (1, 'one');
+insert or ignore into t values (1, 'uno'), (2, 'two');
+select * from t`, "1|one\n2|two\n"},
+		{"index kept in sync", `create table t(a, b);
+create index t_b on t(b);
+insert into t values (1, 'c'), (2, 'a'), (3, 'b');
+select a from t where b = 'b'`, "3\n"},
+		{"index order", `create table t(a, b);
+create index t_b on t(b);
+insert into t values (1, 'c'), (2, 'a'), (3, 'b');
+select b from t order by b`, "a\nb\nc\n"},
+		{"simple case", "select case 1 when 1 then 'one' when 2 then 'two' else 'other' end, case 2.0 when 2 then 'two' end, case 'a' when 'A' then 'upper' else 'lower' end", "one|two|lower\n"},
+		{"simple case null", "select case null when null then 'matched' else 'unmatched' end", "unmatched\n"},
+		{"searched case", "select case when 0 then 'a' when '1' then 'b' end, case when null then 1 else 2 end", "b|2\n"},
+		{"round", "select round(2.5), round(-2.5), round(0.125, 2), round(1.005, 2), round(123.456, -1), round(null)", "3.0|-3.0|0.13|1.0|123.0|\n"},
+		{"alias in where", `create table t(a);
+insert into t values (1), (2), (3);
+select a * 2 as d from t where d > 2`, "4\n6\n"},
+		{"alias in having", `create table t(a, b);
+insert into t values (1, 'x'), (2, 'x'), (3, 'y');
+select b, sum(a) as s from t group by b having s > 2`, "x|3\ny|3\n"},
+		{"column shadows alias", `create table t(a, b);
+insert into t values (1, 10), (2, 20);
+select b as a from t where a = 1`, "10\n"},
+		{"distinct collation", `create table t(a text collate nocase);
+insert into t values ('a'), ('A'), ('b');
+select count(distinct a) from t`, "2\n"},
+		{"distinct collation explicit", "select count(distinct x collate nocase) from (select 'a' x union all select 'A')", "1\n"},
+	})
+}
+
+// TestInsertSplits inserts enough rows, out of rowid order and with overflow
+// payloads, to split leaf and interior pages of the table and its indexes
+func TestInsertSplits(t *testing.T) {
+	db := openTest(t, "create table t(id integer primary key, name text, data blob); create index t_name on t(name)")
+
+	const n = 3000
+	for i := 0; i < n; i += 100 {
+		sql := "insert into t values "
+		for j := i; j < i+100; j++ {
+			id := j*7919%n + 1
+			if j > i {
+				sql += ", "
+			}
+			sql += fmt.Sprintf("(%d, 'name %05d', zeroblob(%d))", id, n-id, id%7*1000)
+		}
+		query(t, db, sql)
+	}
+	checkIntegrity(t, db)
+
+	tests := []sqlTest{
+		{"count", "select count(*), sum(id), sum(length(data)) from t", "3000|4501500|8998000\n"},
+		{"lookup", "select id, name from t where id = 1234", "1234|name 01766\n"},
+		{"index", "select id from t where name = 'name 00010'", "2990\n"},
+		{"index order", "select name from t order by name limit 3", "name 00000\nname 00001\nname 00002\n"},
+	}
+	for _, tt := range tests {
+		if got := query(t, db, tt.sql); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestInsertErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		sql  string
+		err  string
+	}{
+		{"too few values", "create table t(a, b); insert into t values (1)", "table t has 2 columns but 1 values were supplied"},
+		{"too many values", "create table t(a, b); insert into t(a) values (1, 2)", "2 values for 1 columns"},
+		{"no such column", "create table t(a); insert into t(b) values (1)", "table t has no column named b"},
+		{"no such table", "insert into nope values (1)", "no such table: nope"},
+		{"unique", "create table t(a unique); insert into t values (1); insert into t values (1)", "UNIQUE constraint failed: t.a"},
+		{"unique pair", "create table t(a, b, primary key(a, b)); insert into t values (1, 2), (1, 2)", "UNIQUE constraint failed: t.a, t.b"},
+		{"primary key", "create table t(a integer primary key); insert into t values (1); insert into t values (1)", "UNIQUE constraint failed: t.a"},
+		{"not null", "create table t(a not null); insert into t values (null)", "NOT NULL constraint failed: t.a"},
+		{"rowid type", "create table t(a integer primary key); insert into t values ('x')", "datatype mismatch"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTest(t, "")
+			if _, err := queryErr(db, tt.sql); err == nil || err.Error() != tt.err {
+				t.Errorf("got error %v, want %s", err, tt.err)
+			}
+		})
+	}
+}
+
+// TestInsertStatementRollback checks that a statement failing part way
+// through leaves none of its rows behind
+func TestInsertStatementRollback(t *testing.T) {
+	db := openTest(t, "create table t(a unique); insert into t values (1)")
+	if _, err := queryErr(db, "insert into t values (2), (3), (1)"); err == nil {
+		t.Fatal("duplicate insert succeeded")
+	}
+	if got := query(t, db, "select a from t"); got != "1\n" {
+		t.Errorf("got %q, want %q", got, "1\n")
+	}
+}
@@ -0,0 +1,479 @@
+package sqlite
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/elordeiro/SQLite-DBReader/btree"
+	"github.com/elordeiro/SQLite-DBReader/pager"
+	"github.com/elordeiro/SQLite-DBReader/record"
+)
+
+// Constants ------------------------------------------------------------------
+
+const (
+	MaxIntegrityErrors = 100
+	SQLiteCorruptCode  = 11 // SQLITE_CORRUPT, reported for unreadable pages
+)
+
+// ----------------------------------------------------------------------------
+
+// Custom Types ---------------------------------------------------------------
+type integrityCheck struct {
+	db        *DB
+	pageCount int64
+	refs      []bool   // Pages referenced so far
+	problems  []string // Messages in PRAGMA integrity_check format
+	prefix    string   // Location prepended to each message
+	cell      int      // Cell being checked, which SQLite also names for right children
+	err       error    // I/O error that stopped the check
+
+	// Key order of the b-tree being checked, which is walked from its
+	// largest key down
+	isIndex bool
+	colls   []record.Collation
+	desc    []bool
+	lastKey *treeKey
+}
+
+type treeKey struct {
+	rowID  int64
+	record *record.Record
+}
+
+// ----------------------------------------------------------------------------
+
+// IntegrityCheck walks every b-tree in the schema and the freelist and
+// returns the problems found in the format of PRAGMA integrity_check, or
+// "ok". The error is only set when the file could not be read.
+func (db *DB) IntegrityCheck() ([]string, error) {
+	unlock, err := db.readLock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	ic := &integrityCheck{
+		db:        db,
+		pageCount: db.bt.Pager.PageCount(),
+	}
+	ic.refs = make([]bool, ic.pageCount+1)
+	if ic.pageCount == 0 {
+		return []string{"ok"}, nil
+	}
+
+	header, err := db.bt.Pager.ReadPage(1)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check the freelist
+	ic.prefix = "Freelist: "
+	freelistTrunk := binary.BigEndian.Uint32(header[32:36])
+	freelistCount := binary.BigEndian.Uint32(header[36:40])
+	ic.checkList(true, int64(freelistTrunk), int64(freelistCount))
+
+	// The header of an auto-vacuum database holds the largest root page
+	ic.prefix = ""
+	if db.bt.AutoVacuum != btree.AutoVacuumNone {
+		largest := int64(1)
+		for _, table := range db.tables {
+			largest = max(largest, table.PageNum)
+		}
+		if inHeader := int64(binary.BigEndian.Uint32(header[52:56])); largest != inHeader {
+			ic.report("max rootpage (%d) disagrees with header (%d)", largest, inHeader)
+		}
+	} else if binary.BigEndian.Uint32(header[64:68]) != 0 {
+		ic.report("incremental_vacuum enabled with a max rootpage of zero")
+	}
+
+	// Check sqlite_schema and every table and index b-tree
+	ic.checkTree(1, nil)
+	for _, table := range db.tables {
+		if table.PageNum > 0 {
+			ic.checkTree(table.PageNum, table)
+		}
+	}
+	if ic.err != nil {
+		return nil, ic.err
+	}
+
+	// Every page must belong to a b-tree, an overflow chain, the freelist or
+	// the pointer map, and pointer map pages to nothing else
+	ic.prefix = ""
+	for pageNum := int64(1); pageNum <= ic.pageCount && !ic.full(); pageNum++ {
+		isPtrmap := db.bt.IsPtrmapPage(pageNum)
+		if !ic.refs[pageNum] && !isPtrmap {
+			ic.report("Page %d: never used", pageNum)
+		}
+		if ic.refs[pageNum] && isPtrmap {
+			ic.report("Page %d: pointer map referenced", pageNum)
+		}
+	}
+
+	if len(ic.problems) == 0 {
+		return []string{"ok"}, nil
+	}
+	return append([]string{"*** in database main ***"}, ic.problems...), nil
+}
+
+// Checkers -------------------------------------------------------------------
+func (ic *integrityCheck) checkTree(root int64, table *Table) {
+	ic.lastKey = nil
+	ic.colls, ic.desc = nil, nil
+	if table != nil && table.Type == TableTypeIndex {
+		ic.colls, ic.desc, _ = ic.db.IndexKeyOrder(table)
+	}
+
+	ic.prefix = ""
+	if root > 1 {
+		ic.checkPtrmap(root, btree.PtrmapRootPage, 0)
+	}
+	ic.checkTreePage(root, root)
+}
+
+// checkTreePage checks a page and its subtree and returns the height of the
+// subtree. Like SQLite it counts leaves as 0, as well as pages that could not
+// be checked.
+func (ic *integrityCheck) checkTreePage(root int64, pageNum int64) int {
+	if ic.full() || !ic.checkRef(pageNum) {
+		return 0
+	}
+
+	savedPrefix, savedCell := ic.prefix, ic.cell
+	defer func() { ic.prefix, ic.cell = savedPrefix, savedCell }()
+	ic.prefix = fmt.Sprintf("Tree %d page %d: ", root, pageNum)
+
+	pageBuf, err := ic.db.bt.Pager.ReadPage(pageNum)
+	if err != nil {
+		ic.err = err
+		return 0
+	}
+	hdrOff := btree.HeaderOffset(pageNum)
+	usable := int(ic.db.bt.UsableSize)
+
+	header, err := btree.ParseHeader(pageBuf[hdrOff:])
+	if err != nil {
+		ic.report("btreeInitPage() returns error code %d", SQLiteCorruptCode)
+		return 0
+	}
+
+	isIndex := header.Type == btree.InteriorIndexPage || header.Type == btree.LeafIndexPage
+	isLeaf := header.Type == btree.LeafTablePage || header.Type == btree.LeafIndexPage
+	if pageNum == root {
+		ic.isIndex = isIndex
+	} else if isIndex != ic.isIndex {
+		ic.report("page type 0x%02x does not match the tree type", header.Type)
+		return 0
+	}
+
+	ptrsEnd := hdrOff + header.Len() + 2*header.CellCount
+	if ptrsEnd > usable {
+		ic.report("btreeInitPage() returns error code %d", SQLiteCorruptCode)
+		return 0
+	}
+
+	contentStart := int(binary.BigEndian.Uint16(pageBuf[hdrOff+5:]))
+	if contentStart == 0 {
+		contentStart = 65536
+	}
+	problemsAtStart := len(ic.problems)
+	usage := make([]bool, usable) // Bytes of the page in use
+	overlap := -1
+
+	// SQLite checks the right child first, and in an auto-vacuum database
+	// keeps reporting the cells of the page under it
+	cellPrefix := func() string {
+		return fmt.Sprintf("Tree %d page %d cell %d: ", root, pageNum, ic.cell)
+	}
+	depth := -1
+	if !isLeaf {
+		child := int64(header.RightMostPointer)
+		if ic.db.bt.AutoVacuum != btree.AutoVacuumNone {
+			cellPrefix = func() string {
+				return fmt.Sprintf("Tree %d page %d right child: ", root, pageNum)
+			}
+			ic.prefix = cellPrefix()
+			ic.checkPtrmap(child, btree.PtrmapBTree, pageNum)
+		} else {
+			ic.prefix = cellPrefix()
+		}
+		depth = ic.checkTreePage(root, child)
+	}
+
+	// Cells are checked from the last to the first, each before the subtree
+	// to its left, so keys are seen in descending order
+	cellPtrs := btree.ParseCellPtrs(pageBuf[hdrOff:], header)
+	canEqual := isLeaf
+	for i := len(cellPtrs) - 1; i >= 0; i-- {
+		if ic.full() {
+			return 0
+		}
+		ptr := cellPtrs[i]
+		ic.cell = i
+		ic.prefix = cellPrefix()
+
+		// Check the cell lies within the content area
+		lowest := max(contentStart, ptrsEnd)
+		if ptr < lowest || ptr > usable-4 {
+			ic.report("Offset %d out of range %d..%d", ptr, lowest, usable-4)
+			continue
+		}
+		extent, err := ic.db.bt.ParseCellExtent(header.Type, pageBuf, ptr)
+		if err != nil || ptr+extent.Size > usable {
+			ic.report("Extends off end of page")
+			continue
+		}
+		if at := markUsed(usage, ptr, extent.Size); at >= 0 && overlap < 0 {
+			overlap = at
+		}
+
+		ic.checkKey(pageNum, header, i, pageBuf, ptr, extent, canEqual)
+		canEqual = false
+
+		// Check the overflow chain holds the rest of the payload
+		if extent.OverflowPage != 0 {
+			overflowLen := uint64(ic.db.bt.UsableSize - 4)
+			expected := (extent.PayloadSize - uint64(extent.Local) + overflowLen - 1) / overflowLen
+			ic.checkPtrmap(int64(extent.OverflowPage), btree.PtrmapOverflow1, pageNum)
+			ic.checkList(false, int64(extent.OverflowPage), int64(expected))
+		}
+
+		if !isLeaf {
+			child := int64(binary.BigEndian.Uint32(pageBuf[ptr:]))
+			ic.checkPtrmap(child, btree.PtrmapBTree, pageNum)
+			if childDepth := ic.checkTreePage(root, child); childDepth != depth {
+				ic.report("Child page depth differs")
+				depth = childDepth
+			}
+		}
+	}
+
+	// Account for every byte of the content area
+	ic.prefix = ""
+	freeblock := int(binary.BigEndian.Uint16(pageBuf[hdrOff+1:]))
+	for freeblock != 0 && !ic.full() {
+		if freeblock < contentStart || freeblock > usable-4 {
+			ic.report("Freeblock offset %d out of range on page %d", freeblock, pageNum)
+			break
+		}
+		size := int(binary.BigEndian.Uint16(pageBuf[freeblock+2:]))
+		if freeblock+size > usable {
+			ic.report("Freeblock at %d extends off end of page %d", freeblock, pageNum)
+			break
+		}
+		if at := markUsed(usage, freeblock, size); at >= 0 && overlap < 0 {
+			overlap = at
+		}
+
+		next := int(binary.BigEndian.Uint16(pageBuf[freeblock:]))
+		if next != 0 && next <= freeblock+size {
+			ic.report("Freeblocks out of order on page %d", pageNum)
+			break
+		}
+		freeblock = next
+	}
+
+	if overlap >= 0 {
+		ic.report("Multiple uses for byte %d of page %d", overlap, pageNum)
+	} else if len(ic.problems) == problemsAtStart {
+		fragmented := 0
+		for off := contentStart; off < usable; off++ {
+			if !usage[off] {
+				fragmented++
+			}
+		}
+		if reported := int(pageBuf[hdrOff+7]); fragmented != reported {
+			ic.report("Fragmentation of %d bytes reported as %d on page %d", fragmented, reported, pageNum)
+		}
+	}
+
+	return depth + 1
+}
+
+// checkKey verifies the b-tree keys seen so far are in descending order. A
+// rowid may only equal the one before it when canEqual is set, which SQLite
+// allows for the first cell checked on a leaf: the one with the same key as
+// the interior cell above. Index keys must all be distinct.
+func (ic *integrityCheck) checkKey(pageNum int64, header *btree.Header, cellIdx int, pageBuf []byte, ptr int, extent *btree.CellExtent, canEqual bool) {
+	if !ic.isIndex {
+		off := ptr
+		if header.Type == btree.InteriorTablePage {
+			off += btree.LCPLen
+		} else {
+			_, n := record.ParseVarInt(pageBuf[off:])
+			off += n
+		}
+		rowID, _ := record.ParseVarInt(pageBuf[off:])
+
+		key := int64(rowID)
+		if ic.lastKey != nil {
+			last := ic.lastKey.rowID
+			if key > last || (key == last && !canEqual) {
+				ic.report("Rowid %d out of order", key)
+			}
+		}
+		ic.lastKey = &treeKey{rowID: key}
+		return
+	}
+
+	page := &btree.Page{Num: pageNum, Header: header}
+	payload, err := ic.db.bt.ReadPayload(page, cellIdx, pageBuf, extent.PayloadOff, extent.PayloadSize)
+	if err != nil {
+		ic.reportError(err)
+		return
+	}
+	record, err := record.ReadRecord(payload, ic.db.bt.Encoding)
+	if err != nil {
+		ic.reportError(err)
+		return
+	}
+
+	if ic.lastKey != nil && ic.compareRecords(record, ic.lastKey.record) >= 0 {
+		ic.report("Index key out of order")
+	}
+	ic.lastKey = &treeKey{record: record}
+}
+
+// checkList follows a freelist trunk chain or an overflow chain and verifies
+// it holds the expected number of pages
+func (ic *integrityCheck) checkList(isFreeList bool, pageNum int64, expected int64) {
+	remaining := expected
+	problemsAtStart := len(ic.problems)
+
+	for pageNum != 0 && !ic.full() {
+		if !ic.checkRef(pageNum) {
+			break
+		}
+		remaining--
+
+		buf, err := ic.db.bt.Pager.ReadPage(pageNum)
+		if err != nil {
+			ic.err = err
+			return
+		}
+
+		next := int64(binary.BigEndian.Uint32(buf[0:4]))
+		if isFreeList {
+			ic.checkPtrmap(pageNum, btree.PtrmapFreePage, 0)
+			leafCount := int64(binary.BigEndian.Uint32(buf[4:8]))
+			if leafCount > ic.db.bt.UsableSize/4-2 {
+				ic.report("freelist leaf count too big on page %d", pageNum)
+				remaining--
+			} else {
+				for i := range leafCount {
+					leaf := int64(binary.BigEndian.Uint32(buf[8+4*i:]))
+					ic.checkPtrmap(leaf, btree.PtrmapFreePage, 0)
+					ic.checkRef(leaf)
+				}
+				remaining -= leafCount
+			}
+		} else if remaining > 0 {
+			ic.checkPtrmap(next, btree.PtrmapOverflow2, pageNum)
+		}
+
+		pageNum = next
+	}
+
+	if remaining != 0 && len(ic.problems) == problemsAtStart {
+		what := "overflow list length"
+		if isFreeList {
+			what = "size"
+		}
+		ic.report("%s is %d but should be %d", what, expected-remaining, expected)
+	}
+}
+
+// checkPtrmap verifies the pointer map entry of a page in an auto-vacuum
+// database matches where the page was found
+func (ic *integrityCheck) checkPtrmap(pageNum int64, ptrType uint8, parent int64) {
+	if ic.db.bt.AutoVacuum == btree.AutoVacuumNone {
+		return
+	}
+	entry, err := ic.db.bt.ReadPtrmap(pageNum)
+	if err != nil {
+		if !errors.Is(err, pager.ErrCorrupt) {
+			ic.err = err
+			return
+		}
+		ic.report("Failed to read ptrmap key=%d", pageNum)
+		return
+	}
+	if entry.Type != ptrType || entry.Parent != parent {
+		ic.report("Bad ptr map entry key=%d expected=(%d,%d) got=(%d,%d)",
+			pageNum, ptrType, parent, entry.Type, entry.Parent)
+	}
+}
+
+// checkRef marks a page as referenced, reporting invalid and repeated
+// references
+func (ic *integrityCheck) checkRef(pageNum int64) bool {
+	if pageNum < 1 || pageNum > ic.pageCount {
+		ic.report("invalid page number %d", pageNum)
+		return false
+	}
+	if ic.refs[pageNum] {
+		ic.report("2nd reference to page %d", pageNum)
+		return false
+	}
+	ic.refs[pageNum] = true
+	return true
+}
+
+// ----------------------------------------------------------------------------
+
+// Helpers --------------------------------------------------------------------
+func (ic *integrityCheck) report(format string, args ...any) {
+	if ic.full() {
+		return
+	}
+	ic.problems = append(ic.problems, ic.prefix+fmt.Sprintf(format, args...))
+}
+
+func (ic *integrityCheck) reportError(err error) {
+	var corruptErr *pager.CorruptError
+	if errors.As(err, &corruptErr) {
+		ic.report("%s", corruptErr.Msg)
+		return
+	}
+	ic.report("%v", err)
+}
+
+func (ic *integrityCheck) full() bool {
+	return len(ic.problems) >= MaxIntegrityErrors || ic.err != nil
+}
+
+// markUsed records that a range of the page is in use and returns the first
+// byte that was already in use, or -1
+func markUsed(usage []bool, off int, size int) int {
+	overlap := -1
+	for i := off; i < off+size; i++ {
+		if usage[i] && overlap < 0 {
+			overlap = i
+		}
+		usage[i] = true
+	}
+	return overlap
+}
+
+func (ic *integrityCheck) compareRecords(a, b *record.Record) int {
+	n := min(len(a.ColumnTypes), len(b.ColumnTypes))
+	for i := range n {
+		coll := ic.db.binaryCollation
+		if i < len(ic.colls) {
+			coll = ic.colls[i]
+		}
+
+		c := record.CompareValues(a.Value(i), b.Value(i), coll)
+		if i < len(ic.desc) && ic.desc[i] {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return len(a.ColumnTypes) - len(b.ColumnTypes)
+}
+
+// ----------------------------------------------------------------------------
@@ -0,0 +1,110 @@
+package sqlite
+
+import (
+	"encoding/binary"
+	"strings"
+	"testing"
+
+	"github.com/elordeiro/SQLite-DBReader/btree"
+)
+
+const integritySetup = `
+create table t(a integer primary key, b text);
+insert into t values (1, 'one'), (2, 'two'), (3, 'three');
+create table big(a integer primary key, b text);
+insert into big with recursive n(i) as (select 1 union all select i + 1 from n where i < 200)
+select i, hex(randomblob(50)) from n;
+create table gone(a);
+insert into gone with recursive n(i) as (select 1 union all select i + 1 from n where i < 20)
+select zeroblob(1000) from n;
+drop table gone;`
+
+// TestIntegrityDamage damages a database and checks the integrity check
+// reports the same problems as pragma integrity_check in sqlite3 3.50. Where
+// the damage leaves a row unreadable, the sqlite3 shell also prints the error
+// that stops the rest of its check, which IntegrityCheck has no part of.
+func TestIntegrityDamage(t *testing.T) {
+	be32 := func(v uint32) []byte { return binary.BigEndian.AppendUint32(nil, v) }
+
+	// loadPage reads a page of the test database before it is damaged
+	loadPage := func(t *testing.T, db *DB, pageNum int64) (*btree.Page, []byte) {
+		t.Helper()
+		page, buf, err := db.bt.LoadPage(pageNum)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return page, buf
+	}
+
+	tests := []struct {
+		name   string
+		damage func(t *testing.T, db *DB) []pageWrite
+		want   string
+	}{
+		{"rowid out of order", func(t *testing.T, db *DB) []pageWrite {
+			root := db.GetTable("t").PageNum
+			page, _ := loadPage(t, db, root)
+			// The rowid follows the one-byte payload size
+			return []pageWrite{{root, int64(page.CellPtrs[1]) + 1, []byte{7}}}
+		}, "Tree 2 page 2 cell 1: Rowid 7 out of order"},
+		{"page referenced twice", func(t *testing.T, db *DB) []pageWrite {
+			root := db.GetTable("big").PageNum
+			page, buf := loadPage(t, db, root)
+			return []pageWrite{{root, 8, buf[page.CellPtrs[0] : page.CellPtrs[0]+4]}}
+		}, "Tree 3 page 3 cell 8: Rowid 171 out of order\n" +
+			"Tree 3 page 3 cell 0: 2nd reference to page 5\n" +
+			"Page 4: never used"},
+		{"right child referenced twice", func(t *testing.T, db *DB) []pageWrite {
+			// The freelist is checked before the b-trees
+			root := db.GetTable("big").PageNum
+			buf, err := db.bt.Pager.ReadPage(1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return []pageWrite{{root, 8, buf[32:36]}}
+		}, "Tree 3 page 3 cell 0: 2nd reference to page 16\n" +
+			"Page 4: never used"},
+		{"interior key out of order", func(t *testing.T, db *DB) []pageWrite {
+			root := db.GetTable("big").PageNum
+			page, _ := loadPage(t, db, root)
+			// The key follows the left child pointer
+			return []pageWrite{{root, int64(page.CellPtrs[0]) + 4, []byte{0x7f}}}
+		}, "Tree 3 page 3 cell 0: Rowid 127 out of order"},
+		{"bad page type", func(t *testing.T, db *DB) []pageWrite {
+			root := db.GetTable("big").PageNum
+			page, _ := loadPage(t, db, root)
+			return []pageWrite{{int64(page.Header.RightMostPointer), 0, []byte{0x07}}}
+		}, "Tree 3 page 4: btreeInitPage() returns error code 11"},
+		{"freelist count", func(t *testing.T, db *DB) []pageWrite {
+			return []pageWrite{{1, 36, be32(3)}}
+		}, "Freelist: size is 10 but should be 3"},
+		{"orphan pages", func(t *testing.T, db *DB) []pageWrite {
+			return []pageWrite{{1, 32, be32(0)}, {1, 36, be32(0)}}
+		}, "Page 14: never used\nPage 15: never used\nPage 16: never used\nPage 17: never used\n" +
+			"Page 18: never used\nPage 19: never used\nPage 20: never used\nPage 21: never used\n" +
+			"Page 22: never used\nPage 23: never used"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTest(t, integritySetup)
+			writes := tt.damage(t, db)
+			path, pageSize := db.path, db.bt.PageSize
+			db.Close()
+			damagePages(t, path, pageSize, writes...)
+
+			db, err := Open(path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			got, err := db.IntegrityCheck()
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := "*** in database main ***\n" + tt.want
+			if strings.Join(got, "\n") != want {
+				t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), want)
+			}
+		})
+	}
+}
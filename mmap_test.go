@@ -0,0 +1,68 @@
+package sqlite
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// TestMmap reads and writes through a memory-mapped file as it grows and
+// shrinks, by this handle and by sqlite3. Pages read from the mapping skip
+// the page cache, which shows how much of the file is mapped.
+func TestMmap(t *testing.T) {
+	const mmapSize = 256 << 10
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"), &Options{MmapSize: mmapSize})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// scan reads every row and reports whether a page came from the cache
+	scan := func(want string) bool {
+		t.Helper()
+		before := db.GetCacheStats()
+		if got := query(t, db, "select count(*), sum(length(b)) from t"); got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+		after := db.GetCacheStats()
+		return after.Hits+after.Misses != before.Hits+before.Misses
+	}
+
+	query(t, db, "create table t(a integer primary key, b text)")
+	query(t, db, "insert into t with recursive n(i) as (select 1 union all select i + 1 from n where i < 500) "+
+		"select i, hex(randomblob(100)) from n")
+	if scan("500|100000\n") {
+		t.Error("the file grown by this handle is not mapped")
+	}
+
+	query(t, db, "insert into t with recursive n(i) as (select 501 union all select i + 1 from n where i < 3000) "+
+		"select i, hex(randomblob(100)) from n")
+	if !scan("3000|600000\n") {
+		t.Error("pages past the mmap size were read from the mapping")
+	}
+
+	query(t, db, "delete from t where a > 200; vacuum")
+	if scan("200|40000\n") {
+		t.Error("the file shrunk by VACUUM is not mapped")
+	}
+	checkIntegrity(t, db)
+
+	sql := "insert into t select a + 1000, b from t; insert into t select a + 2000, b from t"
+	if out, err := sqlite3Command(t, db.path, sql).CombinedOutput(); err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+	if scan("800|160000\n") {
+		t.Error("the file grown by sqlite3 is not mapped")
+	}
+
+	if out, err := sqlite3Command(t, db.path, "delete from t where a > 100; vacuum").CombinedOutput(); err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+	if scan("100|20000\n") {
+		t.Error("the file shrunk by sqlite3 is not mapped")
+	}
+	query(t, db, "update t set b = lower(b) where a % 2 = 0")
+	if got := query(t, db, "select count(*) from t where b = lower(b)"); got != "50\n" {
+		t.Errorf("rows updated through the mapping: got %q, want %q", got, "50\n")
+	}
+	checkIntegrity(t, db)
+}
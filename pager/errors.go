@@ -0,0 +1,42 @@
+package pager
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrBusy     = errors.New("database is locked")
+	ErrCorrupt  = errors.New("database disk image is malformed")
+	ErrNotADB   = errors.New("file is not a database")
+	ErrReadOnly = errors.New("attempt to write a readonly database")
+)
+
+// CorruptError reports malformed content at a specific page and cell. Cell is
+// -1 when the problem is not tied to a single cell.
+type CorruptError struct {
+	Page int64
+	Cell int
+	Msg  string
+}
+
+func (e *CorruptError) Error() string {
+	if e.Cell < 0 {
+		return fmt.Sprintf("%v: page %d: %s", ErrCorrupt, e.Page, e.Msg)
+	}
+	return fmt.Sprintf("%v: page %d cell %d: %s", ErrCorrupt, e.Page, e.Cell, e.Msg)
+}
+
+func (e *CorruptError) Unwrap() error {
+	return ErrCorrupt
+}
+
+// CorruptPage returns a CorruptError for a problem with a page as a whole
+func CorruptPage(pageNum int64, format string, args ...any) error {
+	return &CorruptError{Page: pageNum, Cell: -1, Msg: fmt.Sprintf(format, args...)}
+}
+
+// CorruptCell returns a CorruptError for a problem with one cell of a page
+func CorruptCell(pageNum int64, cellIdx int, format string, args ...any) error {
+	return &CorruptError{Page: pageNum, Cell: cellIdx, Msg: fmt.Sprintf(format, args...)}
+}
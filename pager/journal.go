@@ -0,0 +1,280 @@
+package pager
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+)
+
+// Constants ------------------------------------------------------------------
+/*
+Rollback journal header, padded to a sector:
+	magic            8 bytes  d9 d5 05 f9 20 a1 63 d7
+	record count     4 bytes  0 until the journal is synced, -1 for "to EOF"
+	checksum nonce   4 bytes
+	database size    4 bytes  Pages in the database before the transaction
+	sector size      4 bytes
+	page size        4 bytes
+
+Each record holds a page number, the original page content and a checksum of
+the nonce plus every 200th byte of the page, counting back from the end.
+*/
+
+const (
+	JournalMagic      = "\xd9\xd5\x05\xf9\x20\xa1\x63\xd7"
+	JournalHeaderLen  = 28
+	JournalSectorSize = 512
+)
+
+// ----------------------------------------------------------------------------
+
+// Custom Types ---------------------------------------------------------------
+// journal is the rollback journal of a write transaction. It holds the
+// original content of every page of the database file modified by the
+// transaction, so a failed or interrupted commit can be undone.
+type journal struct {
+	vfs      VFS
+	path     string
+	file     File
+	pageSize int64
+	nonce    uint32
+	records  uint32
+	size     int64
+	pages    map[int64]bool // Pages already saved
+}
+
+// ----------------------------------------------------------------------------
+
+// Journal Writing ------------------------------------------------------------
+// openJournal creates a journal for a database of dbPages pages
+func openJournal(vfs VFS, path string, pageSize, dbPages int64) (*journal, error) {
+	file, err := vfs.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	j := &journal{
+		vfs:      vfs,
+		path:     path,
+		file:     file,
+		pageSize: pageSize,
+		nonce:    rand.Uint32(),
+		size:     JournalSectorSize,
+		pages:    make(map[int64]bool),
+	}
+	header := make([]byte, JournalSectorSize)
+	copy(header, JournalMagic)
+	binary.BigEndian.PutUint32(header[12:], j.nonce)
+	binary.BigEndian.PutUint32(header[16:], uint32(dbPages))
+	binary.BigEndian.PutUint32(header[20:], JournalSectorSize)
+	binary.BigEndian.PutUint32(header[24:], uint32(pageSize))
+	if _, err := file.WriteAt(header, 0); err != nil {
+		file.Close()
+		vfs.Remove(path)
+		return nil, err
+	}
+	return j, nil
+}
+
+// add saves the original content of a page, once per transaction
+func (j *journal) add(pageNum int64, buf []byte) error {
+	if j.pages[pageNum] {
+		return nil
+	}
+
+	record := binary.BigEndian.AppendUint32(nil, uint32(pageNum))
+	record = append(record, buf...)
+	record = binary.BigEndian.AppendUint32(record, journalChecksum(j.nonce, buf))
+	if _, err := j.file.WriteAt(record, j.size); err != nil {
+		return err
+	}
+
+	j.size += int64(len(record))
+	j.records++
+	j.pages[pageNum] = true
+	return nil
+}
+
+// finalize makes the journal durable before the database file is written.
+// The record count is only filled in once the records are on disk, so a
+// journal torn by a crash is never replayed.
+func (j *journal) finalize() error {
+	if err := j.file.Sync(); err != nil {
+		return err
+	}
+	count := binary.BigEndian.AppendUint32(nil, j.records)
+	if _, err := j.file.WriteAt(count, 8); err != nil {
+		return err
+	}
+	return j.file.Sync()
+}
+
+// remove deletes the journal, which commits the transaction once the
+// database file holds its changes
+func (j *journal) remove() error {
+	if err := j.file.Close(); err != nil {
+		return err
+	}
+	return j.vfs.Remove(j.path)
+}
+
+func journalChecksum(nonce uint32, buf []byte) uint32 {
+	sum := nonce
+	for i := len(buf) - 200; i > 0; i -= 200 {
+		sum += uint32(buf[i])
+	}
+	return sum
+}
+
+// ----------------------------------------------------------------------------
+
+// Journal Playback -----------------------------------------------------------
+// LockShared takes a SHARED lock on a database file for reading. A journal
+// left behind by a writer that stopped before committing is hot, and is
+// rolled back and deleted first. A journal is never hot while its writer
+// still holds RESERVED.
+func LockShared(vfs VFS, db File, path string, readOnly bool) error {
+	if err := db.Lock(SharedLock); err != nil {
+		return err
+	}
+	hot, err := hotJournal(vfs, db, path)
+	if err == nil && hot && readOnly {
+		err = fmt.Errorf("%w: a hot journal must be rolled back", ErrReadOnly)
+	}
+	if err == nil && hot {
+		err = rollbackHotJournal(vfs, db, path)
+	}
+	if err != nil {
+		db.Unlock(NoLock)
+		return err
+	}
+	return nil
+}
+
+// hotJournal reports whether the journal at path holds the changes of a
+// writer that stopped before committing
+func hotJournal(vfs VFS, db File, path string) (bool, error) {
+	file, err := vfs.OpenFile(path, os.O_RDONLY, 0)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	info, err := file.Stat()
+	file.Close()
+	if err != nil || info.Size() == 0 {
+		return false, err
+	}
+
+	reserved, err := db.CheckReservedLock()
+	return !reserved, err
+}
+
+// rollbackHotJournal plays back a hot journal under an EXCLUSIVE lock, then
+// deletes it and returns to SHARED. RESERVED is skipped on the way, since
+// other processes would take the journal for a live one while it is held.
+func rollbackHotJournal(vfs VFS, db File, path string) error {
+	if err := db.Lock(ExclusiveLock); err != nil {
+		return err
+	}
+
+	// Another process may have rolled the journal back while this one
+	// waited for the lock
+	file, err := vfs.OpenFile(path, os.O_RDONLY, 0)
+	if errors.Is(err, os.ErrNotExist) {
+		return db.Unlock(SharedLock)
+	}
+	if err != nil {
+		return err
+	}
+	if err := playbackJournal(file, db); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := vfs.Remove(path); err != nil {
+		return err
+	}
+	return db.Unlock(SharedLock)
+}
+
+// playbackJournal writes the pages saved in a journal back to the database
+// and truncates it to its original size. Playback stops at the first torn
+// or invalid record.
+func playbackJournal(file, db File) error {
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	size := info.Size()
+
+	dbPages, pageSize := int64(-1), int64(0)
+segments:
+	for off := int64(0); off+JournalHeaderLen <= size; {
+		header := make([]byte, JournalHeaderLen)
+		if _, err := file.ReadAt(header, off); err != nil {
+			return err
+		}
+		if string(header[:8]) != JournalMagic {
+			break
+		}
+
+		records := int64(binary.BigEndian.Uint32(header[8:]))
+		nonce := binary.BigEndian.Uint32(header[12:])
+		sectorSize := int64(binary.BigEndian.Uint32(header[20:]))
+		pageSize = int64(binary.BigEndian.Uint32(header[24:]))
+		if pageSize < 512 || pageSize > 65536 || pageSize&(pageSize-1) != 0 ||
+			sectorSize < 32 || sectorSize > 65536 || sectorSize&(sectorSize-1) != 0 {
+			break
+		}
+		if dbPages < 0 {
+			dbPages = int64(binary.BigEndian.Uint32(header[16:]))
+		}
+
+		recordLen := pageSize + 8
+		off += sectorSize
+		if records == 0xffffffff {
+			records = (size - off) / recordLen
+		}
+
+		record := make([]byte, recordLen)
+		for i := int64(0); i < records; i++ {
+			if _, err := file.ReadAt(record, off); err != nil {
+				if err == io.EOF {
+					break segments
+				}
+				return err
+			}
+			pageNum := int64(binary.BigEndian.Uint32(record))
+			page := record[4 : 4+pageSize]
+			if pageNum == 0 || binary.BigEndian.Uint32(record[4+pageSize:]) != journalChecksum(nonce, page) {
+				break segments
+			}
+			if _, err := db.WriteAt(page, (pageNum-1)*pageSize); err != nil {
+				return err
+			}
+			off += recordLen
+		}
+
+		// A later segment starts on the next sector boundary
+		off = (off + sectorSize - 1) / sectorSize * sectorSize
+		if records == 0 {
+			break
+		}
+	}
+
+	if dbPages >= 0 {
+		if err := db.Truncate(dbPages * pageSize); err != nil {
+			return err
+		}
+	}
+	return db.Sync()
+}
+
+// ----------------------------------------------------------------------------
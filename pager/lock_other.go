@@ -0,0 +1,27 @@
+//go:build !unix
+
+package pager
+
+import "os"
+
+// osFile is a file of the OS file system. Locking is not supported on this
+// platform, so every lock is granted.
+type osFile struct {
+	*os.File
+}
+
+func newOSFile(file *os.File) (File, error) {
+	return &osFile{File: file}, nil
+}
+
+func (f *osFile) Lock(level int) error {
+	return nil
+}
+
+func (f *osFile) Unlock(level int) error {
+	return nil
+}
+
+func (f *osFile) CheckReservedLock() (bool, error) {
+	return false, nil
+}
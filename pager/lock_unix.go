@@ -0,0 +1,245 @@
+//go:build unix
+
+package pager
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"syscall"
+)
+
+// Byte ranges locked for each level, the same as sqlite3's, so that both
+// see each other's locks. They lie on the page at the first gigabyte, which
+// never holds data.
+const (
+	pendingByte  = 0x40000000
+	reservedByte = pendingByte + 1
+	sharedFirst  = pendingByte + 2
+	sharedSize   = 510
+)
+
+// osFile is a file of the OS file system. Its locks are POSIX advisory
+// locks, which belong to the process: they do not keep two handles of one
+// process apart, and closing any descriptor of the file releases them all.
+// The handles of a file therefore share an inode, as sqlite3's do.
+type osFile struct {
+	*os.File
+	inode *inode
+	lock  int
+}
+
+// inodeKey identifies a file however many times and by whatever path it was
+// opened
+type inodeKey struct {
+	dev, ino uint64
+}
+
+// inode is the lock state of a file shared by every handle the process has
+// open on it. A handle checks the locks of the others here before asking
+// the OS for its own.
+type inode struct {
+	key    inodeKey
+	refs   int        // Handles open on the file
+	shared int        // Handles holding SHARED or higher
+	lock   int        // Highest lock held by one of them
+	unused []*os.File // Descriptors closed while others held locks
+}
+
+// inodes holds the inode of every file the process has open
+var inodes = struct {
+	sync.Mutex
+	m map[inodeKey]*inode
+}{m: make(map[inodeKey]*inode)}
+
+// ----------------------------------------------------------------------------
+
+// newOSFile wraps an open file, sharing the inode of the other handles on
+// the same file
+func newOSFile(file *os.File) (File, error) {
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		file.Close()
+		return nil, errors.New("cannot identify file: " + file.Name())
+	}
+	key := inodeKey{dev: uint64(st.Dev), ino: uint64(st.Ino)}
+
+	inodes.Lock()
+	defer inodes.Unlock()
+	n := inodes.m[key]
+	if n == nil {
+		n = &inode{key: key}
+		inodes.m[key] = n
+	}
+	n.refs++
+	return &osFile{File: file, inode: n}, nil
+}
+
+func (f *osFile) Lock(level int) error {
+	if f.lock >= level {
+		return nil
+	}
+	n := f.inode
+	inodes.Lock()
+	defer inodes.Unlock()
+
+	// Another handle holding more than SHARED keeps this one from going
+	// past SHARED, and PENDING or more keeps it out
+	if n.lock != f.lock && (n.lock >= PendingLock || level > SharedLock) {
+		return ErrBusy
+	}
+
+	if f.lock == NoLock && n.shared > 0 {
+		// The process already holds the SHARED lock of the file
+		f.lock = SharedLock
+		n.shared++
+	}
+	if f.lock == NoLock {
+		// PENDING is held while SHARED is taken, so that no new reader
+		// gets in while a writer waits for EXCLUSIVE
+		if err := f.setLock(syscall.F_RDLCK, pendingByte, 1); err != nil {
+			return err
+		}
+		err := f.setLock(syscall.F_RDLCK, sharedFirst, sharedSize)
+		f.setLock(syscall.F_UNLCK, pendingByte, 1)
+		if err != nil {
+			return err
+		}
+		f.lock, n.lock = SharedLock, SharedLock
+		n.shared++
+	}
+	if level == ReservedLock {
+		if err := f.setLock(syscall.F_WRLCK, reservedByte, 1); err != nil {
+			return err
+		}
+		f.lock, n.lock = ReservedLock, ReservedLock
+	}
+	if level >= PendingLock && f.lock < PendingLock {
+		if err := f.setLock(syscall.F_WRLCK, pendingByte, 1); err != nil {
+			return err
+		}
+		f.lock, n.lock = PendingLock, PendingLock
+	}
+	if level == ExclusiveLock {
+		// The other handles' reads would not keep the OS lock from
+		// being granted
+		if n.shared > 1 {
+			return ErrBusy
+		}
+		if err := f.setLock(syscall.F_WRLCK, sharedFirst, sharedSize); err != nil {
+			return err
+		}
+		f.lock, n.lock = ExclusiveLock, ExclusiveLock
+	}
+	return nil
+}
+
+func (f *osFile) Unlock(level int) error {
+	if f.lock <= level {
+		return nil
+	}
+	n := f.inode
+	inodes.Lock()
+	defer inodes.Unlock()
+
+	if level == SharedLock {
+		if f.lock == ExclusiveLock {
+			if err := f.setLock(syscall.F_RDLCK, sharedFirst, sharedSize); err != nil {
+				return err
+			}
+		}
+		if err := f.setLock(syscall.F_UNLCK, pendingByte, 2); err != nil {
+			return err
+		}
+		f.lock, n.lock = SharedLock, SharedLock
+		return nil
+	}
+
+	// SHARED is only released when no other handle holds it
+	switch {
+	case n.shared == 1:
+		if err := f.setLock(syscall.F_UNLCK, pendingByte, 2+sharedSize); err != nil {
+			return err
+		}
+		n.lock = NoLock
+	case f.lock > SharedLock:
+		if err := f.setLock(syscall.F_UNLCK, pendingByte, 2); err != nil {
+			return err
+		}
+		n.lock = SharedLock
+	}
+	f.lock = NoLock
+	n.shared--
+	if n.shared == 0 {
+		return n.closeUnused()
+	}
+	return nil
+}
+
+func (f *osFile) CheckReservedLock() (bool, error) {
+	if f.lock >= ReservedLock {
+		return true, nil
+	}
+	inodes.Lock()
+	reserved := f.inode.lock >= ReservedLock
+	inodes.Unlock()
+	if reserved {
+		return true, nil
+	}
+
+	// F_GETLK only reports the locks of other processes
+	lk := syscall.Flock_t{Type: syscall.F_WRLCK, Whence: io.SeekStart, Start: reservedByte, Len: 1}
+	if err := syscall.FcntlFlock(f.Fd(), syscall.F_GETLK, &lk); err != nil {
+		return false, err
+	}
+	return lk.Type != syscall.F_UNLCK, nil
+}
+
+// Close releases the handle's lock. Its descriptor stays open while other
+// handles hold locks, since closing it would release theirs.
+func (f *osFile) Close() error {
+	err := f.Unlock(NoLock)
+	n := f.inode
+	inodes.Lock()
+	defer inodes.Unlock()
+
+	n.refs--
+	if n.refs == 0 {
+		delete(inodes.m, n.key)
+	}
+	if n.shared > 0 {
+		n.unused = append(n.unused, f.File)
+		return err
+	}
+	if cerr := f.File.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// closeUnused closes the descriptors kept open for the locks of others
+func (n *inode) closeUnused() error {
+	var err error
+	for _, file := range n.unused {
+		if cerr := file.Close(); err == nil {
+			err = cerr
+		}
+	}
+	n.unused = nil
+	return err
+}
+
+func (f *osFile) setLock(typ int16, start, length int64) error {
+	lk := syscall.Flock_t{Type: typ, Whence: io.SeekStart, Start: start, Len: length}
+	err := syscall.FcntlFlock(f.Fd(), syscall.F_SETLK, &lk)
+	if errors.Is(err, syscall.EAGAIN) || errors.Is(err, syscall.EACCES) {
+		return ErrBusy
+	}
+	return err
+}
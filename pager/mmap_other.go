@@ -0,0 +1,13 @@
+//go:build !unix
+
+package pager
+
+// mmapFile maps nothing on this platform, so that every page is read with
+// pread instead
+func mmapFile(fd uintptr, size int) ([]byte, error) {
+	return nil, nil
+}
+
+func munmapFile(buf []byte) error {
+	return nil
+}
@@ -0,0 +1,13 @@
+//go:build unix
+
+package pager
+
+import "syscall"
+
+func mmapFile(fd uintptr, size int) ([]byte, error) {
+	return syscall.Mmap(int(fd), 0, size, syscall.PROT_READ, syscall.MAP_SHARED)
+}
+
+func munmapFile(buf []byte) error {
+	return syscall.Munmap(buf)
+}
@@ -0,0 +1,657 @@
+// Package pager reads and writes the pages of a database file through a page
+// cache, saving each page to a rollback journal before it is first changed.
+package pager
+
+import (
+	"container/list"
+	"encoding/binary"
+	"fmt"
+	"slices"
+)
+
+// Constants ------------------------------------------------------------------
+
+const (
+	DefaultCacheSize = 2000 * 1024 // Page cache budget in bytes
+)
+
+// ----------------------------------------------------------------------------
+
+// Custom Types ---------------------------------------------------------------
+type Options struct {
+	CacheSize int64 // Page cache budget in bytes, 0 for the default, negative disables the cache
+	MmapSize  int64 // Bytes of the file to memory-map where supported, 0 reads with pread
+	ReadOnly  bool  // Open the file read-only, rejecting writes
+	VFS       VFS   // Files behind the database, the OS file system when nil
+}
+
+type Pager struct {
+	file      File
+	pageSize  int64
+	pageCount int64
+	cache     *PageCache
+	mmap      []byte // Mapped prefix of the file, nil when reading with pread
+	mmapSize  int64
+	readOnly  bool
+
+	// Lock held on the file, and the file change counter and size when it
+	// was last held, which tell whether another process changed the file
+	lock     int
+	counter  uint32
+	fileSize int64
+
+	// Lays out page 1 when the first write to an empty file adds it
+	onCreate func(page []byte)
+
+	// Pages modified since the last commit, and the page count at that commit
+	dirty          map[int64][]byte
+	committedCount int64
+
+	// Rollback journal of the open write transaction
+	vfs         VFS
+	journalPath string
+	journal     *journal
+	dbWritten   bool  // Commit has started writing the database file
+	failed      error // Rolling back a failed commit failed too
+
+	// Pages as they were before the current statement, nil for pages that
+	// were unmodified, and the page count then
+	stmtPages map[int64][]byte
+	stmtCount int64
+}
+
+type PageCache struct {
+	capacity int64
+	size     int64
+	pages    map[int64]*list.Element
+	lru      *list.List
+	hits     uint64
+	misses   uint64
+}
+
+type CacheStats struct {
+	Hits     uint64
+	Misses   uint64
+	Pages    int
+	Size     int64
+	Capacity int64
+}
+
+type cachedPage struct {
+	pageNum int64
+	buf     []byte
+}
+
+// ----------------------------------------------------------------------------
+
+func DefaultOptions() *Options {
+	return &Options{
+		CacheSize: DefaultCacheSize,
+	}
+}
+
+// GetVFS returns the files behind the database
+func (opts *Options) GetVFS() VFS {
+	if opts.VFS == nil {
+		return osVFS{}
+	}
+	return opts.VFS
+}
+
+// NewPager reads a database file through a page cache. Changes are saved to
+// the rollback journal at journalPath before the file is written.
+func NewPager(file File, journalPath string, pageSize int64, opts *Options) (*Pager, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	cacheSize := opts.CacheSize
+	switch {
+	case cacheSize == 0:
+		cacheSize = DefaultCacheSize
+	case cacheSize < 0:
+		cacheSize = 0
+	}
+
+	pager := &Pager{
+		file:        file,
+		pageSize:    pageSize,
+		pageCount:   info.Size() / pageSize,
+		cache:       NewPageCache(cacheSize),
+		mmapSize:    opts.MmapSize,
+		readOnly:    opts.ReadOnly,
+		fileSize:    info.Size(),
+		dirty:       make(map[int64][]byte),
+		vfs:         opts.GetVFS(),
+		journalPath: journalPath,
+	}
+	pager.committedCount = pager.pageCount
+	if pager.counter, err = pager.readCounter(info.Size()); err != nil {
+		return nil, err
+	}
+
+	if err := pager.mapFile(); err != nil {
+		return nil, err
+	}
+
+	return pager, nil
+}
+
+// Lock takes a SHARED lock for reading, see LockShared. It reports whether
+// another process changed the file since the lock was last held, in which
+// case the cached pages were dropped.
+func (p *Pager) Lock() (bool, error) {
+	if p.lock >= SharedLock {
+		return false, nil
+	}
+	if err := LockShared(p.vfs, p.file, p.journalPath, p.readOnly); err != nil {
+		return false, err
+	}
+	p.lock = SharedLock
+
+	info, err := p.file.Stat()
+	if err != nil {
+		return false, err
+	}
+	counter, err := p.readCounter(info.Size())
+	if err != nil {
+		return false, err
+	}
+	if counter == p.counter && info.Size() == p.fileSize {
+		return false, nil
+	}
+
+	p.counter, p.fileSize = counter, info.Size()
+	p.pageCount = info.Size() / p.pageSize
+	p.committedCount = p.pageCount
+	p.cache.Clear()
+	return true, p.remap()
+}
+
+// OnCreate sets the function that lays out page 1 of an empty file. The
+// page is added by the first write, so that a database is not written
+// until something is stored in it.
+func (p *Pager) OnCreate(fn func(page []byte)) {
+	p.onCreate = fn
+}
+
+// Locked reports whether a SHARED or higher lock is held
+func (p *Pager) Locked() bool {
+	return p.lock >= SharedLock
+}
+
+// Unlock releases the lock on the file once a transaction has ended
+func (p *Pager) Unlock() error {
+	if p.lock == NoLock {
+		return nil
+	}
+	p.lock = NoLock
+	return p.file.Unlock(NoLock)
+}
+
+// ReadPage returns the full contents of a page, including the 100-byte
+// database header for page 1. The returned buffer is shared with the cache
+// or the memory mapping and must not be modified. Buffers from the mapping
+// are only valid until the pager is closed.
+func (p *Pager) ReadPage(pageNum int64) ([]byte, error) {
+	if pageNum < 1 || pageNum > p.pageCount {
+		return nil, CorruptPage(pageNum, "page number out of range")
+	}
+
+	if buf, ok := p.dirty[pageNum]; ok {
+		return buf, nil
+	}
+
+	offset := p.calcOffset(pageNum)
+	if offset+p.pageSize <= int64(len(p.mmap)) {
+		return p.mmap[offset : offset+p.pageSize : offset+p.pageSize], nil
+	}
+
+	if buf, ok := p.cache.Get(pageNum); ok {
+		return buf, nil
+	}
+
+	buf := make([]byte, p.pageSize)
+	_, err := p.file.ReadAt(buf, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	p.cache.Put(pageNum, buf)
+	return buf, nil
+}
+
+// WritablePage returns a private copy of a page that may be modified. The
+// change is written to the file by Commit or dropped by Rollback. The page's
+// original content goes to the journal first.
+func (p *Pager) WritablePage(pageNum int64) ([]byte, error) {
+	if p.readOnly {
+		return nil, ErrReadOnly
+	}
+	if p.failed != nil {
+		return nil, p.failed
+	}
+	if err := p.lockFile(ReservedLock); err != nil {
+		return nil, err
+	}
+	if pageNum == 1 && p.pageCount == 0 && p.onCreate != nil {
+		p.pageCount++
+		p.dirty[1] = make([]byte, p.pageSize)
+		p.onCreate(p.dirty[1])
+	}
+	if buf, ok := p.dirty[pageNum]; ok {
+		if p.stmtPages != nil {
+			if _, saved := p.stmtPages[pageNum]; !saved {
+				p.stmtPages[pageNum] = slices.Clone(buf)
+			}
+		}
+		return buf, nil
+	}
+
+	buf, err := p.ReadPage(pageNum)
+	if err != nil {
+		return nil, err
+	}
+	if pageNum <= p.committedCount {
+		if err := p.journalPage(pageNum, buf); err != nil {
+			return nil, err
+		}
+	}
+	if p.stmtPages != nil {
+		p.stmtPages[pageNum] = nil
+	}
+
+	buf = slices.Clone(buf)
+	p.dirty[pageNum] = buf
+	return buf, nil
+}
+
+// AppendPage grows the file by one zeroed page and returns its number
+func (p *Pager) AppendPage() (int64, error) {
+	if p.readOnly {
+		return 0, ErrReadOnly
+	}
+	if p.failed != nil {
+		return 0, p.failed
+	}
+	if err := p.lockFile(ReservedLock); err != nil {
+		return 0, err
+	}
+	p.pageCount++
+	p.dirty[p.pageCount] = make([]byte, p.pageSize)
+	return p.pageCount, nil
+}
+
+// Truncate shrinks the database to pageCount pages when the transaction
+// commits. The pages cut off are journalled first, so a rollback can
+// restore them.
+func (p *Pager) Truncate(pageCount int64) error {
+	if p.readOnly {
+		return ErrReadOnly
+	}
+	if err := p.lockFile(ReservedLock); err != nil {
+		return err
+	}
+	for pageNum := pageCount + 1; pageNum <= p.committedCount; pageNum++ {
+		if _, ok := p.dirty[pageNum]; ok {
+			continue
+		}
+		buf, err := p.ReadPage(pageNum)
+		if err != nil {
+			return err
+		}
+		if err := p.journalPage(pageNum, buf); err != nil {
+			return err
+		}
+	}
+
+	for pageNum, buf := range p.dirty {
+		if pageNum <= pageCount {
+			continue
+		}
+		if p.stmtPages != nil {
+			if _, saved := p.stmtPages[pageNum]; !saved {
+				p.stmtPages[pageNum] = buf
+			}
+		}
+		delete(p.dirty, pageNum)
+	}
+	p.pageCount = pageCount
+	return nil
+}
+
+func (p *Pager) IsDirty() bool {
+	return len(p.dirty) > 0
+}
+
+// InTransaction reports whether a journal holds changes not yet committed
+func (p *Pager) InTransaction() bool {
+	return p.journal != nil || len(p.dirty) > 0
+}
+
+// Commit writes every modified page to the file and syncs it. The journal
+// is synced before the file is written and deleted once it has been, which
+// is the moment the transaction commits. The file is written under an
+// EXCLUSIVE lock, which waits for no reader: Commit fails with ErrBusy
+// while another process holds SHARED.
+func (p *Pager) Commit() error {
+	if p.failed != nil {
+		return p.failed
+	}
+	p.stmtPages = nil
+	if len(p.dirty) == 0 {
+		if err := p.closeJournal(); err != nil {
+			return err
+		}
+		return p.unlockFile(SharedLock)
+	}
+
+	if p.journal != nil {
+		if err := p.journal.finalize(); err != nil {
+			return err
+		}
+	}
+	if err := p.lockFile(ExclusiveLock); err != nil {
+		return err
+	}
+
+	pageNums := make([]int64, 0, len(p.dirty))
+	for pageNum := range p.dirty {
+		pageNums = append(pageNums, pageNum)
+	}
+	slices.Sort(pageNums)
+
+	p.dbWritten = true
+	for _, pageNum := range pageNums {
+		_, err := p.file.WriteAt(p.dirty[pageNum], p.calcOffset(pageNum))
+		if err != nil {
+			return err
+		}
+	}
+	if p.pageCount < p.committedCount {
+		if err := p.file.Truncate(p.pageCount * p.pageSize); err != nil {
+			return err
+		}
+	}
+	if err := p.file.Sync(); err != nil {
+		return err
+	}
+	if err := p.closeJournal(); err != nil {
+		// The transaction committed unless the journal is still there
+		p.failed = fmt.Errorf("commit failed, reopen the database: %w", err)
+		return p.failed
+	}
+	p.dbWritten = false
+
+	for _, pageNum := range pageNums {
+		p.cache.Put(pageNum, p.dirty[pageNum])
+	}
+	if header, ok := p.dirty[1]; ok {
+		p.counter = binary.BigEndian.Uint32(header[24:])
+	}
+	clear(p.dirty)
+	resized := p.pageCount != p.committedCount
+	p.committedCount = p.pageCount
+	p.fileSize = p.pageCount * p.pageSize
+	if resized {
+		// The transaction has committed, so a failed mapping only leaves
+		// the pages to be read with pread
+		p.remap()
+	}
+	return p.unlockFile(SharedLock)
+}
+
+// Rollback discards every change made since the last commit. When a commit
+// failed part way through writing the file, the journal restores it.
+func (p *Pager) Rollback() error {
+	clear(p.dirty)
+	p.pageCount = p.committedCount
+	p.stmtPages = nil
+	if p.failed != nil {
+		return p.failed
+	}
+
+	if p.dbWritten {
+		if err := playbackJournal(p.journal.file, p.file); err != nil {
+			// Leave the journal for the next open to roll back
+			p.failed = fmt.Errorf("rollback failed, reopen the database: %w", err)
+			p.journal.file.Close()
+			p.journal = nil
+			return p.failed
+		}
+		p.dbWritten = false
+	}
+	if err := p.closeJournal(); err != nil {
+		return err
+	}
+	return p.unlockFile(SharedLock)
+}
+
+// BeginStatement starts tracking the pages a statement changes, so that
+// RollbackStatement can undo it without undoing the rest of the transaction
+func (p *Pager) BeginStatement() {
+	p.stmtPages = make(map[int64][]byte)
+	p.stmtCount = p.pageCount
+}
+
+// RollbackStatement undoes the changes made since BeginStatement
+func (p *Pager) RollbackStatement() {
+	for pageNum, buf := range p.stmtPages {
+		if buf == nil {
+			delete(p.dirty, pageNum)
+		} else {
+			p.dirty[pageNum] = buf
+		}
+	}
+	for pageNum := range p.dirty {
+		if pageNum > p.stmtCount {
+			delete(p.dirty, pageNum)
+		}
+	}
+	p.pageCount = p.stmtCount
+	p.stmtPages = nil
+}
+
+func (p *Pager) PageCount() int64 {
+	return p.pageCount
+}
+
+// VFS returns the files behind the database and its journal
+func (p *Pager) VFS() VFS {
+	return p.vfs
+}
+
+// SetReadOnly rejects any further writes
+func (p *Pager) SetReadOnly() {
+	p.readOnly = true
+}
+
+// ReadOnly reports whether writes are rejected
+func (p *Pager) ReadOnly() bool {
+	return p.readOnly
+}
+
+func (p *Pager) CacheStats() CacheStats {
+	return p.cache.Stats()
+}
+
+// Close discards uncommitted changes and closes the file
+func (p *Pager) Close() error {
+	if p.InTransaction() {
+		p.Rollback()
+	}
+	if p.mmap != nil {
+		err := munmapFile(p.mmap)
+		p.mmap = nil
+		if err != nil {
+			p.file.Close()
+			return err
+		}
+	}
+	return p.file.Close()
+}
+
+// Helpers --------------------------------------------------------------------
+// mapFile maps whole pages from the start of the file, up to the mmap size.
+// Pages past the mapping are read with pread through the cache.
+func (p *Pager) mapFile() error {
+	size := min(p.mmapSize, p.pageCount*p.pageSize)
+	size -= size % p.pageSize
+	if size <= 0 {
+		return nil
+	}
+
+	// A database created after it was opened is mapped once it exists
+	f := p.file
+	if lazy, ok := f.(*lazyFile); ok {
+		f = lazy.file
+	}
+	file, ok := f.(interface{ Fd() uintptr })
+	if !ok {
+		return nil
+	}
+	var err error
+	p.mmap, err = mmapFile(file.Fd(), int(size))
+	return err
+}
+
+// remap maps the file again once its size changed
+func (p *Pager) remap() error {
+	if p.mmap != nil {
+		err := munmapFile(p.mmap)
+		p.mmap = nil
+		if err != nil {
+			return err
+		}
+	}
+	return p.mapFile()
+}
+
+// lockFile raises the lock on the file to level
+func (p *Pager) lockFile(level int) error {
+	if p.lock >= level {
+		return nil
+	}
+	if err := p.file.Lock(level); err != nil {
+		return err
+	}
+	p.lock = level
+	return nil
+}
+
+// unlockFile lowers the lock on the file to level
+func (p *Pager) unlockFile(level int) error {
+	if p.lock <= level {
+		return nil
+	}
+	p.lock = level
+	return p.file.Unlock(level)
+}
+
+// readCounter reads the file change counter of the database header, 0 for
+// a file of size bytes too short to hold one
+func (p *Pager) readCounter(size int64) (uint32, error) {
+	buf := make([]byte, 4)
+	if size < 28 {
+		return 0, nil
+	}
+	if _, err := p.file.ReadAt(buf, 24); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint32(buf), nil
+}
+
+// journalPage saves the original content of a page, starting the journal
+// with the first page a transaction changes
+func (p *Pager) journalPage(pageNum int64, buf []byte) error {
+	if p.journal == nil {
+		j, err := openJournal(p.vfs, p.journalPath, p.pageSize, p.committedCount)
+		if err != nil {
+			return err
+		}
+		p.journal = j
+	}
+	return p.journal.add(pageNum, buf)
+}
+
+func (p *Pager) closeJournal() error {
+	if p.journal == nil {
+		return nil
+	}
+	err := p.journal.remove()
+	p.journal = nil
+	return err
+}
+
+func (p *Pager) calcOffset(pageNum int64) int64 {
+	return (pageNum - 1) * p.pageSize
+}
+
+// ----------------------------------------------------------------------------
+
+// Page Cache -----------------------------------------------------------------
+func NewPageCache(capacity int64) *PageCache {
+	return &PageCache{
+		capacity: capacity,
+		pages:    make(map[int64]*list.Element),
+		lru:      list.New(),
+	}
+}
+
+func (c *PageCache) Get(pageNum int64) ([]byte, bool) {
+	elem, ok := c.pages[pageNum]
+	if !ok {
+		c.misses++
+		return nil, false
+	}
+
+	c.hits++
+	c.lru.MoveToFront(elem)
+	return elem.Value.(*cachedPage).buf, true
+}
+
+func (c *PageCache) Put(pageNum int64, buf []byte) {
+	if elem, ok := c.pages[pageNum]; ok {
+		c.size -= int64(len(elem.Value.(*cachedPage).buf))
+		c.lru.Remove(elem)
+		delete(c.pages, pageNum)
+	}
+
+	if int64(len(buf)) > c.capacity {
+		return
+	}
+
+	// Evict least recently used pages until the new page fits
+	for c.size+int64(len(buf)) > c.capacity {
+		c.evict(c.lru.Back())
+	}
+
+	c.pages[pageNum] = c.lru.PushFront(&cachedPage{pageNum, buf})
+	c.size += int64(len(buf))
+}
+
+// Clear drops every page
+func (c *PageCache) Clear() {
+	clear(c.pages)
+	c.lru.Init()
+	c.size = 0
+}
+
+func (c *PageCache) Stats() CacheStats {
+	return CacheStats{
+		Hits:     c.hits,
+		Misses:   c.misses,
+		Pages:    len(c.pages),
+		Size:     c.size,
+		Capacity: c.capacity,
+	}
+}
+
+func (c *PageCache) evict(elem *list.Element) {
+	page := c.lru.Remove(elem).(*cachedPage)
+	delete(c.pages, page.pageNum)
+	c.size -= int64(len(page.buf))
+}
+
+// ----------------------------------------------------------------------------
@@ -0,0 +1,144 @@
+package pager
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+// cachedPages returns the pages in the cache, most recently used first
+func cachedPages(c *PageCache) []int64 {
+	pages := []int64{}
+	for elem := c.lru.Front(); elem != nil; elem = elem.Next() {
+		pages = append(pages, elem.Value.(*cachedPage).pageNum)
+	}
+	return pages
+}
+
+func TestPageCacheEviction(t *testing.T) {
+	// ops are the pages used in turn: a negative number gets the page and
+	// a positive one puts a 10-byte page
+	tests := []struct {
+		name     string
+		capacity int64
+		ops      []int64
+		want     []int64
+	}{
+		{"fills", 30, []int64{1, 2, 3}, []int64{3, 2, 1}},
+		{"evicts oldest", 30, []int64{1, 2, 3, 4}, []int64{4, 3, 2}},
+		{"get refreshes", 30, []int64{1, 2, 3, -1, 4}, []int64{4, 1, 3}},
+		{"put refreshes", 30, []int64{1, 2, 3, 1, 4}, []int64{4, 1, 3}},
+		{"miss keeps order", 30, []int64{1, 2, 3, -7, 4}, []int64{4, 3, 2}},
+		{"evicts several", 25, []int64{1, 2, 3, 4, 5}, []int64{5, 4}},
+		{"zero capacity", 0, []int64{1, 2}, []int64{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewPageCache(tt.capacity)
+			for _, op := range tt.ops {
+				if op < 0 {
+					c.Get(-op)
+				} else {
+					c.Put(op, make([]byte, 10))
+				}
+			}
+			if got := cachedPages(c); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got pages %v, want %v", got, tt.want)
+			}
+			if size := c.Stats().Size; size != int64(10*len(tt.want)) || size > tt.capacity {
+				t.Errorf("size %d for %d pages, capacity %d", size, len(tt.want), tt.capacity)
+			}
+		})
+	}
+}
+
+func TestPageCacheCapacity(t *testing.T) {
+	c := NewPageCache(100)
+	c.Put(1, make([]byte, 40))
+	c.Put(2, make([]byte, 40))
+
+	// A page larger than the whole cache is not kept, and drops the old
+	// version of the page
+	c.Put(1, make([]byte, 101))
+	if _, ok := c.Get(1); ok {
+		t.Error("a page larger than the cache was kept")
+	}
+	if got := c.Stats(); got.Pages != 1 || got.Size != 40 {
+		t.Errorf("after an oversized page: %d pages of %d bytes, want 1 of 40", got.Pages, got.Size)
+	}
+
+	// Growing a page makes room for it by evicting the others
+	c.Put(3, make([]byte, 40))
+	c.Put(3, make([]byte, 100))
+	if got := cachedPages(c); !slices.Equal(got, []int64{3}) {
+		t.Errorf("after growing a page: got pages %v, want [3]", got)
+	}
+	if got := c.Stats(); got.Size != 100 || got.Capacity != 100 {
+		t.Errorf("after growing a page: size %d of %d, want 100 of 100", got.Size, got.Capacity)
+	}
+}
+
+func TestPageCacheClear(t *testing.T) {
+	c := NewPageCache(100)
+	c.Put(1, make([]byte, 10))
+	c.Put(2, make([]byte, 10))
+	c.Get(1)
+	c.Get(3)
+	c.Clear()
+
+	want := CacheStats{Hits: 1, Misses: 1, Capacity: 100}
+	if got := c.Stats(); got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if _, ok := c.Get(2); ok {
+		t.Error("a page survived Clear")
+	}
+	c.Put(2, make([]byte, 10))
+	if got := cachedPages(c); !slices.Equal(got, []int64{2}) {
+		t.Errorf("after Clear: got pages %v, want [2]", got)
+	}
+}
+
+// TestPagerCacheStats reads the pages of a file through a pager with room
+// for two of them and checks the counts it reports
+func TestPagerCacheStats(t *testing.T) {
+	const pageSize = 512
+	path := filepath.Join(t.TempDir(), "test.db")
+	if err := os.WriteFile(path, make([]byte, 4*pageSize), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		cacheSize int64
+		want      CacheStats
+	}{
+		{"two pages", 2 * pageSize, CacheStats{Hits: 2, Misses: 5, Pages: 2, Size: 2 * pageSize, Capacity: 2 * pageSize}},
+		{"disabled", -1, CacheStats{Misses: 7}},
+		{"default", 0, CacheStats{Hits: 4, Misses: 3, Pages: 3, Size: 3 * pageSize, Capacity: DefaultCacheSize}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file, err := osVFS{}.OpenFile(path, os.O_RDONLY, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			p, err := NewPager(file, path+"-journal", pageSize, &Options{CacheSize: tt.cacheSize, ReadOnly: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer p.Close()
+
+			for _, pageNum := range []int64{1, 1, 2, 3, 1, 3, 2} {
+				if _, err := p.ReadPage(pageNum); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := p.CacheStats(); got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
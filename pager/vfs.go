@@ -0,0 +1,198 @@
+package pager
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Constants ------------------------------------------------------------------
+/*
+Locks of a database file, shared with other processes and the sqlite3
+library. A reader holds SHARED, the one writer of a transaction holds
+RESERVED while it journals its changes, and EXCLUSIVE while it writes the
+file. PENDING is taken on the way to EXCLUSIVE and keeps new readers out.
+*/
+
+const (
+	NoLock = iota
+	SharedLock
+	ReservedLock
+	PendingLock
+	ExclusiveLock
+)
+
+// ----------------------------------------------------------------------------
+
+// Custom Types ---------------------------------------------------------------
+// File is the part of *os.File the pager uses for the database and journal,
+// plus the locks of a database file
+type File interface {
+	io.ReaderAt
+	io.WriterAt
+	Sync() error
+	Truncate(size int64) error
+	Stat() (os.FileInfo, error)
+	Close() error
+
+	// Lock raises the lock to level, taking SHARED first when no lock is
+	// held. It fails with ErrBusy when another process holds a conflicting
+	// lock.
+	Lock(level int) error
+	// Unlock lowers the lock to SharedLock or NoLock
+	Unlock(level int) error
+	// CheckReservedLock reports whether any process holds RESERVED or a
+	// higher lock
+	CheckReservedLock() (bool, error)
+}
+
+// VFS opens and removes the files behind a database, so that tests can
+// inject faults underneath the pager
+type VFS interface {
+	OpenFile(name string, flag int, perm os.FileMode) (File, error)
+	Remove(name string) error
+}
+
+type osVFS struct{}
+
+// lazyFile is a database file that does not exist yet. It reads as empty
+// until a write or a RESERVED lock creates it.
+type lazyFile struct {
+	vfs  VFS
+	name string
+	file File // Nil until created
+	lock int  // Lock held before the file was created
+}
+
+type emptyFileInfo string
+
+// ----------------------------------------------------------------------------
+
+func (osVFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	file, err := os.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return newOSFile(file)
+}
+
+func (osVFS) Remove(name string) error {
+	return os.Remove(name)
+}
+
+// Lazy Files -----------------------------------------------------------------
+// NewLazyFile returns the file of a database that does not exist yet, so
+// that opening a database does not create it. The file is created by the
+// first transaction that writes to it.
+func NewLazyFile(vfs VFS, name string) File {
+	return &lazyFile{vfs: vfs, name: name}
+}
+
+// create creates the file, unless it was already
+func (f *lazyFile) create() error {
+	if f.file != nil {
+		return nil
+	}
+	file, err := f.vfs.OpenFile(f.name, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	f.file = file
+	return nil
+}
+
+func (f *lazyFile) ReadAt(buf []byte, off int64) (int, error) {
+	if f.file == nil {
+		return 0, io.EOF
+	}
+	return f.file.ReadAt(buf, off)
+}
+
+func (f *lazyFile) WriteAt(buf []byte, off int64) (int, error) {
+	if err := f.create(); err != nil {
+		return 0, err
+	}
+	return f.file.WriteAt(buf, off)
+}
+
+func (f *lazyFile) Sync() error {
+	if err := f.create(); err != nil {
+		return err
+	}
+	return f.file.Sync()
+}
+
+func (f *lazyFile) Truncate(size int64) error {
+	if err := f.create(); err != nil {
+		return err
+	}
+	return f.file.Truncate(size)
+}
+
+func (f *lazyFile) Stat() (os.FileInfo, error) {
+	if f.file == nil {
+		return emptyFileInfo(f.name), nil
+	}
+	return f.file.Stat()
+}
+
+func (f *lazyFile) Close() error {
+	if f.file == nil {
+		return nil
+	}
+	return f.file.Close()
+}
+
+// Lock creates the file when a writer asks for RESERVED. Another process
+// may have created it first, in which case the writer's view of the empty
+// database is out of date and it gets ErrBusy.
+func (f *lazyFile) Lock(level int) error {
+	if f.file != nil {
+		return f.file.Lock(level)
+	}
+	if level < ReservedLock {
+		f.lock = max(f.lock, level)
+		return nil
+	}
+
+	if err := f.create(); err != nil {
+		return err
+	}
+	if err := f.file.Lock(level); err != nil {
+		return err
+	}
+	info, err := f.file.Stat()
+	if err == nil && info.Size() > 0 {
+		err = ErrBusy
+	}
+	if err != nil {
+		f.file.Unlock(min(f.lock, SharedLock))
+		return err
+	}
+	return nil
+}
+
+func (f *lazyFile) Unlock(level int) error {
+	if f.file != nil {
+		return f.file.Unlock(level)
+	}
+	f.lock = min(f.lock, level)
+	return nil
+}
+
+func (f *lazyFile) CheckReservedLock() (bool, error) {
+	if f.file == nil {
+		return false, nil
+	}
+	return f.file.CheckReservedLock()
+}
+
+func (fi emptyFileInfo) Name() string       { return filepath.Base(string(fi)) }
+func (fi emptyFileInfo) Size() int64        { return 0 }
+func (fi emptyFileInfo) Mode() os.FileMode  { return 0644 }
+func (fi emptyFileInfo) ModTime() time.Time { return time.Time{} }
+func (fi emptyFileInfo) IsDir() bool        { return false }
+func (fi emptyFileInfo) Sys() any           { return nil }
+
+// ----------------------------------------------------------------------------
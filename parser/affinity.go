@@ -0,0 +1,38 @@
+package parser
+
+import (
+	"strings"
+)
+
+// Constants ------------------------------------------------------------------
+
+// Column affinities, see https://www.sqlite.org/datatype3.html
+type Affinity int
+
+const (
+	AffinityNone Affinity = iota // Of expressions other than columns and casts
+	AffinityBlob
+	AffinityText
+	AffinityNumeric
+	AffinityInteger
+	AffinityReal
+)
+
+// ----------------------------------------------------------------------------
+
+// TypeAffinity derives a column affinity from its declared type
+func TypeAffinity(typeName string) Affinity {
+	typeName = strings.ToUpper(typeName)
+	switch {
+	case strings.Contains(typeName, "INT"):
+		return AffinityInteger
+	case strings.Contains(typeName, "CHAR"), strings.Contains(typeName, "CLOB"), strings.Contains(typeName, "TEXT"):
+		return AffinityText
+	case strings.Contains(typeName, "BLOB"), typeName == "":
+		return AffinityBlob
+	case strings.Contains(typeName, "REAL"), strings.Contains(typeName, "FLOA"), strings.Contains(typeName, "DOUB"):
+		return AffinityReal
+	default:
+		return AffinityNumeric
+	}
+}
@@ -0,0 +1,332 @@
+package parser
+
+// Statements -----------------------------------------------------------------
+type Statement interface {
+	statementNode()
+}
+
+type SelectStatement struct {
+	With     *WithClause
+	Distinct bool
+	Columns  []*ResultColumn
+	From     []*TableRef // Empty when selecting without a table
+	Where    Expr
+	GroupBy  []Expr
+	Having   Expr
+	Windows  []*NamedWindow    // WINDOW clause
+	Compound []*CompoundSelect // SELECTs combined with this one, in order
+	OrderBy  []*OrderingTerm   // Applies to the whole compound, as do Limit and Offset
+	Limit    Expr
+	Offset   Expr
+}
+
+// CompoundSelect is a SELECT combined with the ones before it
+type CompoundSelect struct {
+	Op     string // "UNION", "UNION ALL", "INTERSECT" or "EXCEPT"
+	Select *SelectStatement
+}
+
+type WithClause struct {
+	Recursive bool
+	CTEs      []*CommonTableExpr
+}
+
+// CommonTableExpr is a named subquery of WITH
+type CommonTableExpr struct {
+	Name         string
+	Columns      []string // Column names given after the name, if any
+	Materialized string   // "", "MATERIALIZED" or "NOT MATERIALIZED"
+	Select       *SelectStatement
+}
+
+type ResultColumn struct {
+	Expr  Expr   // Nil for * and table.*
+	Star  bool   // * or table.*
+	Table string // Table qualifying table.*
+	Alias string
+	Text  string // Expression as written, used to name the column
+}
+
+// TableRef is a table in FROM and how it is joined to the ones before it
+type TableRef struct {
+	Name     string
+	Subquery *SelectStatement // FROM (SELECT ...), with Name empty
+	Alias    string
+	Join     string   // "", "INNER", "LEFT" or "CROSS"; "" for the first table and a comma
+	On       Expr     // Join condition
+	Using    []string // Columns matched by USING, or found in both by NATURAL
+}
+
+type OrderingTerm struct {
+	Expr Expr
+	Desc bool
+}
+
+type InsertStatement struct {
+	Table         string
+	Columns       []string
+	Values        [][]Expr
+	Select        *SelectStatement
+	DefaultValues bool
+	Conflict      string // OR clause, e.g. IGNORE or REPLACE
+}
+
+type UpdateStatement struct {
+	Table    string
+	Alias    string
+	Conflict string
+	Set      []*Assignment
+	Where    Expr
+}
+
+type Assignment struct {
+	Column string
+	Value  Expr
+}
+
+type DeleteStatement struct {
+	Table string
+	Alias string
+	Where Expr
+}
+
+type BeginStatement struct{}
+
+type CommitStatement struct{}
+
+type RollbackStatement struct{}
+
+type CreateTableStatement struct {
+	SQL          string // Text stored in sqlite_schema
+	Name         string
+	IfNotExists  bool
+	Columns      []*ColumnDef
+	Constraints  []*TableConstraint
+	WithoutRowID bool
+}
+
+type ColumnDef struct {
+	Name          string
+	Type          string
+	PrimaryKey    bool
+	PrimaryDesc   bool
+	Autoincrement bool
+	NotNull       bool
+	Unique        bool
+	Default       Expr
+	Collate       string
+	Generated     Expr // GENERATED ALWAYS AS (expr)
+	Stored        bool // Generated column is stored in the record
+}
+
+type TableConstraint struct {
+	PrimaryKey bool // PRIMARY KEY when set, otherwise UNIQUE
+	Columns    []*IndexedColumn
+}
+
+type CreateIndexStatement struct {
+	SQL         string // Text stored in sqlite_schema
+	Name        string
+	Table       string
+	Unique      bool
+	IfNotExists bool
+	Columns     []*IndexedColumn
+	Where       Expr
+}
+
+type DropStatement struct {
+	Kind     string // TABLE, INDEX, VIEW or TRIGGER
+	Name     string
+	IfExists bool
+}
+
+type VacuumStatement struct {
+	Into Expr // File to write the copy to, nil to vacuum in place
+}
+
+type AnalyzeStatement struct {
+	Name string // Table or index to analyze, "" for all of them
+}
+
+// ExplainStatement is EXPLAIN QUERY PLAN, reporting how a SELECT would run
+type ExplainStatement struct {
+	Select *SelectStatement
+}
+
+type IndexedColumn struct {
+	Name          string // Column name, empty for expressions
+	Text          string // Term as written, with any COLLATE and ASC or DESC
+	Expr          Expr
+	Collate       string
+	Desc          bool
+	Autoincrement bool // PRIMARY KEY (col AUTOINCREMENT)
+}
+
+func (*SelectStatement) statementNode()      {}
+func (*InsertStatement) statementNode()      {}
+func (*UpdateStatement) statementNode()      {}
+func (*DeleteStatement) statementNode()      {}
+func (*BeginStatement) statementNode()       {}
+func (*CommitStatement) statementNode()      {}
+func (*RollbackStatement) statementNode()    {}
+func (*CreateTableStatement) statementNode() {}
+func (*CreateIndexStatement) statementNode() {}
+func (*DropStatement) statementNode()        {}
+func (*VacuumStatement) statementNode()      {}
+func (*AnalyzeStatement) statementNode()     {}
+func (*ExplainStatement) statementNode()     {}
+
+// ----------------------------------------------------------------------------
+
+// Expressions ----------------------------------------------------------------
+type Expr interface {
+	exprNode()
+}
+
+type Literal struct {
+	Value any // nil, int64, float64, string or []byte
+}
+
+// Param is a parameter bound when the statement runs
+type Param struct {
+	Name  string // "?NNN", ":name", "@name" or "$name", "" for a bare ?
+	Index int    // Position of the value bound, from 1
+}
+
+type ColumnRef struct {
+	Table  string
+	Column string
+
+	// Resolved position of the column in the query's sources, filled in
+	// when the statement is bound
+	Bound    bool
+	Src      int
+	Col      int // -1 for the rowid
+	Depth    int // Enclosing queries out from this one that the source is in
+	Affinity Affinity
+	Collate  string
+}
+
+type UnaryExpr struct {
+	Op string // -, +, ~ or NOT
+	X  Expr
+}
+
+type BinaryExpr struct {
+	Op string // Upper case operator, e.g. =, AND, IS NOT, ||
+	L  Expr
+	R  Expr
+}
+
+type FuncCall struct {
+	Name     string // Lower case function name
+	Args     []Expr
+	Star     bool // count(*)
+	Distinct bool
+	Over     *WindowSpec // Window of a window function call, nil otherwise
+}
+
+// WindowSpec is the window given after OVER, or named by WINDOW
+type WindowSpec struct {
+	Base        string // Named window extended, from OVER name or OVER (name ...)
+	PartitionBy []Expr
+	OrderBy     []*OrderingTerm
+	Frame       *WindowFrame // Nil for the default frame
+}
+
+type WindowFrame struct {
+	Unit  string // ROWS, RANGE or GROUPS
+	Start FrameBound
+	End   FrameBound
+}
+
+type FrameBound struct {
+	Kind   string // UNBOUNDED PRECEDING, PRECEDING, CURRENT ROW, FOLLOWING or UNBOUNDED FOLLOWING
+	Offset Expr   // Rows, groups or range of PRECEDING and FOLLOWING
+}
+
+type NamedWindow struct {
+	Name string
+	Spec *WindowSpec
+}
+
+type InExpr struct {
+	X      Expr
+	List   []Expr
+	Select *SelectStatement // IN (SELECT ...), instead of List
+	Not    bool
+	Outer  []*ColumnRef // Columns of the enclosing query read by Select
+}
+
+// SubqueryExpr is a scalar subquery, the first column of its first row
+type SubqueryExpr struct {
+	Select *SelectStatement
+
+	// Columns of the enclosing query the subquery reads, filled in when
+	// the statement is bound
+	Outer []*ColumnRef
+}
+
+type ExistsExpr struct {
+	Select *SelectStatement
+	Outer  []*ColumnRef
+}
+
+type BetweenExpr struct {
+	X   Expr
+	Lo  Expr
+	Hi  Expr
+	Not bool
+}
+
+type LikeExpr struct {
+	Op      string // LIKE or GLOB
+	X       Expr
+	Pattern Expr
+	Escape  Expr
+	Not     bool
+}
+
+type IsNullExpr struct {
+	X   Expr
+	Not bool
+}
+
+type CastExpr struct {
+	X    Expr
+	Type string
+}
+
+type CaseExpr struct {
+	Operand Expr
+	Whens   []*WhenClause
+	Else    Expr
+}
+
+type WhenClause struct {
+	Cond   Expr
+	Result Expr
+}
+
+type CollateExpr struct {
+	X         Expr
+	Collation string
+}
+
+func (*Literal) exprNode()      {}
+func (*Param) exprNode()        {}
+func (*ColumnRef) exprNode()    {}
+func (*UnaryExpr) exprNode()    {}
+func (*BinaryExpr) exprNode()   {}
+func (*FuncCall) exprNode()     {}
+func (*InExpr) exprNode()       {}
+func (*BetweenExpr) exprNode()  {}
+func (*SubqueryExpr) exprNode() {}
+func (*ExistsExpr) exprNode()   {}
+func (*LikeExpr) exprNode()     {}
+func (*IsNullExpr) exprNode()   {}
+func (*CastExpr) exprNode()     {}
+func (*CaseExpr) exprNode()     {}
+func (*CollateExpr) exprNode()  {}
+
+// ----------------------------------------------------------------------------
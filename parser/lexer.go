@@ -0,0 +1,209 @@
+package parser
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// Constants ------------------------------------------------------------------
+
+type TokenKind int
+
+const (
+	TokenEOF TokenKind = iota
+	TokenIdent
+	TokenString
+	TokenNumber
+	TokenBlob
+	TokenOp
+	TokenParam
+)
+
+// ----------------------------------------------------------------------------
+
+// Custom Types ---------------------------------------------------------------
+type Token struct {
+	Kind   TokenKind
+	Text   string // Identifier or operator text, unquoted string contents
+	Pos    int    // Byte offset in the input
+	End    int    // Byte offset just past the token
+	Quoted bool   // Identifier was quoted and can not be a keyword
+}
+
+// ----------------------------------------------------------------------------
+
+// Tokenize splits SQL text into tokens, dropping whitespace and comments
+func Tokenize(input string) ([]Token, error) {
+	tokens := make([]Token, 0)
+	i := 0
+	for i < len(input) {
+		c := input[i]
+		start := i
+
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f':
+			i++
+			continue
+		case c == '-' && strings.HasPrefix(input[i:], "--"):
+			for i < len(input) && input[i] != '\n' {
+				i++
+			}
+			continue
+		case c == '/' && strings.HasPrefix(input[i:], "/*"):
+			end := strings.Index(input[i+2:], "*/")
+			if end == -1 {
+				i = len(input)
+			} else {
+				i += end + 4
+			}
+			continue
+		case (c == 'x' || c == 'X') && i+1 < len(input) && input[i+1] == '\'':
+			text, n, err := readQuoted(input[i+1:], '\'')
+			if err != nil {
+				return nil, err
+			}
+			blob, err := hex.DecodeString(text)
+			if err != nil {
+				return nil, fmt.Errorf("malformed blob literal: %s", input[i:i+1+n])
+			}
+			i += 1 + n
+			tokens = append(tokens, Token{Kind: TokenBlob, Text: string(blob), Pos: start, End: i})
+		case isIdentStart(c):
+			for i < len(input) && isIdentChar(input[i]) {
+				i++
+			}
+			tokens = append(tokens, Token{Kind: TokenIdent, Text: input[start:i], Pos: start, End: i})
+		case c == '"' || c == '`' || c == '[':
+			closing := c
+			if c == '[' {
+				closing = ']'
+			}
+			text, n, err := readQuoted(input[i:], closing)
+			if err != nil {
+				return nil, err
+			}
+			i += n
+			tokens = append(tokens, Token{Kind: TokenIdent, Text: text, Pos: start, End: i, Quoted: true})
+		case c == '\'':
+			text, n, err := readQuoted(input[i:], '\'')
+			if err != nil {
+				return nil, err
+			}
+			i += n
+			tokens = append(tokens, Token{Kind: TokenString, Text: text, Pos: start, End: i})
+		case c == '?':
+			i++
+			for i < len(input) && isDigit(input[i]) {
+				i++
+			}
+			tokens = append(tokens, Token{Kind: TokenParam, Text: input[start:i], Pos: start, End: i})
+		case (c == ':' || c == '@' || c == '$') && i+1 < len(input) && isIdentChar(input[i+1]):
+			i++
+			for i < len(input) && isIdentChar(input[i]) {
+				i++
+			}
+			tokens = append(tokens, Token{Kind: TokenParam, Text: input[start:i], Pos: start, End: i})
+		case isDigit(c) || (c == '.' && i+1 < len(input) && isDigit(input[i+1])):
+			i += scanNumber(input[i:])
+			tokens = append(tokens, Token{Kind: TokenNumber, Text: input[start:i], Pos: start, End: i})
+		default:
+			op := scanOperator(input[i:])
+			if op == "" {
+				return nil, fmt.Errorf("unrecognized token: \"%c\"", c)
+			}
+			i += len(op)
+			tokens = append(tokens, Token{Kind: TokenOp, Text: op, Pos: start, End: i})
+		}
+	}
+
+	tokens = append(tokens, Token{Kind: TokenEOF, Pos: len(input), End: len(input)})
+	return tokens, nil
+}
+
+// Lexer helpers --------------------------------------------------------------
+// readQuoted reads a quoted token starting at input[0], where a doubled
+// closing quote stands for itself. Returns the contents and bytes consumed.
+func readQuoted(input string, closing byte) (string, int, error) {
+	var sb strings.Builder
+	for i := 1; i < len(input); i++ {
+		if input[i] != closing {
+			sb.WriteByte(input[i])
+			continue
+		}
+		if closing != ']' && i+1 < len(input) && input[i+1] == closing {
+			sb.WriteByte(closing)
+			i++
+			continue
+		}
+		return sb.String(), i + 1, nil
+	}
+	return "", 0, fmt.Errorf("unterminated quoted token: %s", input)
+}
+
+func scanNumber(input string) int {
+	i := 0
+	if strings.HasPrefix(input, "0x") || strings.HasPrefix(input, "0X") {
+		i = 2
+		for i < len(input) && isHexDigit(input[i]) {
+			i++
+		}
+		return i
+	}
+
+	for i < len(input) && isDigit(input[i]) {
+		i++
+	}
+	if i < len(input) && input[i] == '.' {
+		i++
+		for i < len(input) && isDigit(input[i]) {
+			i++
+		}
+	}
+	if i < len(input) && (input[i] == 'e' || input[i] == 'E') {
+		j := i + 1
+		if j < len(input) && (input[j] == '+' || input[j] == '-') {
+			j++
+		}
+		if j < len(input) && isDigit(input[j]) {
+			i = j
+			for i < len(input) && isDigit(input[i]) {
+				i++
+			}
+		}
+	}
+	return i
+}
+
+var operators = []string{
+	"||", "<<", ">>", "<=", ">=", "==", "!=", "<>", "->>", "->",
+	"(", ")", ",", ";", ".", "*", "+", "-", "/", "%", "=", "<", ">", "&", "|", "~",
+}
+
+func scanOperator(input string) string {
+	longest := ""
+	for _, op := range operators {
+		if strings.HasPrefix(input, op) && len(op) > len(longest) {
+			longest = op
+		}
+	}
+	return longest
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= 0x80
+}
+
+func isIdentChar(c byte) bool {
+	return isIdentStart(c) || isDigit(c) || c == '$'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isHexDigit(c byte) bool {
+	return isDigit(c) || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+// ----------------------------------------------------------------------------
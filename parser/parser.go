@@ -0,0 +1,1849 @@
+// Package parser tokenizes SQL and parses it into statements.
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Constants ------------------------------------------------------------------
+
+const MaxParams = 32766 // Largest parameter number
+
+// ----------------------------------------------------------------------------
+
+// Custom Types ---------------------------------------------------------------
+type Parser struct {
+	input  string
+	tokens []Token
+	pos    int
+	params []string // Name of each parameter by index - 1, "" for a bare ?
+}
+
+// ----------------------------------------------------------------------------
+
+// Keywords that end an expression list and so can not be read as an alias
+var reservedWords = map[string]bool{
+	"ALL": true, "AND": true, "AS": true, "ASC": true, "BETWEEN": true, "BY": true,
+	"CASE": true, "COLLATE": true, "CROSS": true, "DEFAULT": true, "DESC": true,
+	"DISTINCT": true, "ELSE": true, "END": true, "ESCAPE": true, "EXCEPT": true,
+	"EXISTS": true, "FROM": true, "FULL": true, "GLOB": true, "GROUP": true,
+	"HAVING": true, "IN": true, "INNER": true, "INTERSECT": true, "INTO": true,
+	"IS": true, "ISNULL": true, "JOIN": true, "LEFT": true, "LIKE": true,
+	"LIMIT": true, "NATURAL": true, "NOT": true, "NOTNULL": true, "NULL": true,
+	"OFFSET": true, "ON": true, "OR": true, "ORDER": true, "OUTER": true,
+	"RIGHT": true, "SELECT": true, "SET": true, "THEN": true, "UNION": true,
+	"USING": true, "VALUES": true, "WHEN": true, "WHERE": true, "WINDOW": true,
+}
+
+// Keywords that start a column constraint rather than continue a type name
+var columnConstraintWords = map[string]bool{
+	"CONSTRAINT": true, "PRIMARY": true, "NOT": true, "NULL": true, "UNIQUE": true,
+	"CHECK": true, "DEFAULT": true, "COLLATE": true, "REFERENCES": true,
+	"GENERATED": true, "AS": true,
+}
+
+// Parser entry points --------------------------------------------------------
+func NewParser(input string) (*Parser, error) {
+	tokens, err := Tokenize(input)
+	if err != nil {
+		return nil, err
+	}
+	return &Parser{input: input, tokens: tokens}, nil
+}
+
+// ParseStatements parses a list of statements separated by semicolons
+func ParseStatements(input string) ([]Statement, error) {
+	stmts, _, err := ParseWithParams(input)
+	return stmts, err
+}
+
+// ParseWithParams parses a list of statements like ParseStatements and also
+// returns the name of each parameter they hold, numbered across all of them.
+// Bare ? parameters have no name.
+func ParseWithParams(input string) ([]Statement, []string, error) {
+	p, err := NewParser(input)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	stmts := make([]Statement, 0)
+	for {
+		for p.acceptOp(";") {
+		}
+		if p.peek().Kind == TokenEOF {
+			return stmts, p.params, nil
+		}
+
+		stmt, err := p.parseStatement()
+		if err != nil {
+			return nil, nil, err
+		}
+		stmts = append(stmts, stmt)
+
+		if p.peek().Kind != TokenEOF && !p.isOp(";") {
+			return nil, nil, p.syntaxError()
+		}
+	}
+}
+
+// ParseStatement parses input holding exactly one statement
+func ParseStatement(input string) (Statement, error) {
+	stmts, err := ParseStatements(input)
+	if err != nil {
+		return nil, err
+	}
+	if len(stmts) != 1 {
+		return nil, fmt.Errorf("expected one statement, found %d", len(stmts))
+	}
+	return stmts[0], nil
+}
+
+func (p *Parser) parseStatement() (Statement, error) {
+	switch {
+	case p.startsSelect(0):
+		return p.parseSelect()
+	case p.isKeyword("INSERT"), p.isKeyword("REPLACE"):
+		return p.parseInsert()
+	case p.isKeyword("UPDATE"):
+		return p.parseUpdate()
+	case p.isKeyword("DELETE"):
+		return p.parseDelete()
+	case p.isKeyword("BEGIN", "COMMIT", "END", "ROLLBACK"):
+		return p.parseTransaction()
+	case p.isKeyword("CREATE"):
+		// The SQL of a CREATE is kept in the schema, where nothing binds
+		// parameters
+		params := len(p.params)
+		stmt, err := p.parseCreate()
+		if err == nil && len(p.params) > params {
+			return nil, errors.New("parameters are not allowed in CREATE statements")
+		}
+		return stmt, err
+	case p.isKeyword("DROP"):
+		return p.parseDrop()
+	case p.isKeyword("VACUUM"):
+		return p.parseVacuum()
+	case p.isKeyword("ANALYZE"):
+		return p.parseAnalyze()
+	case p.isKeyword("EXPLAIN"):
+		return p.parseExplain()
+	default:
+		return nil, p.syntaxError()
+	}
+}
+
+// ----------------------------------------------------------------------------
+
+// SELECT ---------------------------------------------------------------------
+// parseSelect parses a SELECT with its WITH clause and the SELECTs compounded
+// with it, followed by the ORDER BY and LIMIT that apply to them all
+func (p *Parser) parseSelect() (*SelectStatement, error) {
+	var with *WithClause
+	if p.isKeyword("WITH") {
+		var err error
+		if with, err = p.parseWith(); err != nil {
+			return nil, err
+		}
+	}
+
+	stmt, err := p.parseSelectCore()
+	if err != nil {
+		return nil, err
+	}
+	stmt.With = with
+
+	for p.isKeyword("UNION", "INTERSECT", "EXCEPT") {
+		op := strings.ToUpper(p.next().Text)
+		if op == "UNION" && p.acceptKeyword("ALL") {
+			op = "UNION ALL"
+		}
+		core, err := p.parseSelectCore()
+		if err != nil {
+			return nil, err
+		}
+		stmt.Compound = append(stmt.Compound, &CompoundSelect{Op: op, Select: core})
+	}
+
+	if p.acceptKeyword("ORDER") {
+		if stmt.OrderBy, err = p.parseOrderBy(); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.acceptKeyword("LIMIT") {
+		if stmt.Limit, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+		if p.acceptKeyword("OFFSET") {
+			if stmt.Offset, err = p.parseExpr(); err != nil {
+				return nil, err
+			}
+		} else if p.acceptOp(",") {
+			// LIMIT <offset>, <count>
+			stmt.Offset = stmt.Limit
+			if stmt.Limit, err = p.parseExpr(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return stmt, nil
+}
+
+// parseSelectCore parses a SELECT up to its HAVING clause
+func (p *Parser) parseSelectCore() (*SelectStatement, error) {
+	if err := p.expectKeyword("SELECT"); err != nil {
+		return nil, err
+	}
+
+	stmt := &SelectStatement{}
+	if p.acceptKeyword("DISTINCT") {
+		stmt.Distinct = true
+	} else {
+		p.acceptKeyword("ALL")
+	}
+
+	for {
+		col, err := p.parseResultColumn()
+		if err != nil {
+			return nil, err
+		}
+		stmt.Columns = append(stmt.Columns, col)
+		if !p.acceptOp(",") {
+			break
+		}
+	}
+
+	if p.acceptKeyword("FROM") {
+		from, err := p.parseFrom()
+		if err != nil {
+			return nil, err
+		}
+		stmt.From = from
+	}
+
+	var err error
+	if p.acceptKeyword("WHERE") {
+		if stmt.Where, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.acceptKeyword("GROUP") {
+		if err := p.expectKeyword("BY"); err != nil {
+			return nil, err
+		}
+		if stmt.GroupBy, err = p.parseExprList(); err != nil {
+			return nil, err
+		}
+		if p.acceptKeyword("HAVING") {
+			if stmt.Having, err = p.parseExpr(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if p.acceptKeyword("WINDOW") {
+		for {
+			name, err := p.parseName()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expectKeyword("AS"); err != nil {
+				return nil, err
+			}
+			spec, err := p.parseWindowSpec()
+			if err != nil {
+				return nil, err
+			}
+			stmt.Windows = append(stmt.Windows, &NamedWindow{Name: name, Spec: spec})
+			if !p.acceptOp(",") {
+				break
+			}
+		}
+	}
+
+	return stmt, nil
+}
+
+// parseWith parses WITH [RECURSIVE] and its common table expressions
+func (p *Parser) parseWith() (*WithClause, error) {
+	p.next()
+	with := &WithClause{Recursive: p.acceptKeyword("RECURSIVE")}
+	for {
+		name, err := p.parseName()
+		if err != nil {
+			return nil, err
+		}
+		cte := &CommonTableExpr{Name: name}
+		if p.acceptOp("(") {
+			if cte.Columns, err = p.parseNameList(); err != nil {
+				return nil, err
+			}
+		}
+		if err := p.expectKeyword("AS"); err != nil {
+			return nil, err
+		}
+		switch {
+		case p.acceptKeyword("MATERIALIZED"):
+			cte.Materialized = "MATERIALIZED"
+		case p.isKeyword("NOT") && strings.EqualFold(p.peekAt(1).Text, "MATERIALIZED"):
+			p.pos += 2
+			cte.Materialized = "NOT MATERIALIZED"
+		}
+		if cte.Select, err = p.parseSubquery(); err != nil {
+			return nil, err
+		}
+		with.CTEs = append(with.CTEs, cte)
+
+		if !p.acceptOp(",") {
+			return with, nil
+		}
+	}
+}
+
+func (p *Parser) parseResultColumn() (*ResultColumn, error) {
+	if p.acceptOp("*") {
+		return &ResultColumn{Star: true, Text: "*"}, nil
+	}
+	if p.peek().Kind == TokenIdent && p.peekAt(1).Text == "." && p.peekAt(2).Text == "*" {
+		table := p.next().Text
+		p.pos += 2
+		return &ResultColumn{Star: true, Table: table, Text: table + ".*"}, nil
+	}
+
+	start := p.peek().Pos
+	expr, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	col := &ResultColumn{Expr: expr, Text: p.input[start:p.prevEnd()]}
+
+	if p.acceptKeyword("AS") {
+		col.Alias, err = p.parseName()
+		if err != nil {
+			return nil, err
+		}
+	} else if p.isAlias() {
+		col.Alias = p.next().Text
+	}
+	return col, nil
+}
+
+// parseFrom parses the tables of a FROM clause joined with commas or JOIN
+// operators. NATURAL joins are given an empty, non-nil Using list to be
+// filled in once the columns are known.
+func (p *Parser) parseFrom() ([]*TableRef, error) {
+	first, err := p.parseTableRef()
+	if err != nil {
+		return nil, err
+	}
+	from := []*TableRef{first}
+
+	for {
+		join, natural := "", false
+		switch {
+		case p.acceptOp(","):
+		case p.isKeyword("JOIN", "INNER", "LEFT", "CROSS", "NATURAL", "RIGHT", "FULL"):
+			natural = p.acceptKeyword("NATURAL")
+			switch {
+			case p.acceptKeyword("INNER"):
+				join = "INNER"
+			case p.acceptKeyword("CROSS"):
+				join = "CROSS"
+			case p.acceptKeyword("LEFT"):
+				p.acceptKeyword("OUTER")
+				join = "LEFT"
+			case p.isKeyword("RIGHT", "FULL"):
+				return nil, fmt.Errorf("%s JOIN is not supported", strings.ToUpper(p.peek().Text))
+			default:
+				join = "INNER"
+			}
+			if err := p.expectKeyword("JOIN"); err != nil {
+				return nil, err
+			}
+		default:
+			return from, nil
+		}
+
+		ref, err := p.parseTableRef()
+		if err != nil {
+			return nil, err
+		}
+		ref.Join = join
+		switch {
+		case natural:
+			ref.Using = []string{}
+		case p.acceptKeyword("ON"):
+			if ref.On, err = p.parseExpr(); err != nil {
+				return nil, err
+			}
+		case p.acceptKeyword("USING"):
+			if err := p.expectOp("("); err != nil {
+				return nil, err
+			}
+			if ref.Using, err = p.parseNameList(); err != nil {
+				return nil, err
+			}
+		}
+		if natural && (ref.On != nil || p.isKeyword("ON", "USING")) {
+			return nil, errors.New("a NATURAL join may not have an ON or USING clause")
+		}
+		from = append(from, ref)
+	}
+}
+
+func (p *Parser) parseTableRef() (*TableRef, error) {
+	ref := &TableRef{}
+	var err error
+	if p.isOp("(") {
+		if ref.Subquery, err = p.parseSubquery(); err != nil {
+			return nil, err
+		}
+	} else if ref.Name, err = p.parseQualifiedName(); err != nil {
+		return nil, err
+	}
+
+	if p.acceptKeyword("AS") {
+		ref.Alias, err = p.parseName()
+		if err != nil {
+			return nil, err
+		}
+	} else if p.isAlias() {
+		ref.Alias = p.next().Text
+	}
+	return ref, nil
+}
+
+func (p *Parser) parseOrderBy() ([]*OrderingTerm, error) {
+	if err := p.expectKeyword("BY"); err != nil {
+		return nil, err
+	}
+
+	terms := make([]*OrderingTerm, 0)
+	for {
+		expr, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		term := &OrderingTerm{Expr: expr}
+		if p.acceptKeyword("DESC") {
+			term.Desc = true
+		} else {
+			p.acceptKeyword("ASC")
+		}
+		terms = append(terms, term)
+
+		if !p.acceptOp(",") {
+			return terms, nil
+		}
+	}
+}
+
+// ----------------------------------------------------------------------------
+
+// INSERT ---------------------------------------------------------------------
+func (p *Parser) parseInsert() (*InsertStatement, error) {
+	stmt := &InsertStatement{}
+	var err error
+	if p.acceptKeyword("REPLACE") {
+		stmt.Conflict = "REPLACE"
+	} else {
+		p.next()
+		if stmt.Conflict, err = p.parseConflictOr(); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.expectKeyword("INTO"); err != nil {
+		return nil, err
+	}
+
+	stmt.Table, err = p.parseQualifiedName()
+	if err != nil {
+		return nil, err
+	}
+	if p.acceptKeyword("AS") {
+		if _, err := p.parseName(); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.acceptOp("(") {
+		stmt.Columns, err = p.parseNameList()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	switch {
+	case p.acceptKeyword("DEFAULT"):
+		stmt.DefaultValues = true
+		err = p.expectKeyword("VALUES")
+	case p.acceptKeyword("VALUES"):
+		for {
+			if err := p.expectOp("("); err != nil {
+				return nil, err
+			}
+			row, err := p.parseExprList()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expectOp(")"); err != nil {
+				return nil, err
+			}
+			stmt.Values = append(stmt.Values, row)
+			if !p.acceptOp(",") {
+				break
+			}
+		}
+	case p.startsSelect(0):
+		stmt.Select, err = p.parseSelect()
+	default:
+		err = p.syntaxError()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return stmt, nil
+}
+
+// parseConflictOr reads an optional "OR <resolution>" after INSERT or UPDATE
+func (p *Parser) parseConflictOr() (string, error) {
+	if !p.acceptKeyword("OR") {
+		return "", nil
+	}
+	if !p.isKeyword("ROLLBACK", "ABORT", "REPLACE", "FAIL", "IGNORE") {
+		return "", p.syntaxError()
+	}
+	return strings.ToUpper(p.next().Text), nil
+}
+
+// ----------------------------------------------------------------------------
+
+// UPDATE and DELETE ----------------------------------------------------------
+func (p *Parser) parseUpdate() (*UpdateStatement, error) {
+	if err := p.expectKeyword("UPDATE"); err != nil {
+		return nil, err
+	}
+
+	stmt := &UpdateStatement{}
+	var err error
+	if stmt.Conflict, err = p.parseConflictOr(); err != nil {
+		return nil, err
+	}
+	if stmt.Table, stmt.Alias, err = p.parseTargetTable(); err != nil {
+		return nil, err
+	}
+
+	if err := p.expectKeyword("SET"); err != nil {
+		return nil, err
+	}
+	for {
+		set := &Assignment{}
+		if set.Column, err = p.parseName(); err != nil {
+			return nil, err
+		}
+		if err := p.expectOp("="); err != nil {
+			return nil, err
+		}
+		if set.Value, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+		stmt.Set = append(stmt.Set, set)
+		if !p.acceptOp(",") {
+			break
+		}
+	}
+
+	if p.acceptKeyword("WHERE") {
+		if stmt.Where, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+	return stmt, nil
+}
+
+func (p *Parser) parseDelete() (*DeleteStatement, error) {
+	if err := p.expectKeyword("DELETE"); err != nil {
+		return nil, err
+	}
+	if err := p.expectKeyword("FROM"); err != nil {
+		return nil, err
+	}
+
+	stmt := &DeleteStatement{}
+	var err error
+	if stmt.Table, stmt.Alias, err = p.parseTargetTable(); err != nil {
+		return nil, err
+	}
+	if p.acceptKeyword("WHERE") {
+		if stmt.Where, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+	return stmt, nil
+}
+
+// parseTargetTable reads the table an UPDATE or DELETE writes to and its
+// optional alias
+func (p *Parser) parseTargetTable() (string, string, error) {
+	name, err := p.parseQualifiedName()
+	if err != nil {
+		return "", "", err
+	}
+	if p.acceptKeyword("AS") || p.isAlias() {
+		alias, err := p.parseName()
+		return name, alias, err
+	}
+	return name, "", nil
+}
+
+// ----------------------------------------------------------------------------
+
+// Transactions ---------------------------------------------------------------
+func (p *Parser) parseTransaction() (Statement, error) {
+	var stmt Statement
+	switch strings.ToUpper(p.next().Text) {
+	case "BEGIN":
+		if p.isKeyword("DEFERRED", "IMMEDIATE", "EXCLUSIVE") {
+			p.next()
+		}
+		stmt = &BeginStatement{}
+	case "COMMIT", "END":
+		stmt = &CommitStatement{}
+	default:
+		stmt = &RollbackStatement{}
+	}
+
+	if p.acceptKeyword("TRANSACTION") && p.peek().Kind == TokenIdent && !p.isKeyword("TO") {
+		p.next()
+	}
+	if p.isKeyword("TO") {
+		return nil, errors.New("savepoints are not supported")
+	}
+	return stmt, nil
+}
+
+// ----------------------------------------------------------------------------
+
+// CREATE ---------------------------------------------------------------------
+func (p *Parser) parseCreate() (Statement, error) {
+	p.next()
+	switch {
+	case p.acceptKeyword("TABLE"):
+		return p.parseCreateTable()
+	case p.acceptKeyword("UNIQUE"):
+		if err := p.expectKeyword("INDEX"); err != nil {
+			return nil, err
+		}
+		return p.parseCreateIndex(true)
+	case p.acceptKeyword("INDEX"):
+		return p.parseCreateIndex(false)
+	default:
+		return nil, p.syntaxError()
+	}
+}
+
+func (p *Parser) parseCreateTable() (*CreateTableStatement, error) {
+	stmt := &CreateTableStatement{IfNotExists: p.acceptIfNotExists()}
+
+	var err error
+	stmt.Name, err = p.parseQualifiedName()
+	if err != nil {
+		return nil, err
+	}
+	nameStart := p.tokens[p.pos-1].Pos
+	if p.isKeyword("AS") {
+		return nil, errors.New("CREATE TABLE ... AS SELECT is not supported")
+	}
+	if err := p.expectOp("("); err != nil {
+		return nil, err
+	}
+
+	for {
+		if p.isKeyword("CONSTRAINT", "PRIMARY", "UNIQUE", "CHECK", "FOREIGN") {
+			constraint, err := p.parseTableConstraint()
+			if err != nil {
+				return nil, err
+			}
+			if constraint != nil {
+				stmt.Constraints = append(stmt.Constraints, constraint)
+			}
+		} else {
+			col, err := p.parseColumnDef()
+			if err != nil {
+				return nil, err
+			}
+			stmt.Columns = append(stmt.Columns, col)
+		}
+
+		if !p.acceptOp(",") {
+			break
+		}
+	}
+	if err := p.expectOp(")"); err != nil {
+		return nil, err
+	}
+
+	// Table options
+options:
+	for {
+		switch {
+		case p.acceptKeyword("WITHOUT"):
+			if err := p.expectKeyword("ROWID"); err != nil {
+				return nil, err
+			}
+			stmt.WithoutRowID = true
+		case p.acceptKeyword("STRICT"):
+		default:
+			break options
+		}
+		if !p.acceptOp(",") {
+			break
+		}
+	}
+	stmt.SQL = "CREATE TABLE " + p.input[nameStart:p.prevEnd()]
+	return stmt, nil
+}
+
+func (p *Parser) parseColumnDef() (*ColumnDef, error) {
+	name, err := p.parseName()
+	if err != nil {
+		return nil, err
+	}
+	col := &ColumnDef{Name: name}
+
+	// Type names are any run of words not starting a constraint, optionally
+	// followed by one or two sizes, e.g. "UNSIGNED BIG INT" or "VARCHAR(255)"
+	if p.peek().Kind == TokenIdent && !columnConstraintWords[strings.ToUpper(p.peek().Text)] {
+		start := p.peek().Pos
+		for p.peek().Kind == TokenIdent && !columnConstraintWords[strings.ToUpper(p.peek().Text)] {
+			p.next()
+		}
+		if p.acceptOp("(") {
+			for !p.isOp(")") {
+				if p.peek().Kind == TokenEOF {
+					return nil, p.syntaxError()
+				}
+				p.next()
+			}
+			p.next()
+		}
+		col.Type = p.input[start:p.prevEnd()]
+	}
+
+	for {
+		if p.acceptKeyword("CONSTRAINT") {
+			if _, err := p.parseName(); err != nil {
+				return nil, err
+			}
+		}
+
+		switch {
+		case p.acceptKeyword("PRIMARY"):
+			if err := p.expectKeyword("KEY"); err != nil {
+				return nil, err
+			}
+			col.PrimaryKey = true
+			if p.acceptKeyword("DESC") {
+				col.PrimaryDesc = true
+			} else {
+				p.acceptKeyword("ASC")
+			}
+			if err := p.skipConflictClause(); err != nil {
+				return nil, err
+			}
+			col.Autoincrement = p.acceptKeyword("AUTOINCREMENT")
+		case p.acceptKeyword("NOT"):
+			if err := p.expectKeyword("NULL"); err != nil {
+				return nil, err
+			}
+			col.NotNull = true
+			if err := p.skipConflictClause(); err != nil {
+				return nil, err
+			}
+		case p.acceptKeyword("NULL"):
+			if err := p.skipConflictClause(); err != nil {
+				return nil, err
+			}
+		case p.acceptKeyword("UNIQUE"):
+			col.Unique = true
+			if err := p.skipConflictClause(); err != nil {
+				return nil, err
+			}
+		case p.acceptKeyword("CHECK"):
+			if _, err := p.parseParenExpr(); err != nil {
+				return nil, err
+			}
+		case p.acceptKeyword("DEFAULT"):
+			if col.Default, err = p.parseDefault(); err != nil {
+				return nil, err
+			}
+		case p.acceptKeyword("COLLATE"):
+			if col.Collate, err = p.parseName(); err != nil {
+				return nil, err
+			}
+		case p.isKeyword("REFERENCES"):
+			if err := p.skipForeignKeyClause(); err != nil {
+				return nil, err
+			}
+		case p.isKeyword("GENERATED"), p.isKeyword("AS"):
+			if p.acceptKeyword("GENERATED") {
+				if err := p.expectKeyword("ALWAYS"); err != nil {
+					return nil, err
+				}
+			}
+			if err := p.expectKeyword("AS"); err != nil {
+				return nil, err
+			}
+			if col.Generated, err = p.parseParenExpr(); err != nil {
+				return nil, err
+			}
+			if p.acceptKeyword("STORED") {
+				col.Stored = true
+			} else {
+				p.acceptKeyword("VIRTUAL")
+			}
+		default:
+			return col, nil
+		}
+	}
+}
+
+// parseTableConstraint returns nil for CHECK and FOREIGN KEY constraints,
+// which are not enforced
+func (p *Parser) parseTableConstraint() (*TableConstraint, error) {
+	if p.acceptKeyword("CONSTRAINT") {
+		if _, err := p.parseName(); err != nil {
+			return nil, err
+		}
+	}
+
+	constraint := &TableConstraint{}
+	switch {
+	case p.acceptKeyword("PRIMARY"):
+		if err := p.expectKeyword("KEY"); err != nil {
+			return nil, err
+		}
+		constraint.PrimaryKey = true
+	case p.acceptKeyword("UNIQUE"):
+	case p.acceptKeyword("CHECK"):
+		_, err := p.parseParenExpr()
+		return nil, err
+	case p.acceptKeyword("FOREIGN"):
+		if err := p.expectKeyword("KEY"); err != nil {
+			return nil, err
+		}
+		if err := p.expectOp("("); err != nil {
+			return nil, err
+		}
+		if _, err := p.parseNameList(); err != nil {
+			return nil, err
+		}
+		return nil, p.skipForeignKeyClause()
+	default:
+		return nil, p.syntaxError()
+	}
+
+	var err error
+	if err := p.expectOp("("); err != nil {
+		return nil, err
+	}
+	constraint.Columns, err = p.parseIndexedColumns()
+	if err != nil {
+		return nil, err
+	}
+	if p.acceptKeyword("AUTOINCREMENT") && constraint.PrimaryKey && len(constraint.Columns) == 1 {
+		constraint.Columns[0].Autoincrement = true
+	}
+	return constraint, p.skipConflictClause()
+}
+
+func (p *Parser) parseCreateIndex(unique bool) (*CreateIndexStatement, error) {
+	stmt := &CreateIndexStatement{Unique: unique, IfNotExists: p.acceptIfNotExists()}
+
+	var err error
+	stmt.Name, err = p.parseQualifiedName()
+	if err != nil {
+		return nil, err
+	}
+	nameStart := p.tokens[p.pos-1].Pos
+	if err := p.expectKeyword("ON"); err != nil {
+		return nil, err
+	}
+	stmt.Table, err = p.parseName()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectOp("("); err != nil {
+		return nil, err
+	}
+	stmt.Columns, err = p.parseIndexedColumns()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.acceptKeyword("WHERE") {
+		if stmt.Where, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+
+	stmt.SQL = "CREATE INDEX "
+	if unique {
+		stmt.SQL = "CREATE UNIQUE INDEX "
+	}
+	stmt.SQL += p.input[nameStart:p.prevEnd()]
+	return stmt, nil
+}
+
+// parseIndexedColumns reads a column list up to and including the closing
+// parenthesis
+func (p *Parser) parseIndexedColumns() ([]*IndexedColumn, error) {
+	cols := make([]*IndexedColumn, 0)
+	for {
+		start := p.peek().Pos
+		expr, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+
+		col := &IndexedColumn{Expr: expr}
+		if collate, ok := expr.(*CollateExpr); ok {
+			col.Expr = collate.X
+			col.Collate = collate.Collation
+		}
+		if ref, ok := col.Expr.(*ColumnRef); ok && ref.Table == "" {
+			col.Name = ref.Column
+		}
+		if p.acceptKeyword("DESC") {
+			col.Desc = true
+		} else {
+			p.acceptKeyword("ASC")
+		}
+		col.Text = p.input[start:p.prevEnd()]
+		cols = append(cols, col)
+
+		if !p.acceptOp(",") {
+			break
+		}
+	}
+	return cols, p.expectOp(")")
+}
+
+func (p *Parser) parseDefault() (Expr, error) {
+	switch {
+	case p.isOp("("):
+		return p.parseParenExpr()
+	case p.isOp("-"), p.isOp("+"):
+		return p.parseUnary()
+	}
+
+	expr, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	// A bare identifier default is read as a string
+	if ref, ok := expr.(*ColumnRef); ok && ref.Table == "" {
+		return &Literal{ref.Column}, nil
+	}
+	return expr, nil
+}
+
+func (p *Parser) skipConflictClause() error {
+	if !p.acceptKeyword("ON") {
+		return nil
+	}
+	if err := p.expectKeyword("CONFLICT"); err != nil {
+		return err
+	}
+	if !p.isKeyword("ROLLBACK", "ABORT", "FAIL", "IGNORE", "REPLACE") {
+		return p.syntaxError()
+	}
+	p.next()
+	return nil
+}
+
+func (p *Parser) skipForeignKeyClause() error {
+	if err := p.expectKeyword("REFERENCES"); err != nil {
+		return err
+	}
+	if _, err := p.parseName(); err != nil {
+		return err
+	}
+	if p.acceptOp("(") {
+		if _, err := p.parseNameList(); err != nil {
+			return err
+		}
+	}
+
+	for {
+		switch {
+		case p.acceptKeyword("ON"):
+			if !p.acceptKeyword("DELETE") && !p.acceptKeyword("UPDATE") {
+				return p.syntaxError()
+			}
+			switch {
+			case p.acceptKeyword("SET"):
+				if !p.acceptKeyword("NULL") && !p.acceptKeyword("DEFAULT") {
+					return p.syntaxError()
+				}
+			case p.acceptKeyword("NO"):
+				if err := p.expectKeyword("ACTION"); err != nil {
+					return err
+				}
+			case p.acceptKeyword("CASCADE"), p.acceptKeyword("RESTRICT"):
+			default:
+				return p.syntaxError()
+			}
+		case p.acceptKeyword("MATCH"):
+			if _, err := p.parseName(); err != nil {
+				return err
+			}
+		case p.isKeyword("NOT") && strings.EqualFold(p.peekAt(1).Text, "DEFERRABLE"), p.isKeyword("DEFERRABLE"):
+			p.acceptKeyword("NOT")
+			p.next()
+			if p.acceptKeyword("INITIALLY") {
+				if !p.acceptKeyword("DEFERRED") && !p.acceptKeyword("IMMEDIATE") {
+					return p.syntaxError()
+				}
+			}
+		default:
+			return nil
+		}
+	}
+}
+
+func (p *Parser) acceptIfNotExists() bool {
+	if p.isKeyword("IF") && strings.EqualFold(p.peekAt(1).Text, "NOT") {
+		p.pos += 2
+		p.acceptKeyword("EXISTS")
+		return true
+	}
+	return false
+}
+
+// ----------------------------------------------------------------------------
+
+// DROP -----------------------------------------------------------------------
+func (p *Parser) parseDrop() (*DropStatement, error) {
+	p.next()
+	if !p.isKeyword("TABLE", "INDEX", "VIEW", "TRIGGER") {
+		return nil, p.syntaxError()
+	}
+	stmt := &DropStatement{Kind: strings.ToUpper(p.next().Text)}
+
+	if p.isKeyword("IF") && strings.EqualFold(p.peekAt(1).Text, "EXISTS") {
+		p.pos += 2
+		stmt.IfExists = true
+	}
+	var err error
+	stmt.Name, err = p.parseQualifiedName()
+	if err != nil {
+		return nil, err
+	}
+	return stmt, nil
+}
+
+// ----------------------------------------------------------------------------
+
+// VACUUM ---------------------------------------------------------------------
+func (p *Parser) parseVacuum() (*VacuumStatement, error) {
+	p.next()
+	stmt := &VacuumStatement{}
+
+	// Only the main schema exists
+	if p.peek().Kind == TokenIdent && !p.isKeyword("INTO") {
+		p.next()
+	}
+	if p.acceptKeyword("INTO") {
+		var err error
+		if stmt.Into, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+	return stmt, nil
+}
+
+// ----------------------------------------------------------------------------
+
+// ANALYZE --------------------------------------------------------------------
+func (p *Parser) parseAnalyze() (*AnalyzeStatement, error) {
+	p.next()
+	stmt := &AnalyzeStatement{}
+	if p.peek().Kind != TokenIdent {
+		return stmt, nil
+	}
+	var err error
+	stmt.Name, err = p.parseQualifiedName()
+	return stmt, err
+}
+
+// ----------------------------------------------------------------------------
+
+// EXPLAIN --------------------------------------------------------------------
+func (p *Parser) parseExplain() (*ExplainStatement, error) {
+	p.next()
+	if !p.acceptKeyword("QUERY") {
+		return nil, errors.New("EXPLAIN is only supported as EXPLAIN QUERY PLAN")
+	}
+	if err := p.expectKeyword("PLAN"); err != nil {
+		return nil, err
+	}
+	if !p.startsSelect(0) {
+		return nil, errors.New("EXPLAIN QUERY PLAN is only supported for SELECT")
+	}
+	stmt, err := p.parseSelect()
+	if err != nil {
+		return nil, err
+	}
+	return &ExplainStatement{Select: stmt}, nil
+}
+
+// ----------------------------------------------------------------------------
+
+// Expressions ----------------------------------------------------------------
+func (p *Parser) parseExpr() (Expr, error) {
+	return p.parseOr()
+}
+
+func (p *Parser) parseExprList() ([]Expr, error) {
+	exprs := make([]Expr, 0)
+	for {
+		expr, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, expr)
+		if !p.acceptOp(",") {
+			return exprs, nil
+		}
+	}
+}
+
+func (p *Parser) parseParenExpr() (Expr, error) {
+	if err := p.expectOp("("); err != nil {
+		return nil, err
+	}
+	expr, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	return expr, p.expectOp(")")
+}
+
+func (p *Parser) parseOr() (Expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("OR") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryExpr{"OR", left, right}
+	}
+	return left, nil
+}
+
+func (p *Parser) parseAnd() (Expr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("AND") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryExpr{"AND", left, right}
+	}
+	return left, nil
+}
+
+func (p *Parser) parseNot() (Expr, error) {
+	if p.acceptKeyword("NOT") {
+		x, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &UnaryExpr{"NOT", x}, nil
+	}
+	return p.parseEquality()
+}
+
+// parseEquality reads =, ==, !=, <>, IS, IN, LIKE, GLOB, BETWEEN and the
+// NULL tests, which all share one precedence level
+func (p *Parser) parseEquality() (Expr, error) {
+	left, err := p.parseComparison()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		not := false
+		if p.isKeyword("NOT") && p.peekAt(1).Kind == TokenIdent {
+			switch strings.ToUpper(p.peekAt(1).Text) {
+			case "IN", "LIKE", "GLOB", "BETWEEN", "NULL":
+				p.next()
+				not = true
+			}
+		}
+
+		switch {
+		case p.isOp("=", "==", "!=", "<>"):
+			op := p.next().Text
+			switch op {
+			case "==":
+				op = "="
+			case "<>":
+				op = "!="
+			}
+			right, err := p.parseComparison()
+			if err != nil {
+				return nil, err
+			}
+			left = &BinaryExpr{op, left, right}
+		case p.acceptKeyword("IS"):
+			op := "IS"
+			if p.acceptKeyword("NOT") {
+				op = "IS NOT"
+			}
+			if p.acceptKeyword("DISTINCT") {
+				if err := p.expectKeyword("FROM"); err != nil {
+					return nil, err
+				}
+				op = map[string]string{"IS": "IS NOT", "IS NOT": "IS"}[op]
+			}
+			right, err := p.parseComparison()
+			if err != nil {
+				return nil, err
+			}
+			left = &BinaryExpr{op, left, right}
+		case p.acceptKeyword("IN"):
+			if err := p.expectOp("("); err != nil {
+				return nil, err
+			}
+			in := &InExpr{X: left, Not: not}
+			if p.startsSelect(0) {
+				if in.Select, err = p.parseSelect(); err != nil {
+					return nil, err
+				}
+			} else if !p.isOp(")") {
+				if in.List, err = p.parseExprList(); err != nil {
+					return nil, err
+				}
+			}
+			if err := p.expectOp(")"); err != nil {
+				return nil, err
+			}
+			left = in
+		case p.isKeyword("LIKE", "GLOB"):
+			like := &LikeExpr{Op: strings.ToUpper(p.next().Text), X: left, Not: not}
+			if like.Pattern, err = p.parseComparison(); err != nil {
+				return nil, err
+			}
+			if p.acceptKeyword("ESCAPE") {
+				if like.Escape, err = p.parseComparison(); err != nil {
+					return nil, err
+				}
+			}
+			left = like
+		case p.acceptKeyword("BETWEEN"):
+			between := &BetweenExpr{X: left, Not: not}
+			if between.Lo, err = p.parseComparison(); err != nil {
+				return nil, err
+			}
+			if err := p.expectKeyword("AND"); err != nil {
+				return nil, err
+			}
+			if between.Hi, err = p.parseComparison(); err != nil {
+				return nil, err
+			}
+			left = between
+		case p.acceptKeyword("ISNULL"):
+			left = &IsNullExpr{X: left}
+		case p.acceptKeyword("NOTNULL"):
+			left = &IsNullExpr{X: left, Not: true}
+		case not && p.acceptKeyword("NULL"):
+			left = &IsNullExpr{X: left, Not: true}
+		default:
+			return left, nil
+		}
+	}
+}
+
+func (p *Parser) parseComparison() (Expr, error) {
+	return p.parseBinary(p.parseBitwise, "<", "<=", ">", ">=")
+}
+
+func (p *Parser) parseBitwise() (Expr, error) {
+	return p.parseBinary(p.parseAdditive, "&", "|", "<<", ">>")
+}
+
+func (p *Parser) parseAdditive() (Expr, error) {
+	return p.parseBinary(p.parseMultiplicative, "+", "-")
+}
+
+func (p *Parser) parseMultiplicative() (Expr, error) {
+	return p.parseBinary(p.parseConcat, "*", "/", "%")
+}
+
+func (p *Parser) parseConcat() (Expr, error) {
+	return p.parseBinary(p.parseCollate, "||")
+}
+
+// parseBinary reads a left-associative chain of the given operators
+func (p *Parser) parseBinary(operand func() (Expr, error), ops ...string) (Expr, error) {
+	left, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp(ops...) {
+		op := p.next().Text
+		right, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryExpr{op, left, right}
+	}
+	return left, nil
+}
+
+func (p *Parser) parseCollate() (Expr, error) {
+	x, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("COLLATE") {
+		name, err := p.parseName()
+		if err != nil {
+			return nil, err
+		}
+		x = &CollateExpr{x, name}
+	}
+	return x, nil
+}
+
+func (p *Parser) parseUnary() (Expr, error) {
+	if p.isOp("-", "+", "~") {
+		op := p.next().Text
+
+		// Fold negative numbers so -9223372036854775808 stays an integer
+		if op == "-" && p.peek().Kind == TokenNumber {
+			value, err := parseNumber("-" + p.next().Text)
+			if err != nil {
+				return nil, err
+			}
+			return &Literal{value}, nil
+		}
+
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &UnaryExpr{op, x}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *Parser) parsePrimary() (Expr, error) {
+	tok := p.peek()
+	switch tok.Kind {
+	case TokenNumber:
+		p.next()
+		value, err := parseNumber(tok.Text)
+		if err != nil {
+			return nil, err
+		}
+		return &Literal{value}, nil
+	case TokenString:
+		p.next()
+		return &Literal{tok.Text}, nil
+	case TokenBlob:
+		p.next()
+		return &Literal{[]byte(tok.Text)}, nil
+	case TokenParam:
+		p.next()
+		return p.param(tok.Text)
+	case TokenOp:
+		if tok.Text == "(" && p.startsSelect(1) {
+			sel, err := p.parseSubquery()
+			if err != nil {
+				return nil, err
+			}
+			return &SubqueryExpr{Select: sel}, nil
+		}
+		if tok.Text == "(" {
+			return p.parseParenExpr()
+		}
+		return nil, p.syntaxError()
+	case TokenEOF:
+		return nil, p.syntaxError()
+	}
+
+	if !tok.Quoted {
+		switch strings.ToUpper(tok.Text) {
+		case "NULL":
+			p.next()
+			return &Literal{nil}, nil
+		case "TRUE":
+			p.next()
+			return &Literal{int64(1)}, nil
+		case "FALSE":
+			p.next()
+			return &Literal{int64(0)}, nil
+		case "CURRENT_TIME", "CURRENT_DATE", "CURRENT_TIMESTAMP":
+			p.next()
+			return &FuncCall{Name: strings.ToLower(tok.Text)}, nil
+		case "CAST":
+			return p.parseCast()
+		case "CASE":
+			return p.parseCase()
+		case "EXISTS":
+			p.next()
+			sel, err := p.parseSubquery()
+			if err != nil {
+				return nil, err
+			}
+			return &ExistsExpr{Select: sel}, nil
+		}
+		if reservedWords[strings.ToUpper(tok.Text)] {
+			return nil, p.syntaxError()
+		}
+	}
+
+	p.next()
+	if p.isOp("(") {
+		return p.parseFuncCall(tok.Text)
+	}
+	if p.acceptOp(".") {
+		column, err := p.parseName()
+		if err != nil {
+			return nil, err
+		}
+		return &ColumnRef{Table: tok.Text, Column: column}, nil
+	}
+	return &ColumnRef{Column: tok.Text}, nil
+}
+
+// parseSubquery parses a parenthesized SELECT
+func (p *Parser) parseSubquery() (*SelectStatement, error) {
+	if err := p.expectOp("("); err != nil {
+		return nil, err
+	}
+	sel, err := p.parseSelect()
+	if err != nil {
+		return nil, err
+	}
+	return sel, p.expectOp(")")
+}
+
+func (p *Parser) parseFuncCall(name string) (Expr, error) {
+	p.expectOp("(")
+	call := &FuncCall{Name: strings.ToLower(name)}
+
+	switch {
+	case p.acceptOp("*"):
+		call.Star = true
+	case p.isOp(")"):
+	default:
+		call.Distinct = p.acceptKeyword("DISTINCT")
+		args, err := p.parseExprList()
+		if err != nil {
+			return nil, err
+		}
+		call.Args = args
+	}
+	if err := p.expectOp(")"); err != nil {
+		return nil, err
+	}
+
+	if p.acceptKeyword("OVER") {
+		if !p.isOp("(") {
+			base, err := p.parseName()
+			if err != nil {
+				return nil, err
+			}
+			call.Over = &WindowSpec{Base: base}
+			return call, nil
+		}
+		var err error
+		if call.Over, err = p.parseWindowSpec(); err != nil {
+			return nil, err
+		}
+	}
+	return call, nil
+}
+
+// parseWindowSpec parses a parenthesized window definition
+func (p *Parser) parseWindowSpec() (*WindowSpec, error) {
+	if err := p.expectOp("("); err != nil {
+		return nil, err
+	}
+
+	spec := &WindowSpec{}
+	if p.peek().Kind == TokenIdent && !p.isKeyword("PARTITION", "ORDER", "ROWS", "RANGE", "GROUPS") {
+		spec.Base = p.next().Text
+	}
+	var err error
+	if p.acceptKeyword("PARTITION") {
+		if err := p.expectKeyword("BY"); err != nil {
+			return nil, err
+		}
+		if spec.PartitionBy, err = p.parseExprList(); err != nil {
+			return nil, err
+		}
+	}
+	if p.acceptKeyword("ORDER") {
+		if spec.OrderBy, err = p.parseOrderBy(); err != nil {
+			return nil, err
+		}
+	}
+	if p.isKeyword("ROWS", "RANGE", "GROUPS") {
+		if spec.Frame, err = p.parseWindowFrame(); err != nil {
+			return nil, err
+		}
+	}
+	return spec, p.expectOp(")")
+}
+
+// parseWindowFrame parses ROWS, RANGE or GROUPS and the bounds of the frame.
+// A single bound starts a frame ending at the current row.
+func (p *Parser) parseWindowFrame() (*WindowFrame, error) {
+	frame := &WindowFrame{Unit: strings.ToUpper(p.next().Text), End: FrameBound{Kind: "CURRENT ROW"}}
+	between := p.acceptKeyword("BETWEEN")
+
+	var err error
+	if frame.Start, err = p.parseFrameBound(false); err != nil {
+		return nil, err
+	}
+	if between {
+		if err := p.expectKeyword("AND"); err != nil {
+			return nil, err
+		}
+		if frame.End, err = p.parseFrameBound(true); err != nil {
+			return nil, err
+		}
+	}
+	if p.isKeyword("EXCLUDE") {
+		return nil, errors.New("EXCLUDE is not supported in window frames")
+	}
+	return frame, nil
+}
+
+// parseFrameBound parses the start or end of a frame. Only the start may be
+// UNBOUNDED PRECEDING and only the end UNBOUNDED FOLLOWING.
+func (p *Parser) parseFrameBound(end bool) (FrameBound, error) {
+	switch {
+	case p.acceptKeyword("UNBOUNDED"):
+		if !end {
+			return FrameBound{Kind: "UNBOUNDED PRECEDING"}, p.expectKeyword("PRECEDING")
+		}
+		return FrameBound{Kind: "UNBOUNDED FOLLOWING"}, p.expectKeyword("FOLLOWING")
+	case p.acceptKeyword("CURRENT"):
+		return FrameBound{Kind: "CURRENT ROW"}, p.expectKeyword("ROW")
+	}
+
+	offset, err := p.parseExpr()
+	if err != nil {
+		return FrameBound{}, err
+	}
+	if p.acceptKeyword("PRECEDING") {
+		return FrameBound{Kind: "PRECEDING", Offset: offset}, nil
+	}
+	if err := p.expectKeyword("FOLLOWING"); err != nil {
+		return FrameBound{}, err
+	}
+	return FrameBound{Kind: "FOLLOWING", Offset: offset}, nil
+}
+
+func (p *Parser) parseCast() (Expr, error) {
+	p.next()
+	if err := p.expectOp("("); err != nil {
+		return nil, err
+	}
+	x, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectKeyword("AS"); err != nil {
+		return nil, err
+	}
+
+	start := p.peek().Pos
+	for !p.isOp(")") {
+		if p.peek().Kind == TokenEOF {
+			return nil, p.syntaxError()
+		}
+		if p.acceptOp("(") {
+			for !p.acceptOp(")") {
+				if p.peek().Kind == TokenEOF {
+					return nil, p.syntaxError()
+				}
+				p.next()
+			}
+			continue
+		}
+		p.next()
+	}
+	typeName := p.input[start:p.prevEnd()]
+	p.next()
+
+	return &CastExpr{x, typeName}, nil
+}
+
+func (p *Parser) parseCase() (Expr, error) {
+	p.next()
+	expr := &CaseExpr{}
+
+	var err error
+	if !p.isKeyword("WHEN") {
+		if expr.Operand, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+
+	for p.acceptKeyword("WHEN") {
+		when := &WhenClause{}
+		if when.Cond, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+		if err := p.expectKeyword("THEN"); err != nil {
+			return nil, err
+		}
+		if when.Result, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+		expr.Whens = append(expr.Whens, when)
+	}
+	if len(expr.Whens) == 0 {
+		return nil, p.syntaxError()
+	}
+
+	if p.acceptKeyword("ELSE") {
+		if expr.Else, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+	return expr, p.expectKeyword("END")
+}
+
+// param numbers a parameter. A bare ? takes the number after the largest so
+// far, ?NNN takes NNN, and a named parameter shares the number of an earlier
+// one with the same name.
+func (p *Parser) param(text string) (Expr, error) {
+	if text == "?" {
+		p.params = append(p.params, "")
+		return &Param{Index: len(p.params)}, nil
+	}
+
+	if text[0] == '?' {
+		n, err := strconv.Atoi(text[1:])
+		if err != nil || n < 1 || n > MaxParams {
+			return nil, fmt.Errorf("variable number must be between ?1 and ?%d", MaxParams)
+		}
+		for len(p.params) < n {
+			p.params = append(p.params, "")
+		}
+		if p.params[n-1] == "" {
+			p.params[n-1] = text
+		}
+		return &Param{Name: text, Index: n}, nil
+	}
+
+	for i, name := range p.params {
+		if name == text {
+			return &Param{Name: text, Index: i + 1}, nil
+		}
+	}
+	p.params = append(p.params, text)
+	return &Param{Name: text, Index: len(p.params)}, nil
+}
+
+// ----------------------------------------------------------------------------
+
+// Token helpers --------------------------------------------------------------
+func (p *Parser) peek() Token {
+	return p.tokens[p.pos]
+}
+
+func (p *Parser) peekAt(n int) Token {
+	if p.pos+n >= len(p.tokens) {
+		return p.tokens[len(p.tokens)-1]
+	}
+	return p.tokens[p.pos+n]
+}
+
+func (p *Parser) next() Token {
+	tok := p.tokens[p.pos]
+	if tok.Kind != TokenEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// prevEnd returns the end offset of the last consumed token
+func (p *Parser) prevEnd() int {
+	if p.pos == 0 {
+		return 0
+	}
+	return p.tokens[p.pos-1].End
+}
+
+func (p *Parser) isKeyword(keywords ...string) bool {
+	tok := p.peek()
+	if tok.Kind != TokenIdent || tok.Quoted {
+		return false
+	}
+	for _, kw := range keywords {
+		if strings.EqualFold(tok.Text, kw) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Parser) acceptKeyword(keyword string) bool {
+	if p.isKeyword(keyword) {
+		p.next()
+		return true
+	}
+	return false
+}
+
+func (p *Parser) expectKeyword(keyword string) error {
+	if !p.acceptKeyword(keyword) {
+		return p.syntaxError()
+	}
+	return nil
+}
+
+func (p *Parser) isOp(ops ...string) bool {
+	tok := p.peek()
+	if tok.Kind != TokenOp {
+		return false
+	}
+	for _, op := range ops {
+		if tok.Text == op {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Parser) acceptOp(op string) bool {
+	if p.isOp(op) {
+		p.next()
+		return true
+	}
+	return false
+}
+
+func (p *Parser) expectOp(op string) error {
+	if !p.acceptOp(op) {
+		return p.syntaxError()
+	}
+	return nil
+}
+
+// isAlias reports whether the next token can be read as an implicit alias
+// startsSelect reports whether the token n ahead begins a SELECT, which may
+// open with WITH
+func (p *Parser) startsSelect(n int) bool {
+	tok := p.peekAt(n)
+	return tok.Kind == TokenIdent && !tok.Quoted &&
+		(strings.EqualFold(tok.Text, "SELECT") || strings.EqualFold(tok.Text, "WITH"))
+}
+
+func (p *Parser) isAlias() bool {
+	tok := p.peek()
+	if tok.Kind == TokenString {
+		return true
+	}
+	return tok.Kind == TokenIdent && (tok.Quoted || !reservedWords[strings.ToUpper(tok.Text)])
+}
+
+// parseName reads an identifier, also accepting a string as SQLite does
+func (p *Parser) parseName() (string, error) {
+	tok := p.peek()
+	if tok.Kind != TokenIdent && tok.Kind != TokenString {
+		return "", p.syntaxError()
+	}
+	p.next()
+	return tok.Text, nil
+}
+
+// parseQualifiedName reads [schema.]name and drops the schema
+func (p *Parser) parseQualifiedName() (string, error) {
+	name, err := p.parseName()
+	if err != nil {
+		return "", err
+	}
+	if p.acceptOp(".") {
+		return p.parseName()
+	}
+	return name, nil
+}
+
+// parseNameList reads names up to and including the closing parenthesis
+func (p *Parser) parseNameList() ([]string, error) {
+	names := make([]string, 0)
+	for {
+		name, err := p.parseName()
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+		if !p.acceptOp(",") {
+			break
+		}
+	}
+	return names, p.expectOp(")")
+}
+
+func (p *Parser) syntaxError() error {
+	tok := p.peek()
+	if tok.Kind == TokenEOF {
+		return errors.New("incomplete input")
+	}
+	return fmt.Errorf("near \"%s\": syntax error", p.input[tok.Pos:tok.End])
+}
+
+// parseNumber converts a numeric literal to int64, or to float64 when it has
+// a fraction or exponent or does not fit in 64 bits
+func parseNumber(text string) (any, error) {
+	digits := strings.TrimPrefix(text, "-")
+	if strings.HasPrefix(digits, "0x") || strings.HasPrefix(digits, "0X") {
+		u, err := strconv.ParseUint(digits[2:], 16, 64)
+		if err != nil {
+			return nil, fmt.Errorf("hex literal too big: %s", text)
+		}
+		if digits != text {
+			return -int64(u), nil
+		}
+		return int64(u), nil
+	}
+
+	if !strings.ContainsAny(text, ".eE") {
+		if i, err := strconv.ParseInt(text, 10, 64); err == nil {
+			return i, nil
+		}
+	}
+	f, err := strconv.ParseFloat(text, 64)
+	if err != nil && !errors.Is(err, strconv.ErrRange) {
+		return nil, fmt.Errorf("malformed number: %s", text)
+	}
+	if math.IsInf(f, 0) {
+		return f, nil
+	}
+	return f, nil
+}
+
+// ----------------------------------------------------------------------------
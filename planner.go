@@ -0,0 +1,866 @@
+package sqlite
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/elordeiro/SQLite-DBReader/parser"
+	"github.com/elordeiro/SQLite-DBReader/record"
+)
+
+// Constants ------------------------------------------------------------------
+const (
+	DefaultTableRows = 1 << 20 // Rows assumed for a table ANALYZE has not seen
+	MaxJoinTables    = 64
+
+	exhaustiveJoinLimit = 8 // Every join order is costed up to this many tables
+
+	// Cost of reading a table row relative to an index entry, as sqlite3
+	// weighs them
+	tableRowCost = 3
+)
+
+// Rows assumed to share a key prefix of 1, 2, ... columns without statistics
+var defaultPrefixRows = []float64{10, 9, 8, 7, 6}
+
+// ----------------------------------------------------------------------------
+
+// Custom Types ---------------------------------------------------------------
+
+// joinPlan reads the sources of a query in nested loops, the outermost first
+type joinPlan struct {
+	loops []*scanPlan
+	where []parser.Expr // Terms reading no source, checked once before the loops
+	cost  float64
+	rows  float64
+}
+
+// scanPlan is the access path of one loop. Without an index it reads the
+// table, seeking a rowid when eq is set or a rowid range when a bound is.
+// With one it reads the index entries equal to eq on the leading columns and
+// within the bounds on the next.
+type scanPlan struct {
+	src      int
+	table    *Table
+	index    *Table
+	eq       []*constraint
+	lower    *constraint
+	upper    *constraint
+	query    *selectPlan   // Subquery in FROM, read from memory instead of a b-tree
+	covering bool          // The index holds every column the query reads
+	left     bool          // A LEFT JOIN, giving a NULL row when nothing matches
+	on       []parser.Expr // Join condition of a LEFT JOIN
+	filter   []parser.Expr // Terms checked once this loop has a row
+	rows     float64       // Rows read per outer row
+	cost     float64       // Cost of one run of the loop
+	outRows  float64       // Rows left after the filters
+}
+
+// constraint is a term comparing a column of a source with a value read from
+// other sources, normalized so the column is on the left
+type constraint struct {
+	term   parser.Expr // Term the constraint comes from
+	op     string      // =, IS, <, <=, > or >=
+	col    int         // Table column or RowIDColumn
+	column parser.Expr
+	value  parser.Expr
+	coll   string // Collation of the comparison, lower case
+	deps   uint64 // Sources the value reads
+}
+
+// planTerm is a conjunct of WHERE or of a join condition
+type planTerm struct {
+	expr   parser.Expr
+	deps   uint64
+	stable bool // Deterministic and free of aggregates
+	on     int  // Source whose LEFT JOIN condition it is, or -1
+}
+
+// planner chooses the join order and access paths for a set of sources
+type planner struct {
+	db      *DB
+	sources []*rowSource
+	terms   []*planTerm
+	used    []map[int]bool // Columns read from each source, nil for whole rows
+	best    map[[2]uint64]*scanPlan
+}
+
+// planStats holds the statistics ANALYZE gathered
+type planStats struct {
+	tables  map[string]float64     // Rows in each table, by lower case name
+	indexes map[string]*indexStats // By lower case index name
+}
+
+type indexStats struct {
+	rows    float64
+	prefix  []float64 // Average rows sharing a key prefix of 1, 2, ... columns
+	samples []*statSample
+}
+
+// statSample is a key sampled from an index by ANALYZE, with the rows equal
+// to and before each of its prefixes
+type statSample struct {
+	key []any
+	eq  []float64
+	lt  []float64
+}
+
+// ----------------------------------------------------------------------------
+
+// Join Planning --------------------------------------------------------------
+
+// planJoin picks the order the sources are read in and how each is read.
+// Tables before the first LEFT or CROSS join may be reordered, and every
+// order of up to exhaustiveJoinLimit of them is costed; beyond that the
+// cheapest next table is added greedily. used lists the columns the query
+// reads from each source, or is nil when whole rows are needed.
+func (db *DB) planJoin(sources []*rowSource, where parser.Expr, used []map[int]bool) (*joinPlan, error) {
+	if len(sources) > MaxJoinTables {
+		return nil, errors.New("at most 64 tables in a join")
+	}
+	p := &planner{db: db, sources: sources, used: used, best: make(map[[2]uint64]*scanPlan)}
+	for _, e := range splitConjuncts(where) {
+		p.addTerm(e, -1)
+	}
+	for i, src := range sources {
+		on := -1
+		if src.join == "LEFT" {
+			on = i
+		}
+		for _, e := range splitConjuncts(src.on) {
+			p.addTerm(e, on)
+		}
+	}
+
+	fixed := len(sources)
+	for i, src := range sources {
+		if i > 0 && (src.join == "LEFT" || src.join == "CROSS") {
+			fixed = i
+			break
+		}
+	}
+
+	var order []int
+	if fixed <= exhaustiveJoinLimit {
+		order = p.searchOrder(fixed)
+	} else {
+		order = p.greedyOrder(fixed)
+	}
+	for i := fixed; i < len(sources); i++ {
+		order = append(order, i)
+	}
+	return p.build(order), nil
+}
+
+func (p *planner) addTerm(e parser.Expr, on int) {
+	deps, stable := exprDeps(e)
+	p.terms = append(p.terms, &planTerm{expr: e, deps: deps, stable: stable, on: on})
+}
+
+// searchOrder costs every order of the first n sources, dropping partial
+// orders already costlier than the best found
+func (p *planner) searchOrder(n int) []int {
+	best, bestCost := []int(nil), math.Inf(1)
+	order := make([]int, 0, n)
+	var search func(avail uint64, cost, rows float64)
+	search = func(avail uint64, cost, rows float64) {
+		if cost >= bestCost {
+			return
+		}
+		if len(order) == n {
+			best, bestCost = append([]int(nil), order...), cost
+			return
+		}
+		for src := range n {
+			if avail&(1<<src) != 0 {
+				continue
+			}
+			scan := p.bestScan(src, avail)
+			order = append(order, src)
+			search(avail|1<<src, cost+rows*scan.cost, rows*scan.outRows)
+			order = order[:len(order)-1]
+		}
+	}
+	search(0, 0, 1)
+	return best
+}
+
+// greedyOrder adds whichever of the first n sources is cheapest to read next
+func (p *planner) greedyOrder(n int) []int {
+	order := make([]int, 0, n)
+	avail, rows := uint64(0), 1.0
+	for len(order) < n {
+		next, nextCost := -1, math.Inf(1)
+		for src := range n {
+			if avail&(1<<src) != 0 {
+				continue
+			}
+			if cost := rows * p.bestScan(src, avail).cost; cost < nextCost {
+				next, nextCost = src, cost
+			}
+		}
+		rows *= p.bestScan(next, avail).outRows
+		avail |= 1 << next
+		order = append(order, next)
+	}
+	return order
+}
+
+// build lays out the loops in order and checks each term at the first loop
+// where every source it reads has a row
+func (p *planner) build(order []int) *joinPlan {
+	plan := &joinPlan{rows: 1}
+	avail := uint64(0)
+	for _, src := range order {
+		scan := *p.bestScan(src, avail)
+		plan.cost += plan.rows * scan.cost
+		plan.rows *= scan.outRows
+		avail |= 1 << src
+		plan.loops = append(plan.loops, &scan)
+	}
+
+	for _, term := range p.terms {
+		switch {
+		case term.on >= 0:
+			for _, l := range plan.loops {
+				if l.src == term.on {
+					l.on = append(l.on, term.expr)
+				}
+			}
+		case term.deps == 0 && term.stable || len(plan.loops) == 0:
+			plan.where = append(plan.where, term.expr)
+		default:
+			avail := uint64(0)
+			for i, l := range plan.loops {
+				avail |= 1 << l.src
+				if term.deps&^avail == 0 || i == len(plan.loops)-1 {
+					l.filter = append(l.filter, term.expr)
+					break
+				}
+			}
+		}
+	}
+	return plan
+}
+
+// bestScan picks the cheapest way to read a source once the sources in
+// avail have rows
+func (p *planner) bestScan(src int, avail uint64) *scanPlan {
+	if scan, ok := p.best[[2]uint64{uint64(src), avail}]; ok {
+		return scan
+	}
+
+	source := p.sources[src]
+	table := source.table
+	nRow := p.db.tableRows(table)
+	if source.query != nil {
+		nRow = max(source.query.estimatedRows(), 1)
+	}
+	left := source.join == "LEFT"
+
+	// Constraints the values of which are known before the loop starts
+	cons := make([]*constraint, 0)
+	for _, term := range p.terms {
+		if left && term.on != src || !left && term.on >= 0 {
+			continue
+		}
+		for _, c := range termConstraints(term.expr, src) {
+			if c.deps&^avail == 0 {
+				cons = append(cons, c)
+			}
+		}
+	}
+
+	// The rows of a subquery can only be read in full
+	indexes := p.db.GetIndexes(table)
+	if source.query != nil {
+		cons, indexes = nil, nil
+	}
+
+	seek := math.Log2(nRow + 1)
+	best := &scanPlan{src: src, table: table, query: source.query, left: left, rows: nRow, cost: nRow * tableRowCost}
+	consider := func(scan *scanPlan) {
+		if scan.cost < best.cost || scan.cost == best.cost && len(scan.eq) > len(best.eq) {
+			best = scan
+		}
+	}
+
+	// Rowid lookup or range
+	if c := findConstraint(cons, RowIDColumn, "", "=", "IS"); c != nil {
+		consider(&scanPlan{src: src, table: table, left: left, eq: []*constraint{c}, rows: 1, cost: seek})
+	} else {
+		scan := &scanPlan{src: src, table: table, left: left, rows: nRow}
+		scan.lower = findConstraint(cons, RowIDColumn, "", ">", ">=")
+		scan.upper = findConstraint(cons, RowIDColumn, "", "<", "<=")
+		if scan.lower != nil || scan.upper != nil {
+			scan.rows = nRow * rangeFraction(scan.lower, scan.upper)
+			scan.cost = seek + scan.rows*tableRowCost
+			consider(scan)
+		}
+	}
+
+	for _, index := range indexes {
+		if scan := p.indexScan(src, index, cons, nRow); scan != nil {
+			scan.left = left
+			consider(scan)
+		}
+	}
+
+	// Terms the access path does not already apply narrow the rows further
+	best.outRows = best.rows
+	mask := avail | 1<<src
+	for _, term := range p.terms {
+		if term.on >= 0 && term.on != src || term.deps&(1<<src) == 0 || term.deps&^mask != 0 {
+			continue
+		}
+		if best.applies(term.expr) {
+			continue
+		}
+		if bin, ok := term.expr.(*parser.BinaryExpr); ok && (bin.Op == "=" || bin.Op == "IS") {
+			best.outRows *= 0.25
+		} else {
+			best.outRows *= 0.9
+		}
+	}
+	if left {
+		best.outRows = max(best.outRows, 1)
+	}
+	p.best[[2]uint64{uint64(src), avail}] = best
+	return best
+}
+
+// indexScan costs reading a source through an index, or returns nil when no
+// constraint can seek in it
+func (p *planner) indexScan(src int, index *Table, cons []*constraint, nRow float64) *scanPlan {
+	if index.Where != nil || len(index.IndexColumns) == 0 {
+		return nil
+	}
+	stats := p.db.indexStats(index)
+	scan := &scanPlan{src: src, table: p.sources[src].table, index: index}
+
+	for _, col := range index.IndexColumns {
+		if col.Col == ExprColumn {
+			break
+		}
+		c := findConstraint(cons, col.Col, indexCollation(col), "=", "IS")
+		if c == nil {
+			break
+		}
+		scan.eq = append(scan.eq, c)
+	}
+	k := len(scan.eq)
+	if k < len(index.IndexColumns) && index.IndexColumns[k].Col != ExprColumn {
+		col := index.IndexColumns[k]
+		scan.lower = findConstraint(cons, col.Col, indexCollation(col), ">", ">=")
+		scan.upper = findConstraint(cons, col.Col, indexCollation(col), "<", "<=")
+	}
+	scan.covering = p.covers(src, index)
+	if k == 0 && scan.lower == nil && scan.upper == nil {
+		// Reading every entry of a covering index beats reading the table,
+		// when its entries are narrower than the table's rows
+		if !scan.covering || indexWidth(index, scan.table) >= tableWidth(scan.table) {
+			return nil
+		}
+		scan.rows = nRow
+		scan.cost = nRow * indexRowCost(index, scan.table)
+		return scan
+	}
+
+	// Rows sharing the key prefix, from the statistics when there are some
+	switch {
+	case k == 0:
+		scan.rows = nRow
+	case index.Unique && k == len(index.IndexColumns):
+		scan.rows = 1
+	case stats != nil && k <= len(stats.prefix):
+		scan.rows = stats.prefix[k-1]
+	default:
+		scan.rows = nRow / 10
+		if k <= len(defaultPrefixRows) {
+			scan.rows = min(scan.rows, defaultPrefixRows[k-1])
+		}
+	}
+	if rows, ok := p.db.sampleRows(index, stats, scan); ok {
+		scan.rows = rows
+	} else {
+		scan.rows *= rangeFraction(scan.lower, scan.upper)
+	}
+	scan.rows = max(scan.rows, 1)
+
+	// Each row is looked up in the table unless the index covers the query
+	scan.cost = math.Log2(nRow+1) + scan.rows*indexRowCost(index, scan.table)
+	if !scan.covering {
+		scan.cost += scan.rows * tableRowCost
+	}
+	return scan
+}
+
+// indexRowCost is the cost of reading an index entry, growing with its
+// estimated width so that the narrowest index is scanned when several cover
+// a query
+func indexRowCost(index, table *Table) float64 {
+	return 1 + float64(indexWidth(index, table))/100
+}
+
+// tableWidth and indexWidth estimate the size of a table row and an index
+// entry the way sqlite3 does, on its logarithmic scale
+func tableWidth(table *Table) int {
+	w := 0
+	for _, col := range table.Columns {
+		w += columnWidth(col.Type)
+	}
+	if table.RowIDAlias < 0 {
+		w++
+	}
+	return logEst(uint64(w * 4))
+}
+
+func indexWidth(index, table *Table) int {
+	w := 1 // The rowid every entry ends with
+	for _, col := range index.IndexColumns {
+		if col.Col >= 0 && col.Col != table.RowIDAlias {
+			w += columnWidth(table.Columns[col.Col].Type)
+		} else {
+			w++
+		}
+	}
+	return logEst(uint64(w * 4))
+}
+
+// columnWidth estimates the size of a column from its declared type, in
+// units of 4 bytes. Text and blobs are taken to be 20 bytes, unless a size
+// follows CHAR or BLOB, as in VARCHAR(100).
+func columnWidth(typeName string) int {
+	aff := parser.TypeAffinity(typeName)
+	if typeName == "" || aff != parser.AffinityText && aff != parser.AffinityBlob {
+		return 1
+	}
+	upper := strings.ToUpper(typeName)
+	v := 16
+	if i := strings.Index(upper, "CHAR"); i >= 0 {
+		v = sizeAfter(upper[i:])
+	} else if i := strings.Index(upper, "BLOB("); i >= 0 {
+		v = sizeAfter(upper[i:])
+	}
+	return min(v/4+1, 255)
+}
+
+// sizeAfter returns the first number in s, or 0 when there is none
+func sizeAfter(s string) int {
+	i := strings.IndexAny(s, "0123456789")
+	if i < 0 {
+		return 0
+	}
+	j := i
+	for j < len(s) && j < i+9 && s[j] >= '0' && s[j] <= '9' {
+		j++
+	}
+	n, _ := strconv.Atoi(s[i:j])
+	return n
+}
+
+// logEst returns about 10*log2(x), as sqlite3 rounds it
+func logEst(x uint64) int {
+	a := []int{0, 2, 3, 5, 6, 7, 8, 9}
+	y := 40
+	if x < 8 {
+		if x < 2 {
+			return 0
+		}
+		for x < 8 {
+			y -= 10
+			x <<= 1
+		}
+	} else {
+		for x > 255 {
+			y += 40
+			x >>= 4
+		}
+		for x > 15 {
+			y += 10
+			x >>= 1
+		}
+	}
+	return a[x&7] + y - 10
+}
+
+// covers reports whether an index holds every column the query reads from
+// a source
+func (p *planner) covers(src int, index *Table) bool {
+	if p.used == nil || p.used[src] == nil {
+		return false
+	}
+	for col := range p.used[src] {
+		if col == RowIDColumn {
+			continue
+		}
+		found := false
+		for _, ic := range index.IndexColumns {
+			found = found || ic.Col == col
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// applies reports whether a term is one of the constraints the access path
+// seeks on
+func (scan *scanPlan) applies(term parser.Expr) bool {
+	for _, c := range append(scan.eq, scan.lower, scan.upper) {
+		if c != nil && c.term == term {
+			return true
+		}
+	}
+	return false
+}
+
+// rangeFraction is the share of rows assumed to fall within range bounds:
+// a quarter for one bound and, as sqlite3 assumes, a 64th for two
+func rangeFraction(lower, upper *constraint) float64 {
+	f := 1.0
+	if lower != nil {
+		f /= 4
+	}
+	if upper != nil {
+		f /= 4
+	}
+	if lower != nil && upper != nil {
+		f /= 4
+	}
+	return f
+}
+
+// ----------------------------------------------------------------------------
+
+// Constraints ----------------------------------------------------------------
+
+// termConstraints lists the comparisons a term makes between a column of src
+// and a value that does not read src
+func termConstraints(term parser.Expr, src int) []*constraint {
+	cons := make([]*constraint, 0)
+	add := func(op string, column, value parser.Expr, coll string) {
+		ref, ok := unwrapCollate(column).(*parser.ColumnRef)
+		if !ok || !ref.Bound || ref.Depth > 0 || ref.Src != src {
+			return
+		}
+		deps, stable := exprDeps(value)
+		if !stable || deps&(1<<src) != 0 || !seekAffinityOK(ref.Affinity, exprAffinity(value)) {
+			return
+		}
+		cons = append(cons, &constraint{
+			term: term, op: op, col: ref.Col, column: column, value: value, coll: coll, deps: deps,
+		})
+	}
+
+	switch x := term.(type) {
+	case *parser.BinaryExpr:
+		flipped := map[string]string{"=": "=", "IS": "IS", "<": ">", "<=": ">=", ">": "<", ">=": "<="}
+		op, ok := flipped[x.Op]
+		if !ok {
+			return nil
+		}
+		coll := comparisonCollation(x.L, x.R)
+		add(x.Op, x.L, x.R, coll)
+		add(op, x.R, x.L, coll)
+	case *parser.BetweenExpr:
+		if !x.Not {
+			add(">=", x.X, x.Lo, comparisonCollation(x.X, x.Lo))
+			add("<=", x.X, x.Hi, comparisonCollation(x.X, x.Hi))
+		}
+	}
+	return cons
+}
+
+// seekAffinityOK reports whether a column's index can be searched for the
+// values it is compared with. Comparing a column with a numeric value
+// converts the column's values to numbers, so text and blobs that read as
+// numbers match too, and their index holds them as text and blobs.
+func seekAffinityOK(col, value parser.Affinity) bool {
+	return col >= parser.AffinityNumeric || value < parser.AffinityNumeric
+}
+
+// findConstraint returns the first constraint on a column with one of the
+// operators, comparing with the collation unless coll is ""
+func findConstraint(cons []*constraint, col int, coll string, ops ...string) *constraint {
+	for _, c := range cons {
+		if c.col != col || coll != "" && c.coll != coll {
+			continue
+		}
+		for _, op := range ops {
+			if c.op == op {
+				return c
+			}
+		}
+	}
+	return nil
+}
+
+// comparisonCollation is the collation a comparison uses: an explicit one on
+// either side, else the left column's, else the right's
+func comparisonCollation(l, r parser.Expr) string {
+	lname, lexplicit := exprCollation(l)
+	rname, rexplicit := exprCollation(r)
+	name := lname
+	switch {
+	case lexplicit:
+	case rexplicit:
+		name = rname
+	case lname == "":
+		name = rname
+	}
+	return normalizeCollation(name)
+}
+
+func indexCollation(col *IndexColumn) string {
+	return normalizeCollation(col.Collate)
+}
+
+func normalizeCollation(name string) string {
+	if name == "" {
+		return "binary"
+	}
+	return strings.ToLower(name)
+}
+
+// exprDeps returns the sources an expression reads, and whether it gives
+// the same value each time they hold the same rows
+func exprDeps(e parser.Expr) (uint64, bool) {
+	deps, stable := uint64(0), true
+	walkExpr(e, func(e parser.Expr) error {
+		switch x := e.(type) {
+		case *parser.ColumnRef:
+			if x.Bound && x.Depth == 0 {
+				deps |= 1 << x.Src
+			}
+		case *parser.FuncCall:
+			if isAggregate(x) || x.Name == "random" || x.Name == "randomblob" {
+				stable = false
+			}
+		}
+		return nil
+	})
+	return deps, stable
+}
+
+// usedColumns records the columns each expression reads in used
+func usedColumns(used []map[int]bool, exprs ...parser.Expr) {
+	for _, e := range exprs {
+		walkExpr(e, func(e parser.Expr) error {
+			if ref, ok := e.(*parser.ColumnRef); ok && ref.Bound && ref.Depth == 0 {
+				used[ref.Src][ref.Col] = true
+			}
+			return nil
+		})
+	}
+}
+
+func splitConjuncts(e parser.Expr) []parser.Expr {
+	if bin, ok := e.(*parser.BinaryExpr); ok && bin.Op == "AND" {
+		return append(splitConjuncts(bin.L), splitConjuncts(bin.R)...)
+	}
+	if e == nil {
+		return nil
+	}
+	return []parser.Expr{e}
+}
+
+func unwrapCollate(e parser.Expr) parser.Expr {
+	for {
+		collate, ok := e.(*parser.CollateExpr)
+		if !ok {
+			return e
+		}
+		e = collate.X
+	}
+}
+
+// ----------------------------------------------------------------------------
+
+// Statistics -----------------------------------------------------------------
+
+// stats returns the statistics in sqlite_stat1, or the stats file, and in
+// sqlite_stat4, read once per schema version
+func (db *DB) stats() *planStats {
+	if db.planStats != nil && db.statsVersion == db.schemaVersion {
+		return db.planStats
+	}
+	stats := &planStats{tables: make(map[string]float64), indexes: make(map[string]*indexStats)}
+	db.planStats, db.statsVersion = stats, db.schemaVersion
+
+	// Statistics that can not be read are ignored, as sqlite3 does. A
+	// partial index counts only some of the table's rows.
+	for _, r := range db.statRows() {
+		nums := statNumbers(r.stat)
+		if len(nums) == 0 {
+			continue
+		}
+		tbl := strings.ToLower(r.tbl)
+		if r.idx == "" {
+			stats.tables[tbl] = nums[0]
+			continue
+		}
+		is := stats.index(r.idx)
+		is.rows, is.prefix = nums[0], nums[1:]
+		if index := db.GetTable(r.idx); index != nil && index.Where == nil {
+			if _, ok := stats.tables[tbl]; !ok {
+				stats.tables[tbl] = nums[0]
+			}
+		}
+	}
+
+	db.readStatTable("sqlite_stat4", func(row *Row) {
+		idx, _ := row.Values[1].(string)
+		blob, _ := row.Values[5].([]byte)
+		rec, err := record.ReadRecord(blob, db.bt.Encoding)
+		if idx == "" || err != nil {
+			return
+		}
+		sample := &statSample{
+			key: make([]any, len(rec.ColumnTypes)),
+			eq:  statNumbers(FormatValue(row.Values[2])),
+			lt:  statNumbers(FormatValue(row.Values[3])),
+		}
+		for i := range sample.key {
+			sample.key[i] = rec.Value(i)
+		}
+		if len(sample.eq) > 0 && len(sample.lt) > 0 {
+			is := stats.index(idx)
+			is.samples = append(is.samples, sample)
+		}
+	})
+	return stats
+}
+
+func (s *planStats) index(name string) *indexStats {
+	is, ok := s.indexes[strings.ToLower(name)]
+	if !ok {
+		is = &indexStats{}
+		s.indexes[strings.ToLower(name)] = is
+	}
+	return is
+}
+
+// readStatTable calls visit with each row of a statistics table, if it
+// exists with the expected columns
+func (db *DB) readStatTable(name string, visit func(*Row)) {
+	table := db.GetTable(name)
+	if table == nil || table.Type != TableTypeTable || len(table.Columns) < 3 ||
+		name == "sqlite_stat4" && len(table.Columns) < 6 {
+		return
+	}
+	c := db.bt.NewCursor(table.PageNum)
+	ok, err := c.First()
+	for ; ok && err == nil; ok, err = c.Next() {
+		row, err := db.tableRow(table, c.Cell())
+		if err != nil {
+			return
+		}
+		visit(row)
+	}
+}
+
+func statNumbers(stat string) []float64 {
+	fields := strings.Fields(stat)
+	nums := make([]float64, 0, len(fields))
+	for _, f := range fields {
+		n, err := strconv.ParseFloat(f, 64)
+		if err != nil {
+			break
+		}
+		nums = append(nums, n)
+	}
+	return nums
+}
+
+// tableRows is the number of rows in a table, DefaultTableRows when ANALYZE
+// has not counted them
+func (db *DB) tableRows(table *Table) float64 {
+	if n, ok := db.stats().tables[strings.ToLower(table.Name)]; ok {
+		return max(n, 1)
+	}
+	return DefaultTableRows
+}
+
+func (db *DB) indexStats(index *Table) *indexStats {
+	return db.stats().indexes[strings.ToLower(index.Name)]
+}
+
+// sampleRows estimates the rows an index scan reads from the samples, when
+// it compares the leading column with literals only
+func (db *DB) sampleRows(index *Table, stats *indexStats, scan *scanPlan) (float64, bool) {
+	if stats == nil || len(stats.samples) == 0 {
+		return 0, false
+	}
+	literal := func(c *constraint) (any, bool) {
+		if c == nil {
+			return nil, false
+		}
+		lit, ok := c.value.(*parser.Literal)
+		if !ok || lit.Value == nil {
+			return nil, false
+		}
+		v, _ := applyComparisonAffinity(lit.Value, nil, parser.AffinityNone, exprAffinity(c.column))
+		return v, true
+	}
+	colls, _, err := db.IndexKeyOrder(index)
+	if err != nil {
+		return 0, false
+	}
+	coll := colls[0]
+
+	// rank counts the entries whose leading column sorts before v, and those
+	// equal to it when inclusive is set
+	rank := func(v any, inclusive bool) float64 {
+		n := 0.0
+		for _, s := range stats.samples {
+			c := record.CompareValues(s.key[0], v, coll)
+			switch {
+			case c < 0:
+				n = max(n, s.lt[0]+s.eq[0])
+			case c == 0 && inclusive:
+				n = max(n, s.lt[0]+s.eq[0])
+			case c == 0:
+				n = max(n, s.lt[0])
+			}
+		}
+		return n
+	}
+
+	switch {
+	case len(scan.eq) == 1 && scan.lower == nil && scan.upper == nil:
+		v, ok := literal(scan.eq[0])
+		if !ok {
+			return 0, false
+		}
+		for _, s := range stats.samples {
+			if record.CompareValues(s.key[0], v, coll) == 0 {
+				return s.eq[0], true
+			}
+		}
+		return 0, false
+	case len(scan.eq) == 0 && !index.IndexColumns[0].Desc:
+		lo, hi := 0.0, stats.rows
+		if scan.lower != nil {
+			v, ok := literal(scan.lower)
+			if !ok {
+				return 0, false
+			}
+			lo = rank(v, scan.lower.op == ">")
+		}
+		if scan.upper != nil {
+			v, ok := literal(scan.upper)
+			if !ok {
+				return 0, false
+			}
+			hi = rank(v, scan.upper.op == "<=")
+		}
+		return max(hi-lo, 1), true
+	}
+	return 0, false
+}
+
+// ----------------------------------------------------------------------------
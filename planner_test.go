@@ -0,0 +1,91 @@
+package sqlite
+
+import "testing"
+
+// joinSetup is a company of departments, employees and their projects, with
+// some employees in no department and some projects of no employee
+const joinSetup = `
+create table dept(id integer primary key, name text unique, region text);
+create table emp(id integer primary key, name text, dept_id integer, salary real, manager integer, flag integer);
+create index emp_dept on emp(dept_id);
+create index emp_salary on emp(salary);
+create index emp_flag on emp(flag);
+create table proj(id integer primary key, emp_id integer, title text);
+create index proj_emp on proj(emp_id, title);
+insert into dept with recursive c(i) as (select 1 union all select i + 1 from c where i < 20) select i, 'dept' || i, case i % 3 when 0 then 'east' when 1 then 'west' else 'north' end from c;
+insert into emp with recursive c(i) as (select 1 union all select i + 1 from c where i < 400) select i, 'emp' || i, i % 21 + 1, 1000 + (i * 37) % 5000, case when i > 10 then i % 10 + 1 end, i % 2 from c;
+insert into proj with recursive c(i) as (select 1 union all select i + 1 from c where i < 600) select i, i % 450 + 1, 'p' || (i % 7) from c;
+create table tiny(a, b);
+insert into tiny values (1, 2), (3, 4);`
+
+func TestJoins(t *testing.T) {
+	runQueries(t, openTest(t, joinSetup), []sqlTest{
+		{"inner join", "select e.name, d.name from emp e join dept d on e.dept_id = d.id where d.region = 'east' and e.salary < 1500 order by e.id", "emp2|dept3\nemp5|dept6\nemp8|dept9\nemp11|dept12\nemp137|dept12\nemp140|dept15\nemp143|dept18\nemp275|dept3\nemp278|dept6\nemp281|dept9\n"},
+		{"three tables", "select d.region, count(*), sum(e.salary) from dept d join emp e on e.dept_id = d.id join proj p on p.emp_id = e.id where p.title = 'p3' group by d.region order by d.region", "east|27|89948.0\nnorth|26|87140.0\nwest|26|95169.0\n"},
+		{"comma join", "select count(*) from emp e, dept d, proj p where e.dept_id = d.id and p.emp_id = e.id and d.name = 'dept4'", "27\n"},
+		{"left join unmatched", "select e.id, d.name from emp e left join dept d on e.dept_id = d.id where d.id is null order by e.id limit 5", "20|\n41|\n62|\n83|\n104|\n"},
+		{"left join on term", "select d.id, count(e.id) from dept d left join emp e on e.dept_id = d.id and e.flag = 1 group by d.id order by d.id", "1|10\n2|10\n3|9\n4|10\n5|9\n6|10\n7|9\n8|10\n9|9\n10|10\n11|9\n12|10\n13|9\n14|10\n15|9\n16|10\n17|9\n18|10\n19|9\n20|10\n"},
+		{"left join no employee", "select count(*), min(p.emp_id) from proj p left join emp e on p.emp_id = e.id where e.id is null", "50|401\n"},
+		{"self join", "select m.name, count(*) from emp e join emp m on e.manager = m.id group by m.name order by m.name", "emp1|39\nemp10|39\nemp2|39\nemp3|39\nemp4|39\nemp5|39\nemp6|39\nemp7|39\nemp8|39\nemp9|39\n"},
+		{"cross join", "select d.id, e.id from dept d cross join emp e where e.id < 3 and d.id > 18 order by d.id, e.id", "19|1\n19|2\n20|1\n20|2\n"},
+		{"join subquery", "select d.name, t.n from dept d join (select dept_id, count(*) n from emp group by dept_id) t on t.dept_id = d.id where t.n > 19 order by d.name", "dept2|20\n"},
+		{"range and equality", "select count(*), min(salary), max(salary) from emp where dept_id = 5 and salary between 1000 and 3000", "8|1148.0|2803.0\n"},
+		{"collate", "select count(*) from dept where name = 'DEPT3' collate nocase", "1\n"},
+	})
+}
+
+// TestPlans compares the access paths and join order chosen, with and
+// without statistics, with sqlite3's
+func TestPlans(t *testing.T) {
+	db := openTest(t, joinSetup)
+	runQueries(t, db, []sqlTest{
+		{"plan index equality", "explain query plan select * from emp where dept_id = 3", "QUERY PLAN\n`--SEARCH emp USING INDEX emp_dept (dept_id=?)\n"},
+		{"plan index range", "explain query plan select * from emp where salary > 5000", "QUERY PLAN\n`--SEARCH emp USING INDEX emp_salary (salary>?)\n"},
+		{"plan rowid", "explain query plan select * from emp where id = 5", "QUERY PLAN\n`--SEARCH emp USING INTEGER PRIMARY KEY (rowid=?)\n"},
+		{"plan rowid range", "explain query plan select * from emp where id between 5 and 10", "QUERY PLAN\n`--SEARCH emp USING INTEGER PRIMARY KEY (rowid>? AND rowid<?)\n"},
+		{"plan scan", "explain query plan select * from emp where name = 'emp5'", "QUERY PLAN\n`--SCAN emp\n"},
+		{"plan covering", "explain query plan select count(*) from emp where salary > 1000", "QUERY PLAN\n`--SEARCH emp USING COVERING INDEX emp_salary (salary>?)\n"},
+		{"plan covering scan", "explain query plan select dept_id from emp", "QUERY PLAN\n`--SCAN emp USING COVERING INDEX emp_dept\n"},
+		{"plan same width", "explain query plan select * from proj", "QUERY PLAN\n`--SCAN proj\n"},
+		{"plan join order", "explain query plan select e.name, d.name from emp e join dept d on e.dept_id = d.id where d.region = 'east'", "QUERY PLAN\n|--SCAN d\n`--SEARCH e USING INDEX emp_dept (dept_id=?)\n"},
+		{"plan join inner", "explain query plan select e.name, p.title from emp e join proj p on p.emp_id = e.id where e.dept_id = 2", "QUERY PLAN\n|--SEARCH e USING INDEX emp_dept (dept_id=?)\n`--SEARCH p USING COVERING INDEX proj_emp (emp_id=?)\n"},
+		{"plan three tables", "explain query plan select * from emp e, dept d, proj p where e.dept_id = d.id and p.emp_id = e.id and d.name = 'dept4'", "QUERY PLAN\n|--SEARCH d USING INDEX sqlite_autoindex_dept_1 (name=?)\n|--SEARCH e USING INDEX emp_dept (dept_id=?)\n`--SEARCH p USING COVERING INDEX proj_emp (emp_id=?)\n"},
+		{"plan left join", "explain query plan select * from dept d left join emp e on e.dept_id = d.id", "QUERY PLAN\n|--SCAN d\n`--SEARCH e USING INDEX emp_dept (dept_id=?) LEFT-JOIN\n"},
+		{"plan self join", "explain query plan select m.name, e.name from emp e join emp m on e.manager = m.id", "QUERY PLAN\n|--SCAN e\n`--SEARCH m USING INTEGER PRIMARY KEY (rowid=?)\n"},
+		{"plan unanalyzed table", "explain query plan select * from emp e join tiny t on t.a = e.id", "QUERY PLAN\n|--SCAN t\n`--SEARCH e USING INTEGER PRIMARY KEY (rowid=?)\n"},
+	})
+
+	query(t, db, "analyze")
+	runQueries(t, db, []sqlTest{
+		{"stats choose selective", "explain query plan select * from emp where flag = 1 and dept_id = 3", "QUERY PLAN\n`--SEARCH emp USING INDEX emp_dept (dept_id=?)\n"},
+		{"stats closed range", "explain query plan select * from emp where salary between 1000 and 1100 and dept_id = 5", "QUERY PLAN\n`--SEARCH emp USING INDEX emp_salary (salary>? AND salary<?)\n"},
+		{"stats join order", "explain query plan select * from dept d join emp e on e.dept_id = d.id join proj p on p.emp_id = e.id where p.title = 'p3'", "QUERY PLAN\n|--SCAN p\n|--SEARCH e USING INTEGER PRIMARY KEY (rowid=?)\n`--SEARCH d USING INTEGER PRIMARY KEY (rowid=?)\n"},
+		{"stats range join", "explain query plan select * from proj p join emp e on p.emp_id = e.id where e.salary < 1100", "QUERY PLAN\n|--SEARCH e USING INDEX emp_salary (salary<?)\n`--SEARCH p USING COVERING INDEX proj_emp (emp_id=?)\n"},
+		{"stats without indexes", "explain query plan select * from emp e join tiny t on t.a = e.id", "QUERY PLAN\n|--SCAN t\n`--SEARCH e USING INTEGER PRIMARY KEY (rowid=?)\n"},
+	})
+}
+
+// TestSeekAffinity checks that an index is only searched when the
+// comparison leaves the column's values as the index holds them
+func TestSeekAffinity(t *testing.T) {
+	db := openTest(t, `
+create table u(x);
+create index u_x on u(x);
+insert into u values ('1'), (2), ('3x');
+create table t(a integer primary key, s text);
+create index t_s on t(s);
+insert into t values (1, '2'), (2, '1'), (3, '3x');
+create table v(n integer);
+create index v_n on v(n);
+insert into v values (1), (2);`)
+	runQueries(t, db, []sqlTest{
+		{"blob column with integer column", "select count(*) from t where exists (select 1 from u where u.x = t.a)", "2\n"},
+		{"blob column plan", "explain query plan select * from t where exists (select 1 from u where u.x = t.a)", "QUERY PLAN\n|--SCAN t\n`--CORRELATED SCALAR SUBQUERY 1\n   `--SCAN u\n"},
+		{"blob column with text column", "select group_concat(t.a) from t where t.s in (select x from u)", "2,3\n"},
+		{"text column with integer column", "select group_concat(v.n) from v, t where t.s = v.n", "2,1\n"},
+		{"text column plan", "explain query plan select * from v, t where t.s = v.n", "QUERY PLAN\n|--SCAN t\n`--SEARCH v USING COVERING INDEX v_n (n=?)\n"},
+		{"integer column with text column", "select group_concat(t.a) from t where s in (select n from v)", "1,2\n"},
+		{"blob column with literal", "select typeof(x) from u where x = 2", "integer\n"},
+		{"text column with literal", "select a from t where s = 1", "2\n"},
+	})
+}
@@ -0,0 +1,120 @@
+package record
+
+import (
+	"bytes"
+)
+
+// Custom Types ---------------------------------------------------------------
+// Collation orders two text values
+type Collation func(a, b string) int
+
+// ----------------------------------------------------------------------------
+
+// Value Comparison -----------------------------------------------------------
+// Storage classes in sort order
+const (
+	ClassNull = iota
+	ClassNumeric
+	ClassText
+	ClassBlob
+)
+
+func storageClass(v any) int {
+	switch v.(type) {
+	case nil:
+		return ClassNull
+	case int64, float64:
+		return ClassNumeric
+	case string:
+		return ClassText
+	default:
+		return ClassBlob
+	}
+}
+
+// CompareValues orders values the way SQLite does: NULLs first, then numbers,
+// then text using the collation, then blobs
+func CompareValues(a, b any, coll Collation) int {
+	ca, cb := storageClass(a), storageClass(b)
+	if ca != cb {
+		return ca - cb
+	}
+
+	switch ca {
+	case ClassNull:
+		return 0
+	case ClassNumeric:
+		return compareNumeric(a, b)
+	case ClassText:
+		return coll(a.(string), b.(string))
+	default:
+		return bytes.Compare(a.([]byte), b.([]byte))
+	}
+}
+
+// CompareKey compares an index record with a key, column by column using the
+// index's collations and directions. Only the columns present in both are
+// compared, so a shorter key matches every record it is a prefix of.
+func CompareKey(rec *Record, key []any, colls []Collation, desc []bool) int {
+	n := min(len(rec.ColumnTypes), len(key))
+	for i := range n {
+		c := CompareValues(rec.Value(i), key[i], colls[min(i, len(colls)-1)])
+		if i < len(desc) && desc[i] {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+func compareNumeric(a, b any) int {
+	switch x := a.(type) {
+	case int64:
+		switch y := b.(type) {
+		case int64:
+			return compareOrdered(x, y)
+		case float64:
+			return compareIntFloat(x, y)
+		}
+	case float64:
+		switch y := b.(type) {
+		case int64:
+			return -compareIntFloat(y, x)
+		case float64:
+			return compareOrdered(x, y)
+		}
+	}
+	return 0
+}
+
+// Compares without converting the integer to a float, which would lose
+// precision beyond 2^53
+func compareIntFloat(i int64, f float64) int {
+	switch {
+	case f >= 9223372036854775808.0:
+		return -1
+	case f < -9223372036854775808.0:
+		return 1
+	}
+
+	truncated := int64(f)
+	if i != truncated {
+		return compareOrdered(i, truncated)
+	}
+	return compareOrdered(float64(truncated), f)
+}
+
+func compareOrdered[T int64 | float64](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// ----------------------------------------------------------------------------
@@ -0,0 +1,57 @@
+package record
+
+import (
+	"encoding/binary"
+	"unicode/utf16"
+)
+
+// Text Encodings -------------------------------------------------------------
+// Text encodings stored at header offset 56
+type TextEncoding uint32
+
+const (
+	TextEncodingUTF8    TextEncoding = 1
+	TextEncodingUTF16le TextEncoding = 2
+	TextEncodingUTF16be TextEncoding = 3
+)
+
+// Decode converts text stored in the database encoding to UTF-8
+func (enc TextEncoding) Decode(buf []byte) []byte {
+	var order binary.ByteOrder
+	switch enc {
+	case TextEncodingUTF16le:
+		order = binary.LittleEndian
+	case TextEncodingUTF16be:
+		order = binary.BigEndian
+	default:
+		return buf
+	}
+
+	units := make([]uint16, len(buf)/2)
+	for i := range units {
+		units[i] = order.Uint16(buf[2*i:])
+	}
+	return []byte(string(utf16.Decode(units)))
+}
+
+// Encode converts UTF-8 text to the database encoding
+func (enc TextEncoding) Encode(s string) []byte {
+	var order binary.ByteOrder
+	switch enc {
+	case TextEncodingUTF16le:
+		order = binary.LittleEndian
+	case TextEncodingUTF16be:
+		order = binary.BigEndian
+	default:
+		return []byte(s)
+	}
+
+	units := utf16.Encode([]rune(s))
+	buf := make([]byte, 2*len(units))
+	for i, unit := range units {
+		order.PutUint16(buf[2*i:], unit)
+	}
+	return buf
+}
+
+// ----------------------------------------------------------------------------
@@ -0,0 +1,306 @@
+// Package record encodes and decodes the records stored in b-tree cells, and
+// compares the values they hold.
+package record
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+)
+
+// Custom Types ---------------------------------------------------------------
+// Record is a decoded record. Keys holds the body bytes of each column, with
+// text converted to UTF-8.
+type Record struct {
+	HeaderSize  int       // Part of Header
+	ColumnTypes []uint64  // Part of Header
+	Keys        [][]uint8 // Part of Body
+}
+
+// ----------------------------------------------------------------------------
+
+// Record Decoding ------------------------------------------------------------
+// ReadRecord decodes a record, converting text from the encoding enc
+func ReadRecord(buf []byte, enc TextEncoding) (*Record, error) {
+	record := &Record{
+		Keys: make([][]uint8, 0),
+	}
+
+	// Read header size
+	headerSize, n := ParseVarInt(buf)
+	if n == 0 || headerSize > uint64(len(buf)) {
+		return nil, errors.New("record header extends past end of payload")
+	}
+	record.HeaderSize = int(headerSize)
+
+	// Read column types
+	numCols := 0
+	for n < record.HeaderSize {
+		colType, n1 := ParseVarInt(buf[n:record.HeaderSize])
+		if n1 == 0 {
+			return nil, errors.New("truncated record header")
+		}
+		record.ColumnTypes = append(record.ColumnTypes, colType)
+		n += n1
+		numCols++
+	}
+
+	off := uint64(n)
+
+	// Read keys
+	for i := range numCols {
+		colType := record.ColumnTypes[i]
+		keyLen := SerialTypeLen(colType)
+		if off+keyLen > uint64(len(buf)) {
+			return nil, fmt.Errorf("column %d extends past end of payload", i)
+		}
+
+		switch {
+		case colType == 0:
+			record.Keys = append(record.Keys, []byte{0})
+		case colType >= 1 && colType <= 7:
+			// Read big-endian integer or IEEE floating point
+			record.Keys = append(record.Keys, buf[off:off+keyLen])
+		case colType == 8:
+			// Value is the integer 0
+			record.Keys = append(record.Keys, []byte{0})
+		case colType == 9:
+			// Value is the integer 1
+			record.Keys = append(record.Keys, []byte{1})
+		case colType == 10, colType == 11:
+			return nil, fmt.Errorf("reserved serial type %d in column %d", colType, i)
+		case colType%2 == 0:
+			// Read blob
+			record.Keys = append(record.Keys, buf[off:off+keyLen])
+		default:
+			// Read string in the database text encoding
+			record.Keys = append(record.Keys, enc.Decode(buf[off:off+keyLen]))
+		}
+		off += keyLen
+	}
+
+	return record, nil
+}
+
+// Value decodes column i of the record into nil, int64, float64, string or
+// []byte. Columns missing from the record are NULL.
+func (r *Record) Value(i int) any {
+	if i >= len(r.ColumnTypes) {
+		return nil
+	}
+
+	key := r.Keys[i]
+	switch colType := r.ColumnTypes[i]; {
+	case colType == 0:
+		return nil
+	case colType >= 1 && colType <= 6:
+		// Sign-extend the big-endian two's complement integer
+		shift := 64 - 8*len(key)
+		return int64(bytesToInt(key)<<shift) >> shift
+	case colType == 7:
+		return math.Float64frombits(bytesToInt(key))
+	case colType == 8:
+		return int64(0)
+	case colType == 9:
+		return int64(1)
+	case colType%2 == 0:
+		// The key may point into a cached or memory-mapped page, which
+		// changes or goes away after the value is returned
+		return slices.Clone(key)
+	default:
+		return string(key)
+	}
+}
+
+// SerialTypeLen returns the number of bytes a value of the given serial type
+// occupies in a record body
+func SerialTypeLen(colType uint64) uint64 {
+	switch {
+	case colType <= 4:
+		return colType
+	case colType == 5:
+		return 6
+	case colType == 6, colType == 7:
+		return 8
+	case colType >= 12:
+		return (colType - 12) / 2
+	default:
+		return 0
+	}
+}
+
+func bytesToInt(bytes []byte) uint64 {
+	var result uint64
+	for _, b := range bytes {
+		result = (result << 8) | uint64(b)
+	}
+	return result
+}
+
+// ----------------------------------------------------------------------------
+
+// Record Encoding ------------------------------------------------------------
+/*
+Record Format:
+
+	A varint header size, including itself, followed by one varint serial
+	type per column. The body holds the column values in order:
+
+	0       NULL, no body bytes
+	1-6     Big-endian two's complement integer of 1, 2, 3, 4, 6 or 8 bytes
+	7       Big-endian IEEE 754 64-bit float
+	8, 9    The integers 0 and 1, no body bytes (schema format 4)
+	N>=12   Even: blob of (N-12)/2 bytes, odd: text of (N-13)/2 bytes
+*/
+// Encode builds a record from values, writing text in the encoding enc
+func Encode(values []any, enc TextEncoding, schemaFormat uint32) []byte {
+	types := make([]uint64, len(values))
+	bodies := make([][]byte, len(values))
+	headerLen, bodyLen := 0, 0
+	for i, v := range values {
+		types[i], bodies[i] = serialType(v, enc, schemaFormat)
+		headerLen += VarIntLen(types[i])
+		bodyLen += len(bodies[i])
+	}
+
+	// The header size varint counts itself
+	headerSize := headerLen + VarIntLen(uint64(headerLen+1))
+	if VarIntLen(uint64(headerSize)) != VarIntLen(uint64(headerLen+1)) {
+		headerSize++
+	}
+
+	buf := make([]byte, 0, headerSize+bodyLen)
+	buf = AppendVarInt(buf, uint64(headerSize))
+	for _, t := range types {
+		buf = AppendVarInt(buf, t)
+	}
+	for _, body := range bodies {
+		buf = append(buf, body...)
+	}
+	return buf
+}
+
+func serialType(v any, enc TextEncoding, schemaFormat uint32) (uint64, []byte) {
+	switch x := v.(type) {
+	case nil:
+		return 0, nil
+	case int64:
+		if (x == 0 || x == 1) && schemaFormat >= 4 {
+			return 8 + uint64(x), nil
+		}
+		n := intSerialLen(x)
+		body := make([]byte, 8)
+		binary.BigEndian.PutUint64(body, uint64(x))
+		return serialTypeForLen(n), body[8-n:]
+	case float64:
+		body := make([]byte, 8)
+		binary.BigEndian.PutUint64(body, math.Float64bits(x))
+		return 7, body
+	case string:
+		body := enc.Encode(x)
+		return uint64(len(body))*2 + 13, body
+	case []byte:
+		return uint64(len(x))*2 + 12, x
+	}
+	return 0, nil
+}
+
+// Smallest integer width able to hold x
+func intSerialLen(x int64) int {
+	switch {
+	case x >= -128 && x <= 127:
+		return 1
+	case x >= -32768 && x <= 32767:
+		return 2
+	case x >= -8388608 && x <= 8388607:
+		return 3
+	case x >= -2147483648 && x <= 2147483647:
+		return 4
+	case x >= -140737488355328 && x <= 140737488355327:
+		return 6
+	default:
+		return 8
+	}
+}
+
+func serialTypeForLen(n int) uint64 {
+	switch n {
+	case 6:
+		return 5
+	case 8:
+		return 6
+	default:
+		return uint64(n)
+	}
+}
+
+// ----------------------------------------------------------------------------
+
+// Varint Encoding ------------------------------------------------------------
+// AppendVarInt writes v in 1 to 9 bytes. The first eight bytes carry 7 bits
+// each, high bit set when more follow, and a ninth byte carries 8 bits.
+func AppendVarInt(buf []byte, v uint64) []byte {
+	if v > 0x00ffffffffffffff {
+		var tmp [9]byte
+		tmp[8] = byte(v)
+		v >>= 8
+		for i := 7; i >= 0; i-- {
+			tmp[i] = byte(v&0x7f) | 0x80
+			v >>= 7
+		}
+		return append(buf, tmp[:]...)
+	}
+
+	var tmp [9]byte
+	n := 0
+	for {
+		tmp[n] = byte(v & 0x7f)
+		n++
+		v >>= 7
+		if v == 0 {
+			break
+		}
+	}
+	for i := n - 1; i >= 0; i-- {
+		b := tmp[i]
+		if i > 0 {
+			b |= 0x80
+		}
+		buf = append(buf, b)
+	}
+	return buf
+}
+
+// VarIntLen returns the number of bytes AppendVarInt writes for v
+func VarIntLen(v uint64) int {
+	if v > 0x00ffffffffffffff {
+		return 9
+	}
+	n := 1
+	for v >>= 7; v != 0; v >>= 7 {
+		n++
+	}
+	return n
+}
+
+// ParseVarInt reads a varint, big-endian, the ninth byte contributing all 8
+// bits. Returns a length of 0
+// when the buffer ends before the varint does.
+func ParseVarInt(buf []byte) (uint64, int) {
+	result := uint64(0)
+	for i, b := range buf {
+		if i == 8 {
+			return (result << 8) | uint64(b), 9
+		}
+		result <<= 7
+		result |= uint64(b & 0x7f)
+		if b&0x80 == 0 {
+			return result, i + 1
+		}
+	}
+	return result, 0
+}
+
+// ----------------------------------------------------------------------------
@@ -0,0 +1,134 @@
+package sqlite
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Custom Types ---------------------------------------------------------------
+
+// Rows is the result of a query, read a row at a time with Next and Scan.
+// The rows do not stream: the query has run to completion and every row is
+// held in memory before Rows is returned, so a query over a large table
+// should select only the columns and rows it needs.
+type Rows struct {
+	result *Result
+	pos    int // Current row, -1 before the first call to Next
+	err    error
+	closed bool
+}
+
+// ----------------------------------------------------------------------------
+
+func (rows *Rows) Columns() []string {
+	return rows.result.Columns
+}
+
+// ColumnTypes returns the declared type and nullability of each column
+func (rows *Rows) ColumnTypes() []ColumnType {
+	if len(rows.result.Types) == len(rows.result.Columns) {
+		return rows.result.Types
+	}
+	return make([]ColumnType, len(rows.result.Columns))
+}
+
+// Next moves to the next row, returning false after the last one or once
+// the rows are closed
+func (rows *Rows) Next() bool {
+	if rows.closed || rows.pos+1 >= len(rows.result.Rows) {
+		rows.closed = true
+		return false
+	}
+	rows.pos++
+	return true
+}
+
+// Values returns the values of the current row: nil, int64, float64,
+// string or []byte. The returned slice must not be modified.
+func (rows *Rows) Values() []any {
+	if rows.closed || rows.pos < 0 {
+		return nil
+	}
+	return rows.result.Rows[rows.pos]
+}
+
+// Scan copies the values of the current row into dest, one pointer per
+// column. Values are converted the way SQLite casts them to the type
+// pointed to, and NULL can only be scanned into *any or a pointer to a
+// pointer.
+func (rows *Rows) Scan(dest ...any) error {
+	row := rows.Values()
+	if row == nil {
+		return errors.New("Scan called without calling Next")
+	}
+	if len(dest) != len(row) {
+		return fmt.Errorf("expected %d destination arguments in Scan, not %d", len(row), len(dest))
+	}
+	for i, v := range row {
+		if err := scanValue(dest[i], v); err != nil {
+			rows.err = fmt.Errorf("converting column %d (%q): %w", i, rows.result.Columns[i], err)
+			return rows.err
+		}
+	}
+	return nil
+}
+
+// Err returns the error met while scanning, if any
+func (rows *Rows) Err() error {
+	return rows.err
+}
+
+func (rows *Rows) Close() error {
+	rows.closed = true
+	return nil
+}
+
+// scanValue stores a value in the variable dest points to
+func scanValue(dest, v any) error {
+	if p, ok := dest.(*any); ok {
+		*p = v
+		return nil
+	}
+	if v == nil {
+		switch d := dest.(type) {
+		case **string:
+			*d = nil
+		case **int64:
+			*d = nil
+		case **float64:
+			*d = nil
+		case *[]byte:
+			*d = nil
+		default:
+			return fmt.Errorf("cannot scan NULL into %T", dest)
+		}
+		return nil
+	}
+
+	n := castValue(v, "INTEGER").(int64)
+	switch d := dest.(type) {
+	case *string:
+		*d = FormatValue(v)
+	case **string:
+		s := FormatValue(v)
+		*d = &s
+	case *[]byte:
+		*d = []byte(FormatValue(v))
+	case *int64:
+		*d = n
+	case **int64:
+		*d = &n
+	case *int:
+		*d = int(n)
+	case *float64:
+		*d = toReal(v).(float64)
+	case **float64:
+		f := toReal(v).(float64)
+		*d = &f
+	case *bool:
+		*d = n != 0
+	default:
+		return fmt.Errorf("unsupported Scan destination %T", dest)
+	}
+	return nil
+}
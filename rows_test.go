@@ -0,0 +1,151 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// scanRow runs a query and scans its first row into dest
+func scanRow(t *testing.T, db *DB, sql string, dest ...any) error {
+	t.Helper()
+	rows, err := db.Query(context.Background(), sql)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		t.Fatalf("%s: no rows", sql)
+	}
+	return rows.Scan(dest...)
+}
+
+// TestScan checks that Scan converts values as sqlite3's CAST does
+func TestScan(t *testing.T) {
+	tests := []struct {
+		value string
+		i     int64
+		f     float64
+		s     string
+	}{
+		{"'12abc'", 12, 12, "12abc"},
+		{"2.9", 2, 2.9, "2.9"},
+		{"'1e3'", 1, 1000, "1e3"},
+		{"5", 5, 5, "5"},
+		{"1.0", 1, 1, "1.0"},
+		{"x'3132'", 12, 12, "12"},
+		{"' 7 '", 7, 7, " 7 "},
+		{"9223372036854775807", 9223372036854775807, 9.223372036854775807e18, "9223372036854775807"},
+		{"1e30", 9223372036854775807, 1e30, "1.0e+30"},
+		{"'abc'", 0, 0, "abc"},
+	}
+	db := openTest(t, "")
+	for _, tt := range tests {
+		var i int64
+		var f float64
+		var s string
+		sql := "select " + tt.value + ", " + tt.value + ", " + tt.value
+		if err := scanRow(t, db, sql, &i, &f, &s); err != nil {
+			t.Fatal(err)
+		}
+		if i != tt.i || f != tt.f || s != tt.s {
+			t.Errorf("%s: got %d, %g, %q, want %d, %g, %q", tt.value, i, f, s, tt.i, tt.f, tt.s)
+		}
+	}
+}
+
+func TestScanNull(t *testing.T) {
+	db := openTest(t, "")
+	s := new(string)
+	var v any = 1
+	var b []byte = []byte("x")
+	if err := scanRow(t, db, "select null, null, null", &s, &v, &b); err != nil {
+		t.Fatal(err)
+	}
+	if s != nil || v != nil || b != nil {
+		t.Errorf("got %v, %v, %v, want nil", s, v, b)
+	}
+
+	var str string
+	err := scanRow(t, db, "select null", &str)
+	if err == nil || err.Error() != `converting column 0 ("null"): cannot scan NULL into *string` {
+		t.Errorf("got error %v", err)
+	}
+}
+
+func TestRowsColumns(t *testing.T) {
+	db := openTest(t, "create table t(id integer primary key, name text not null, n numeric, x)")
+	rows, err := db.Query(context.Background(), "select id, name as label, n, x, 1 + 1 from t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	if got, want := rows.Columns(), []string{"id", "label", "n", "x", "1 + 1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("columns: got %q, want %q", got, want)
+	}
+	want := []ColumnType{
+		{DeclType: "integer", Nullable: false, Known: true},
+		{DeclType: "text", Nullable: false, Known: true},
+		{DeclType: "numeric", Nullable: true, Known: true},
+		{DeclType: "", Nullable: true, Known: true},
+		{},
+	}
+	if got := rows.ColumnTypes(); !reflect.DeepEqual(got, want) {
+		t.Errorf("column types: got %+v, want %+v", got, want)
+	}
+	if rows.Next() {
+		t.Error("rows from an empty table")
+	}
+}
+
+// TestSample reads the sample database in the repository read-only
+func TestSample(t *testing.T) {
+	db, err := Open("sample.db", &Options{ReadOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query(context.Background(), "select id, name from apples where color = ?", "Red")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var id int64
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, name)
+	}
+	if want := []string{"Fuji"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("got %q, want %q", names, want)
+	}
+
+	if _, err := db.Exec(context.Background(), "delete from apples"); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("write: got %v, want %v", err, ErrReadOnly)
+	}
+}
+
+func TestOpenErrors(t *testing.T) {
+	dir := t.TempDir()
+	notADB := filepath.Join(dir, "text.db")
+	if err := os.WriteFile(notADB, []byte("this is not a database, just some text"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(notADB, nil); !errors.Is(err, ErrNotADB) {
+		t.Errorf("text file: got %v, want %v", err, ErrNotADB)
+	}
+	if _, err := Open(filepath.Join(dir, "missing.db"), &Options{ReadOnly: true}); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("missing read-only: got %v, want %v", err, os.ErrNotExist)
+	}
+	if _, err := Open(filepath.Join(dir, "nodir", "x.db"), nil); err != nil {
+		t.Errorf("missing directory: got %v, want the error on the first write", err)
+	}
+}
@@ -0,0 +1,275 @@
+package sqlite
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/elordeiro/SQLite-DBReader/parser"
+	"github.com/elordeiro/SQLite-DBReader/record"
+)
+
+// Constants ------------------------------------------------------------------
+
+const (
+	RowIDColumn = -1 // Column index standing for the rowid
+	ExprColumn  = -2 // Index column computed from an expression
+)
+
+// ----------------------------------------------------------------------------
+
+// Custom Types ---------------------------------------------------------------
+type Column struct {
+	Name      string
+	Type      string
+	Affinity  parser.Affinity
+	NotNull   bool
+	Default   parser.Expr
+	Collate   string
+	Generated parser.Expr
+	RecordIdx int // Position in the record, -1 for virtual generated columns
+}
+
+type uniqueConstraint struct {
+	key  []string // Lower case "name collation" of each column
+	cols []*parser.IndexedColumn
+}
+
+type IndexColumn struct {
+	Name    string
+	Text    string // Term of CREATE INDEX or the constraint as written
+	Col     int    // Table column, RowIDColumn or ExprColumn
+	Expr    parser.Expr
+	Collate string
+	Desc    bool
+}
+
+// ----------------------------------------------------------------------------
+
+// parseTableSchema fills in the columns of a table from its CREATE TABLE
+// statement
+func (table *Table) parseTableSchema() error {
+	stmt, err := parser.ParseStatement(table.SQL)
+	if err != nil {
+		return err
+	}
+	create, ok := stmt.(*parser.CreateTableStatement)
+	if !ok {
+		return fmt.Errorf("expected CREATE TABLE for %s", table.Name)
+	}
+
+	table.WithoutRowID = create.WithoutRowID
+	table.RowIDAlias = -1
+	recordIdx := 0
+	for _, def := range create.Columns {
+		col := &Column{
+			Name:      def.Name,
+			Type:      def.Type,
+			Affinity:  parser.TypeAffinity(def.Type),
+			NotNull:   def.NotNull,
+			Default:   def.Default,
+			Collate:   def.Collate,
+			Generated: def.Generated,
+			RecordIdx: -1,
+		}
+		if def.Generated == nil || def.Stored {
+			col.RecordIdx = recordIdx
+			recordIdx++
+		}
+		table.Columns = append(table.Columns, col)
+		table.ColNames = append(table.ColNames, def.Name)
+	}
+
+	// A single INTEGER PRIMARY KEY column is an alias for the rowid, except
+	// when declared "INTEGER PRIMARY KEY DESC"
+	for i, def := range create.Columns {
+		if def.PrimaryKey && !def.PrimaryDesc && strings.EqualFold(def.Type, "INTEGER") {
+			table.RowIDAlias = i
+			table.Autoincrement = def.Autoincrement
+		}
+	}
+	for _, constraint := range create.Constraints {
+		if !constraint.PrimaryKey || len(constraint.Columns) != 1 {
+			continue
+		}
+		i, ok := table.ColumnIndex(constraint.Columns[0].Name)
+		if ok && i >= 0 && strings.EqualFold(table.Columns[i].Type, "INTEGER") {
+			table.RowIDAlias = i
+			table.Autoincrement = constraint.Columns[0].Autoincrement
+		}
+	}
+	if table.WithoutRowID {
+		table.RowIDAlias = -1
+	}
+
+	// Generated columns are computed from the other columns of the row
+	sources := []*rowSource{{name: table.Name, table: table}}
+	for _, col := range table.Columns {
+		if err := bindExpr(col.Generated, sources); err != nil {
+			return err
+		}
+	}
+
+	// Remaining PRIMARY KEY and UNIQUE constraints are enforced by automatic
+	// indexes, numbered in the order they appear
+	for i, def := range create.Columns {
+		if (def.PrimaryKey && i != table.RowIDAlias) || def.Unique {
+			table.addUniqueConstraint([]*parser.IndexedColumn{{Name: def.Name}})
+		}
+	}
+	for _, constraint := range create.Constraints {
+		if constraint.PrimaryKey && len(constraint.Columns) == 1 && table.RowIDAlias >= 0 &&
+			strings.EqualFold(constraint.Columns[0].Name, table.Columns[table.RowIDAlias].Name) {
+			continue
+		}
+		table.addUniqueConstraint(constraint.Columns)
+	}
+
+	return nil
+}
+
+func (table *Table) addUniqueConstraint(cols []*parser.IndexedColumn) {
+	key := make([]string, len(cols))
+	for i, col := range cols {
+		key[i] = strings.ToLower(col.Name + " " + col.Collate)
+	}
+	for _, existing := range table.uniqueConstraints {
+		if strings.Join(existing.key, ",") == strings.Join(key, ",") {
+			return
+		}
+	}
+	table.uniqueConstraints = append(table.uniqueConstraints, &uniqueConstraint{key, cols})
+}
+
+// parseIndexSchema fills in the columns of an index, either from its CREATE
+// INDEX statement or from the constraint that created an automatic index
+func (db *DB) parseIndexSchema(index *Table) error {
+	table := db.GetTable(index.TblName)
+	if table == nil {
+		return fmt.Errorf("no such table: %s", index.TblName)
+	}
+
+	var cols []*parser.IndexedColumn
+	if index.SQL == "" {
+		// sqlite_autoindex_<table>_<N>
+		var n int
+		prefix := "sqlite_autoindex_" + table.Name + "_"
+		_, err := fmt.Sscanf(strings.TrimPrefix(index.Name, prefix), "%d", &n)
+		if err != nil || n < 1 || n > len(table.uniqueConstraints) {
+			return fmt.Errorf("unknown automatic index %s", index.Name)
+		}
+		cols = table.uniqueConstraints[n-1].cols
+		index.Unique = true
+	} else {
+		stmt, err := parser.ParseStatement(index.SQL)
+		if err != nil {
+			return err
+		}
+		create, ok := stmt.(*parser.CreateIndexStatement)
+		if !ok {
+			return fmt.Errorf("expected CREATE INDEX for %s", index.Name)
+		}
+		cols = create.Columns
+		index.Unique = create.Unique
+		index.Where = create.Where
+	}
+
+	for _, def := range cols {
+		col := &IndexColumn{
+			Name:    def.Name,
+			Text:    def.Text,
+			Col:     ExprColumn,
+			Expr:    def.Expr,
+			Collate: def.Collate,
+			Desc:    def.Desc,
+		}
+		if def.Name != "" {
+			var ok bool
+			col.Col, ok = table.ColumnIndex(def.Name)
+			if !ok {
+				return fmt.Errorf("no such column: %s", def.Name)
+			}
+			if col.Col == table.RowIDAlias {
+				col.Col = RowIDColumn
+			}
+			if col.Col >= 0 {
+				col.Name = table.Columns[col.Col].Name
+				if col.Collate == "" {
+					col.Collate = table.Columns[col.Col].Collate
+				}
+			}
+		}
+		index.IndexColumns = append(index.IndexColumns, col)
+		index.ColNames = append(index.ColNames, col.Name)
+	}
+
+	// Expressions and the partial index condition read the indexed row
+	sources := []*rowSource{{name: table.Name, table: table}}
+	for _, col := range index.IndexColumns {
+		if err := bindExpr(col.Expr, sources); err != nil {
+			return err
+		}
+	}
+	return bindExpr(index.Where, sources)
+}
+
+func isRowIDName(name string) bool {
+	switch strings.ToLower(name) {
+	case "rowid", "oid", "_rowid_":
+		return true
+	}
+	return false
+}
+
+// Getters --------------------------------------------------------------------
+// ColumnIndex returns the index of the named column, or RowIDColumn when the
+// name refers to the rowid. ok is false when the table has no such column.
+func (table *Table) ColumnIndex(name string) (int, bool) {
+	for i, col := range table.Columns {
+		if strings.EqualFold(col.Name, name) {
+			return i, true
+		}
+	}
+	if isRowIDName(name) && !table.WithoutRowID {
+		return RowIDColumn, true
+	}
+	return 0, false
+}
+
+// IndexKeyOrder returns the collation and direction of each column of an
+// index's keys. The trailing rowid sorts with BINARY, ascending.
+func (db *DB) IndexKeyOrder(index *Table) ([]record.Collation, []bool, error) {
+	colls := make([]record.Collation, len(index.IndexColumns)+1)
+	desc := make([]bool, len(index.IndexColumns)+1)
+	for i, col := range index.IndexColumns {
+		coll, err := db.GetCollation(col.Collate)
+		if err != nil {
+			return nil, nil, err
+		}
+		colls[i], desc[i] = coll, col.Desc
+	}
+	colls[len(index.IndexColumns)] = db.binaryCollation
+	return colls, desc, nil
+}
+
+// GetTable returns the table, index or view with the given name
+func (db *DB) GetTable(name string) *Table {
+	for _, table := range db.tables {
+		if strings.EqualFold(table.Name, name) {
+			return table
+		}
+	}
+	return nil
+}
+
+// GetIndexes returns the indexes on a table
+func (db *DB) GetIndexes(table *Table) []*Table {
+	indexes := make([]*Table, 0)
+	for _, index := range db.tables {
+		if index.Type == TableTypeIndex && strings.EqualFold(index.TblName, table.Name) {
+			indexes = append(indexes, index)
+		}
+	}
+	return indexes
+}
+
+// ----------------------------------------------------------------------------
@@ -0,0 +1,1305 @@
+package sqlite
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/elordeiro/SQLite-DBReader/btree"
+	"github.com/elordeiro/SQLite-DBReader/pager"
+	"github.com/elordeiro/SQLite-DBReader/parser"
+	"github.com/elordeiro/SQLite-DBReader/record"
+)
+
+// Custom Types ---------------------------------------------------------------
+// Result holds the output of one statement
+type Result struct {
+	Columns      []string
+	Types        []ColumnType // Set for the columns of a SELECT
+	Rows         [][]any
+	RowsAffected int64
+	QueryPlan    bool // Rows are the id, parent, notused and detail of EXPLAIN QUERY PLAN
+}
+
+// ColumnType describes a result column that reads a table column. Both
+// fields are unknown for columns computed from expressions.
+type ColumnType struct {
+	DeclType string // Type the column was declared with
+	Nullable bool
+	Known    bool // The column reads a table column
+}
+
+// selectPlan is a SELECT bound to the tables it reads, with its access path
+// chosen, ready to run any number of times
+type selectPlan struct {
+	stmt     *parser.SelectStatement
+	sources  []*rowSource
+	exprs    []parser.Expr // Result columns, with * expanded
+	names    []string
+	types    []ColumnType
+	groupBy  []parser.Expr
+	orderBy  []parser.Expr
+	aggCalls []*parser.FuncCall
+	join     *joinPlan
+	sorted   bool // Rows are read in ORDER BY order, so need no sorting
+
+	subqueries []*subquery
+	correlated bool // Reads columns of an enclosing query
+
+	windows []*window // Windows of the window functions in the result and ORDER BY
+
+	// SELECTs of a compound, which has no sources of its own. ORDER BY
+	// sorts on the result columns at orderCols.
+	arms      []*compoundArm
+	orderCols []int
+	recursive int // Arms before the first recursive one of a recursive CTE
+}
+
+// Output row together with the values it is sorted by. Until the window
+// functions of a query are computed, it holds the rows and aggregates its
+// values are computed from instead.
+type outputRow struct {
+	values []any
+	keys   []any
+	rows   []*Row
+	aggs   map[*parser.FuncCall]any
+}
+
+type group struct {
+	aggs []aggregator
+	keys []any  // Values of the GROUP BY terms
+	rows []*Row // Row the bare columns of the group are read from
+}
+
+// ----------------------------------------------------------------------------
+
+// SELECT ---------------------------------------------------------------------
+func (db *DB) execSelect(stmt *parser.SelectStatement) (*Result, error) {
+	plan, err := db.planSelect(stmt)
+	if err != nil {
+		return nil, err
+	}
+	return db.runSelect(plan)
+}
+
+// planSelect binds a SELECT to the schema and picks how to scan its table
+func (db *DB) planSelect(stmt *parser.SelectStatement) (*selectPlan, error) {
+	return db.planQuery(stmt, nil)
+}
+
+// planQuery plans a SELECT that may be nested in another query, the scope
+// of which column references not found in its own sources resolve against
+func (db *DB) planQuery(stmt *parser.SelectStatement, sc *scope) (*selectPlan, error) {
+	if sc == nil {
+		sc = &scope{}
+	}
+	if stmt.With != nil {
+		if err := sc.addCTEs(stmt.With); err != nil {
+			return nil, err
+		}
+	}
+	if len(stmt.Compound) > 0 {
+		return db.planCompound(stmt, sc)
+	}
+
+	sources, err := db.selectSources(stmt, sc)
+	if err != nil {
+		return nil, err
+	}
+	sc.sources = sources
+
+	exprs, names, err := expandResultColumns(stmt.Columns, sources)
+	if err != nil {
+		return nil, err
+	}
+	terms := make([]parser.Expr, len(stmt.OrderBy))
+	for i, term := range stmt.OrderBy {
+		terms[i] = term.Expr
+	}
+	if err := resolveWindows(stmt, append(slices.Clone(exprs), terms...)...); err != nil {
+		return nil, err
+	}
+	for _, e := range exprs {
+		if err := sc.bind(e); err != nil {
+			return nil, err
+		}
+	}
+
+	stmt.Where = resolveAliases(stmt.Where, stmt.Columns, sc)
+	if err := sc.bind(stmt.Where); err != nil {
+		return nil, err
+	}
+	if err := bindJoinConditions(sc); err != nil {
+		return nil, err
+	}
+	groupBy := make([]parser.Expr, len(stmt.GroupBy))
+	for i, e := range stmt.GroupBy {
+		if groupBy[i], err = resolveOutputRef(e, exprs, stmt.Columns, "GROUP BY"); err != nil {
+			return nil, err
+		}
+		if err := sc.bind(groupBy[i]); err != nil {
+			return nil, err
+		}
+	}
+	stmt.Having = resolveAliases(stmt.Having, stmt.Columns, sc)
+	if err := sc.bind(stmt.Having); err != nil {
+		return nil, err
+	}
+	orderBy := make([]parser.Expr, len(stmt.OrderBy))
+	for i, term := range stmt.OrderBy {
+		if orderBy[i], err = resolveOutputRef(term.Expr, exprs, stmt.Columns, "ORDER BY"); err != nil {
+			return nil, err
+		}
+		if err := sc.bind(orderBy[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	// Subqueries are planned once the columns they may read are bound, and
+	// add the columns of this query they read to the expressions they are in
+	ons := make([]parser.Expr, len(sources))
+	for i, src := range sources {
+		ons[i] = src.on
+	}
+	clauses := append(append(append(slices.Clone(exprs), groupBy...), orderBy...), stmt.Where, stmt.Having)
+	subqueries, err := db.planSubqueries(sc, append(clauses, ons...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Aggregates may appear in the result, HAVING and ORDER BY only, and
+	// window functions in the result and ORDER BY
+	for _, e := range append(slices.Clone(groupBy), stmt.Where) {
+		if call := findAggregate(e); call != nil {
+			return nil, fmt.Errorf("misuse of aggregate function %s()", call.Name)
+		}
+	}
+	for _, e := range append(slices.Clone(groupBy), stmt.Where, stmt.Having) {
+		if call := findWindow(e); call != nil {
+			return nil, fmt.Errorf("misuse of window function %s()", call.Name)
+		}
+	}
+	aggCalls, err := collectAggregates(append(append(slices.Clone(exprs), orderBy...), stmt.Having))
+	if err != nil {
+		return nil, err
+	}
+	windows, err := collectWindows(append(slices.Clone(exprs), orderBy...))
+	if err != nil {
+		return nil, err
+	}
+	if stmt.Having != nil && len(groupBy) == 0 && len(aggCalls) == 0 {
+		return nil, errors.New("a GROUP BY clause is required before HAVING")
+	}
+
+	plan := &selectPlan{
+		stmt:     stmt,
+		sources:  sources,
+		exprs:    exprs,
+		names:    names,
+		groupBy:  groupBy,
+		orderBy:  orderBy,
+		aggCalls: aggCalls,
+
+		subqueries: subqueries,
+		correlated: sc.correlated,
+
+		windows: windows,
+	}
+	// Without GROUP BY an aggregate query yields a row even for an empty
+	// table, leaving its bare columns NULL
+	plan.types = resultColumnTypes(exprs, sources, len(aggCalls) > 0 && len(groupBy) == 0)
+
+	used := make([]map[int]bool, len(sources))
+	for i := range used {
+		used[i] = make(map[int]bool)
+	}
+	usedColumns(used, append(clauses, ons...)...)
+	if plan.join, err = db.planJoin(sources, stmt.Where, used); err != nil {
+		return nil, err
+	}
+	plan.sorted = plan.rowIDOrdered()
+	return plan, nil
+}
+
+// rowIDOrdered reports whether ORDER BY sorts on the rowid of the outer
+// loop, which reads its table b-tree in rowid order. Later terms only
+// matter when inner loops give several rows per outer row.
+func (plan *selectPlan) rowIDOrdered() bool {
+	if len(plan.orderBy) == 0 || len(plan.join.loops) == 0 || len(plan.groupBy) > 0 || len(plan.aggCalls) > 0 ||
+		len(plan.windows) > 0 {
+		return false
+	}
+	outer := plan.join.loops[0]
+	ref, ok := plan.orderBy[0].(*parser.ColumnRef)
+	return ok && ref.Bound && ref.Depth == 0 && ref.Src == outer.src && ref.Col == RowIDColumn && outer.index == nil &&
+		!plan.stmt.OrderBy[0].Desc && (len(plan.orderBy) == 1 || len(plan.join.loops) == 1)
+}
+
+// estimatedRows is the number of rows the planner expects a plan to give
+func (plan *selectPlan) estimatedRows() float64 {
+	if plan.join != nil {
+		return plan.join.rows
+	}
+	rows := 0.0
+	for _, arm := range plan.arms {
+		rows += arm.plan.estimatedRows()
+	}
+	return rows
+}
+
+// bindJoinConditions binds the ON clause of each source. The condition of a
+// LEFT JOIN may only read the sources up to and including it.
+func bindJoinConditions(sc *scope) error {
+	for i, src := range sc.sources {
+		if err := sc.bind(src.on); err != nil {
+			return err
+		}
+		if call := findAggregate(src.on); call != nil {
+			return fmt.Errorf("misuse of aggregate function %s()", call.Name)
+		}
+		if call := findWindow(src.on); call != nil {
+			return fmt.Errorf("misuse of window function %s()", call.Name)
+		}
+		if deps, _ := exprDeps(src.on); src.join == "LEFT" && deps>>(i+1) != 0 {
+			return errors.New("ON clause references tables to its right")
+		}
+	}
+	return nil
+}
+
+// runSelect reads the rows of a planned SELECT
+func (db *DB) runSelect(plan *selectPlan) (*Result, error) {
+	return db.runQuery(plan, nil, nil, -1)
+}
+
+// runQuery reads the rows of a planned query, nested in the query outer is
+// reading when it is a subquery. Subqueries read nothing from it have their
+// rows kept in results. The rows stop at maxRows when it is not negative.
+func (db *DB) runQuery(plan *selectPlan, outer *evalContext, results map[*selectPlan]*Result, maxRows int64) (*Result, error) {
+	stmt := plan.stmt
+	if results == nil {
+		results = make(map[*selectPlan]*Result)
+	}
+	ctx := &evalContext{
+		db:         db,
+		rows:       make([]*Row, len(plan.sources)),
+		outer:      outer,
+		subqueries: plan.subqueries,
+		results:    results,
+	}
+	limit, offset, err := ctx.evalLimit(stmt)
+	if err != nil {
+		return nil, err
+	}
+	if maxRows >= 0 && (limit < 0 || limit > maxRows) {
+		limit = maxRows
+	}
+
+	// Without sorting, de-duplication or windows the scan can stop at the
+	// limit
+	stopAfter := int64(-1)
+	if limit >= 0 && (len(plan.orderBy) == 0 || plan.sorted) && !(stmt.Distinct && plan.arms == nil) &&
+		len(plan.windows) == 0 {
+		stopAfter = limit + offset
+	}
+
+	var out []*outputRow
+	switch {
+	case plan.arms != nil:
+		out, err = db.compoundRows(ctx, plan, stopAfter)
+	case len(plan.aggCalls) > 0 || len(plan.groupBy) > 0:
+		out, err = db.selectGroups(ctx, plan)
+	default:
+		out, err = db.selectRows(ctx, plan, stopAfter)
+	}
+	if err == nil && len(plan.windows) > 0 {
+		out, err = db.windowRows(ctx, plan, out)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if stmt.Distinct && plan.arms == nil {
+		if out, err = distinctRows(db, out, plan.exprs); err != nil {
+			return nil, err
+		}
+	}
+	if len(plan.orderBy) > 0 && !plan.sorted {
+		if err := sortRows(db, out, plan.orderBy, stmt.OrderBy); err != nil {
+			return nil, err
+		}
+	}
+
+	result := &Result{Columns: plan.names, Types: plan.types, Rows: make([][]any, 0)}
+	for i, row := range out {
+		if int64(i) < offset {
+			continue
+		}
+		if limit >= 0 && int64(len(result.Rows)) >= limit {
+			break
+		}
+		result.Rows = append(result.Rows, row.values)
+	}
+	return result, nil
+}
+
+// selectSources looks up the tables in FROM and turns the columns matched by
+// USING or NATURAL into join conditions
+func (db *DB) selectSources(stmt *parser.SelectStatement, sc *scope) ([]*rowSource, error) {
+	if len(stmt.From) > MaxJoinTables {
+		return nil, errors.New("at most 64 tables in a join")
+	}
+	sources := make([]*rowSource, 0, len(stmt.From))
+	for _, ref := range stmt.From {
+		src, err := db.fromSource(ref, sc)
+		if err != nil {
+			return nil, err
+		}
+		table := src.table
+
+		using := ref.Using
+		if using != nil && len(using) == 0 {
+			// NATURAL matches the columns the tables on both sides have
+			for _, col := range table.Columns {
+				if findUsingSource(sources, col.Name) != nil {
+					using = append(using, col.Name)
+				}
+			}
+		}
+		for _, name := range using {
+			left := findUsingSource(sources, name)
+			if _, ok := table.ColumnIndex(name); !ok || left == nil {
+				return nil, fmt.Errorf("cannot join using column %s - column not present in both tables", name)
+			}
+			if src.using == nil {
+				src.using = make(map[string]bool)
+			}
+			src.using[strings.ToLower(name)] = true
+			eq := &parser.BinaryExpr{
+				Op: "=",
+				L:  &parser.ColumnRef{Table: left.name, Column: name},
+				R:  &parser.ColumnRef{Table: src.name, Column: name},
+			}
+			if src.on == nil {
+				src.on = eq
+			} else {
+				src.on = &parser.BinaryExpr{Op: "AND", L: src.on, R: eq}
+			}
+		}
+		sources = append(sources, src)
+	}
+	return sources, nil
+}
+
+// fromSource looks up the table a FROM term names, or plans its subquery.
+// The subquery cannot read the other sources of the query, only those of
+// the queries enclosing it, which the query then reads too.
+func (db *DB) fromSource(ref *parser.TableRef, sc *scope) (*rowSource, error) {
+	src := &rowSource{name: ref.Alias, join: ref.Join, on: ref.On}
+	if ref.Subquery != nil {
+		inner := sc.sibling()
+		query, err := db.planQuery(ref.Subquery, inner)
+		if err != nil {
+			return nil, err
+		}
+		sc.readsOuter(inner)
+		src.query, src.table = query, derivedTable(ref.Alias, query)
+		return src, nil
+	}
+	if c, level := sc.lookupCTE(ref.Name); c != nil {
+		return db.cteSource(src, c, level, sc)
+	}
+
+	table, err := db.lookupTable(ref.Name)
+	if err != nil {
+		return nil, err
+	}
+	src.table = table
+	if src.name == "" {
+		src.name = table.Name
+	}
+	return src, nil
+}
+
+// findUsingSource returns the leftmost source with a column of that name
+func findUsingSource(sources []*rowSource, name string) *rowSource {
+	for _, src := range sources {
+		for _, col := range src.table.Columns {
+			if strings.EqualFold(col.Name, name) {
+				return src
+			}
+		}
+	}
+	return nil
+}
+
+// lookupTable finds a table that can be read and written row by row
+func (db *DB) lookupTable(name string) (*Table, error) {
+	table := db.GetTable(name)
+	if table == nil || table.Type == TableTypeIndex || table.Type == TableTypeTrigger {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+
+	switch {
+	case table.Type == TableTypeView:
+		return nil, fmt.Errorf("views are not supported: %s", name)
+	case table.Virtual:
+		return nil, fmt.Errorf("virtual tables are not supported: %s", name)
+	case table.WithoutRowID:
+		return nil, fmt.Errorf("WITHOUT ROWID tables are not supported: %s", name)
+	}
+	return table, nil
+}
+
+// expandResultColumns replaces * and table.* with the columns they stand for
+// and names every output column
+func expandResultColumns(cols []*parser.ResultColumn, sources []*rowSource) ([]parser.Expr, []string, error) {
+	exprs := make([]parser.Expr, 0, len(cols))
+	names := make([]string, 0, len(cols))
+	for _, col := range cols {
+		if !col.Star {
+			exprs = append(exprs, col.Expr)
+			names = append(names, resultColumnName(col))
+			continue
+		}
+
+		if len(sources) == 0 {
+			return nil, nil, errors.New("no tables specified")
+		}
+		matched := false
+		for i, src := range sources {
+			if col.Table != "" && !strings.EqualFold(col.Table, src.name) {
+				continue
+			}
+			matched = true
+			for j, column := range src.table.Columns {
+				// A column matched by USING appears once, from the left table
+				if col.Table == "" && src.using[strings.ToLower(column.Name)] {
+					continue
+				}
+				// Bound here, as sources need not have distinct names
+				ref := &parser.ColumnRef{Table: src.name, Column: column.Name, Bound: true}
+				bindSource(ref, i, src, j)
+				exprs = append(exprs, ref)
+				names = append(names, column.Name)
+			}
+		}
+		if !matched {
+			return nil, nil, fmt.Errorf("no such table: %s", col.Table)
+		}
+	}
+	return exprs, names, nil
+}
+
+func resultColumnName(col *parser.ResultColumn) string {
+	if col.Alias != "" {
+		return col.Alias
+	}
+	if ref, ok := col.Expr.(*parser.ColumnRef); ok {
+		return ref.Column
+	}
+	return col.Text
+}
+
+// resultColumnTypes reports the declared type and nullability of the
+// result columns that name a table column. Columns of a LEFT JOIN table may
+// always be NULL.
+func resultColumnTypes(exprs []parser.Expr, sources []*rowSource, aggregate bool) []ColumnType {
+	types := make([]ColumnType, len(exprs))
+	for i, e := range exprs {
+		ref, ok := e.(*parser.ColumnRef)
+		if !ok || !ref.Bound || ref.Depth > 0 {
+			continue
+		}
+		nullable := aggregate || sources[ref.Src].join == "LEFT"
+		// The rowid and the INTEGER PRIMARY KEY column aliasing it are
+		// bound alike, and both have the type the alias was declared with
+		table := sources[ref.Src].table
+		if ref.Col == RowIDColumn {
+			types[i] = ColumnType{DeclType: "INTEGER", Nullable: nullable, Known: true}
+			if table.RowIDAlias >= 0 {
+				types[i].DeclType = table.Columns[table.RowIDAlias].Type
+			}
+			continue
+		}
+		col := table.Columns[ref.Col]
+		types[i] = ColumnType{DeclType: col.Type, Nullable: nullable || !col.NotNull, Known: true}
+	}
+	return types
+}
+
+// resolveOutputRef lets GROUP BY and ORDER BY terms name a result column by
+// its 1-based position or its alias
+func resolveOutputRef(e parser.Expr, exprs []parser.Expr, cols []*parser.ResultColumn, clause string) (parser.Expr, error) {
+	switch x := e.(type) {
+	case *parser.Literal:
+		n, ok := x.Value.(int64)
+		if !ok {
+			return e, nil
+		}
+		if n < 1 || n > int64(len(exprs)) {
+			return nil, fmt.Errorf("%d%s %s term out of range - should be between 1 and %d",
+				n, ordinalSuffix(n), clause, len(exprs))
+		}
+		return exprs[n-1], nil
+	case *parser.ColumnRef:
+		if x.Table != "" {
+			return e, nil
+		}
+		for _, col := range cols {
+			if col.Alias != "" && strings.EqualFold(col.Alias, x.Column) {
+				return col.Expr, nil
+			}
+		}
+	case *parser.CollateExpr:
+		inner, err := resolveOutputRef(x.X, exprs, cols, clause)
+		if err != nil {
+			return nil, err
+		}
+		return &parser.CollateExpr{X: inner, Collation: x.Collation}, nil
+	}
+	return e, nil
+}
+
+// resolveAliases lets WHERE and HAVING name a result column by its alias,
+// wherever in the expression, when no column of the query's sources has
+// the name. The result column's expression replaces the name.
+func resolveAliases(e parser.Expr, cols []*parser.ResultColumn, sc *scope) parser.Expr {
+	return rewriteExpr(e, func(e parser.Expr) parser.Expr {
+		ref, ok := e.(*parser.ColumnRef)
+		if !ok || ref.Bound || ref.Table != "" {
+			return nil
+		}
+		if found, err := sc.resolve(&parser.ColumnRef{Column: ref.Column}); found || err != nil {
+			return nil
+		}
+		for _, col := range cols {
+			if col.Alias != "" && strings.EqualFold(col.Alias, ref.Column) {
+				return col.Expr
+			}
+		}
+		return nil
+	})
+}
+
+func ordinalSuffix(n int64) string {
+	switch {
+	case n%100 >= 11 && n%100 <= 13:
+		return "th"
+	case n%10 == 1:
+		return "st"
+	case n%10 == 2:
+		return "nd"
+	case n%10 == 3:
+		return "rd"
+	default:
+		return "th"
+	}
+}
+
+func (ctx *evalContext) evalLimit(stmt *parser.SelectStatement) (int64, int64, error) {
+	limit, offset := int64(-1), int64(0)
+	for _, clause := range []struct {
+		expr parser.Expr
+		dst  *int64
+	}{{stmt.Limit, &limit}, {stmt.Offset, &offset}} {
+		if clause.expr == nil {
+			continue
+		}
+		v, err := ctx.Eval(clause.expr)
+		if err != nil {
+			return 0, 0, err
+		}
+		n, ok := applyAffinity(v, parser.AffinityInteger).(int64)
+		if !ok {
+			return 0, 0, errors.New("datatype mismatch")
+		}
+		*clause.dst = n
+	}
+	return limit, max(offset, 0), nil
+}
+
+// selectRows produces an output row for every source row matching WHERE
+func (db *DB) selectRows(ctx *evalContext, plan *selectPlan, stopAfter int64) ([]*outputRow, error) {
+	out := make([]*outputRow, 0)
+	err := db.scanSources(ctx, plan.join, func() (bool, error) {
+		row, err := ctx.outputRow(plan)
+		if err != nil {
+			return false, err
+		}
+		out = append(out, row)
+		return stopAfter < 0 || int64(len(out)) < stopAfter, nil
+	})
+	return out, err
+}
+
+// selectGroups runs the aggregates over each group of matching rows and
+// produces one output row per group passing HAVING
+func (db *DB) selectGroups(ctx *evalContext, plan *selectPlan) ([]*outputRow, error) {
+	stmt, groupBy, aggCalls := plan.stmt, plan.groupBy, plan.aggCalls
+	groups := make(map[string]*group)
+	order := make([]string, 0)
+
+	// Bare columns come from the first row of the group or, as in sqlite3,
+	// from the row holding the extreme value of the last min() or max()
+	extremeIdx := -1
+	for i, call := range aggCalls {
+		if call.Name == "min" || call.Name == "max" {
+			extremeIdx = i
+		}
+	}
+
+	newGroup := func() (*group, error) {
+		g := &group{aggs: make([]aggregator, len(aggCalls))}
+		for i, call := range aggCalls {
+			var err error
+			if g.aggs[i], err = db.newAggregator(call); err != nil {
+				return nil, err
+			}
+		}
+		return g, nil
+	}
+
+	err := db.scanSources(ctx, plan.join, func() (bool, error) {
+		var key strings.Builder
+		keys := make([]any, len(groupBy))
+		for i, e := range groupBy {
+			var err error
+			if keys[i], err = ctx.Eval(e); err != nil {
+				return false, err
+			}
+			coll, _ := exprCollation(e)
+			key.WriteString(collationKey(keys[i], coll))
+			key.WriteByte(0)
+		}
+
+		g, ok := groups[key.String()]
+		if !ok {
+			var err error
+			if g, err = newGroup(); err != nil {
+				return false, err
+			}
+			g.keys = keys
+			groups[key.String()] = g
+			order = append(order, key.String())
+		}
+
+		for i, call := range aggCalls {
+			args := make([]any, len(call.Args))
+			for j, arg := range call.Args {
+				var err error
+				if args[j], err = ctx.Eval(arg); err != nil {
+					return false, err
+				}
+			}
+
+			before := any(nil)
+			if i == extremeIdx {
+				before = g.aggs[i].Final()
+			}
+			if err := g.aggs[i].Step(args); err != nil {
+				return false, err
+			}
+			if i == extremeIdx && (g.rows == nil || record.CompareValues(before, g.aggs[i].Final(), db.binaryCollation) != 0) {
+				g.rows = slices.Clone(ctx.rows)
+			}
+		}
+		if extremeIdx < 0 && g.rows == nil {
+			g.rows = slices.Clone(ctx.rows)
+		}
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Groups come out in the order of their keys, as sqlite3 sorts them
+	if len(groupBy) > 0 {
+		terms := make([]*parser.OrderingTerm, len(groupBy))
+		for i := range terms {
+			terms[i] = &parser.OrderingTerm{}
+		}
+		compare, err := db.keyComparer(groupBy, terms)
+		if err != nil {
+			return nil, err
+		}
+		slices.SortStableFunc(order, func(a, b string) int {
+			return compare(groups[a].keys, groups[b].keys)
+		})
+	}
+
+	// Aggregating an empty input without GROUP BY still gives one row
+	if len(order) == 0 && len(groupBy) == 0 {
+		g, err := newGroup()
+		if err != nil {
+			return nil, err
+		}
+		groups[""] = g
+		order = append(order, "")
+	}
+
+	out := make([]*outputRow, 0, len(order))
+	for _, key := range order {
+		g := groups[key]
+		ctx.aggs = make(map[*parser.FuncCall]any, len(aggCalls))
+		for i, call := range aggCalls {
+			ctx.aggs[call] = g.aggs[i].Final()
+		}
+		ctx.rows = g.rows
+		if ctx.rows == nil {
+			ctx.rows = make([]*Row, len(plan.sources))
+		}
+
+		if stmt.Having != nil {
+			ok, err := ctx.EvalBool(stmt.Having)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				continue
+			}
+		}
+
+		row, err := ctx.outputRow(plan)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, row)
+	}
+	ctx.aggs = nil
+	return out, nil
+}
+
+// outputRow computes the output row for the current rows and aggregates.
+// A query with window functions keeps them for windowRows instead, as the
+// window functions need the other output rows.
+func (ctx *evalContext) outputRow(plan *selectPlan) (*outputRow, error) {
+	if len(plan.windows) > 0 {
+		row := &outputRow{rows: slices.Clone(ctx.rows), aggs: ctx.aggs}
+		if row.aggs == nil {
+			row.aggs = make(map[*parser.FuncCall]any)
+		}
+		return row, nil
+	}
+	row := &outputRow{}
+	return row, ctx.evalRow(plan, row)
+}
+
+// evalRow evaluates the result columns and ORDER BY terms of an output row
+func (ctx *evalContext) evalRow(plan *selectPlan, row *outputRow) error {
+	row.values, row.keys = make([]any, len(plan.exprs)), make([]any, len(plan.orderBy))
+	for i, e := range plan.exprs {
+		var err error
+		if row.values[i], err = ctx.Eval(e); err != nil {
+			return err
+		}
+	}
+	for i, e := range plan.orderBy {
+		var err error
+		if row.keys[i], err = ctx.Eval(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// findAggregate returns the first aggregate call in e, or nil
+func findAggregate(e parser.Expr) *parser.FuncCall {
+	var found *parser.FuncCall
+	walkExpr(e, func(e parser.Expr) error {
+		if call, ok := e.(*parser.FuncCall); ok && found == nil && isAggregate(call) {
+			found = call
+		}
+		return nil
+	})
+	return found
+}
+
+// collectAggregates lists the aggregate calls in exprs, rejecting aggregates
+// nested inside another aggregate's arguments
+func collectAggregates(exprs []parser.Expr) ([]*parser.FuncCall, error) {
+	calls := make([]*parser.FuncCall, 0)
+	for _, e := range exprs {
+		err := walkExpr(e, func(e parser.Expr) error {
+			call, ok := e.(*parser.FuncCall)
+			if !ok || !isAggregate(call) {
+				return nil
+			}
+			for _, arg := range call.Args {
+				if inner := findAggregate(arg); inner != nil {
+					return fmt.Errorf("misuse of aggregate function %s()", inner.Name)
+				}
+				if inner := findWindow(arg); inner != nil {
+					return fmt.Errorf("misuse of window function %s()", inner.Name)
+				}
+			}
+			if !slices.Contains(calls, call) {
+				calls = append(calls, call)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return calls, nil
+}
+
+// collationKey encodes a value so that values equal under the collation map
+// to the same key
+func collationKey(v any, coll string) string {
+	if s, ok := v.(string); ok {
+		switch strings.ToLower(coll) {
+		case "nocase":
+			return valueKey(asciiToLower(s))
+		case "rtrim":
+			return valueKey(strings.TrimRight(s, " "))
+		}
+	}
+	return valueKey(v)
+}
+
+func distinctRows(db *DB, rows []*outputRow, exprs []parser.Expr) ([]*outputRow, error) {
+	seen := make(map[string]bool)
+	out := rows[:0]
+	for _, row := range rows {
+		key := rowKey(row.values, exprs)
+		if !seen[key] {
+			seen[key] = true
+			out = append(out, row)
+		}
+	}
+	return out, nil
+}
+
+// rowKey returns a string equal for rows holding equal values under the
+// collations of the expressions giving them
+func rowKey(values []any, exprs []parser.Expr) string {
+	var key strings.Builder
+	for i, v := range values {
+		coll, _ := exprCollation(exprs[i])
+		key.WriteString(collationKey(v, coll))
+		key.WriteByte(0)
+	}
+	return key.String()
+}
+
+func sortRows(db *DB, rows []*outputRow, orderBy []parser.Expr, terms []*parser.OrderingTerm) error {
+	compare, err := db.rowComparer(orderBy, terms)
+	if err != nil {
+		return err
+	}
+	slices.SortStableFunc(rows, compare)
+	return nil
+}
+
+// rowComparer returns a function ordering rows by their sort keys
+func (db *DB) rowComparer(orderBy []parser.Expr, terms []*parser.OrderingTerm) (func(a, b *outputRow) int, error) {
+	compare, err := db.keyComparer(orderBy, terms)
+	if err != nil {
+		return nil, err
+	}
+	return func(a, b *outputRow) int {
+		return compare(a.keys, b.keys)
+	}, nil
+}
+
+// keyComparer returns a function ordering lists of sort key values
+func (db *DB) keyComparer(orderBy []parser.Expr, terms []*parser.OrderingTerm) (func(a, b []any) int, error) {
+	colls := make([]record.Collation, len(orderBy))
+	for i, e := range orderBy {
+		name, _ := exprCollation(e)
+		var err error
+		if colls[i], err = db.GetCollation(name); err != nil {
+			return nil, err
+		}
+	}
+
+	return func(a, b []any) int {
+		for i := range orderBy {
+			c := record.CompareValues(a[i], b[i], colls[i])
+			if terms[i].Desc {
+				c = -c
+			}
+			if c != 0 {
+				return c
+			}
+		}
+		return 0
+	}, nil
+}
+
+// ----------------------------------------------------------------------------
+
+// Scanning -------------------------------------------------------------------
+// scanSources calls visit with ctx.rows set to each combination of rows the
+// join plan produces, until visit returns false. Without sources there is a
+// single combination with no rows.
+func (db *DB) scanSources(ctx *evalContext, plan *joinPlan, visit func() (bool, error)) error {
+	for _, term := range plan.where {
+		ok, err := ctx.EvalBool(term)
+		if err != nil || !ok {
+			return err
+		}
+	}
+	_, err := db.scanLoops(ctx, plan.loops, visit)
+	return err
+}
+
+// scanLoops runs the outermost loop, running the loops inside it for each of
+// its rows that passes the filters. A LEFT JOIN loop whose condition matches
+// no row runs them once with its row set to nil, reading as NULLs.
+func (db *DB) scanLoops(ctx *evalContext, loops []*scanPlan, visit func() (bool, error)) (bool, error) {
+	if len(loops) == 0 {
+		return visit()
+	}
+	l := loops[0]
+	inner := func() (bool, error) {
+		for _, term := range l.filter {
+			ok, err := ctx.EvalBool(term)
+			if err != nil || !ok {
+				return err == nil, err
+			}
+		}
+		return db.scanLoops(ctx, loops[1:], visit)
+	}
+
+	matched, more := false, true
+	err := db.scanTable(ctx, l, func(row *Row) (bool, error) {
+		if err := db.interrupted(); err != nil {
+			return false, err
+		}
+		ctx.rows[l.src] = row
+		for _, term := range l.on {
+			ok, err := ctx.EvalBool(term)
+			if err != nil || !ok {
+				return err == nil, err
+			}
+		}
+		matched = true
+		var err error
+		more, err = inner()
+		return more, err
+	})
+	if err == nil && more && l.left && !matched {
+		ctx.rows[l.src] = nil
+		more, err = inner()
+	}
+	ctx.rows[l.src] = nil
+	return more, err
+}
+
+// scanTable reads the rows of a table chosen by the plan. Rows outside the
+// constraints may be read too, so the terms they come from are checked again.
+func (db *DB) scanTable(ctx *evalContext, plan *scanPlan, visit func(*Row) (bool, error)) error {
+	if plan.query != nil {
+		return ctx.scanSubquery(plan.query, visit)
+	}
+
+	table := plan.table
+	c := db.bt.NewCursor(table.PageNum)
+
+	switch {
+	case plan.index != nil:
+		return db.scanIndex(ctx, plan, func(rec *record.Record, rowID int64) (bool, error) {
+			if plan.covering {
+				return visit(indexRow(table, plan.index, rec, rowID))
+			}
+			found, err := c.SeekRowID(rowID)
+			if err != nil {
+				return false, err
+			}
+			if !found || int64(c.Cell().RowID) != rowID {
+				return false, pager.CorruptPage(table.PageNum, "index %s refers to missing row %d", plan.index.Name, rowID)
+			}
+			row, err := db.tableRow(table, c.Cell())
+			if err != nil {
+				return false, err
+			}
+			return visit(row)
+		})
+
+	case len(plan.eq) > 0:
+		v, err := ctx.constraintValue(plan.eq[0])
+		if err != nil {
+			return err
+		}
+		rowID, ok := applyAffinity(v, parser.AffinityInteger).(int64)
+		if !ok {
+			return nil
+		}
+		found, err := c.SeekRowID(rowID)
+		if err != nil || !found || int64(c.Cell().RowID) != rowID {
+			return err
+		}
+		row, err := db.tableRow(table, c.Cell())
+		if err != nil {
+			return err
+		}
+		_, err = visit(row)
+		return err
+	}
+
+	start, stop := int64(math.MinInt64), int64(math.MaxInt64)
+	for _, bound := range []struct {
+		c     *constraint
+		dst   *int64
+		lower bool
+	}{{plan.lower, &start, true}, {plan.upper, &stop, false}} {
+		if bound.c == nil {
+			continue
+		}
+		n, ok, err := ctx.rowIDBound(bound.c, bound.lower)
+		if err != nil || !ok {
+			return err
+		}
+		*bound.dst = n
+	}
+
+	ok, err := c.First()
+	if start != math.MinInt64 {
+		ok, err = c.SeekRowID(start)
+	}
+	for ; ok && err == nil; ok, err = c.Next() {
+		if int64(c.Cell().RowID) > stop {
+			return nil
+		}
+		row, err := db.tableRow(table, c.Cell())
+		if err != nil {
+			return err
+		}
+		if more, err := visit(row); err != nil || !more {
+			return err
+		}
+	}
+	return err
+}
+
+// scanSubquery reads the rows of a subquery in FROM, numbering them from 1
+// as their rowids. It runs in the query enclosing the one it is part of.
+func (ctx *evalContext) scanSubquery(query *selectPlan, visit func(*Row) (bool, error)) error {
+	if _, ok := ctx.results[query]; !ok && query.recursive > 0 {
+		return ctx.scanRecursive(query, visit)
+	}
+	result, err := ctx.runSubquery(query, ctx.outer, -1)
+	if err != nil {
+		return err
+	}
+	for i, values := range result.Rows {
+		more, err := visit(&Row{RowID: int64(i + 1), Values: values})
+		if err != nil || !more {
+			return err
+		}
+	}
+	return nil
+}
+
+// scanRecursive streams the rows of a recursive CTE in FROM, so that a
+// query stopping early, such as at its LIMIT, stops the recursion too, even
+// when it would never end. Rows read to the end are kept like those of
+// other subqueries.
+func (ctx *evalContext) scanRecursive(query *selectPlan, visit func(*Row) (bool, error)) error {
+	inner := &evalContext{
+		db:         ctx.db,
+		rows:       make([]*Row, len(query.sources)),
+		outer:      ctx.outer,
+		subqueries: query.subqueries,
+		results:    ctx.results,
+	}
+	limit, offset, err := inner.evalLimit(query.stmt)
+	if err != nil || limit == 0 {
+		return err
+	}
+
+	rows := make([][]any, 0)
+	skipped, stopped := int64(0), false
+	err = ctx.db.walkRecursive(inner, query, func(row *outputRow) (bool, error) {
+		if skipped < offset {
+			skipped++
+			return true, nil
+		}
+		rows = append(rows, row.values)
+		more, err := visit(&Row{RowID: int64(len(rows)), Values: row.values})
+		stopped = !more
+		return more && (limit < 0 || int64(len(rows)) < limit), err
+	})
+	if err == nil && !stopped && !query.correlated && ctx.results != nil {
+		ctx.results[query] = &Result{Columns: query.names, Types: query.types, Rows: rows}
+	}
+	return err
+}
+
+// scanIndex calls visit with each index entry, and its rowid, whose leading
+// columns equal the plan's eq constraints and whose next column is within
+// its bounds. Without constraints every entry is visited.
+func (db *DB) scanIndex(ctx *evalContext, plan *scanPlan, visit func(*record.Record, int64) (bool, error)) error {
+	colls, desc, err := db.IndexKeyOrder(plan.index)
+	if err != nil {
+		return err
+	}
+
+	key := make([]any, 0, len(plan.eq)+1)
+	for _, c := range plan.eq {
+		v, err := ctx.constraintValue(c)
+		if err != nil {
+			return err
+		}
+		if v == nil && c.op == "=" {
+			return nil
+		}
+		key = append(key, v)
+	}
+	prefix := len(key)
+
+	// The bounds swap places on a descending column
+	start, stop := plan.lower, plan.upper
+	if desc[prefix] {
+		start, stop = stop, start
+	}
+	var stopKey []any
+	for _, bound := range []*constraint{start, stop} {
+		if bound == nil {
+			continue
+		}
+		v, err := ctx.constraintValue(bound)
+		if err != nil || v == nil {
+			return err
+		}
+		if bound == start {
+			key = append(key, v)
+		} else {
+			stopKey = append(slices.Clone(key[:prefix]), v)
+		}
+	}
+
+	c := db.bt.NewCursor(plan.index.PageNum)
+	ok, err := c.SeekKey(func(rec *record.Record) int {
+		return record.CompareKey(rec, key, colls, desc)
+	})
+	for ; ok && err == nil; ok, err = c.Next() {
+		rec := c.Cell().Record
+		if record.CompareKey(rec, key[:prefix], colls, desc) != 0 {
+			return nil
+		}
+		if stopKey != nil && record.CompareKey(rec, stopKey, colls, desc) > 0 {
+			return nil
+		}
+		rowID, ok := rec.Value(len(rec.ColumnTypes) - 1).(int64)
+		if !ok {
+			return pager.CorruptPage(plan.index.PageNum, "index entry without rowid")
+		}
+		if more, err := visit(rec, rowID); err != nil || !more {
+			return err
+		}
+	}
+	return err
+}
+
+// indexRow makes a row from an index entry covering a query. It holds the
+// indexed columns and the rowid, leaving the columns the query does not
+// read NULL.
+func indexRow(table, index *Table, rec *record.Record, rowID int64) *Row {
+	row := &Row{RowID: rowID, Values: make([]any, len(table.Columns))}
+	for i, col := range index.IndexColumns {
+		if col.Col >= 0 {
+			row.Values[col.Col] = columnValue(rec.Value(i), table.Columns[col.Col])
+		}
+	}
+	if table.RowIDAlias >= 0 {
+		row.Values[table.RowIDAlias] = rowID
+	}
+	return row
+}
+
+// constraintValue evaluates the value side of a constraint, converted the
+// way the comparison converts it
+func (ctx *evalContext) constraintValue(c *constraint) (any, error) {
+	v, err := ctx.Eval(c.value)
+	if err != nil {
+		return nil, err
+	}
+	v, _ = applyComparisonAffinity(v, nil, exprAffinity(c.value), exprAffinity(c.column))
+	return v, nil
+}
+
+// rowIDBound evaluates a bound on the rowid as the integer to seek from or
+// stop at. ok is false when the bound is NULL and no row matches. A bound
+// that is not a number leaves the scan unbounded.
+func (ctx *evalContext) rowIDBound(c *constraint, lower bool) (int64, bool, error) {
+	v, err := ctx.Eval(c.value)
+	if err != nil || v == nil {
+		return 0, false, err
+	}
+	switch x := applyAffinity(v, parser.AffinityInteger).(type) {
+	case int64:
+		return x, true, nil
+	case float64:
+		switch {
+		case x >= math.MaxInt64:
+			return math.MaxInt64, true, nil
+		case x <= math.MinInt64:
+			return math.MinInt64, true, nil
+		case lower:
+			return int64(math.Floor(x)), true, nil
+		default:
+			return int64(math.Ceil(x)), true, nil
+		}
+	}
+	if lower {
+		return math.MinInt64, true, nil
+	}
+	return math.MaxInt64, true, nil
+}
+
+// tableRow decodes a table b-tree cell into a row of column values
+func (db *DB) tableRow(table *Table, cell *btree.Cell) (*Row, error) {
+	row := &Row{RowID: int64(cell.RowID), Values: make([]any, len(table.Columns))}
+	for i, col := range table.Columns {
+		switch {
+		case i == table.RowIDAlias:
+			row.Values[i] = row.RowID
+		case col.RecordIdx < 0:
+		case col.RecordIdx < len(cell.Record.ColumnTypes):
+			row.Values[i] = columnValue(cell.Record.Value(col.RecordIdx), col)
+		case col.Default != nil:
+			// Columns added by ALTER TABLE are missing from older records
+			v, err := (&evalContext{db: db}).Eval(col.Default)
+			if err != nil {
+				return nil, err
+			}
+			row.Values[i] = applyAffinity(v, col.Affinity)
+		}
+	}
+
+	return row, db.computeGeneratedColumns(table, row, false)
+}
+
+// columnValue converts a value read from a record to the type of its column.
+// A whole number in a REAL column is stored as an integer to save space.
+func columnValue(v any, col *Column) any {
+	if x, ok := v.(int64); ok && col.Affinity == parser.AffinityReal {
+		return float64(x)
+	}
+	return v
+}
+
+// computeGeneratedColumns evaluates the generated columns of a row in
+// declaration order, only those not stored in the record unless stored is set
+func (db *DB) computeGeneratedColumns(table *Table, row *Row, stored bool) error {
+	ctx := &evalContext{db: db, rows: []*Row{row}}
+	for i, col := range table.Columns {
+		if col.Generated == nil || (col.RecordIdx >= 0 && !stored) {
+			continue
+		}
+		v, err := ctx.Eval(col.Generated)
+		if err != nil {
+			return err
+		}
+		row.Values[i] = applyAffinity(v, col.Affinity)
+	}
+	return nil
+}
+
+// ----------------------------------------------------------------------------
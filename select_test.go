@@ -0,0 +1,32 @@
+package sqlite
+
+import "testing"
+
+// In groupSetup, x has groups that differ in case under NOCASE and y has
+// the minimum and maximum of each column on a different row
+const groupSetup = `
+create table x(c text collate nocase, n);
+insert into x values ('b', 1), ('B', 2), ('a', 3), ('A', 4), ('b', 5);
+create table y(c, n, m);
+insert into y values ('r1', 3, 9), ('r2', 5, 2), ('r3', 1, 7), ('r4', 4, 1);`
+
+func TestGroupBy(t *testing.T) {
+	runQueries(t, openTest(t, groupSetup), []sqlTest{
+		{"bare columns", "select c, n, count(*) from x group by c order by c", "a|3|2\nb|1|3\n"},
+		{"bare columns without group by", "select c, n, count(*) from x", "b|1|5\n"},
+		{"bare columns filtered", "select c, n, sum(n) from x where n > 1", "B|2|14\n"},
+		{"bare column with max", "select c, max(n) from x group by c order by c", "A|4\nb|5\n"},
+		{"bare column with min", "select c, min(n) from x group by c order by c", "a|3\nb|1\n"},
+		{"bare columns with two aggregates", "select c, n, min(n), max(n) from x group by c order by c", "A|4|3|4\nb|5|1|5\n"},
+		{"bare column with min and max", "select c, min(n), max(m) from y", "r1|1|9\n"},
+		{"bare column with max and min", "select c, max(m), min(n) from y", "r3|9|1\n"},
+		{"bare column with three extremes", "select c, min(n), count(*), max(n), min(m) from y", "r4|1|4|5|1\n"},
+		{"bare column with aggregates in an expression", "select c, max(n) + min(m) from y", "r4|6\n"},
+		{"bare column of no rows", "select c, max(n), min(m) from y where n > 100", "||\n"},
+		{"groups in key order", "select c, count(*) from x group by c", "a|2\nb|3\n"},
+		{"groups of an expression", "select n % 2, c from x group by n % 2", "0|B\n1|b\n"},
+		{"groups of two terms", "select n % 2, upper(c), count(*) from x group by upper(c), n % 2", "0|A|1\n1|A|1\n0|B|1\n1|B|2\n"},
+		{"groups with nulls and types", "select v, count(*) from (select 'b' v union all select 2 union all select null union all select 1.5 union all select x'41' union all select 'a' union all select 2) group by v", "|1\n1.5|1\n2|2\na|1\nb|1\nA|1\n"},
+		{"group having", "select c, sum(n) from x group by c having sum(n) > 7", "b|8\n"},
+	})
+}
@@ -0,0 +1,439 @@
+// Package sqldriver registers the reader as the "sqlitereader" driver of
+// database/sql. The data source name is a file path, optionally prefixed
+// with "file:" and followed by query parameters:
+//
+//	db, err := sql.Open("sqlitereader", "file.db?mode=ro")
+//
+// mode is ro to open the file read-only, rw to open an existing file for
+// writing or rwc, the default, to create it when missing. cache_size sets
+// the page cache budget in bytes, negative to disable the cache, and
+// mmap_size the bytes of the file to memory-map.
+//
+// Every connection of a *sql.DB shares one open database. While one of them
+// is in a transaction, statements on the others fail with ErrLocked.
+// Queries run to completion before returning, so *sql.Rows holds every row
+// of a result in memory.
+package sqldriver
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	sqlite "github.com/elordeiro/SQLite-DBReader"
+	"github.com/elordeiro/SQLite-DBReader/parser"
+)
+
+// Constants ------------------------------------------------------------------
+
+const DriverName = "sqlitereader"
+
+var ErrLocked = errors.New("database is locked")
+
+// ----------------------------------------------------------------------------
+
+// Custom Types ---------------------------------------------------------------
+type Driver struct{}
+
+// connector opens the database on the first connection and shares it with
+// the ones after
+type connector struct {
+	path string
+	opts *sqlite.Options
+
+	mu sync.Mutex // Held while a statement runs
+	db *sqlite.DB
+	tx *conn // Connection in a transaction
+}
+
+type conn struct {
+	c      *connector
+	closed bool
+}
+
+type stmt struct {
+	conn *conn
+	stmt *sqlite.Stmt
+}
+
+type tx struct {
+	conn *conn
+}
+
+type rows struct {
+	rows *sqlite.Rows
+}
+
+// ----------------------------------------------------------------------------
+
+func init() {
+	sql.Register(DriverName, &Driver{})
+}
+
+// Driver ---------------------------------------------------------------------
+func (d *Driver) Open(name string) (driver.Conn, error) {
+	c, err := d.OpenConnector(name)
+	if err != nil {
+		return nil, err
+	}
+	return c.Connect(context.Background())
+}
+
+func (d *Driver) OpenConnector(name string) (driver.Connector, error) {
+	path, opts, err := parseDSN(name)
+	if err != nil {
+		return nil, err
+	}
+	return &connector{path: path, opts: opts}, nil
+}
+
+// parseDSN splits a data source name into the file path and the options
+func parseDSN(name string) (string, *sqlite.Options, error) {
+	path, query, _ := strings.Cut(strings.TrimPrefix(name, "file:"), "?")
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid data source name %q: %w", name, err)
+	}
+
+	opts := sqlite.DefaultOptions()
+	for key, values := range params {
+		value := values[len(values)-1]
+		switch key {
+		case "mode":
+			switch value {
+			case "ro":
+				opts.ReadOnly = true
+			case "rw":
+				if _, err := os.Stat(path); err != nil {
+					return "", nil, err
+				}
+			case "rwc":
+			default:
+				return "", nil, fmt.Errorf("no such access mode: %s", value)
+			}
+		case "cache_size", "mmap_size":
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || (n < 0 && key == "mmap_size") {
+				return "", nil, fmt.Errorf("invalid %s: %s", key, value)
+			}
+			if key == "cache_size" {
+				opts.CacheSize = n
+			} else {
+				opts.MmapSize = n
+			}
+		default:
+			return "", nil, fmt.Errorf("no such option: %s", key)
+		}
+	}
+	return path, opts, nil
+}
+
+// ----------------------------------------------------------------------------
+
+// Connector ------------------------------------------------------------------
+func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.db == nil {
+		db, err := sqlite.Open(c.path, c.opts)
+		if err != nil {
+			return nil, err
+		}
+		c.db = db
+	}
+	return &conn{c: c}, nil
+}
+
+func (c *connector) Driver() driver.Driver {
+	return &Driver{}
+}
+
+// Close closes the database, called by sql.DB.Close
+func (c *connector) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.db == nil {
+		return nil
+	}
+	err := c.db.Close()
+	c.db = nil
+	return err
+}
+
+// ----------------------------------------------------------------------------
+
+// Conn -----------------------------------------------------------------------
+func (cn *conn) Prepare(query string) (driver.Stmt, error) {
+	return cn.PrepareContext(context.Background(), query)
+}
+
+// PrepareContext parses the statements once, and the statement keeps the
+// plans of its SELECTs between runs
+func (cn *conn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if err := cn.lock(); err != nil {
+		return nil, err
+	}
+	defer cn.c.mu.Unlock()
+	s, err := cn.c.db.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	return &stmt{conn: cn, stmt: s}, nil
+}
+
+// Close rolls back a transaction left open
+func (cn *conn) Close() error {
+	if cn.closed {
+		return nil
+	}
+	cn.closed = true
+	cn.c.mu.Lock()
+	defer cn.c.mu.Unlock()
+	if cn.c.tx == cn {
+		cn.c.tx = nil
+		_, err := cn.c.db.Exec(context.Background(), "ROLLBACK")
+		return err
+	}
+	return nil
+}
+
+func (cn *conn) Begin() (driver.Tx, error) {
+	return cn.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (cn *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if sql.IsolationLevel(opts.Isolation) != sql.LevelDefault {
+		return nil, errors.New("isolation levels are not supported")
+	}
+	if err := cn.lock(); err != nil {
+		return nil, err
+	}
+	defer cn.c.mu.Unlock()
+	if _, err := cn.c.db.Exec(ctx, "BEGIN"); err != nil {
+		return nil, err
+	}
+	// Set before the lock is let go, so no other connection runs a
+	// statement inside the transaction
+	cn.c.tx = cn
+	return &tx{conn: cn}, nil
+}
+
+func (cn *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if err := cn.lock(); err != nil {
+		return nil, err
+	}
+	defer cn.c.mu.Unlock()
+	r, err := cn.c.db.Query(ctx, query, namedArgs(args)...)
+	if err != nil {
+		return nil, err
+	}
+	return &rows{rows: r}, nil
+}
+
+// query runs a prepared statement
+func (cn *conn) query(ctx context.Context, s *sqlite.Stmt, args []driver.NamedValue) (driver.Rows, error) {
+	if err := cn.lock(); err != nil {
+		return nil, err
+	}
+	defer cn.c.mu.Unlock()
+	r, err := s.Query(ctx, namedArgs(args)...)
+	if err != nil {
+		return nil, err
+	}
+	return &rows{rows: r}, nil
+}
+
+func (cn *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return cn.exec(ctx, query, args)
+}
+
+func (cn *conn) exec(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if err := cn.lock(); err != nil {
+		return nil, err
+	}
+	defer cn.c.mu.Unlock()
+	result, err := cn.c.db.Exec(ctx, query, namedArgs(args)...)
+	if err != nil {
+		return nil, err
+	}
+	return execResult{rowsAffected: result.RowsAffected, lastInsertID: cn.c.db.LastInsertRowID()}, nil
+}
+
+// execStmt runs a prepared statement
+func (cn *conn) execStmt(ctx context.Context, s *sqlite.Stmt, args []driver.NamedValue) (driver.Result, error) {
+	if err := cn.lock(); err != nil {
+		return nil, err
+	}
+	defer cn.c.mu.Unlock()
+	result, err := s.Exec(ctx, namedArgs(args)...)
+	if err != nil {
+		return nil, err
+	}
+	return execResult{rowsAffected: result.RowsAffected, lastInsertID: cn.c.db.LastInsertRowID()}, nil
+}
+
+// lock takes the database for a statement, failing while another
+// connection is in a transaction
+func (cn *conn) lock() error {
+	if cn.closed {
+		return driver.ErrBadConn
+	}
+	cn.c.mu.Lock()
+	if cn.c.tx != nil && cn.c.tx != cn {
+		cn.c.mu.Unlock()
+		return ErrLocked
+	}
+	return nil
+}
+
+// namedArgs passes the arguments on in ordinal order, binding the ones given
+// with sql.Named by name. The others bind the parameters not bound by name,
+// so in "select :a, ?" the second argument binds ?2.
+func namedArgs(args []driver.NamedValue) []any {
+	values := make([]any, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+		if arg.Name != "" {
+			values[i] = sqlite.Named(arg.Name, arg.Value)
+		}
+	}
+	return values
+}
+
+type execResult struct {
+	rowsAffected int64
+	lastInsertID int64
+}
+
+func (r execResult) LastInsertId() (int64, error) {
+	return r.lastInsertID, nil
+}
+
+func (r execResult) RowsAffected() (int64, error) {
+	return r.rowsAffected, nil
+}
+
+// ----------------------------------------------------------------------------
+
+// Tx -------------------------------------------------------------------------
+func (t *tx) Commit() error {
+	return t.end("COMMIT")
+}
+
+func (t *tx) Rollback() error {
+	return t.end("ROLLBACK")
+}
+
+// end runs COMMIT or ROLLBACK and lets other connections have the database
+func (t *tx) end(command string) error {
+	cn := t.conn
+	if err := cn.lock(); err != nil {
+		return err
+	}
+	defer cn.c.mu.Unlock()
+	if cn.c.tx != cn {
+		return sql.ErrTxDone
+	}
+	cn.c.tx = nil
+	_, err := cn.c.db.Exec(context.Background(), command)
+	return err
+}
+
+// ----------------------------------------------------------------------------
+
+// Stmt -----------------------------------------------------------------------
+func (s *stmt) Close() error {
+	return s.stmt.Close()
+}
+
+func (s *stmt) NumInput() int {
+	return s.stmt.NumParams()
+}
+
+func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.ExecContext(context.Background(), valueArgs(args))
+}
+
+func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.QueryContext(context.Background(), valueArgs(args))
+}
+
+func (s *stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	return s.conn.execStmt(ctx, s.stmt, args)
+}
+
+func (s *stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	return s.conn.query(ctx, s.stmt, args)
+}
+
+func valueArgs(args []driver.Value) []driver.NamedValue {
+	named := make([]driver.NamedValue, len(args))
+	for i, v := range args {
+		named[i] = driver.NamedValue{Ordinal: i + 1, Value: v}
+	}
+	return named
+}
+
+// ----------------------------------------------------------------------------
+
+// Rows -----------------------------------------------------------------------
+func (r *rows) Columns() []string {
+	return r.rows.Columns()
+}
+
+func (r *rows) Close() error {
+	return r.rows.Close()
+}
+
+func (r *rows) Next(dest []driver.Value) error {
+	if !r.rows.Next() {
+		return io.EOF
+	}
+	for i, v := range r.rows.Values() {
+		dest[i] = v
+	}
+	return nil
+}
+
+// ColumnTypeDatabaseTypeName returns the declared type of a column read from
+// a table, in upper case, and "" for expressions
+func (r *rows) ColumnTypeDatabaseTypeName(index int) string {
+	return strings.ToUpper(r.rows.ColumnTypes()[index].DeclType)
+}
+
+func (r *rows) ColumnTypeNullable(index int) (nullable, ok bool) {
+	t := r.rows.ColumnTypes()[index]
+	return t.Nullable, t.Known
+}
+
+// ColumnTypeScanType follows the affinity of the declared type. Values of
+// columns without one may be of any type.
+func (r *rows) ColumnTypeScanType(index int) reflect.Type {
+	t := r.rows.ColumnTypes()[index]
+	if t.Known {
+		switch parser.TypeAffinity(t.DeclType) {
+		case parser.AffinityInteger:
+			return reflect.TypeFor[int64]()
+		case parser.AffinityReal:
+			return reflect.TypeFor[float64]()
+		case parser.AffinityText:
+			return reflect.TypeFor[string]()
+		case parser.AffinityBlob:
+			if t.DeclType != "" {
+				return reflect.TypeFor[[]byte]()
+			}
+		}
+	}
+	return reflect.TypeFor[any]()
+}
+
+// ----------------------------------------------------------------------------
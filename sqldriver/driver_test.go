@@ -0,0 +1,319 @@
+package sqldriver
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/elordeiro/SQLite-DBReader/pager"
+)
+
+func openTest(t *testing.T, dsn string) *sql.DB {
+	t.Helper()
+	db, err := sql.Open(DriverName, filepath.Join(t.TempDir(), "test.db")+dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func exec(t *testing.T, db *sql.DB, query string, args ...any) sql.Result {
+	t.Helper()
+	result, err := db.Exec(query, args...)
+	if err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+	return result
+}
+
+func TestDriver(t *testing.T) {
+	db := openTest(t, "")
+	exec(t, db, "create table t(id integer primary key, name text not null, score real)")
+
+	result := exec(t, db, "insert into t(name, score) values (?, ?), (?, ?)", "a", 1.5, "b", nil)
+	if n, _ := result.RowsAffected(); n != 2 {
+		t.Errorf("rows affected: got %d, want 2", n)
+	}
+	if id, _ := result.LastInsertId(); id != 2 {
+		t.Errorf("last insert id: got %d, want 2", id)
+	}
+	exec(t, db, "insert into t(name, score) values (:name, $score)", sql.Named("score", 3), sql.Named("name", "c"))
+
+	var a, b int64
+	if err := db.QueryRow("select :a, ?", sql.Named("a", 5), 6).Scan(&a, &b); err != nil || a != 5 || b != 6 {
+		t.Errorf("named then positional: got %d, %d, %v, want 5, 6", a, b, err)
+	}
+
+	rows, err := db.Query("select id, name, score from t where id >= ? order by id", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var got []string
+	for rows.Next() {
+		var id int64
+		var name string
+		var score sql.NullFloat64
+		if err := rows.Scan(&id, &name, &score); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, name)
+		if name == "b" && score.Valid {
+			t.Errorf("NULL score scanned as %v", score.Float64)
+		}
+		if name == "c" && score.Float64 != 3 {
+			t.Errorf("score of c: got %v, want 3.0", score.Float64)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a", "b", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestDriverColumnTypes(t *testing.T) {
+	db := openTest(t, "")
+	exec(t, db, "create table t(id integer primary key, name text not null, score real, data blob, n numeric, x)")
+	rows, err := db.Query("select id, name, score, data, n, x, id + 1 from t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		name     string
+		nullable bool
+		ok       bool
+		scanType reflect.Type
+	}{
+		{"INTEGER", false, true, reflect.TypeFor[int64]()},
+		{"TEXT", false, true, reflect.TypeFor[string]()},
+		{"REAL", true, true, reflect.TypeFor[float64]()},
+		{"BLOB", true, true, reflect.TypeFor[[]byte]()},
+		{"NUMERIC", true, true, reflect.TypeFor[any]()},
+		{"", true, true, reflect.TypeFor[any]()},
+		{"", false, false, reflect.TypeFor[any]()},
+	}
+	for i, ct := range types {
+		nullable, ok := ct.Nullable()
+		if ct.DatabaseTypeName() != want[i].name || nullable != want[i].nullable || ok != want[i].ok || ct.ScanType() != want[i].scanType {
+			t.Errorf("%s: got %q, %v, %v, %v, want %+v", ct.Name(), ct.DatabaseTypeName(), nullable, ok, ct.ScanType(), want[i])
+		}
+	}
+}
+
+func TestDriverTx(t *testing.T) {
+	db := openTest(t, "")
+	exec(t, db, "create table t(a)")
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Exec("insert into t values (1)"); err != nil {
+		t.Fatal(err)
+	}
+	// Other connections are locked out until the transaction ends
+	if _, err := db.Exec("insert into t values (2)"); !errors.Is(err, ErrLocked) {
+		t.Errorf("write outside the transaction: got %v, want %v", err, ErrLocked)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); !errors.Is(err, sql.ErrTxDone) {
+		t.Errorf("commit after rollback: got %v, want %v", err, sql.ErrTxDone)
+	}
+
+	tx, err = db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Exec("insert into t values (3)"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	var sum int
+	if err := db.QueryRow("select sum(a) from t").Scan(&sum); err != nil || sum != 3 {
+		t.Errorf("got %d, %v, want 3", sum, err)
+	}
+}
+
+// TestDriverTwoPools opens the same file in two pools, which do not share
+// a database, and checks their transactions still lock each other out
+func TestDriverTwoPools(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	a, err := sql.Open(DriverName, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	b, err := sql.Open(DriverName, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	exec(t, a, "create table t(a)")
+	exec(t, a, "insert into t values (1)")
+
+	tx, err := a.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Exec("update t set a = a * 10"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Exec("insert into t values (5)"); !errors.Is(err, pager.ErrBusy) {
+		t.Errorf("write during the other pool's transaction: got %v, want %v", err, pager.ErrBusy)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	var sum int
+	if err := b.QueryRow("select sum(a) from t").Scan(&sum); err != nil || sum != 10 {
+		t.Errorf("got %d, %v, want 10", sum, err)
+	}
+}
+
+// TestDriverConcurrentTx runs transactions from many goroutines, each
+// retrying while another holds the database
+func TestDriverConcurrentTx(t *testing.T) {
+	db := openTest(t, "")
+	exec(t, db, "create table t(a)")
+
+	const goroutines, inserts = 8, 20
+	var wg sync.WaitGroup
+	errs := make(chan error, goroutines)
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < inserts; {
+				tx, err := db.Begin()
+				if errors.Is(err, ErrLocked) {
+					continue
+				}
+				if err != nil {
+					errs <- err
+					return
+				}
+				_, err = tx.Exec("insert into t values (1)")
+				if errors.Is(err, ErrLocked) {
+					errs <- errors.New("statement locked out of its own transaction")
+					return
+				}
+				if err == nil {
+					err = tx.Commit()
+				}
+				if err != nil {
+					errs <- err
+					return
+				}
+				i++
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	var n int
+	if err := db.QueryRow("select count(*) from t").Scan(&n); err != nil || n != goroutines*inserts {
+		t.Errorf("got %d rows, %v, want %d", n, err, goroutines*inserts)
+	}
+}
+
+func TestDriverPrepare(t *testing.T) {
+	db := openTest(t, "")
+	exec(t, db, "create table t(a, b)")
+	stmt, err := db.Prepare("insert into t values (?, ?)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stmt.Close()
+	for i := 0; i < 3; i++ {
+		if _, err := stmt.Exec(i, i*i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	query, err := db.Prepare("select sum(b) from t where a >= ?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer query.Close()
+	var sum int
+	if err := query.QueryRow(1).Scan(&sum); err != nil || sum != 5 {
+		t.Errorf("got %d, %v, want 5", sum, err)
+	}
+	// The schema changing under the statement makes it plan again
+	exec(t, db, "create index t_a on t(a)")
+	if err := query.QueryRow(2).Scan(&sum); err != nil || sum != 4 {
+		t.Errorf("after schema change: got %d, %v, want 4", sum, err)
+	}
+}
+
+func TestParseDSN(t *testing.T) {
+	dir := t.TempDir()
+	missing := filepath.Join(dir, "missing.db")
+	tests := []struct {
+		dsn       string
+		readOnly  bool
+		cacheSize int64
+		mmapSize  int64
+		err       string
+	}{
+		{dsn: missing, cacheSize: pager.DefaultCacheSize},
+		{dsn: "file:" + missing + "?mode=ro", readOnly: true, cacheSize: pager.DefaultCacheSize},
+		{dsn: missing + "?mode=rwc&cache_size=-1&mmap_size=4096", cacheSize: -1, mmapSize: 4096},
+		{dsn: missing + "?mode=rw", err: "stat " + missing + ": no such file or directory"},
+		{dsn: missing + "?mode=x", err: "no such access mode: x"},
+		{dsn: missing + "?mmap_size=-1", err: "invalid mmap_size: -1"},
+		{dsn: missing + "?cache_size=big", err: "invalid cache_size: big"},
+		{dsn: missing + "?foo=1", err: "no such option: foo"},
+	}
+	for _, tt := range tests {
+		path, opts, err := parseDSN(tt.dsn)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("%s: got error %v, want %s", tt.dsn, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.dsn, err)
+			continue
+		}
+		if path != missing || opts.ReadOnly != tt.readOnly || opts.CacheSize != tt.cacheSize || opts.MmapSize != tt.mmapSize {
+			t.Errorf("%s: got %s, %+v", tt.dsn, path, opts)
+		}
+	}
+	if _, err := os.Stat(missing); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("parsing created the file: %v", err)
+	}
+}
+
+// TestDriverContext checks that a statement stops once its context is done
+func TestDriverContext(t *testing.T) {
+	db := openTest(t, "")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := db.QueryContext(ctx, "select 1"); !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want %v", err, context.Canceled)
+	}
+}
@@ -0,0 +1,474 @@
+// Package sqlite reads and writes SQLite database files without cgo. Open a
+// file with Open, then run SQL with Query, Exec or Execute.
+package sqlite
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/elordeiro/SQLite-DBReader/btree"
+	"github.com/elordeiro/SQLite-DBReader/pager"
+	"github.com/elordeiro/SQLite-DBReader/parser"
+	"github.com/elordeiro/SQLite-DBReader/record"
+)
+
+const (
+	HeaderMagic  = "SQLite format 3\x00"
+	MaxHeaderLen = 12
+
+	DefaultPageSize     = 4096    // Page size of new databases
+	SQLiteVersionNumber = 3050002 // Written to the header of new databases
+)
+
+const (
+	TableTypeTable = iota
+	TableTypeIndex
+	TableTypeView
+	TableTypeTrigger
+)
+
+// Schema Constants -----------------------------------------------------------
+/*
+CREATE TABLE sqlite_schema(
+	type text,        -> Idx 0
+	name text,        -> Idx 1
+	tbl_name text,    -> Idx 2
+	rootpage integer, -> Idx 3
+	sql text          -> Idx 4
+);
+*/
+
+const (
+	SchemaTypeIdx     = 0
+	SchemaNameIdx     = 1
+	SchemaTblNameIdx  = 2
+	SchemaRootPageIdx = 3
+	SchemaTextIdx     = 4
+)
+
+// ----------------------------------------------------------------------------
+
+// Custom Types ---------------------------------------------------------------
+
+// Options configure how a database file is read, see pager.Options
+type Options = pager.Options
+
+// DB is an open database file
+type DB struct {
+	path          string
+	bt            *btree.BTree
+	tables        []*Table
+	schemaVersion int64 // Counts schema reloads, so plans can tell they are stale
+	planStats     *planStats
+	statsVersion  int64 // Schema version planStats was read at
+
+	params          []any           // Values bound to the parameters of the running statement
+	ctx             context.Context // Context of the running statement, nil for none
+	changes         int64           // Rows changed by the last INSERT
+	lastInsertRowID int64
+	inTransaction   bool // Started by BEGIN
+}
+
+type Table struct {
+	Type     int
+	Name     string
+	TblName  string // Table an index belongs to
+	PageNum  int64
+	SQL      string
+	ColNames []string
+
+	// Tables
+	Columns       []*Column
+	RowIDAlias    int // Column aliasing the rowid, -1 when there is none
+	Autoincrement bool
+	WithoutRowID  bool
+	Virtual       bool
+
+	// Indexes
+	IndexColumns []*IndexColumn
+	Unique       bool
+	Where        parser.Expr // Condition of a partial index
+
+	uniqueConstraints []*uniqueConstraint
+}
+
+// ----------------------------------------------------------------------------
+
+// DefaultOptions returns the options Open uses when given nil
+func DefaultOptions() *Options {
+	return pager.DefaultOptions()
+}
+
+func Open(databaseFilePath string, opts *Options) (*DB, error) {
+	if opts == nil {
+		opts = pager.DefaultOptions()
+	}
+
+	// Open database file, falling back to read-only when it is not
+	// writable. A missing file is only created once something is written.
+	flag := os.O_RDWR
+	if opts.ReadOnly {
+		flag = os.O_RDONLY
+	}
+	vfs := opts.GetVFS()
+	databaseFile, err := vfs.OpenFile(databaseFilePath, flag, 0644)
+	if err != nil && !opts.ReadOnly && errors.Is(err, os.ErrNotExist) {
+		databaseFile, err = pager.NewLazyFile(vfs, databaseFilePath), nil
+	}
+	if err != nil && !opts.ReadOnly && errors.Is(err, os.ErrPermission) {
+		readOnly := *opts
+		readOnly.ReadOnly = true
+		opts = &readOnly
+		databaseFile, err = vfs.OpenFile(databaseFilePath, os.O_RDONLY, 0)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// The header and schema are read under a SHARED lock, which rolls back
+	// a journal left by a writer that never committed
+	journalPath := databaseFilePath + "-journal"
+	err = pager.LockShared(vfs, databaseFile, journalPath, opts.ReadOnly)
+	if err != nil {
+		databaseFile.Close()
+		return nil, err
+	}
+
+	db, err := openSQLite(databaseFile, journalPath, opts)
+	if err != nil {
+		databaseFile.Close()
+		return nil, err
+	}
+	db.path = databaseFilePath
+
+	// Statements take their own locks
+	if err := databaseFile.Unlock(pager.NoLock); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// initDatabase writes the first page of an empty database file
+func initDatabase(file pager.File, pageSize int64, reserved uint8, encoding record.TextEncoding) error {
+	info, err := file.Stat()
+	if err != nil || info.Size() > 0 {
+		return err
+	}
+
+	// Another process may be creating the database at the same time
+	if err := file.Lock(pager.ReservedLock); err != nil {
+		return err
+	}
+	if err := file.Lock(pager.ExclusiveLock); err != nil {
+		file.Unlock(pager.SharedLock)
+		return err
+	}
+	defer file.Unlock(pager.SharedLock)
+	if info, err = file.Stat(); err != nil || info.Size() > 0 {
+		return err
+	}
+
+	page := make([]byte, pageSize)
+	initHeader(page, reserved, encoding)
+	if _, err := file.WriteAt(page, 0); err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+// initHeader lays out the first page of a new database: the header followed
+// by the empty sqlite_schema b-tree
+func initHeader(page []byte, reserved uint8, encoding record.TextEncoding) {
+	pageSize := len(page)
+	copy(page, HeaderMagic)
+	if pageSize == 65536 {
+		binary.BigEndian.PutUint16(page[16:], 1)
+	} else {
+		binary.BigEndian.PutUint16(page[16:], uint16(pageSize))
+	}
+	page[18], page[19] = 1, 1                 // Legacy file format versions
+	page[20] = reserved                       // Reserved space at the end of each page
+	page[21], page[22], page[23] = 64, 32, 32 // Payload fractions
+	binary.BigEndian.PutUint32(page[24:], 1)  // File change counter
+	binary.BigEndian.PutUint32(page[28:], 1)  // Database size in pages
+	binary.BigEndian.PutUint32(page[44:], 4)  // Schema format
+	binary.BigEndian.PutUint32(page[56:], uint32(encoding))
+	binary.BigEndian.PutUint32(page[92:], 1) // Version-valid-for
+	binary.BigEndian.PutUint32(page[96:], SQLiteVersionNumber)
+
+	page[100] = btree.LeafTablePage
+	binary.BigEndian.PutUint16(page[105:], uint16(pageSize-int(reserved)))
+}
+
+func openSQLite(databaseFile pager.File, journalPath string, opts *Options) (*DB, error) {
+	// An empty file is a database with nothing stored yet, which gets the
+	// header of a new one on its first write
+	info, err := databaseFile.Stat()
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, DefaultPageSize)
+	if info.Size() == 0 {
+		initHeader(header, 0, record.TextEncodingUTF8)
+	} else if _, err := databaseFile.ReadAt(header[:100], 0); err != nil || string(header[:16]) != HeaderMagic {
+		return nil, pager.ErrNotADB
+	}
+
+	// Read page size
+	var pageSize uint16
+	err = binary.Read(bytes.NewReader(header[16:18]), binary.BigEndian, &pageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	// A page size of 1 represents 65536
+	realPageSize := int64(pageSize)
+	if pageSize == 1 {
+		realPageSize = 65536
+	}
+	if realPageSize < 512 || realPageSize&(realPageSize-1) != 0 {
+		return nil, pager.ErrNotADB
+	}
+
+	// Read reserved space at the end of each page
+	usableSize := realPageSize - int64(header[20])
+	if usableSize < 480 {
+		return nil, pager.ErrNotADB
+	}
+
+	// Read text encoding
+	var encoding uint32
+	err = binary.Read(bytes.NewReader(header[56:60]), binary.BigEndian, &encoding)
+	if err != nil {
+		return nil, err
+	}
+	switch record.TextEncoding(encoding) {
+	case record.TextEncodingUTF8, record.TextEncodingUTF16le, record.TextEncodingUTF16be:
+	case 0:
+		encoding = uint32(record.TextEncodingUTF8)
+	default:
+		return nil, pager.ErrNotADB
+	}
+
+	p, err := pager.NewPager(databaseFile, journalPath, realPageSize, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	db := &DB{
+		bt: &btree.BTree{
+			Pager:        p,
+			PageSize:     realPageSize,
+			UsableSize:   usableSize,
+			Encoding:     record.TextEncoding(encoding),
+			SchemaFormat: binary.BigEndian.Uint32(header[44:48]),
+		},
+	}
+
+	// A nonzero largest root page marks an auto-vacuum database. Writes
+	// are refused, since they would leave its pointer map out of date.
+	if binary.BigEndian.Uint32(header[52:56]) != 0 {
+		db.bt.AutoVacuum = btree.AutoVacuumFull
+		if binary.BigEndian.Uint32(header[64:68]) != 0 {
+			db.bt.AutoVacuum = btree.AutoVacuumIncremental
+		}
+		p.SetReadOnly()
+	}
+	p.OnCreate(func(page []byte) {
+		initHeader(page, 0, db.bt.Encoding)
+	})
+
+	db.tables, err = db.ParseSQLiteSchema()
+	if err != nil {
+		p.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+func parseTableType(typ []uint8) int {
+	switch string(typ) {
+	case "table":
+		return TableTypeTable
+	case "index":
+		return TableTypeIndex
+	case "view":
+		return TableTypeView
+	case "trigger":
+		return TableTypeTrigger
+	default:
+		return 0
+	}
+}
+
+func (db *DB) ParseSQLiteSchema() ([]*Table, error) {
+	if db.bt.Pager.PageCount() == 0 {
+		return make([]*Table, 0), nil
+	}
+	schemaPage, err := db.bt.ParseTablePage(1)
+	if err != nil {
+		return nil, err
+	}
+
+	tables := make([]*Table, 0)
+	for _, cell := range schemaPage.GetLeafCells() {
+		keys := cell.Record.Keys
+		if len(keys) <= SchemaTextIdx {
+			return nil, fmt.Errorf("%w: malformed database schema", pager.ErrCorrupt)
+		}
+
+		rootPage, _ := cell.Record.Value(SchemaRootPageIdx).(int64)
+		table := &Table{
+			Type:       parseTableType(keys[SchemaTypeIdx]),
+			Name:       string(keys[SchemaNameIdx]),
+			TblName:    string(keys[SchemaTblNameIdx]),
+			PageNum:    rootPage,
+			RowIDAlias: -1,
+		}
+
+		// Views and triggers have no columns, automatic indexes have no SQL
+		if sql, ok := cell.Record.Value(SchemaTextIdx).(string); ok {
+			table.SQL = sql
+		}
+		if table.Type == TableTypeTable && table.SQL != "" {
+			if fields := strings.Fields(table.SQL); len(fields) > 1 && strings.EqualFold(fields[1], "VIRTUAL") {
+				table.Virtual = true
+			} else if err := table.parseTableSchema(); err != nil {
+				return nil, fmt.Errorf("%w: malformed database schema (%s) - %v", pager.ErrCorrupt, table.Name, err)
+			}
+		}
+
+		// Append cell record to tables
+		tables = append(tables, table)
+	}
+
+	// Indexes refer to the columns of their table
+	db.tables = tables
+	for _, table := range tables {
+		if table.Type != TableTypeIndex {
+			continue
+		}
+		if err := db.parseIndexSchema(table); err != nil {
+			return nil, fmt.Errorf("%w: malformed database schema (%s) - %v", pager.ErrCorrupt, table.Name, err)
+		}
+	}
+
+	return tables, nil
+}
+
+func (db *DB) Close() error {
+	return db.bt.Pager.Close()
+}
+
+// commit updates the header of a modified database and writes the changes
+func (db *DB) commit() error {
+	if !db.bt.Pager.IsDirty() {
+		return nil
+	}
+
+	header, err := db.bt.Pager.WritablePage(1)
+	if err != nil {
+		return err
+	}
+	counter := binary.BigEndian.Uint32(header[24:]) + 1
+	binary.BigEndian.PutUint32(header[24:], counter)
+	binary.BigEndian.PutUint32(header[28:], uint32(db.bt.Pager.PageCount()))
+	binary.BigEndian.PutUint32(header[92:], counter)
+
+	return db.bt.Pager.Commit()
+}
+
+// lock takes the SHARED lock a statement reads under. The schema is read
+// again when another process changed the database since the last one.
+func (db *DB) lock() error {
+	changed, err := db.bt.Pager.Lock()
+	if err != nil || !changed {
+		return err
+	}
+	return db.reloadSchema()
+}
+
+// unlock releases the lock taken by lock, unless a transaction is open
+func (db *DB) unlock() {
+	if !db.inTransaction {
+		db.bt.Pager.Unlock()
+	}
+}
+
+// readLock takes a SHARED lock for reading outside of a statement. The
+// returned function releases it, unless the lock was already held.
+func (db *DB) readLock() (func(), error) {
+	if db.bt.Pager.Locked() {
+		return func() {}, nil
+	}
+	if err := db.lock(); err != nil {
+		return nil, err
+	}
+	return db.unlock, nil
+}
+
+// interrupted returns the error of the running statement's context once it
+// is canceled. Loops reading rows check it, so that a runaway query stops.
+func (db *DB) interrupted() error {
+	if db.ctx == nil {
+		return nil
+	}
+	return db.ctx.Err()
+}
+
+// rollback drops the changes of a failed statement or transaction
+func (db *DB) rollback() error {
+	if err := db.bt.Pager.Rollback(); err != nil {
+		return err
+	}
+	return db.reloadSchema()
+}
+
+// rollbackStatement drops the changes of a statement that failed inside a
+// transaction
+func (db *DB) rollbackStatement() error {
+	db.bt.Pager.RollbackStatement()
+	return db.reloadSchema()
+}
+
+// Getters --------------------------------------------------------------------
+func (db *DB) GetPageSize() int {
+	return int(db.bt.PageSize)
+}
+
+func (db *DB) GetCacheStats() pager.CacheStats {
+	return db.bt.Pager.CacheStats()
+}
+
+// LastInsertRowID returns the rowid of the last row inserted
+func (db *DB) LastInsertRowID() int64 {
+	return db.lastInsertRowID
+}
+
+func (db *DB) GetTableCount() int {
+	return len(db.tables)
+}
+
+// Schema returns the tables, indexes, views and triggers of sqlite_schema.
+// The returned objects must not be modified.
+func (db *DB) Schema() []*Table {
+	return db.tables
+}
+
+func (db *DB) GetTableNames() []string {
+	var tableNames []string
+	for _, table := range db.tables {
+		tableNames = append(tableNames, table.Name)
+	}
+
+	return tableNames
+}
+
+// ----------------------------------------------------------------------------
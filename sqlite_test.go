@@ -0,0 +1,160 @@
+package sqlite
+
+import (
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// openTest creates a database in a temporary directory and runs setup in it
+func openTest(t *testing.T, setup string) *DB {
+	t.Helper()
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if setup != "" {
+		if _, err := db.Execute(setup); err != nil {
+			t.Fatalf("%s: %v", setup, err)
+		}
+	}
+	return db
+}
+
+// query runs sql and returns the rows of its last statement the way the
+// sqlite3 shell prints them in list mode, or the tree of a query plan
+func query(t *testing.T, db *DB, sql string) string {
+	t.Helper()
+	got, err := queryErr(db, sql)
+	if err != nil {
+		t.Fatalf("%s: %v", sql, err)
+	}
+	return got
+}
+
+func queryErr(db *DB, sql string) (string, error) {
+	results, err := db.Execute(sql)
+	if err != nil || len(results) == 0 {
+		return "", err
+	}
+
+	var sb strings.Builder
+	if results[len(results)-1].QueryPlan {
+		sb.WriteString("QUERY PLAN\n")
+		writePlan(&sb, results[len(results)-1].Rows, 0, "")
+		return sb.String(), nil
+	}
+	for _, row := range results[len(results)-1].Rows {
+		for i, v := range row {
+			if i > 0 {
+				sb.WriteByte('|')
+			}
+			sb.WriteString(FormatValue(v))
+		}
+		sb.WriteByte('\n')
+	}
+	return sb.String(), nil
+}
+
+// writePlan draws the steps of a query plan below parent as sqlite3 does
+func writePlan(sb *strings.Builder, rows [][]any, parent int64, prefix string) {
+	children := make([][]any, 0)
+	for _, row := range rows {
+		if row[1] == parent {
+			children = append(children, row)
+		}
+	}
+	for i, row := range children {
+		branch, indent := "|--", "|  "
+		if i == len(children)-1 {
+			branch, indent = "`--", "   "
+		}
+		sb.WriteString(prefix + branch + FormatValue(row[3]) + "\n")
+		writePlan(sb, rows, row[0].(int64), prefix+indent)
+	}
+}
+
+// sqlTest is a script run in a new database and the output sqlite3 prints
+// for its last statement
+type sqlTest struct {
+	name string
+	sql  string
+	want string
+}
+
+// runSQLTests runs each test in a database of its own, created by setup
+func runSQLTests(t *testing.T, setup string, tests []sqlTest) {
+	t.Helper()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTest(t, setup)
+			if got := query(t, db, tt.sql); got != tt.want {
+				t.Errorf("%s\ngot:\n%s\nwant:\n%s", tt.sql, got, tt.want)
+			}
+		})
+	}
+}
+
+// runQueries runs each test in the same database, for tests that only read
+func runQueries(t *testing.T, db *DB, tests []sqlTest) {
+	t.Helper()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := query(t, db, tt.sql); got != tt.want {
+				t.Errorf("%s\ngot:\n%s\nwant:\n%s", tt.sql, got, tt.want)
+			}
+		})
+	}
+}
+
+// sqlError is a statement and the error sqlite3 reports for it
+type sqlError struct {
+	sql string
+	err string
+}
+
+// runSQLErrors runs each statement in the same database and checks that it
+// fails with the error sqlite3 reports
+func runSQLErrors(t *testing.T, db *DB, tests []sqlError) {
+	t.Helper()
+	for _, tt := range tests {
+		if _, err := db.Execute(tt.sql); err == nil || err.Error() != tt.err {
+			t.Errorf("%s: got error %v, want %s", tt.sql, err, tt.err)
+		}
+	}
+}
+
+// checkIntegrity fails the test unless both the integrity check and, when it
+// is installed, sqlite3's own find the database intact
+func checkIntegrity(t *testing.T, db *DB) {
+	t.Helper()
+	errs, err := db.IntegrityCheck()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(errs) != 1 || errs[0] != "ok" {
+		t.Fatalf("integrity check:\n%s", strings.Join(errs, "\n"))
+	}
+
+	sqlite3, err := exec.LookPath("sqlite3")
+	if err != nil {
+		return
+	}
+	out, err := exec.Command(sqlite3, db.path, "pragma integrity_check").CombinedOutput()
+	if err != nil || string(out) != "ok\n" {
+		t.Fatalf("sqlite3 integrity check: %v\n%s", err, out)
+	}
+}
+
+// sqlite3Command returns a command running the sqlite3 shell on path, and
+// skips the test when it is not installed
+func sqlite3Command(t *testing.T, path string, args ...string) *exec.Cmd {
+	t.Helper()
+	sqlite3, err := exec.LookPath("sqlite3")
+	if err != nil {
+		t.Skip("sqlite3 is not installed")
+	}
+	return exec.Command(sqlite3, append([]string{path}, args...)...)
+}
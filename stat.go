@@ -0,0 +1,389 @@
+package sqlite
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"github.com/elordeiro/SQLite-DBReader/btree"
+	"github.com/elordeiro/SQLite-DBReader/pager"
+)
+
+// Custom Types ---------------------------------------------------------------
+
+// FreelistTrunk is a freelist trunk page and the leaf pages it lists
+type FreelistTrunk struct {
+	PageNum int64
+	Leaves  []int64
+}
+
+// PageUsage describes what a page of the file holds, with the same space
+// accounting as the dbstat virtual table
+type PageUsage struct {
+	PageNum    int64
+	Owner      string // Table or index the page belongs to
+	Type       string // See the PageType constants
+	Cells      int    // Cells, or entries of a pointer map page
+	Payload    int    // Payload bytes stored on the page
+	Unused     int    // Bytes free for new cells, excluding reserved space
+	Overflowed int    // Cells whose payload continues on overflow pages
+}
+
+const (
+	PageTypeInternal      = "internal"
+	PageTypeLeaf          = "leaf"
+	PageTypeOverflow      = "overflow"
+	PageTypeFreelistTrunk = "freelist trunk"
+	PageTypeFreelistLeaf  = "freelist leaf"
+	PageTypePtrmap        = "pointer map"
+	PageTypeUnreferenced  = "unreferenced"
+)
+
+// ----------------------------------------------------------------------------
+
+// Freelist -------------------------------------------------------------------
+
+// Freelist walks the freelist trunk chain from the database header
+func (db *DB) Freelist() ([]FreelistTrunk, error) {
+	unlock, err := db.readLock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	trunks := make([]FreelistTrunk, 0)
+	if db.bt.Pager.PageCount() == 0 {
+		return trunks, nil
+	}
+	header, err := db.bt.Pager.ReadPage(1)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[int64]bool)
+	trunk := int64(binary.BigEndian.Uint32(header[32:]))
+	for trunk != 0 {
+		if trunk < 2 || trunk > db.bt.Pager.PageCount() {
+			return nil, pager.CorruptPage(trunk, "freelist trunk page out of range")
+		}
+		if seen[trunk] {
+			return nil, pager.CorruptPage(trunk, "freelist trunk chain loops")
+		}
+		seen[trunk] = true
+
+		buf, err := db.bt.Pager.ReadPage(trunk)
+		if err != nil {
+			return nil, err
+		}
+		leafCount := int64(binary.BigEndian.Uint32(buf[4:]))
+		if leafCount > db.bt.UsableSize/4-2 {
+			return nil, pager.CorruptPage(trunk, "freelist leaf count too big")
+		}
+		leaves := make([]int64, leafCount)
+		for i := range leaves {
+			leaves[i] = int64(binary.BigEndian.Uint32(buf[8+4*i:]))
+			if leaves[i] < 2 || leaves[i] > db.bt.Pager.PageCount() {
+				return nil, pager.CorruptPage(trunk, "freelist leaf %d out of range", leaves[i])
+			}
+		}
+
+		trunks = append(trunks, FreelistTrunk{PageNum: trunk, Leaves: leaves})
+		trunk = int64(binary.BigEndian.Uint32(buf[0:4]))
+	}
+	return trunks, nil
+}
+
+// FreelistReport lists the freelist trunk pages and their leaves, for the
+// .freelist command
+func (db *DB) FreelistReport() ([]string, error) {
+	trunks, err := db.Freelist()
+	if err != nil {
+		return nil, err
+	}
+	total := len(trunks)
+	for _, trunk := range trunks {
+		total += len(trunk.Leaves)
+	}
+	summary := fmt.Sprintf("freelist pages: %d, trunk pages: %d", total, len(trunks))
+	if db.bt.Pager.PageCount() > 0 {
+		header, err := db.bt.Pager.ReadPage(1)
+		if err != nil {
+			return nil, err
+		}
+		if count := binary.BigEndian.Uint32(header[36:]); int64(count) != int64(total) {
+			summary += fmt.Sprintf(" (header says %d)", count)
+		}
+	}
+
+	lines := []string{summary}
+	for _, trunk := range trunks {
+		line := fmt.Sprintf("trunk %d: %d leaves", trunk.PageNum, len(trunk.Leaves))
+		if len(trunk.Leaves) > 0 {
+			leaves := make([]string, len(trunk.Leaves))
+			for i, leaf := range trunk.Leaves {
+				leaves[i] = fmt.Sprint(leaf)
+			}
+			line += ": " + strings.Join(leaves, " ")
+		}
+		lines = append(lines, line)
+	}
+	return lines, nil
+}
+
+// ----------------------------------------------------------------------------
+
+// Page Usage -----------------------------------------------------------------
+
+// PageUsage attributes every page of the file to the b-tree or overflow chain
+// of a table or index, to the freelist or to the pointer map of an
+// auto-vacuum database. Pages nothing refers to are left as
+// PageTypeUnreferenced. The result is indexed by page number minus one.
+func (db *DB) PageUsage() ([]*PageUsage, error) {
+	unlock, err := db.readLock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	pages := make([]*PageUsage, db.bt.Pager.PageCount())
+	if len(pages) == 0 {
+		return pages, nil
+	}
+	for i := range pages {
+		pages[i] = &PageUsage{PageNum: int64(i + 1), Type: PageTypeUnreferenced}
+	}
+	claim := func(pageNum int64, owner, pageType string) (*PageUsage, error) {
+		if pageNum < 1 || pageNum > int64(len(pages)) {
+			return nil, pager.CorruptPage(pageNum, "page number out of range")
+		}
+		usage := pages[pageNum-1]
+		if usage.Type != PageTypeUnreferenced {
+			return nil, pager.CorruptPage(pageNum, "page used by both %s and %s", usage.Owner, owner)
+		}
+		usage.Owner, usage.Type = owner, pageType
+		return usage, nil
+	}
+
+	// Pointer map pages are found by their position in the file
+	for _, usage := range pages {
+		if db.bt.IsPtrmapPage(usage.PageNum) {
+			usage.Type = PageTypePtrmap
+			usage.Cells = db.bt.PtrmapEntries(usage.PageNum)
+			usage.Unused = int(db.bt.UsableSize) - 5*usage.Cells
+		}
+	}
+
+	if err := db.treeUsage(1, "sqlite_schema", claim); err != nil {
+		return nil, err
+	}
+	for _, table := range db.tables {
+		if table.PageNum > 0 {
+			if err := db.treeUsage(table.PageNum, table.Name, claim); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	trunks, err := db.Freelist()
+	if err != nil {
+		return nil, err
+	}
+	for _, trunk := range trunks {
+		usage, err := claim(trunk.PageNum, "", PageTypeFreelistTrunk)
+		if err != nil {
+			return nil, err
+		}
+		usage.Unused = int(db.bt.UsableSize) - 8 - 4*len(trunk.Leaves)
+		for _, leaf := range trunk.Leaves {
+			if usage, err = claim(leaf, "", PageTypeFreelistLeaf); err != nil {
+				return nil, err
+			}
+			usage.Unused = int(db.bt.UsableSize)
+		}
+	}
+	return pages, nil
+}
+
+type pageClaimer func(pageNum int64, owner, pageType string) (*PageUsage, error)
+
+// treeUsage accounts for the pages of the b-tree at root and their overflow
+// chains
+func (db *DB) treeUsage(root int64, owner string, claim pageClaimer) error {
+	stack := []int64{root}
+	for len(stack) > 0 {
+		pageNum := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		usage, err := claim(pageNum, owner, PageTypeLeaf)
+		if err != nil {
+			return err
+		}
+		pageBuf, err := db.bt.Pager.ReadPage(pageNum)
+		if err != nil {
+			return err
+		}
+		hdrOff := btree.HeaderOffset(pageNum)
+		header, err := btree.ParseHeader(pageBuf[hdrOff:])
+		if err != nil {
+			return pager.CorruptPage(pageNum, "%v", err)
+		}
+		isLeaf := header.Type == btree.LeafTablePage || header.Type == btree.LeafIndexPage
+		if !isLeaf {
+			usage.Type = PageTypeInternal
+		}
+
+		usage.Cells = header.CellCount
+		usage.Unused, err = db.unusedBytes(pageNum, pageBuf, header)
+		if err != nil {
+			return err
+		}
+		for i, ptr := range btree.ParseCellPtrs(pageBuf[hdrOff:], header) {
+			extent, err := db.bt.ParseCellExtent(header.Type, pageBuf, ptr)
+			if err != nil {
+				return pager.CorruptCell(pageNum, i, "%v", err)
+			}
+			if !isLeaf {
+				stack = append(stack, int64(binary.BigEndian.Uint32(pageBuf[ptr:])))
+			}
+			usage.Payload += extent.Local
+			if extent.OverflowPage != 0 {
+				usage.Overflowed++
+				err := db.overflowUsage(int64(extent.OverflowPage), extent.PayloadSize-uint64(extent.Local), owner, claim)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		if !isLeaf {
+			stack = append(stack, int64(header.RightMostPointer))
+		}
+	}
+	return nil
+}
+
+// overflowUsage accounts for the pages of an overflow chain holding the
+// given number of payload bytes
+func (db *DB) overflowUsage(pageNum int64, remaining uint64, owner string, claim pageClaimer) error {
+	capacity := uint64(db.bt.UsableSize - 4)
+	for pageNum != 0 && remaining > 0 {
+		usage, err := claim(pageNum, owner, PageTypeOverflow)
+		if err != nil {
+			return err
+		}
+		stored := min(remaining, capacity)
+		usage.Payload = int(stored)
+		usage.Unused = int(capacity - stored)
+		remaining -= stored
+
+		buf, err := db.bt.Pager.ReadPage(pageNum)
+		if err != nil {
+			return err
+		}
+		pageNum = int64(binary.BigEndian.Uint32(buf[0:4]))
+	}
+	if remaining > 0 {
+		return pager.CorruptPage(pageNum, "overflow chain too short")
+	}
+	return nil
+}
+
+// unusedBytes counts the gap between the cell pointers and the cell content,
+// the freeblocks and the fragmented bytes of a b-tree page
+func (db *DB) unusedBytes(pageNum int64, pageBuf []byte, header *btree.Header) (int, error) {
+	hdrOff := btree.HeaderOffset(pageNum)
+	contentStart := int(binary.BigEndian.Uint16(pageBuf[hdrOff+5:]))
+	if contentStart == 0 {
+		contentStart = 65536
+	}
+	ptrsEnd := hdrOff + header.Len() + 2*header.CellCount
+	if contentStart < ptrsEnd || contentStart > int(db.bt.UsableSize) {
+		return 0, pager.CorruptPage(pageNum, "cell content area out of range")
+	}
+	unused := contentStart - ptrsEnd + int(pageBuf[hdrOff+7])
+
+	freeblock := int(binary.BigEndian.Uint16(pageBuf[hdrOff+1:]))
+	for freeblock != 0 {
+		if freeblock < contentStart || freeblock > int(db.bt.UsableSize)-4 {
+			return 0, pager.CorruptPage(pageNum, "freeblock offset %d out of range", freeblock)
+		}
+		unused += int(binary.BigEndian.Uint16(pageBuf[freeblock+2:]))
+		next := int(binary.BigEndian.Uint16(pageBuf[freeblock:]))
+		if next != 0 && next <= freeblock {
+			return 0, pager.CorruptPage(pageNum, "freeblocks out of order")
+		}
+		freeblock = next
+	}
+	return unused, nil
+}
+
+// PageUsageReport sums the page usage of each table and index, the freelist
+// and the whole file, for the .dbstat command
+func (db *DB) PageUsageReport() ([]string, error) {
+	pages, err := db.PageUsage()
+	if err != nil {
+		return nil, err
+	}
+
+	type objectUsage struct {
+		name                               string
+		pages, leaf, internal, overflow    int
+		cells, payload, unused, overflowed int
+	}
+	objects := make([]*objectUsage, 0)
+	byName := make(map[string]*objectUsage)
+	total := &objectUsage{name: "(total)"}
+	for _, page := range pages {
+		name := page.Owner
+		switch page.Type {
+		case PageTypeFreelistTrunk, PageTypeFreelistLeaf:
+			name = "(freelist)"
+		case PageTypePtrmap:
+			name = "(pointer map)"
+		case PageTypeUnreferenced:
+			name = "(unreferenced)"
+		}
+		obj := byName[name]
+		if obj == nil {
+			obj = &objectUsage{name: name}
+			byName[name] = obj
+			objects = append(objects, obj)
+		}
+
+		for _, o := range []*objectUsage{obj, total} {
+			o.pages++
+			switch page.Type {
+			case PageTypeLeaf:
+				o.leaf++
+			case PageTypeInternal:
+				o.internal++
+			case PageTypeOverflow:
+				o.overflow++
+			}
+			o.cells += page.Cells
+			o.payload += page.Payload
+			o.unused += page.Unused
+			o.overflowed += page.Overflowed
+		}
+	}
+	objects = append(objects, total)
+
+	width := 4
+	for _, obj := range objects {
+		width = max(width, len(obj.name))
+	}
+	lines := []string{fmt.Sprintf("%-*s %7s %7s %8s %8s %8s %10s %10s %6s %10s", width,
+		"name", "pages", "leaf", "internal", "overflow", "cells", "payload", "unused", "fill", "overflowed")}
+	for _, obj := range objects {
+		size := obj.pages * int(db.bt.PageSize)
+		fill := 0.0
+		if size > 0 {
+			fill = 100 * float64(size-obj.unused) / float64(size)
+		}
+		lines = append(lines, fmt.Sprintf("%-*s %7d %7d %8d %8d %8d %10d %10d %5.1f%% %10d", width,
+			obj.name, obj.pages, obj.leaf, obj.internal, obj.overflow,
+			obj.cells, obj.payload, obj.unused, fill, obj.overflowed))
+	}
+	return lines, nil
+}
+
+// ----------------------------------------------------------------------------
@@ -0,0 +1,73 @@
+package sqlite
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// statSetup leaves a table with overflow pages, an index and a freelist
+const statSetup = "create table t(a integer primary key, b text); create index t_b on t(b); " +
+	"insert into t with recursive n(i) as (select 1 union all select i + 1 from n where i < 300) " +
+	"select i, hex(zeroblob(i % 7 * 700)) from n; " +
+	"create table u(c); insert into u select b from t where a < 100; drop table u; " +
+	"delete from t where a % 5 = 0"
+
+// TestFreelistReport frees a table's root page and overflow chains, which
+// sqlite3 puts on its freelist in the same order
+func TestFreelistReport(t *testing.T) {
+	db := openTest(t, "create table t(a); create table u(c); "+
+		"insert into u values (zeroblob(10000)), (zeroblob(5000)); insert into t values (1); drop table u")
+	got, err := db.FreelistReport()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "freelist pages: 4, trunk pages: 1\ntrunk 4: 3 leaves: 5 6 3"
+	if strings.Join(got, "\n") != want {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), want)
+	}
+}
+
+// TestPageUsageDbstat compares the page usage of databases written by the
+// engine and by sqlite3 with what sqlite3's dbstat reports
+func TestPageUsageDbstat(t *testing.T) {
+	ours := openTest(t, statSetup)
+	path := filepath.Join(t.TempDir(), "sqlite3.db")
+	if out, err := sqlite3Command(t, path, statSetup).CombinedOutput(); err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	theirs, err := Open(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer theirs.Close()
+
+	for _, db := range []*DB{ours, theirs} {
+		pages, err := db.PageUsage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got strings.Builder
+		free := 0
+		for _, page := range pages {
+			switch page.Type {
+			case PageTypeFreelistTrunk, PageTypeFreelistLeaf:
+				free++
+			case PageTypeUnreferenced:
+				t.Errorf("%s: page %d is unreferenced", db.path, page.PageNum)
+			default:
+				fmt.Fprintf(&got, "%d|%s|%s|%d|%d|%d\n", page.PageNum, page.Owner, page.Type, page.Cells, page.Payload, page.Unused)
+			}
+		}
+		fmt.Fprintf(&got, "%d\n", free)
+
+		want, err := sqlite3Command(t, db.path, "select pageno, name, pagetype, ncell, payload, unused from dbstat order by pageno; pragma freelist_count").CombinedOutput()
+		if err != nil {
+			t.Fatalf("%v: %s", err, want)
+		}
+		if got.String() != string(want) {
+			t.Errorf("%s:\ngot:\n%s\nwant:\n%s", db.path, got.String(), want)
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/elordeiro/SQLite-DBReader/parser"
+)
+
+// Custom Types ---------------------------------------------------------------
+
+// Stmt is SQL parsed once to be run any number of times, with the values of
+// its ?, ?NNN, :name, @name and $name parameters bound on each run. The plan
+// of each SELECT is kept after its first run, and the statements are parsed
+// again when the schema changes.
+type Stmt struct {
+	db     *DB
+	sql    string
+	stmts  []parser.Statement
+	params []string      // Name of each parameter, "" for a bare ?
+	plans  []*selectPlan // Plan of each SELECT once it has run
+	schema int64         // Schema version the statements were parsed against
+}
+
+// NamedArg binds a value to the parameters with a name, given with or
+// without its :, @ or $ prefix
+type NamedArg struct {
+	Name  string
+	Value any
+}
+
+// ----------------------------------------------------------------------------
+
+// Named returns an argument binding value to the parameters called name
+func Named(name string, value any) NamedArg {
+	return NamedArg{Name: name, Value: value}
+}
+
+// Prepare parses the statements in sql for running later
+func (db *DB) Prepare(sql string) (*Stmt, error) {
+	s := &Stmt{db: db, sql: sql}
+	if err := s.parse(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Stmt) parse() error {
+	stmts, params, err := parser.ParseWithParams(s.sql)
+	if err != nil {
+		return err
+	}
+	s.stmts, s.params = stmts, params
+	s.plans = make([]*selectPlan, len(stmts))
+	s.schema = s.db.schemaVersion
+	return nil
+}
+
+// NumParams returns the number of values to bind, the largest parameter
+// number
+func (s *Stmt) NumParams() int {
+	return len(s.params)
+}
+
+// ParamName returns the name of parameter i, counted from 1, with its
+// prefix, or "" for a bare ?
+func (s *Stmt) ParamName(i int) string {
+	if i < 1 || i > len(s.params) {
+		return ""
+	}
+	return s.params[i-1]
+}
+
+// Query runs the statements and returns the rows of the last one, all read
+// into memory before it returns
+func (s *Stmt) Query(ctx context.Context, args ...any) (*Rows, error) {
+	result, err := s.run(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	return &Rows{result: result, pos: -1}, nil
+}
+
+// Exec runs the statements and returns the result of the last one, with the
+// number of rows it changed
+func (s *Stmt) Exec(ctx context.Context, args ...any) (*Result, error) {
+	return s.run(ctx, args)
+}
+
+// Close releases the statement. It can not be run afterwards.
+func (s *Stmt) Close() error {
+	s.stmts, s.plans = nil, nil
+	return nil
+}
+
+// run binds the arguments and runs each statement in turn, checking the
+// context before each one starts and as rows are read
+func (s *Stmt) run(ctx context.Context, args []any) (*Result, error) {
+	if s.stmts == nil {
+		return nil, errors.New("statement is closed")
+	}
+	params, err := s.bind(args)
+	if err != nil {
+		return nil, err
+	}
+	s.db.params, s.db.ctx = params, ctx
+	defer func() { s.db.params, s.db.ctx = nil, nil }()
+
+	result := &Result{}
+	for i := range s.stmts {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if result, err = s.exec(i); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// exec runs statement i, parsing the statements again first when the schema
+// changed since they were parsed. The lock is taken before the check, as
+// taking it is what notices another process changed the schema. A statement
+// before this one may have changed it too.
+func (s *Stmt) exec(i int) (*Result, error) {
+	switch s.stmts[i].(type) {
+	case *parser.BeginStatement, *parser.CommitStatement, *parser.RollbackStatement:
+		return s.db.execTransaction(s.stmts[i], nil)
+	}
+
+	unlock, err := s.db.readLock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	if s.schema != s.db.schemaVersion {
+		if err := s.parse(); err != nil {
+			return nil, err
+		}
+	}
+	return s.db.execTransaction(s.stmts[i], &s.plans[i])
+}
+
+// bind orders the arguments by parameter number. Named arguments bind by
+// name, and positional ones bind the parameters left unbound in turn, so
+// that in "select :a, ?" a positional argument binds ?2. Every parameter
+// must be given a value.
+func (s *Stmt) bind(args []any) ([]any, error) {
+	values := make([]any, len(s.params))
+	bound := make([]bool, len(s.params))
+	var positional []any
+	for _, arg := range args {
+		named, ok := arg.(NamedArg)
+		if !ok {
+			positional = append(positional, arg)
+			continue
+		}
+
+		found := false
+		for i, name := range s.params {
+			if name != "" && name[0] != '?' && (name == named.Name || name[1:] == named.Name) {
+				v, err := bindValue(named.Value)
+				if err != nil {
+					return nil, fmt.Errorf("argument %s: %w", named.Name, err)
+				}
+				values[i], bound[i], found = v, true, true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("no such parameter: %s", named.Name)
+		}
+	}
+
+	pos := 0
+	for _, arg := range positional {
+		for pos < len(bound) && bound[pos] {
+			pos++
+		}
+		if pos >= len(values) {
+			return nil, fmt.Errorf("too many arguments: %d given for %d parameters", len(args), len(values))
+		}
+		v, err := bindValue(arg)
+		if err != nil {
+			return nil, fmt.Errorf("argument %d: %w", pos+1, err)
+		}
+		values[pos], bound[pos] = v, true
+	}
+
+	for i, ok := range bound {
+		if !ok {
+			name := s.params[i]
+			if name == "" {
+				name = fmt.Sprintf("?%d", i+1)
+			}
+			return nil, fmt.Errorf("no value bound to parameter %s", name)
+		}
+	}
+	return values, nil
+}
+
+// bindValue converts a Go value to the SQLite value it is stored as
+func bindValue(v any) (any, error) {
+	switch x := v.(type) {
+	case nil, int64, float64, string:
+		return x, nil
+	case []byte:
+		if x == nil {
+			return nil, nil
+		}
+		return x, nil
+	case int:
+		return int64(x), nil
+	case int8:
+		return int64(x), nil
+	case int16:
+		return int64(x), nil
+	case int32:
+		return int64(x), nil
+	case uint8:
+		return int64(x), nil
+	case uint16:
+		return int64(x), nil
+	case uint32:
+		return int64(x), nil
+	case uint:
+		return bindUint(uint64(x))
+	case uint64:
+		return bindUint(x)
+	case float32:
+		return float64(x), nil
+	case bool:
+		if x {
+			return int64(1), nil
+		}
+		return int64(0), nil
+	case time.Time:
+		return x.Format("2006-01-02 15:04:05.999999999-07:00"), nil
+	}
+	return nil, fmt.Errorf("unsupported type %T", v)
+}
+
+func bindUint(n uint64) (any, error) {
+	if n > math.MaxInt64 {
+		return nil, fmt.Errorf("integer %d is too large", n)
+	}
+	return int64(n), nil
+}
+
+// ----------------------------------------------------------------------------
@@ -0,0 +1,213 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// stmtQuery runs a prepared statement with args and returns its rows the way
+// query does
+func stmtQuery(t *testing.T, s *Stmt, args ...any) string {
+	t.Helper()
+	rows, err := s.Query(context.Background(), args...)
+	if err != nil {
+		t.Fatalf("%s: %v", s.sql, err)
+	}
+	defer rows.Close()
+	var sb strings.Builder
+	for rows.Next() {
+		for i, v := range rows.Values() {
+			if i > 0 {
+				sb.WriteByte('|')
+			}
+			sb.WriteString(FormatValue(v))
+		}
+		sb.WriteByte('\n')
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return sb.String()
+}
+
+// The expected output is what sqlite3 prints with the same values given to
+// .parameter set
+func TestStmtParams(t *testing.T) {
+	tests := []struct {
+		name string
+		sql  string
+		args []any
+		want string
+	}{
+		{"positional", "select ?, ? + 1, typeof(?)", []any{1, 2, "x"}, "1|3|text\n"},
+		{"numbered", "select ?2, ?1, ?2, ?", []any{"a", "b", nil}, "b|a|b|\n"},
+		{"named", "select :a, @b, $c, :a, typeof($c)",
+			[]any{Named("a", 1), Named("@b", "x"), Named("c", nil)}, "1|x||1|null\n"},
+		{"types", "select typeof(?), typeof(?), typeof(?), typeof(?), ?, ?",
+			[]any{[]byte("A"), 1.5, true, int8(-3), float32(0.25), uint16(7)},
+			"blob|real|integer|integer|0.25|7\n"},
+		{"time", "select ?", []any{time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)},
+			"2024-01-02 03:04:05+00:00\n"},
+		{"where", "select b from t where a = ? or a between :lo and :hi order by a",
+			[]any{1, Named("lo", 4), Named("hi", 5)}, "one\nfour\nfive\n"},
+		{"named first", "select :a, ?", []any{Named("a", 5), 6}, "5|6\n"},
+		{"named later", "select ?, :a, ?", []any{Named("a", 5), 6, 7}, "6|5|7\n"},
+		{"limit", "select b from t order by a limit ? offset ?", []any{2, 1}, "two\nthree\n"},
+		{"in", "select count(*) from t where b in (?, ?, 'six')", []any{"two", "nine"}, "1\n"},
+	}
+	db := openTest(t, "create table t(a integer primary key, b text); "+
+		"insert into t values (1, 'one'), (2, 'two'), (3, 'three'), (4, 'four'), (5, 'five')")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := db.Prepare(tt.sql)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+			if got := stmtQuery(t, s, tt.args...); got != tt.want {
+				t.Errorf("%s\ngot:\n%s\nwant:\n%s", tt.sql, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStmtParamNames(t *testing.T) {
+	db := openTest(t, "")
+	s, err := db.Prepare("select ?, ?5, ?, :a, @b, :a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"", "", "", "", "?5", "", ":a", "@b"}
+	if s.NumParams() != len(want) {
+		t.Fatalf("NumParams: got %d, want %d", s.NumParams(), len(want))
+	}
+	for i, name := range want {
+		if got := s.ParamName(i + 1); got != name {
+			t.Errorf("ParamName(%d): got %q, want %q", i+1, got, name)
+		}
+	}
+}
+
+func TestStmtErrors(t *testing.T) {
+	tests := []struct {
+		sql  string
+		args []any
+		err  string
+	}{
+		{"select ?", []any{1, 2}, "too many arguments: 2 given for 1 parameters"},
+		{"select ?, ?", []any{1}, "no value bound to parameter ?2"},
+		{"select :a", nil, "no value bound to parameter :a"},
+		{"select :a", []any{Named("b", 1)}, "no such parameter: b"},
+		{"select ?", []any{struct{}{}}, "argument 1: unsupported type struct {}"},
+		{"select ?", []any{uint64(1 << 63)}, "argument 1: integer 9223372036854775808 is too large"},
+	}
+	db := openTest(t, "")
+	for _, tt := range tests {
+		s, err := db.Prepare(tt.sql)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.Query(context.Background(), tt.args...); err == nil || err.Error() != tt.err {
+			t.Errorf("%s %v: got error %v, want %s", tt.sql, tt.args, err, tt.err)
+		}
+	}
+
+	s, err := db.Prepare("select 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+	if _, err := s.Query(context.Background()); err == nil || err.Error() != "statement is closed" {
+		t.Errorf("closed statement: got error %v", err)
+	}
+}
+
+// TestStmtReuse runs one statement many times, across a schema change that
+// makes it parse and plan again
+func TestStmtReuse(t *testing.T) {
+	db := openTest(t, "create table t(a, b)")
+	insert, err := db.Prepare("insert into t values (?, ?)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer insert.Close()
+	for i := 0; i < 200; i++ {
+		if _, err := insert.Exec(context.Background(), i, i%7); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s, err := db.Prepare("select count(*), sum(a) from t where b = ?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if got := stmtQuery(t, s, 3); got != "29|2929\n" {
+		t.Errorf("got %q, want %q", got, "29|2929\n")
+	}
+	if _, err := db.Execute("create index t_b on t(b); create table u(c)"); err != nil {
+		t.Fatal(err)
+	}
+	if got := stmtQuery(t, s, 4); got != "28|2758\n" {
+		t.Errorf("after schema change: got %q, want %q", got, "28|2758\n")
+	}
+}
+
+// TestStmtSchemaChanged runs prepared statements again after sqlite3 moved
+// every table to another root page
+func TestStmtSchemaChanged(t *testing.T) {
+	db := openTest(t, "create table pad(p); create table t(a); create table u(z, a); "+
+		"insert into t values ('t1'), ('t2'); insert into u values (1, 'u1'), (2, 'u2')")
+	sel, err := db.Prepare("select a from t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sel.Close()
+	upd, err := db.Prepare("update u set a = a || '!' where z = 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer upd.Close()
+	if got := stmtQuery(t, sel); got != "t1\nt2\n" {
+		t.Fatalf("got %q, want %q", got, "t1\nt2\n")
+	}
+	if _, err := upd.Exec(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	sql := "drop table pad; drop table u; create table u(a, z); insert into u values ('u1', 1); vacuum"
+	if out, err := sqlite3Command(t, db.path, sql).CombinedOutput(); err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+	if got := stmtQuery(t, sel); got != "t1\nt2\n" {
+		t.Errorf("select: got %q, want %q", got, "t1\nt2\n")
+	}
+	if _, err := upd.Exec(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := query(t, db, "select * from u"); got != "u1!|1\n" {
+		t.Errorf("update: got %q, want %q", got, "u1!|1\n")
+	}
+}
+
+// TestStmtCancel stops a query that would never end once its context is done
+func TestStmtCancel(t *testing.T) {
+	db := openTest(t, "")
+	s, err := db.Prepare("with recursive c(x) as (select 1 union all select x + 1 from c) select count(*) from c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := s.Query(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+	// The database is usable once the statement has been stopped
+	if got := query(t, db, "select 1"); got != "1\n" {
+		t.Errorf("got %q, want %q", got, "1\n")
+	}
+}
@@ -0,0 +1,243 @@
+package sqlite
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/elordeiro/SQLite-DBReader/parser"
+)
+
+// Custom Types ---------------------------------------------------------------
+
+// subquery is a SELECT nested in an expression: a scalar subquery, EXISTS or
+// the right side of IN
+type subquery struct {
+	sel  *parser.SelectStatement
+	kind string // "SCALAR" or "LIST", as EXPLAIN QUERY PLAN names it
+	plan *selectPlan
+}
+
+// ----------------------------------------------------------------------------
+
+// Subqueries -----------------------------------------------------------------
+
+// planSubqueries plans the subqueries in the expressions of a query, bound
+// to the query's scope, and records the columns of the query each one reads
+func (db *DB) planSubqueries(sc *scope, exprs ...parser.Expr) ([]*subquery, error) {
+	subqueries := make([]*subquery, 0)
+	for _, e := range exprs {
+		err := walkExpr(e, func(e parser.Expr) error {
+			sub := &subquery{kind: "SCALAR"}
+			var outer *[]*parser.ColumnRef
+			switch x := e.(type) {
+			case *parser.SubqueryExpr:
+				sub.sel, outer = x.Select, &x.Outer
+			case *parser.ExistsExpr:
+				sub.sel, outer = x.Select, &x.Outer
+			case *parser.InExpr:
+				sub.sel, outer, sub.kind = x.Select, &x.Outer, "LIST"
+			}
+			if sub.sel == nil {
+				return nil
+			}
+			// GROUP BY and ORDER BY may repeat a result column
+			for _, other := range subqueries {
+				if other.sel == sub.sel {
+					return nil
+				}
+			}
+
+			inner := &scope{outer: sc}
+			plan, err := db.planQuery(sub.sel, inner)
+			if err != nil {
+				return err
+			}
+			if _, exists := e.(*parser.ExistsExpr); !exists && len(plan.exprs) != 1 {
+				return fmt.Errorf("sub-select returns %d columns - expected 1", len(plan.exprs))
+			}
+			sub.plan, *outer = plan, inner.outerRefs
+			subqueries = append(subqueries, sub)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return subqueries, nil
+}
+
+// subquery runs a subquery of the current query, keeping at most maxRows
+// rows when it is not negative
+func (ctx *evalContext) subquery(sel *parser.SelectStatement, maxRows int64) (*Result, error) {
+	for _, sub := range ctx.subqueries {
+		if sub.sel == sel {
+			return ctx.runSubquery(sub.plan, ctx, maxRows)
+		}
+	}
+	return nil, errors.New("subqueries are not supported here")
+}
+
+// runSubquery runs a nested query with outer as the query enclosing it. One
+// that reads nothing from the queries around it gives the same rows each
+// time, so it runs once per statement.
+func (ctx *evalContext) runSubquery(plan *selectPlan, outer *evalContext, maxRows int64) (*Result, error) {
+	if result, ok := ctx.results[plan]; ok {
+		return result, nil
+	}
+	result, err := ctx.db.runQuery(plan, outer, ctx.results, maxRows)
+	if err != nil {
+		return nil, err
+	}
+	if !plan.correlated && ctx.results != nil {
+		ctx.results[plan] = result
+	}
+	return result, nil
+}
+
+// derivedTable describes the rows of a subquery in FROM as a table, with
+// the names, types and affinities of its result columns
+func derivedTable(name string, plan *selectPlan) *Table {
+	table := &Table{Type: TableTypeTable, Name: name, RowIDAlias: -1}
+	for i, e := range plan.exprs {
+		col := &Column{
+			Name:      plan.names[i],
+			Type:      plan.types[i].DeclType,
+			Affinity:  exprAffinity(e),
+			NotNull:   plan.types[i].Known && !plan.types[i].Nullable,
+			RecordIdx: i,
+		}
+		col.Collate, _ = exprCollation(e)
+		table.Columns = append(table.Columns, col)
+		table.ColNames = append(table.ColNames, col.Name)
+	}
+	return table
+}
+
+// ----------------------------------------------------------------------------
+
+// Common Table Expressions ---------------------------------------------------
+
+// cte is a named subquery of WITH
+type cte struct {
+	def     *parser.CommonTableExpr
+	scope   *scope // Scope of the query WITH belongs to
+	visible []*cte // CTEs its body may name: all those of its WITH clause
+
+	// Plan shared by every reference unless NOT MATERIALIZED, with the
+	// columns of enclosing queries it reads
+	plan      *selectPlan
+	outerRefs []*parser.ColumnRef
+
+	// While the body is planned, the plan recursive references read, and
+	// the table they see once the first SELECT of a compound is planned
+	planning  *selectPlan
+	table     *Table
+	step      *scope // Scope of the SELECT of the compound being planned
+	recursive bool   // The SELECT being planned read the CTE
+}
+
+// addCTEs makes the common table expressions of a WITH clause visible to
+// the query of sc, the queries nested in it and each other's bodies
+func (sc *scope) addCTEs(with *parser.WithClause) error {
+	ctes := slices.Clone(sc.ctes)
+	for i, def := range with.CTEs {
+		for _, other := range with.CTEs[:i] {
+			if strings.EqualFold(other.Name, def.Name) {
+				return fmt.Errorf("duplicate WITH table name: %s", def.Name)
+			}
+		}
+		ctes = append(ctes, &cte{def: def, scope: sc})
+	}
+	for _, c := range ctes[len(sc.ctes):] {
+		c.visible = ctes
+	}
+	sc.ctes = ctes
+	return nil
+}
+
+// lookupCTE finds the CTE a table name refers to, and how many queries out
+// from sc it was defined
+func (sc *scope) lookupCTE(name string) (*cte, int) {
+	for s, level := sc, 0; s != nil; s, level = s.outer, level+1 {
+		for i := len(s.ctes) - 1; i >= 0; i-- {
+			if strings.EqualFold(s.ctes[i].def.Name, name) {
+				return s.ctes[i], level
+			}
+		}
+	}
+	return nil, 0
+}
+
+// cteSource makes src read a CTE. A reference found while the CTE's body is
+// planned reads the rows of its recursion, which only the FROM of a SELECT
+// of the compound may name, once.
+func (db *DB) cteSource(src *rowSource, c *cte, level int, sc *scope) (*rowSource, error) {
+	if src.name == "" {
+		src.name = c.def.Name
+	}
+	if c.planning != nil {
+		switch {
+		case c.table == nil || sc != c.step && !c.recursive:
+			return nil, fmt.Errorf("circular reference: %s", c.def.Name)
+		case sc != c.step:
+			return nil, fmt.Errorf("multiple recursive references: %s", c.def.Name)
+		case c.recursive:
+			return nil, fmt.Errorf("multiple references to recursive table: %s", c.def.Name)
+		}
+		c.recursive = true
+		src.query, src.table = c.planning, c.table
+		return src, nil
+	}
+
+	plan, outerRefs := c.plan, c.outerRefs
+	if plan == nil {
+		inner := &scope{outer: c.scope.outer, ctes: c.visible, cte: c}
+		c.planning = &selectPlan{}
+		var err error
+		plan, err = db.planQuery(c.def.Select, inner)
+		c.planning, c.table = nil, nil
+		if err != nil {
+			return nil, err
+		}
+		outerRefs = inner.outerRefs
+		if c.def.Materialized != "NOT MATERIALIZED" {
+			c.plan, c.outerRefs = plan, outerRefs
+		}
+	}
+
+	// The rows are read in the context of the query WITH belongs to
+	if plan.correlated {
+		if level > 0 {
+			return nil, fmt.Errorf("correlated common table expression %s is not supported in a subquery", c.def.Name)
+		}
+		sc.correlated = true
+		sc.outerRefs = append(sc.outerRefs, outerRefs...)
+	}
+
+	table, err := cteTable(c, plan)
+	if err != nil {
+		return nil, err
+	}
+	src.query, src.table = plan, table
+	return src, nil
+}
+
+// cteTable describes the rows of a CTE as a table named after it, with the
+// column names it declares, if any
+func cteTable(c *cte, plan *selectPlan) (*Table, error) {
+	table := derivedTable(c.def.Name, plan)
+	if c.def.Columns == nil {
+		return table, nil
+	}
+	if len(c.def.Columns) != len(table.Columns) {
+		return nil, fmt.Errorf("table %s has %d values for %d columns", c.def.Name, len(table.Columns), len(c.def.Columns))
+	}
+	for i, name := range c.def.Columns {
+		table.Columns[i].Name, table.ColNames[i] = name, name
+	}
+	return table, nil
+}
+
+// ----------------------------------------------------------------------------
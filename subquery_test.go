@@ -0,0 +1,55 @@
+package sqlite
+
+import "testing"
+
+const subquerySetup = `
+create table t(x integer primary key, y text, z real);
+create table u(a integer, b text);
+create index u_a on u(a);
+insert into t values (1, 'a', 1.5), (2, 'b', null), (3, 'c', 3), (4, null, 4.5);
+insert into u values (1, 'one'), (1, 'uno'), (3, 'three'), (5, 'five'), (null, 'none');`
+
+func TestSubqueries(t *testing.T) {
+	runQueries(t, openTest(t, subquerySetup), []sqlTest{
+		{"scalar", "select x, (select count(*) from u) from t order by x", "1|5\n2|5\n3|5\n4|5\n"},
+		{"scalar correlated", "select x, (select count(*) from u where u.a = t.x) from t order by x", "1|2\n2|0\n3|1\n4|0\n"},
+		{"scalar first row", "select x, (select b from u where a = x order by b desc) from t order by x", "1|uno\n2|\n3|three\n4|\n"},
+		{"scalar no rows", "select (select b from u where a = 42), typeof((select b from u where a = 42))", "|null\n"},
+		{"scalar in where", "select x from t where z > (select avg(z) from t) order by x", "4\n"},
+		{"scalar nested", "select (select (select max(x) from t) + max(a) from u)", "9\n"},
+		{"scalar cached", "select count(distinct (select random())) from t", "1\n"},
+		{"in", "select x from t where x in (select a from u) order by x", "1\n3\n"},
+		{"not in", "select x from t where x not in (select a from u where a is not null) order by x", "2\n4\n"},
+		{"not in null", "select count(*) from t where x not in (select a from u)", "0\n"},
+		{"in null lhs", "select null in (select a from u), null in (select a from u where 0), 1 in (select a from u)", "|0|1\n"},
+		{"in correlated", "select x from t where 'one' in (select b from u where u.a = t.x) order by x", "1\n"},
+		{"in affinity", "select x from t where cast(x as text) in (select a from u) order by x", "1\n3\n"},
+		{"in result", "select x, x in (select a from u) from t order by x", "1|1\n2|\n3|1\n4|\n"},
+		{"exists", "select x from t where exists (select 1 from u where u.a = t.x) order by x", "1\n3\n"},
+		{"not exists", "select x from t where not exists (select 1 from u where u.a = t.x) order by x", "2\n4\n"},
+		{"exists uncorrelated", "select exists (select * from u where a > 4), exists (select * from u where a > 5)", "1|0\n"},
+		{"exists result", "select y, exists (select 1 from u where a = x and b like 't%') from t order by x", "a|0\nb|0\nc|1\n|0\n"},
+		{"derived", "select * from (select a, count(*) as n from u group by a) as g order by a", "|1\n1|2\n3|1\n5|1\n"},
+		{"derived where", "select g.n, g.a from (select a, count(*) as n from u group by a) g where g.n > 1", "2|1\n"},
+		{"derived join", "select t.y, d.b from t join (select a, b from u where a is not null) as d on d.a = t.x order by t.y, d.b", "a|one\na|uno\nc|three\n"},
+		{"derived nested", "select max(m) from (select a * 2 as m from (select a from u where a < 5))", "6\n"},
+		{"derived aggregate", "select count(*), sum(z) from (select z from t where z is not null)", "3|9.0\n"},
+		{"derived limit", "select * from (select x from t order by x desc limit 2) order by x", "3\n4\n"},
+		{"derived same names", "select * from (select a from u where a = 3) cross join (select a from u where a = 5)", "3|5\n"},
+		{"derived star", "select * from t cross join (select b from u where a > 1 limit 2) cross join (select distinct y as b from t where x < 3) order by 1, 2, 4, 5", "1|a|1.5|five|a\n1|a|1.5|five|b\n1|a|1.5|three|a\n1|a|1.5|three|b\n2|b||five|a\n2|b||five|b\n2|b||three|a\n2|b||three|b\n3|c|3.0|five|a\n3|c|3.0|five|b\n3|c|3.0|three|a\n3|c|3.0|three|b\n4||4.5|five|a\n4||4.5|five|b\n4||4.5|three|a\n4||4.5|three|b\n"},
+		{"lateral correlated", "select x, (select group_concat(b, ',') from (select b from u where a = t.x order by b)) from t order by x", "1|one,uno\n2|\n3|three\n4|\n"},
+		{"in derived", "select x from t where x in (select a from (select a from u where a > 1)) order by x", "3\n"},
+		{"subquery in order by", "select x from t order by (select count(*) from u where a = x) desc, x", "1\n3\n2\n4\n"},
+		{"subquery in having", "select a, count(*) from u group by a having count(*) > (select count(*) from t where x > 3) order by a", "1|2\n"},
+		{"cached plan", "explain query plan select x, (select count(*) from u), (select count(*) from u where a = x) from t", "QUERY PLAN\n|--SCAN t\n|--SCALAR SUBQUERY 1\n|  `--SCAN u USING COVERING INDEX u_a\n`--CORRELATED SCALAR SUBQUERY 2\n   `--SEARCH u USING COVERING INDEX u_a (a=?)\n"},
+	})
+}
+
+func TestSubqueryErrors(t *testing.T) {
+	runSQLErrors(t, openTest(t, subquerySetup), []sqlError{
+		{"select (select x, y from t)", "sub-select returns 2 columns - expected 1"},
+		{"select 1 in (select a, b from u)", "sub-select returns 2 columns - expected 1"},
+		{"select * from (select x from t) where y = 'a'", "no such column: y"},
+		{"select x from t where exists (select 1 from u where nope = x)", "no such column: nope"},
+	})
+}
@@ -0,0 +1,245 @@
+package sqlite
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/elordeiro/SQLite-DBReader/pager"
+)
+
+func TestTransaction(t *testing.T) {
+	runSQLTests(t, "create table t(a); insert into t values (1), (2)", []sqlTest{
+		{"commit", `begin;
+insert into t values (3);
+commit;
+select * from t`, "1\n2\n3\n"},
+		{"rollback", `begin;
+insert into t values (3);
+delete from t where a = 1;
+rollback;
+select * from t`, "1\n2\n"},
+		{"reads inside transaction", `begin;
+insert into t values (3);
+select count(*) from t`, "3\n"},
+		{"rollback create", `begin;
+create table u(b);
+insert into u values (1);
+rollback;
+create table u(c);
+select count(*) from u`, "0\n"},
+		{"rollback drop", `begin;
+drop table t;
+rollback;
+select * from t`, "1\n2\n"},
+		{"begin kinds", `begin deferred;
+commit;
+begin immediate;
+insert into t values (4);
+end;
+begin exclusive transaction;
+rollback transaction;
+select * from t`, "1\n2\n4\n"},
+	})
+}
+
+func TestTransactionErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		sql  string
+		err  string
+	}{
+		{"nested", "begin; begin", "cannot start a transaction within a transaction"},
+		{"commit", "commit", "cannot commit - no transaction is active"},
+		{"rollback", "rollback", "cannot rollback - no transaction is active"},
+		{"vacuum", "begin; vacuum", "cannot VACUUM from within a transaction"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTest(t, "")
+			if _, err := queryErr(db, tt.sql); err == nil || err.Error() != tt.err {
+				t.Errorf("got error %v, want %s", err, tt.err)
+			}
+		})
+	}
+}
+
+// TestTransactionFailedStatement checks that a failing statement only undoes
+// its own changes and leaves the transaction open
+func TestTransactionFailedStatement(t *testing.T) {
+	db := openTest(t, "create table t(a unique); insert into t values (1)")
+	query(t, db, "begin; insert into t values (2)")
+	if _, err := queryErr(db, "insert into t values (3), (1)"); err == nil {
+		t.Fatal("duplicate insert succeeded")
+	}
+	if got := query(t, db, "commit; select a from t"); got != "1\n2\n" {
+		t.Errorf("got %q, want %q", got, "1\n2\n")
+	}
+}
+
+// sqlite3Shell is a running sqlite3 shell, fed statements one at a time
+type sqlite3Shell struct {
+	cmd *exec.Cmd
+	in  io.WriteCloser
+	out *bufio.Reader
+}
+
+func startSqlite3(t *testing.T, path string) *sqlite3Shell {
+	t.Helper()
+	cmd := sqlite3Command(t, path)
+	in, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd.Stderr = cmd.Stdout
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		in.Close()
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+	return &sqlite3Shell{cmd: cmd, in: in, out: bufio.NewReader(out)}
+}
+
+// run runs sql and waits for it to finish, returning its output
+func (sh *sqlite3Shell) run(t *testing.T, sql string) string {
+	t.Helper()
+	if _, err := io.WriteString(sh.in, sql+";\n.print --done--\n"); err != nil {
+		t.Fatal(err)
+	}
+	var out strings.Builder
+	for {
+		line, err := sh.out.ReadString('\n')
+		if err != nil {
+			t.Fatalf("sqlite3: %v\n%s", err, out.String())
+		}
+		if line == "--done--\n" {
+			return out.String()
+		}
+		out.WriteString(line)
+	}
+}
+
+// TestTransactionLocking runs transactions in a sqlite3 process alongside
+// the database, each side seeing the other's commits and failing to write
+// while the other is writing
+func TestTransactionLocking(t *testing.T) {
+	db := openTest(t, "create table t(a); insert into t values (1)")
+	sh := startSqlite3(t, db.path)
+
+	sh.run(t, "begin immediate; insert into t values (2)")
+	if _, err := queryErr(db, "insert into t values (3)"); !errors.Is(err, pager.ErrBusy) {
+		t.Errorf("write during a sqlite3 transaction: got %v, want %v", err, pager.ErrBusy)
+	}
+	if got := query(t, db, "select a from t"); got != "1\n" {
+		t.Errorf("read during a sqlite3 transaction: got %q", got)
+	}
+	sh.run(t, "commit")
+	if got := query(t, db, "select a from t"); got != "1\n2\n" {
+		t.Errorf("read after the sqlite3 commit: got %q", got)
+	}
+
+	query(t, db, "begin; insert into t values (3)")
+	if got := sh.run(t, "insert into t values (4)"); !strings.Contains(got, "database is locked") {
+		t.Errorf("sqlite3 write during a transaction: got %q", got)
+	}
+	query(t, db, "commit")
+	if got := sh.run(t, "select a from t"); got != "1\n2\n3\n" {
+		t.Errorf("sqlite3 read after the commit: got %q", got)
+	}
+}
+
+// TestTransactionTwoHandles opens a database twice in one process, whose
+// POSIX locks do not keep the two apart, and checks they lock each other out
+// as two processes would
+func TestTransactionTwoHandles(t *testing.T) {
+	a := openTest(t, "create table t(a); insert into t values (1)")
+	b, err := Open(a.path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	query(t, a, "begin; update t set a = a * 10")
+	if _, err := queryErr(b, "insert into t values (5)"); !errors.Is(err, pager.ErrBusy) {
+		t.Errorf("write during a transaction of the other handle: got %v, want %v", err, pager.ErrBusy)
+	}
+	if got := query(t, b, "select a from t"); got != "1\n" {
+		t.Errorf("read during a transaction of the other handle: got %q", got)
+	}
+	if _, err := os.Stat(a.path + "-journal"); err != nil {
+		t.Errorf("the live journal was removed: %v", err)
+	}
+
+	// Closing a third handle must not release the locks of the first
+	c, err := Open(a.path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query(t, c, "select a from t")
+	c.Close()
+	if out, err := sqlite3Command(t, a.path, "insert into t values (6)").CombinedOutput(); err == nil ||
+		!strings.Contains(string(out), "database is locked") {
+		t.Errorf("sqlite3 write after closing another handle: %v %s", err, out)
+	}
+
+	query(t, a, "commit")
+	if got := query(t, b, "select a from t"); got != "10\n" {
+		t.Errorf("read after the other handle's commit: got %q", got)
+	}
+
+	// A reader's transaction keeps the other handle from committing
+	query(t, b, "begin; select a from t")
+	if _, err := queryErr(a, "insert into t values (7)"); !errors.Is(err, pager.ErrBusy) {
+		t.Errorf("commit during a read of the other handle: got %v, want %v", err, pager.ErrBusy)
+	}
+	query(t, b, "commit")
+	query(t, a, "insert into t values (8)")
+	if got := query(t, b, "select a from t"); got != "10\n8\n" {
+		t.Errorf("read after both transactions: got %q", got)
+	}
+	checkIntegrity(t, a)
+}
+
+// TestTransactionHotJournal kills a sqlite3 process in the middle of a
+// transaction that already wrote to the database, and checks that opening
+// the database rolls its journal back
+func TestTransactionHotJournal(t *testing.T) {
+	db := openTest(t, "create table t(a integer primary key, b text); "+
+		"insert into t with recursive n(i) as (select 1 union all select i + 1 from n where i < 2000) "+
+		"select i, hex(randomblob(100)) from n")
+	before := query(t, db, "select * from t")
+	path := db.path
+	db.Close()
+
+	sh := startSqlite3(t, path)
+	sh.run(t, "pragma cache_size = 1; begin; update t set b = lower(b); delete from t where a % 3 = 0")
+	sh.cmd.Process.Kill()
+	sh.cmd.Wait()
+	if info, err := os.Stat(path + "-journal"); err != nil || info.Size() == 0 {
+		t.Fatalf("no hot journal: %v", err)
+	}
+
+	db, err := Open(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if got := query(t, db, "select * from t"); got != before {
+		t.Error("the transaction was not rolled back")
+	}
+	if _, err := os.Stat(path + "-journal"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("the hot journal was not deleted: %v", err)
+	}
+	checkIntegrity(t, db)
+}
@@ -0,0 +1,104 @@
+package sqlite
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/elordeiro/SQLite-DBReader/parser"
+)
+
+// UPDATE ---------------------------------------------------------------------
+func (db *DB) execUpdate(stmt *parser.UpdateStatement) (*Result, error) {
+	src, err := db.targetSource(stmt.Table, stmt.Alias)
+	if err != nil {
+		return nil, err
+	}
+	table, sources := src.table, []*rowSource{src}
+
+	cols := make([]int, len(stmt.Set))
+	values := make([]parser.Expr, len(stmt.Set))
+	for i, set := range stmt.Set {
+		col, ok := table.ColumnIndex(set.Column)
+		if !ok {
+			return nil, fmt.Errorf("no such column: %s", set.Column)
+		}
+		if col >= 0 && table.Columns[col].Generated != nil {
+			return nil, fmt.Errorf("cannot UPDATE generated column \"%s\"", table.Columns[col].Name)
+		}
+		if col == table.RowIDAlias {
+			col = RowIDColumn
+		}
+		cols[i] = col
+
+		if err := bindExpr(set.Value, sources); err != nil {
+			return nil, err
+		}
+		if call := findAggregate(set.Value); call != nil {
+			return nil, fmt.Errorf("misuse of aggregate function %s()", call.Name)
+		}
+		values[i] = set.Value
+	}
+	subqueries, err := db.planSubqueries(&scope{sources: sources}, values...)
+	if err != nil {
+		return nil, err
+	}
+
+	rowIDs, err := db.matchingRowIDs(src, stmt.Where)
+	if err != nil {
+		return nil, err
+	}
+
+	// Like SQLite, check the most recently created index first
+	indexes := db.GetIndexes(table)
+	slices.Reverse(indexes)
+
+	result := &Result{}
+	results := make(map[*selectPlan]*Result)
+	for _, rowID := range rowIDs {
+		old, err := db.fetchRow(table, rowID)
+		if err != nil {
+			return nil, err
+		}
+		if old == nil {
+			continue // Deleted by an earlier OR REPLACE
+		}
+
+		// Every SET expression sees the row as it was
+		row := &Row{RowID: old.RowID, Values: slices.Clone(old.Values)}
+		ctx := &evalContext{db: db, rows: []*Row{old}, subqueries: subqueries, results: results}
+		for i, set := range stmt.Set {
+			v, err := ctx.Eval(set.Value)
+			if err != nil {
+				return nil, err
+			}
+			if cols[i] != RowIDColumn {
+				row.Values[cols[i]] = applyAffinity(v, table.Columns[cols[i]].Affinity)
+				continue
+			}
+			id, ok := applyAffinity(v, parser.AffinityInteger).(int64)
+			if !ok {
+				return nil, errors.New("datatype mismatch")
+			}
+			row.RowID = id
+		}
+		if table.RowIDAlias >= 0 {
+			row.Values[table.RowIDAlias] = row.RowID
+		}
+		if err := db.computeGeneratedColumns(table, row, true); err != nil {
+			return nil, err
+		}
+
+		written, err := db.writeRow(table, indexes, row, old, stmt.Conflict)
+		if err != nil {
+			return nil, err
+		}
+		if written {
+			result.RowsAffected++
+		}
+	}
+	db.changes = result.RowsAffected
+	return result, nil
+}
+
+// ----------------------------------------------------------------------------
@@ -0,0 +1,59 @@
+package sqlite
+
+import "testing"
+
+// updateSetup is a table with an index on each of its columns
+const updateSetup = "create table t(id integer primary key, name text, qty int); " +
+	"create index t_name on t(name); " +
+	"create index t_qty on t(qty); " +
+	"insert into t values (1, 'apple', 5), (2, 'banana', 3), (3, 'cherry', 7), (4, 'date', 3), (5, 'elder', null)"
+
+func TestUpdate(t *testing.T) {
+	runSQLTests(t, updateSetup, []sqlTest{
+		{"update where", `update t set qty = qty + 1 where qty = 3;
+select * from t`, "1|apple|5\n2|banana|4\n3|cherry|7\n4|date|4\n5|elder|\n"},
+		{"update by rowid", `update t set name = 'apricot' where id = 1;
+select id, name from t order by name`, "1|apricot\n2|banana\n3|cherry\n4|date\n5|elder\n"},
+		{"update indexed column", `update t set name = upper(name) where id > 3;
+select id from t where name = 'DATE'`, "4\n"},
+		{"update old index entry gone", `update t set name = upper(name) where id > 3;
+select count(*) from t where name = 'date'`, "0\n"},
+		{"update all", `update t set qty = 0;
+select sum(qty), count(*) from t where qty = 0`, "0|5\n"},
+		{"update uses old values", `update t set qty = id, id = id + 10 where name < 'c';
+select * from t`, "3|cherry|7\n4|date|3\n5|elder|\n11|apple|1\n12|banana|2\n"},
+		{"update rowid", `update t set id = 100 where id = 3;
+select id, name from t where name = 'cherry'`, "100|cherry\n"},
+		{"update null", `update t set qty = 9 where qty is null;
+select name from t where qty = 9`, "elder\n"},
+		{"update expression types", `update t set qty = '12' where id = 1;
+select qty, typeof(qty) from t where id = 1`, "12|integer\n"},
+		{"update or replace", `update or replace t set id = 2 where id = 1;
+select * from t`, "2|apple|5\n3|cherry|7\n4|date|3\n5|elder|\n"},
+		{"update no rows", `update t set qty = 1 where 0;
+select sum(qty) from t`, "18\n"},
+	})
+}
+
+func TestUpdateErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		sql  string
+		err  string
+	}{
+		{"unique", "update t set id = 2 where id = 1", "UNIQUE constraint failed: t.id"},
+		{"no such column", "update t set nope = 1", "no such column: nope"},
+		{"no such table", "update nope set a = 1", "no such table: nope"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTest(t, updateSetup)
+			if _, err := queryErr(db, tt.sql); err == nil || err.Error() != tt.err {
+				t.Errorf("got error %v, want %s", err, tt.err)
+			}
+			if got := query(t, db, "select count(*), sum(qty) from t"); got != "5|18\n" {
+				t.Errorf("failed update changed the table: %q", got)
+			}
+		})
+	}
+}
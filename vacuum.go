@@ -0,0 +1,232 @@
+package sqlite
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/elordeiro/SQLite-DBReader/btree"
+	"github.com/elordeiro/SQLite-DBReader/pager"
+	"github.com/elordeiro/SQLite-DBReader/parser"
+)
+
+// VACUUM ---------------------------------------------------------------------
+func (db *DB) execVacuum(stmt *parser.VacuumStatement) (*Result, error) {
+	if db.inTransaction {
+		return nil, errors.New("cannot VACUUM from within a transaction")
+	}
+	if stmt.Into == nil {
+		return &Result{}, db.vacuum()
+	}
+
+	if err := bindExpr(stmt.Into, nil); err != nil {
+		return nil, err
+	}
+	v, err := (&evalContext{db: db}).Eval(stmt.Into)
+	if err != nil {
+		return nil, err
+	}
+	path, ok := v.(string)
+	if !ok {
+		return nil, errors.New("non-text filename")
+	}
+	return &Result{}, db.vacuumInto(path)
+}
+
+// vacuum rebuilds the database in place. A compact copy is written to a
+// temporary file, then copied back over the database page by page, so the
+// rollback journal protects the database until the copy commits.
+func (db *DB) vacuum() error {
+	// A database with nothing stored in it is not written
+	if db.bt.Pager.PageCount() == 0 {
+		return nil
+	}
+	tmp, err := os.CreateTemp("", "sqlite-vacuum-*.db")
+	if err != nil {
+		return err
+	}
+	path := tmp.Name()
+	tmp.Close()
+	defer db.bt.Pager.VFS().Remove(path)
+
+	if err := db.vacuumInto(path); err != nil {
+		return err
+	}
+	file, err := db.bt.Pager.VFS().OpenFile(path, os.O_RDONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	// The change counter carries on from the database's own
+	header, err := db.bt.Pager.ReadPage(1)
+	if err != nil {
+		return err
+	}
+	counter := string(header[24:28])
+
+	pageCount := info.Size() / db.bt.PageSize
+	for pageNum := int64(1); pageNum <= pageCount; pageNum++ {
+		if pageNum > db.bt.Pager.PageCount() {
+			if _, err := db.bt.Pager.AppendPage(); err != nil {
+				return err
+			}
+		}
+		buf, err := db.bt.Pager.WritablePage(pageNum)
+		if err != nil {
+			return err
+		}
+		if _, err := file.ReadAt(buf, (pageNum-1)*db.bt.PageSize); err != nil {
+			return err
+		}
+		if pageNum == 1 {
+			copy(buf[24:28], counter)
+		}
+	}
+	if pageCount < db.bt.Pager.PageCount() {
+		if err := db.bt.Pager.Truncate(pageCount); err != nil {
+			return err
+		}
+	}
+	return db.reloadSchema()
+}
+
+// vacuumInto writes a compact copy of the database to a new file, which may
+// exist as long as it is empty
+func (db *DB) vacuumInto(path string) error {
+	vfs := db.bt.Pager.VFS()
+	file, err := vfs.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	if info.Size() > 0 {
+		file.Close()
+		return errors.New("output file already exists")
+	}
+
+	var reserved uint8
+	if db.bt.Pager.PageCount() > 0 {
+		header, err := db.bt.Pager.ReadPage(1)
+		if err != nil {
+			file.Close()
+			return err
+		}
+		reserved = header[20]
+	}
+	if err := initDatabase(file, db.bt.PageSize, reserved, db.bt.Encoding); err != nil {
+		file.Close()
+		vfs.Remove(path)
+		return err
+	}
+	opts := pager.DefaultOptions()
+	opts.VFS = vfs
+	out, err := openSQLite(file, path+"-journal", opts)
+	if err != nil {
+		file.Close()
+		vfs.Remove(path)
+		return err
+	}
+
+	err = db.copyInto(out)
+	if err == nil {
+		err = out.commit()
+	}
+	if err != nil {
+		out.Close()
+		vfs.Remove(path)
+		return err
+	}
+	return out.Close()
+}
+
+// copyInto fills the empty database out with a copy of every b-tree, each
+// packed onto as few pages as possible, and lists the objects in its
+// sqlite_schema in the same order
+func (db *DB) copyInto(out *DB) error {
+	if db.bt.Pager.PageCount() == 0 {
+		return nil
+	}
+	schema, err := db.bt.ParseTablePage(1)
+	if err != nil {
+		return err
+	}
+	for _, cell := range schema.GetLeafCells() {
+		values := make([]any, len(cell.Record.ColumnTypes))
+		for i := range values {
+			values[i] = cell.Record.Value(i)
+		}
+		if len(values) <= SchemaTextIdx {
+			return fmt.Errorf("%w: malformed database schema", pager.ErrCorrupt)
+		}
+
+		// Views and triggers have no b-tree
+		if root, _ := values[SchemaRootPageIdx].(int64); root > 0 {
+			if values[SchemaRootPageIdx], err = db.copyTree(out, root); err != nil {
+				return err
+			}
+		}
+		if err := out.bt.InsertRow(1, int64(cell.RowID), out.bt.MakeRecord(values)); err != nil {
+			return err
+		}
+	}
+
+	// Header fields kept by a VACUUM: the schema cookie, bumped to tell
+	// other connections the schema moved, the schema format, the default
+	// cache size, the user version and the application id
+	src, err := db.bt.Pager.ReadPage(1)
+	if err != nil {
+		return err
+	}
+	dst, err := out.bt.Pager.WritablePage(1)
+	if err != nil {
+		return err
+	}
+	for _, off := range []int{40, 44, 48, 60, 68} {
+		copy(dst[off:off+4], src[off:off+4])
+	}
+	cookie := binary.BigEndian.Uint32(dst[40:]) + 1
+	binary.BigEndian.PutUint32(dst[40:], cookie)
+	return nil
+}
+
+// copyTree copies the table or index b-tree at root to a new b-tree of out
+// and returns the new root page. Cells are read in key order by a cursor
+// and loaded into packed pages as they come.
+func (db *DB) copyTree(out *DB, root int64) (int64, error) {
+	page, _, err := db.bt.LoadPage(root)
+	if err != nil {
+		return 0, err
+	}
+	pageType := uint8(btree.LeafTablePage)
+	if page.Header.Type != btree.LeafTablePage && page.Header.Type != btree.InteriorTablePage {
+		pageType = btree.LeafIndexPage
+	}
+
+	newRoot, err := out.bt.CreateTree(pageType)
+	if err != nil {
+		return 0, err
+	}
+	c := db.bt.NewCursor(root)
+	ok, err := c.First()
+	return newRoot, out.bt.LoadTree(newRoot, pageType, func() ([]byte, error) {
+		if err != nil || !ok {
+			return nil, err
+		}
+		cell := c.Cell()
+		raw, buildErr := out.bt.BuildCell(pageType, int64(cell.RowID), cell.Payload)
+		ok, err = c.Next()
+		return raw, buildErr
+	})
+}
+
+// ----------------------------------------------------------------------------
@@ -0,0 +1,79 @@
+package sqlite
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// vacuumSetup is a table and index left with most of their pages partly
+// empty by a delete
+const vacuumSetup = "create table t(a integer primary key autoincrement, b text); create index t_b on t(b); " +
+	"insert into t(b) with recursive n(i) as (select 1 union all select i + 1 from n where i < 1500) " +
+	"select hex(zeroblob(i % 40 * 10)) from n; " +
+	"delete from t where a % 3 != 0"
+
+func TestVacuum(t *testing.T) {
+	runSQLTests(t, vacuumSetup, []sqlTest{
+		{"rows kept", `vacuum;
+select count(*), sum(a), sum(length(b)) from t`, "500|375750|194200\n"},
+		{"index kept", `vacuum;
+select a from t where b = '' order by a limit 3`, "120\n240\n360\n"},
+		{"sequence kept", `vacuum;
+insert into t(b) values ('new');
+select a from t where b = 'new'`, "1501\n"},
+		{"writes after", `vacuum;
+delete from t where a < 1000;
+insert into t(b) values ('x');
+select count(*) from t`, "168\n"},
+		{"rowids kept", `delete from t where a < 1400;
+vacuum;
+select a from t order by a limit 3`, "1401\n1404\n1407\n"},
+	})
+}
+
+// TestVacuumCompacts checks that VACUUM rebuilds the database into as many
+// pages as sqlite3's VACUUM does
+func TestVacuumCompacts(t *testing.T) {
+	db := openTest(t, vacuumSetup)
+	query(t, db, "vacuum")
+	// sqlite3 3.50 leaves 109 pages
+	if got := db.bt.Pager.PageCount(); got != 109 {
+		t.Errorf("got %d pages, want 109", got)
+	}
+	trunks, err := db.Freelist()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trunks) > 0 {
+		t.Errorf("%d freelist trunks left", len(trunks))
+	}
+	checkIntegrity(t, db)
+	checkNoEmptyPages(t, db)
+}
+
+func TestVacuumInto(t *testing.T) {
+	db := openTest(t, vacuumSetup)
+	want := query(t, db, "select * from t")
+	path := filepath.Join(t.TempDir(), "into.db")
+	query(t, db, "vacuum into '"+path+"'")
+
+	out, err := Open(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	if got := query(t, out, "select * from t"); got != want {
+		t.Error("the copy differs")
+	}
+	if got := out.bt.Pager.PageCount(); got != 109 {
+		t.Errorf("got %d pages, want 109", got)
+	}
+	checkIntegrity(t, out)
+
+	if _, err := queryErr(db, "vacuum into '"+path+"'"); err == nil || err.Error() != "output file already exists" {
+		t.Errorf("got error %v, want output file already exists", err)
+	}
+	if _, err := queryErr(db, "vacuum into 1"); err == nil || err.Error() != "non-text filename" {
+		t.Errorf("got error %v, want non-text filename", err)
+	}
+}
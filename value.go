@@ -0,0 +1,278 @@
+package sqlite
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/elordeiro/SQLite-DBReader/parser"
+	"github.com/elordeiro/SQLite-DBReader/record"
+)
+
+// Collations -----------------------------------------------------------------
+// GetCollation returns the named collating sequence. BINARY compares text as
+// it is stored, so databases in UTF-16 order by their encoded bytes.
+func (db *DB) GetCollation(name string) (record.Collation, error) {
+	switch strings.ToLower(name) {
+	case "", "binary":
+		return db.binaryCollation, nil
+	case "nocase":
+		return func(a, b string) int {
+			return db.binaryCollation(asciiToLower(a), asciiToLower(b))
+		}, nil
+	case "rtrim":
+		return func(a, b string) int {
+			return db.binaryCollation(strings.TrimRight(a, " "), strings.TrimRight(b, " "))
+		}, nil
+	default:
+		return nil, fmt.Errorf("no such collation sequence: %s", name)
+	}
+}
+
+func (db *DB) binaryCollation(a, b string) int {
+	if db.bt.Encoding == record.TextEncodingUTF8 {
+		return strings.Compare(a, b)
+	}
+	return bytes.Compare(db.bt.Encoding.Encode(a), db.bt.Encoding.Encode(b))
+}
+
+// NOCASE only folds ASCII letters
+func asciiToLower(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'A' && r <= 'Z' {
+			return r + 'a' - 'A'
+		}
+		return r
+	}, s)
+}
+
+// ----------------------------------------------------------------------------
+
+// Value Comparison -----------------------------------------------------------
+// compareKeys orders two index entries
+func compareKeys(a, b []any, colls []record.Collation, desc []bool) int {
+	for i := range min(len(a), len(b)) {
+		c := record.CompareValues(a[i], b[i], colls[min(i, len(colls)-1)])
+		if i < len(desc) && desc[i] {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// ----------------------------------------------------------------------------
+
+// Value Conversion -----------------------------------------------------------
+// applyAffinity converts a value before it is stored in a column, see
+// https://www.sqlite.org/datatype3.html#type_affinity
+func applyAffinity(v any, aff parser.Affinity) any {
+	switch aff {
+	case parser.AffinityText:
+		switch v.(type) {
+		case int64, float64:
+			return FormatValue(v)
+		}
+	case parser.AffinityNumeric, parser.AffinityInteger:
+		switch x := v.(type) {
+		case string:
+			if n, ok := parseNumericText(x); ok {
+				return applyAffinity(n, aff)
+			}
+		case float64:
+			if i, ok := floatToInt(x); ok {
+				return i
+			}
+		}
+	case parser.AffinityReal:
+		switch x := v.(type) {
+		case string:
+			if n, ok := parseNumericText(x); ok {
+				return applyAffinity(n, aff)
+			}
+		case int64:
+			return float64(x)
+		}
+	}
+	return v
+}
+
+// parseNumericText converts text that is entirely a number, ignoring
+// surrounding spaces, to an int64 or float64
+func parseNumericText(s string) (any, bool) {
+	s = strings.TrimSpace(s)
+	n := scanNumericPrefix(s)
+	if n == 0 || n != len(s) {
+		return nil, false
+	}
+	return parseNumericPrefix(s[:n]), true
+}
+
+// toNumeric converts a value for arithmetic. Text uses its longest numeric
+// prefix, so 'abc' is 0 and '12abc' is 12.
+func toNumeric(v any) any {
+	switch x := v.(type) {
+	case nil, int64, float64:
+		return v
+	case string:
+		s := strings.TrimLeft(x, " \t\n\r\f")
+		n := scanNumericPrefix(s)
+		if n == 0 {
+			return int64(0)
+		}
+		return parseNumericPrefix(s[:n])
+	case []byte:
+		return toNumeric(string(x))
+	}
+	return int64(0)
+}
+
+// toInteger converts a value the way CAST(x AS INTEGER) does
+func toInteger(v any) any {
+	switch x := toNumeric(v).(type) {
+	case float64:
+		switch {
+		case math.IsNaN(x):
+			return int64(0)
+		case x >= 9223372036854775807.0:
+			return int64(math.MaxInt64)
+		case x <= -9223372036854775808.0:
+			return int64(math.MinInt64)
+		}
+		return int64(x)
+	default:
+		return x
+	}
+}
+
+// toReal converts a value the way CAST(x AS REAL) does
+func toReal(v any) any {
+	switch x := toNumeric(v).(type) {
+	case int64:
+		return float64(x)
+	default:
+		return x
+	}
+}
+
+// FormatValue renders a value as text the way SQLite converts it, with
+// floats printed to 15 significant digits
+func FormatValue(v any) string {
+	switch x := v.(type) {
+	case nil:
+		return ""
+	case int64:
+		return strconv.FormatInt(x, 10)
+	case float64:
+		return formatFloat(x)
+	case string:
+		return x
+	case []byte:
+		return string(x)
+	}
+	return fmt.Sprint(v)
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	case f == 0:
+		return "0.0"
+	}
+
+	s := strconv.FormatFloat(f, 'g', 15, 64)
+	mantissa, exp, hasExp := strings.Cut(s, "e")
+	if !strings.Contains(mantissa, ".") {
+		mantissa += ".0"
+	}
+	if !hasExp {
+		return mantissa
+	}
+
+	// Go writes at least two exponent digits, as does printf
+	return mantissa + "e" + exp
+}
+
+// valueToBool reports the truth value of a condition, with NULL as nil
+func valueToBool(v any) any {
+	switch x := toNumeric(v).(type) {
+	case nil:
+		return nil
+	case int64:
+		return x != 0
+	case float64:
+		return x != 0
+	}
+	return false
+}
+
+func floatToInt(f float64) (int64, bool) {
+	if f != math.Trunc(f) || f < -9223372036854775808.0 || f >= 9223372036854775808.0 {
+		return 0, false
+	}
+	return int64(f), true
+}
+
+// scanNumericPrefix returns the length of the number at the start of s:
+// [+-] digits [. digits] [e [+-] digits]
+func scanNumericPrefix(s string) int {
+	i := 0
+	if i < len(s) && (s[i] == '+' || s[i] == '-') {
+		i++
+	}
+	digits := 0
+	for i < len(s) && isDigit(s[i]) {
+		i++
+		digits++
+	}
+	if i < len(s) && s[i] == '.' {
+		j := i + 1
+		for j < len(s) && isDigit(s[j]) {
+			j++
+			digits++
+		}
+		if digits > 0 {
+			i = j
+		}
+	}
+	if digits == 0 {
+		return 0
+	}
+
+	if i < len(s) && (s[i] == 'e' || s[i] == 'E') {
+		j := i + 1
+		if j < len(s) && (s[j] == '+' || s[j] == '-') {
+			j++
+		}
+		if j < len(s) && isDigit(s[j]) {
+			for j < len(s) && isDigit(s[j]) {
+				j++
+			}
+			i = j
+		}
+	}
+	return i
+}
+
+func parseNumericPrefix(s string) any {
+	if !strings.ContainsAny(s, ".eE") {
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return i
+		}
+	}
+	f, _ := strconv.ParseFloat(s, 64)
+	return f
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// ----------------------------------------------------------------------------
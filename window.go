@@ -0,0 +1,573 @@
+package sqlite
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/elordeiro/SQLite-DBReader/parser"
+)
+
+// Custom Types ---------------------------------------------------------------
+
+// window is a window definition and the window function calls over it,
+// which share one sort of the rows
+type window struct {
+	spec  *parser.WindowSpec
+	calls []*parser.FuncCall
+}
+
+// windowRow is an output row as a window sees it: the keys it is partitioned
+// and ordered by, and the arguments of each call over the window
+type windowRow struct {
+	out  *outputRow
+	keys []any
+	args [][]any
+}
+
+// windowFrame is the frame of a window with its offsets evaluated
+type windowFrame struct {
+	unit       string
+	start, end string // Kinds of parser.FrameBound
+	startN     float64
+	endN       float64
+}
+
+// windowPartition is a run of rows that share their partition keys, sorted
+// by the window's ORDER BY. Rows that tie on it are peers.
+type windowPartition struct {
+	rows   []*windowRow
+	groups []int // Index of the first row of each peer group, then len(rows)
+	group  []int // Peer group of each row
+	order  int   // Index of the ORDER BY key among the keys
+	desc   bool  // The ORDER BY key sorts descending
+	frame  *windowFrame
+}
+
+// Functions that may only be used as window functions, with the number of
+// arguments they take. Aggregate functions may be used as either.
+var windowFunctions = map[string]struct{ minArgs, maxArgs int }{
+	"row_number":   {0, 0},
+	"rank":         {0, 0},
+	"dense_rank":   {0, 0},
+	"percent_rank": {0, 0},
+	"cume_dist":    {0, 0},
+	"ntile":        {1, 1},
+	"lag":          {1, 3},
+	"lead":         {1, 3},
+	"first_value":  {1, 1},
+	"last_value":   {1, 1},
+	"nth_value":    {2, 2},
+}
+
+// Order of the kinds of frame bound, from the start of the partition
+var frameBoundOrder = map[string]int{
+	"UNBOUNDED PRECEDING": 0, "PRECEDING": 1, "CURRENT ROW": 2, "FOLLOWING": 3, "UNBOUNDED FOLLOWING": 4,
+}
+
+// ----------------------------------------------------------------------------
+
+// Window Planning ------------------------------------------------------------
+
+// resolveWindows replaces the windows of the calls in exprs that name one
+// of the WINDOW clause with the definition they name, extended by their own
+func resolveWindows(stmt *parser.SelectStatement, exprs ...parser.Expr) error {
+	named := make(map[string]*parser.WindowSpec)
+	for _, w := range stmt.Windows {
+		spec, err := extendWindow(w.Spec, named)
+		if err != nil {
+			return err
+		}
+		named[strings.ToLower(w.Name)] = spec
+	}
+
+	for _, e := range exprs {
+		err := walkExpr(e, func(e parser.Expr) error {
+			call, ok := e.(*parser.FuncCall)
+			if !ok || call.Over == nil {
+				return nil
+			}
+			var err error
+			call.Over, err = extendWindow(call.Over, named)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// extendWindow builds the window a definition based on a named one gives.
+// It takes the partitioning of the named window, and its ordering and
+// frame when it has none of its own, but may not replace them.
+func extendWindow(spec *parser.WindowSpec, named map[string]*parser.WindowSpec) (*parser.WindowSpec, error) {
+	if spec.Base == "" {
+		return spec, nil
+	}
+	base, ok := named[strings.ToLower(spec.Base)]
+	switch {
+	case !ok:
+		return nil, fmt.Errorf("no such window: %s", spec.Base)
+	case spec.PartitionBy != nil:
+		return nil, fmt.Errorf("cannot override PARTITION clause of window: %s", spec.Base)
+	case spec.OrderBy != nil && base.OrderBy != nil:
+		return nil, fmt.Errorf("cannot override ORDER BY clause of window: %s", spec.Base)
+	case spec.OrderBy == nil && spec.Frame == nil:
+		return base, nil
+	case base.Frame != nil:
+		return nil, fmt.Errorf("cannot override frame specification of window: %s", spec.Base)
+	}
+
+	extended := &parser.WindowSpec{PartitionBy: base.PartitionBy, OrderBy: spec.OrderBy, Frame: spec.Frame}
+	if extended.OrderBy == nil {
+		extended.OrderBy = base.OrderBy
+	}
+	return extended, nil
+}
+
+// collectWindows lists the windows of the window function calls in exprs,
+// rejecting calls to functions that cannot be one and calls nested in the
+// arguments or window of another
+func collectWindows(exprs []parser.Expr) ([]*window, error) {
+	windows := make([]*window, 0)
+	for _, e := range exprs {
+		err := walkExpr(e, func(e parser.Expr) error {
+			call, ok := e.(*parser.FuncCall)
+			if !ok || call.Over == nil {
+				return nil
+			}
+			if err := checkWindowCall(call); err != nil {
+				return err
+			}
+
+			i := slices.IndexFunc(windows, func(w *window) bool { return w.spec == call.Over })
+			if i < 0 {
+				i = len(windows)
+				windows = append(windows, &window{spec: call.Over})
+			}
+			if !slices.Contains(windows[i].calls, call) {
+				windows[i].calls = append(windows[i].calls, call)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return windows, nil
+}
+
+// checkWindowCall validates a window function call and its window
+func checkWindowCall(call *parser.FuncCall) error {
+	spec := call.Over
+	if f, ok := windowFunctions[call.Name]; ok {
+		if call.Star || len(call.Args) < f.minArgs || len(call.Args) > f.maxArgs {
+			return fmt.Errorf("wrong number of arguments to function %s()", call.Name)
+		}
+	} else if f, ok := aggregateFunctions[call.Name]; !ok || len(call.Args) > f.maxArgs {
+		if _, ok := scalarFunctions[call.Name]; !ok {
+			return fmt.Errorf("no such function: %s", call.Name)
+		}
+		return fmt.Errorf("%s() may not be used as a window function", call.Name)
+	}
+	if call.Distinct {
+		return errors.New("DISTINCT is not supported for window functions")
+	}
+
+	nested := slices.Clone(call.Args)
+	nested = append(nested, spec.PartitionBy...)
+	for _, term := range spec.OrderBy {
+		nested = append(nested, term.Expr)
+	}
+	for _, e := range nested {
+		if inner := findWindow(e); inner != nil {
+			return fmt.Errorf("misuse of window function %s()", inner.Name)
+		}
+	}
+
+	if frame := spec.Frame; frame != nil {
+		if frameBoundOrder[frame.Start.Kind] > frameBoundOrder[frame.End.Kind] {
+			return errors.New("unsupported frame specification")
+		}
+		if frame.Unit == "RANGE" && len(spec.OrderBy) != 1 && (frame.Start.Offset != nil || frame.End.Offset != nil) {
+			return errors.New("RANGE with offset PRECEDING/FOLLOWING requires one ORDER BY expression")
+		}
+	}
+	return nil
+}
+
+// findWindow returns the first window function call in e, or nil
+func findWindow(e parser.Expr) *parser.FuncCall {
+	var found *parser.FuncCall
+	walkExpr(e, func(e parser.Expr) error {
+		if call, ok := e.(*parser.FuncCall); ok && found == nil && call.Over != nil {
+			found = call
+		}
+		return nil
+	})
+	return found
+}
+
+// ----------------------------------------------------------------------------
+
+// Window Functions -----------------------------------------------------------
+
+// windowRows computes the window functions for the output rows, which hold
+// the rows and aggregates they are computed from, then the values of the
+// rows. Each window sorts the rows by its partitioning and ordering. As in
+// sqlite3 the last window is computed first, so the rows come out in the
+// order of the first.
+func (db *DB) windowRows(ctx *evalContext, plan *selectPlan, out []*outputRow) ([]*outputRow, error) {
+	for i := len(plan.windows) - 1; i >= 0; i-- {
+		var err error
+		if out, err = db.runWindow(ctx, plan.windows[i], out); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, row := range out {
+		ctx.rows, ctx.aggs = row.rows, row.aggs
+		if err := ctx.evalRow(plan, row); err != nil {
+			return nil, err
+		}
+	}
+	ctx.aggs = nil
+	return out, nil
+}
+
+// runWindow computes the calls over one window, storing their values with
+// the aggregates of each row
+func (db *DB) runWindow(ctx *evalContext, w *window, out []*outputRow) ([]*outputRow, error) {
+	spec := w.spec
+	keyExprs := slices.Clone(spec.PartitionBy)
+	terms := make([]*parser.OrderingTerm, len(spec.PartitionBy))
+	for i := range terms {
+		terms[i] = &parser.OrderingTerm{}
+	}
+	for _, term := range spec.OrderBy {
+		keyExprs = append(keyExprs, term.Expr)
+		terms = append(terms, term)
+	}
+	compare, err := db.keyComparer(keyExprs, terms)
+	if err != nil {
+		return nil, err
+	}
+	nPart := len(spec.PartitionBy)
+	partition, err := db.keyComparer(keyExprs[:nPart], terms[:nPart])
+	if err != nil {
+		return nil, err
+	}
+
+	rows := make([]*windowRow, len(out))
+	for i, o := range out {
+		ctx.rows, ctx.aggs = o.rows, o.aggs
+		row := &windowRow{out: o, keys: make([]any, len(keyExprs)), args: make([][]any, len(w.calls))}
+		for j, e := range keyExprs {
+			if row.keys[j], err = ctx.Eval(e); err != nil {
+				return nil, err
+			}
+		}
+		for j, call := range w.calls {
+			row.args[j] = make([]any, len(call.Args))
+			for k, arg := range call.Args {
+				if row.args[j][k], err = ctx.Eval(arg); err != nil {
+					return nil, err
+				}
+			}
+		}
+		rows[i] = row
+	}
+	if len(rows) == 0 {
+		return out, nil
+	}
+	slices.SortStableFunc(rows, func(a, b *windowRow) int { return compare(a.keys, b.keys) })
+
+	frame, err := ctx.windowFrame(spec)
+	if err != nil {
+		return nil, err
+	}
+	for lo := 0; lo < len(rows); {
+		hi := lo + 1
+		for hi < len(rows) && partition(rows[lo].keys, rows[hi].keys) == 0 {
+			hi++
+		}
+
+		p := &windowPartition{rows: rows[lo:hi], order: nPart, frame: frame}
+		p.desc = len(spec.OrderBy) > 0 && spec.OrderBy[0].Desc
+		for i := range p.rows {
+			if i == 0 || compare(p.rows[i-1].keys, p.rows[i].keys) != 0 {
+				p.groups = append(p.groups, i)
+			}
+			p.group = append(p.group, len(p.groups)-1)
+		}
+		p.groups = append(p.groups, len(p.rows))
+
+		for j, call := range w.calls {
+			if err := db.computeWindow(p, j, call); err != nil {
+				return nil, err
+			}
+		}
+		lo = hi
+	}
+
+	for i, row := range rows {
+		out[i] = row.out
+	}
+	return out, nil
+}
+
+// windowFrame evaluates the offsets of the frame of a window. Without one
+// the frame runs from the start of the partition to the last peer of the
+// current row, which is the whole partition when there is no ORDER BY.
+func (ctx *evalContext) windowFrame(spec *parser.WindowSpec) (*windowFrame, error) {
+	if spec.Frame == nil {
+		return &windowFrame{unit: "RANGE", start: "UNBOUNDED PRECEDING", end: "CURRENT ROW"}, nil
+	}
+
+	frame := &windowFrame{unit: spec.Frame.Unit, start: spec.Frame.Start.Kind, end: spec.Frame.End.Kind}
+	offset := func(b parser.FrameBound, which string) (float64, error) {
+		if b.Offset == nil {
+			return 0, nil
+		}
+		v, err := ctx.Eval(b.Offset)
+		if err != nil {
+			return 0, err
+		}
+		switch x := toNumeric(v).(type) {
+		case int64:
+			if x >= 0 {
+				return float64(x), nil
+			}
+		case float64:
+			if x >= 0 && frame.unit == "RANGE" {
+				return x, nil
+			}
+		}
+		if frame.unit == "RANGE" {
+			return 0, fmt.Errorf("frame %s offset must be a non-negative number", which)
+		}
+		return 0, fmt.Errorf("frame %s offset must be a non-negative integer", which)
+	}
+
+	var err error
+	if frame.startN, err = offset(spec.Frame.Start, "starting"); err != nil {
+		return nil, err
+	}
+	if frame.endN, err = offset(spec.Frame.End, "ending"); err != nil {
+		return nil, err
+	}
+	return frame, nil
+}
+
+// computeWindow computes the jth call over a window for the rows of a
+// partition
+func (db *DB) computeWindow(p *windowPartition, j int, call *parser.FuncCall) error {
+	n := len(p.rows)
+	set := func(i int, v any) {
+		p.rows[i].out.aggs[call] = v
+	}
+
+	switch call.Name {
+	case "row_number":
+		for i := range p.rows {
+			set(i, int64(i+1))
+		}
+	case "rank":
+		for i := range p.rows {
+			set(i, int64(p.groups[p.group[i]]+1))
+		}
+	case "dense_rank":
+		for i := range p.rows {
+			set(i, int64(p.group[i]+1))
+		}
+	case "percent_rank":
+		for i := range p.rows {
+			rank := 0.0
+			if n > 1 {
+				rank = float64(p.groups[p.group[i]]) / float64(n-1)
+			}
+			set(i, rank)
+		}
+	case "cume_dist":
+		for i := range p.rows {
+			set(i, float64(p.groups[p.group[i]+1])/float64(n))
+		}
+	case "ntile":
+		for i, row := range p.rows {
+			tiles, ok := toInteger(row.args[j][0]).(int64)
+			if !ok || tiles < 1 {
+				return errors.New("argument of ntile must be a positive integer")
+			}
+			// The first n%tiles tiles hold one row more than the others
+			size, large := int64(n)/tiles, int64(n)%tiles
+			r, tile := int64(i), int64(0)
+			if r < large*(size+1) {
+				tile = r / (size + 1)
+			} else {
+				tile = (r-large*(size+1))/size + large
+			}
+			set(i, tile+1)
+		}
+	case "lag", "lead":
+		for i, row := range p.rows {
+			args := row.args[j]
+			offset := int64(1)
+			if len(args) > 1 {
+				var ok bool
+				if offset, ok = toInteger(args[1]).(int64); !ok {
+					set(i, nil)
+					continue
+				}
+			}
+			if call.Name == "lag" {
+				offset = -offset
+			}
+			var v any
+			if k := int64(i) + offset; k >= 0 && k < int64(n) {
+				v = p.rows[k].args[j][0]
+			} else if len(args) > 2 {
+				v = args[2]
+			}
+			set(i, v)
+		}
+	case "first_value", "last_value", "nth_value":
+		for i, row := range p.rows {
+			start, end := p.frameBounds(i)
+			k := start
+			switch call.Name {
+			case "last_value":
+				k = end - 1
+			case "nth_value":
+				nth, ok := toInteger(row.args[j][1]).(int64)
+				if !ok || nth < 1 {
+					return errors.New("second argument to nth_value must be a positive integer")
+				}
+				k = end
+				if nth <= int64(end-start) {
+					k = start + int(nth) - 1
+				}
+			}
+			var v any
+			if k >= start && k < end {
+				v = p.rows[k].args[j][0]
+			}
+			set(i, v)
+		}
+	default:
+		return db.computeWindowAggregate(p, j, call)
+	}
+	return nil
+}
+
+// computeWindowAggregate runs an aggregate over the frame of each row. While
+// the frame keeps its start and only grows, as a running total's does, the
+// aggregate steps on from the previous row's. Once a frame held a value that
+// is not an integer, sum() stays REAL for the rest of the partition, as
+// sqlite3's does when it removes rows leaving the frame.
+func (db *DB) computeWindowAggregate(p *windowPartition, j int, call *parser.FuncCall) error {
+	var agg aggregator
+	aggStart, aggEnd := 0, 0
+	isFloat := false
+	for i, row := range p.rows {
+		start, end := p.frameBounds(i)
+		end = max(end, start)
+		if agg == nil || start != aggStart || end < aggEnd {
+			var err error
+			if agg, err = db.newAggregator(call); err != nil {
+				return err
+			}
+			if sum, ok := agg.(*sumAgg); ok {
+				sum.isFloat = isFloat
+			}
+			aggStart, aggEnd = start, start
+		}
+		for ; aggEnd < end; aggEnd++ {
+			if err := agg.Step(p.rows[aggEnd].args[j]); err != nil {
+				return err
+			}
+		}
+		if sum, ok := agg.(*sumAgg); ok {
+			isFloat = sum.isFloat
+		}
+		row.out.aggs[call] = agg.Final()
+	}
+	return nil
+}
+
+// frameBounds returns the rows of the ith row's frame, from start up to but
+// not including end. An empty frame may have end before start.
+func (p *windowPartition) frameBounds(i int) (int, int) {
+	return p.frameBound(i, p.frame.start, p.frame.startN, false),
+		p.frameBound(i, p.frame.end, p.frame.endN, true)
+}
+
+// frameBound finds the first row of a frame, or the row after its last for
+// the end bound
+func (p *windowPartition) frameBound(i int, kind string, n float64, end bool) int {
+	switch kind {
+	case "UNBOUNDED PRECEDING":
+		return 0
+	case "UNBOUNDED FOLLOWING":
+		return len(p.rows)
+	case "PRECEDING":
+		n = -n
+	case "CURRENT ROW":
+		n = 0
+	}
+
+	switch p.frame.unit {
+	case "ROWS":
+		k := i + int(n)
+		if end {
+			k++
+		}
+		return min(max(k, 0), len(p.rows))
+	case "GROUPS":
+		g := p.group[i] + int(n)
+		if end {
+			g++
+		}
+		return p.groups[min(max(g, 0), len(p.groups)-1)]
+	}
+
+	// RANGE runs over the rows whose ORDER BY value is within n of the
+	// current row's
+	if kind == "CURRENT ROW" {
+		if end {
+			return p.groups[p.group[i]+1]
+		}
+		return p.groups[p.group[i]]
+	}
+	target := p.position(i) + n
+	return sort.Search(len(p.rows), func(k int) bool {
+		if end {
+			return p.position(k) > target
+		}
+		return p.position(k) >= target
+	})
+}
+
+// position places a row on a line along which the rows of the partition
+// are in order, so RANGE offsets can be measured. NULLs sort before numbers
+// and other values after them.
+func (p *windowPartition) position(i int) float64 {
+	pos := math.Inf(1)
+	switch x := p.rows[i].keys[p.order].(type) {
+	case nil:
+		pos = math.Inf(-1)
+	case int64:
+		pos = float64(x)
+	case float64:
+		pos = x
+	}
+	if p.desc {
+		return -pos
+	}
+	return pos
+}
+
+// ----------------------------------------------------------------------------
@@ -0,0 +1,57 @@
+package sqlite
+
+import "testing"
+
+const windowSetup = `
+create table sales(id integer primary key, region text, rep text, month integer, amount integer, score real);
+insert into sales values (1, 'east', 'ann', 1, 100, 1.5), (2, 'east', 'bo', 1, 80, 2), (3, 'east', 'ann', 2, 120, null), (4, 'east', 'bo', 2, 80, 3.5), (5, 'west', 'cat', 1, 50, 1), (6, 'west', 'dan', 1, 70, 2.5), (7, 'west', 'cat', 2, 70, 4), (8, 'west', 'dan', 3, null, 0.5), (9, 'north', 'eve', 1, 30, 2);`
+
+func TestWindows(t *testing.T) {
+	runQueries(t, openTest(t, windowSetup), []sqlTest{
+		{"row number", "select id, row_number() over (order by amount desc, id) from sales order by id", "1|2\n2|3\n3|1\n4|4\n5|7\n6|5\n7|6\n8|9\n9|8\n"},
+		{"row number partition", "select region, id, row_number() over (partition by region order by id desc) from sales order by region, id", "east|1|4\neast|2|3\neast|3|2\neast|4|1\nnorth|9|1\nwest|5|4\nwest|6|3\nwest|7|2\nwest|8|1\n"},
+		{"rank", "select id, amount, rank() over (order by amount desc) from sales order by id", "1|100|2\n2|80|3\n3|120|1\n4|80|3\n5|50|7\n6|70|5\n7|70|5\n8||9\n9|30|8\n"},
+		{"dense rank", "select id, amount, dense_rank() over (order by amount desc) from sales order by id", "1|100|2\n2|80|3\n3|120|1\n4|80|3\n5|50|5\n6|70|4\n7|70|4\n8||7\n9|30|6\n"},
+		{"rank partition", "select region, amount, rank() over (partition by region order by amount), dense_rank() over (partition by region order by amount) from sales order by region, amount, id", "east|80|1|1\neast|80|1|1\neast|100|3|2\neast|120|4|3\nnorth|30|1|1\nwest||1|1\nwest|50|2|2\nwest|70|3|3\nwest|70|3|3\n"},
+		{"percent rank", "select id, percent_rank() over (order by amount), cume_dist() over (order by amount) from sales order by id", "1|0.875|0.888888888888889\n2|0.625|0.777777777777778\n3|1.0|1.0\n4|0.625|0.777777777777778\n5|0.25|0.333333333333333\n6|0.375|0.555555555555556\n7|0.375|0.555555555555556\n8|0.0|0.111111111111111\n9|0.125|0.222222222222222\n"},
+		{"lag lead", "select id, lag(amount) over (order by id), lead(amount) over (order by id) from sales order by id", "1||80\n2|100|120\n3|80|80\n4|120|50\n5|80|70\n6|50|70\n7|70|\n8|70|30\n9||\n"},
+		{"lag offset default", "select id, lag(amount, 2, -1) over (partition by region order by id), lead(rep, 1, 'none') over (partition by region order by id) from sales order by id", "1|-1|bo\n2|-1|ann\n3|100|bo\n4|80|none\n5|-1|dan\n6|-1|cat\n7|50|dan\n8|70|none\n9|-1|none\n"},
+		{"first last value", "select id, first_value(rep) over w, last_value(rep) over w from sales window w as (partition by region order by month) order by id", "1|ann|bo\n2|ann|bo\n3|ann|bo\n4|ann|bo\n5|cat|dan\n6|cat|dan\n7|cat|cat\n8|cat|dan\n9|eve|eve\n"},
+		{"last value whole partition", "select id, last_value(amount) over (partition by region order by id rows between unbounded preceding and unbounded following) from sales order by id", "1|80\n2|80\n3|80\n4|80\n5|\n6|\n7|\n8|\n9|30\n"},
+		{"nth value", "select id, nth_value(amount, 2) over (order by id) from sales order by id", "1|\n2|80\n3|80\n4|80\n5|80\n6|80\n7|80\n8|80\n9|80\n"},
+		{"ntile", "select id, ntile(4) over (order by id) from sales order by id", "1|1\n2|1\n3|1\n4|2\n5|2\n6|3\n7|3\n8|4\n9|4\n"},
+		{"ntile partition", "select region, id, ntile(2) over (partition by region order by id) from sales order by region, id", "east|1|1\neast|2|1\neast|3|2\neast|4|2\nnorth|9|1\nwest|5|1\nwest|6|1\nwest|7|2\nwest|8|2\n"},
+		{"running sum", "select id, sum(amount) over (order by id) from sales order by id", "1|100\n2|180\n3|300\n4|380\n5|430\n6|500\n7|570\n8|570\n9|600\n"},
+		{"running sum partition", "select region, id, sum(amount) over (partition by region order by id) from sales order by region, id", "east|1|100\neast|2|180\neast|3|300\neast|4|380\nnorth|9|30\nwest|5|50\nwest|6|120\nwest|7|190\nwest|8|190\n"},
+		{"peers share sum", "select id, month, sum(amount) over (order by month) from sales order by id", "1|1|330\n2|1|330\n3|2|600\n4|2|600\n5|1|330\n6|1|330\n7|2|600\n8|3|600\n9|1|330\n"},
+		{"rows frame", "select id, sum(amount) over (order by id rows between 1 preceding and 1 following) from sales order by id", "1|180\n2|300\n3|280\n4|250\n5|200\n6|190\n7|140\n8|100\n9|30\n"},
+		{"rows frame moving avg", "select id, avg(amount) over (partition by region order by id rows 1 preceding) from sales order by id", "1|100.0\n2|90.0\n3|100.0\n4|100.0\n5|50.0\n6|60.0\n7|70.0\n8|70.0\n9|30.0\n"},
+		{"rows following", "select id, count(amount) over (order by id rows between current row and 2 following) from sales order by id", "1|3\n2|3\n3|3\n4|3\n5|3\n6|2\n7|2\n8|1\n9|1\n"},
+		{"range frame", "select id, month, sum(amount) over (order by month range between 1 preceding and current row) from sales order by id", "1|1|330\n2|1|330\n3|2|600\n4|2|600\n5|1|330\n6|1|330\n7|2|600\n8|3|270\n9|1|330\n"},
+		{"range frame real", "select id, score, count(*) over (order by score range between 1 preceding and 1 following) from sales order by id", "1|1.5|6\n2|2.0|5\n3||1\n4|3.5|3\n5|1.0|5\n6|2.5|5\n7|4.0|2\n8|0.5|3\n9|2.0|5\n"},
+		{"range unbounded", "select id, max(amount) over (partition by region order by month range between current row and unbounded following) from sales order by id", "1|120\n2|120\n3|120\n4|120\n5|70\n6|70\n7|70\n8|\n9|30\n"},
+		{"whole partition", "select id, count(*) over (partition by region), sum(amount) over () from sales order by id", "1|4|600\n2|4|600\n3|4|600\n4|4|600\n5|4|600\n6|4|600\n7|4|600\n8|4|600\n9|1|600\n"},
+		{"aggregate over window", "select region, sum(amount), rank() over (order by sum(amount) desc) from sales group by region order by region", "east|380|1\nnorth|30|3\nwest|190|2\n"},
+		{"window in order by", "select id from sales order by row_number() over (order by amount, id desc)", "8\n9\n5\n7\n6\n4\n2\n1\n3\n"},
+		{"group concat window", "select id, group_concat(rep, '-') over (partition by region order by id) from sales order by id", "1|ann\n2|ann-bo\n3|ann-bo-ann\n4|ann-bo-ann-bo\n5|cat\n6|cat-dan\n7|cat-dan-cat\n8|cat-dan-cat-dan\n9|eve\n"},
+		{"min max window", "select id, min(score) over (order by id rows 2 preceding), max(score) over (order by id rows 2 preceding) from sales order by id", "1|1.5|1.5\n2|1.5|2.0\n3|1.5|2.0\n4|2.0|3.5\n5|1.0|3.5\n6|1.0|3.5\n7|1.0|4.0\n8|0.5|4.0\n9|0.5|4.0\n"},
+		{"groups frame", "select id, month, count(*) over (order by month groups between 1 preceding and current row) from sales order by id", "1|1|5\n2|1|5\n3|2|8\n4|2|8\n5|1|5\n6|1|5\n7|2|8\n8|3|4\n9|1|5\n"},
+		{"named window extended", "select id, sum(amount) over (w rows unbounded preceding) from sales window w as (partition by region order by id) order by id", "1|100\n2|180\n3|300\n4|380\n5|50\n6|120\n7|190\n8|190\n9|30\n"},
+		{"sliding sum stays real", "select x, sum(x) over (order by x range between 1 preceding and 1 following) from (select 1 x union all select null union all select 2 union all select 2.5 union all select null union all select 5) order by x", "|\n|\n1|3\n2|5.5\n2.5|4.5\n5|5.0\n"},
+		{"real sum per partition", "select id, sum(v) over (partition by region order by id rows between current row and 1 following) from (select id, region, case id when 2 then 0.5 else amount end as v from sales) order by id", "1|100.5\n2|120.5\n3|200.0\n4|80.0\n5|120\n6|140\n7|70\n8|\n9|30\n"},
+		{"plan", "explain query plan select id, row_number() over (order by amount) from sales", "QUERY PLAN\n|--CO-ROUTINE (subquery-2)\n|  |--SCAN sales\n|  `--USE TEMP B-TREE FOR ORDER BY\n`--SCAN (subquery-2)\n"},
+	})
+}
+
+func TestWindowErrors(t *testing.T) {
+	runSQLErrors(t, openTest(t, windowSetup), []sqlError{
+		{"select row_number() over () from sales where row_number() over () > 1", "misuse of window function row_number()"},
+		{"select sum(amount) over w from sales", "no such window: w"},
+		{"select ntile(0) over () from sales", "argument of ntile must be a positive integer"},
+		{"select row_number(1) over () from sales", "wrong number of arguments to function row_number()"},
+		{"select sum(amount) over (rows between 1 following and current row) from sales", "unsupported frame specification"},
+		{"select sum(amount) over (rows between current row and unbounded preceding) from sales", `near "preceding": syntax error`},
+		{"select sum(amount) over (partition by region range 1 preceding) from sales", "RANGE with offset PRECEDING/FOLLOWING requires one ORDER BY expression"},
+		{"select sum(amount) over (rows between unbounded following and current row) from sales", `near "following": syntax error`},
+	})
+}
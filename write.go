@@ -0,0 +1,340 @@
+package sqlite
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/elordeiro/SQLite-DBReader/btree"
+	"github.com/elordeiro/SQLite-DBReader/pager"
+	"github.com/elordeiro/SQLite-DBReader/parser"
+	"github.com/elordeiro/SQLite-DBReader/record"
+)
+
+// Row Writing ----------------------------------------------------------------
+// writeRow checks a new or changed row against the constraints of its table
+// and stores it along with its index entries. old is the row as it was
+// before an UPDATE and nil for an INSERT. Conflicts are resolved as the
+// statement's OR clause says: IGNORE skips the row, reported by returning
+// false, REPLACE deletes the rows in the way and anything else fails.
+func (db *DB) writeRow(table *Table, indexes []*Table, row, old *Row, conflict string) (bool, error) {
+	for i, col := range table.Columns {
+		if !col.NotNull || row.Values[i] != nil {
+			continue
+		}
+		if conflict == "IGNORE" {
+			return false, nil
+		}
+		if conflict == "REPLACE" && col.Default != nil {
+			v, err := (&evalContext{db: db}).Eval(col.Default)
+			if err != nil {
+				return false, err
+			}
+			row.Values[i] = applyAffinity(v, col.Affinity)
+		}
+		if row.Values[i] == nil {
+			return false, fmt.Errorf("NOT NULL constraint failed: %s.%s", table.Name, col.Name)
+		}
+	}
+
+	if old == nil || old.RowID != row.RowID {
+		existing, err := db.fetchRow(table, row.RowID)
+		if err != nil {
+			return false, err
+		}
+		if existing != nil {
+			switch conflict {
+			case "IGNORE":
+				return false, nil
+			case "REPLACE":
+				if err := db.deleteRow(table, indexes, existing); err != nil {
+					return false, err
+				}
+			default:
+				name := "rowid"
+				if table.RowIDAlias >= 0 {
+					name = table.Columns[table.RowIDAlias].Name
+				}
+				return false, fmt.Errorf("UNIQUE constraint failed: %s.%s", table.Name, name)
+			}
+		}
+	}
+
+	// An updated row's own index entries do not conflict with it
+	self := row.RowID
+	if old != nil {
+		self = old.RowID
+	}
+	keys := make([][]any, len(indexes))
+	for i, index := range indexes {
+		key, err := db.indexKey(index, row)
+		if err != nil {
+			return false, err
+		}
+		keys[i] = key
+
+		rowID, found, err := db.uniqueConflict(index, key, self)
+		if err != nil {
+			return false, err
+		}
+		if !found {
+			continue
+		}
+		switch conflict {
+		case "IGNORE":
+			return false, nil
+		case "REPLACE":
+			existing, err := db.fetchRow(table, rowID)
+			if err != nil {
+				return false, err
+			}
+			if existing == nil {
+				return false, pager.CorruptPage(index.PageNum, "index %s refers to missing row %d", index.Name, rowID)
+			}
+			if err := db.deleteRow(table, indexes, existing); err != nil {
+				return false, err
+			}
+		default:
+			return false, uniqueError(table, index)
+		}
+	}
+
+	record := db.bt.MakeRecord(tableRecord(table, row))
+	switch {
+	case old == nil:
+		if err := db.bt.InsertRow(table.PageNum, row.RowID, record); err != nil {
+			return false, err
+		}
+	case old.RowID == row.RowID:
+		if err := db.deleteIndexEntries(indexes, old); err != nil {
+			return false, err
+		}
+		if err := db.bt.ReplaceRow(table.PageNum, row.RowID, record); err != nil {
+			return false, err
+		}
+	default:
+		if err := db.deleteRow(table, indexes, old); err != nil {
+			return false, err
+		}
+		if err := db.bt.InsertRow(table.PageNum, row.RowID, record); err != nil {
+			return false, err
+		}
+	}
+
+	for i, index := range indexes {
+		if len(keys[i]) == 0 {
+			continue
+		}
+		if err := db.insertIndexEntry(index, keys[i]); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// deleteRow removes a row and its index entries
+func (db *DB) deleteRow(table *Table, indexes []*Table, row *Row) error {
+	if err := db.deleteIndexEntries(indexes, row); err != nil {
+		return err
+	}
+	return db.bt.DeleteRow(table.PageNum, row.RowID)
+}
+
+func (db *DB) deleteIndexEntries(indexes []*Table, row *Row) error {
+	for _, index := range indexes {
+		key, err := db.indexKey(index, row)
+		if err != nil {
+			return err
+		}
+		if len(key) == 0 {
+			continue
+		}
+		if err := db.deleteIndexEntry(index, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (db *DB) insertIndexEntry(index *Table, key []any) error {
+	cmp, err := db.indexKeyCompare(index)
+	if err != nil {
+		return err
+	}
+	return db.bt.InsertIndexEntry(index.PageNum, key, cmp)
+}
+
+func (db *DB) deleteIndexEntry(index *Table, key []any) error {
+	cmp, err := db.indexKeyCompare(index)
+	if err != nil {
+		return err
+	}
+	return db.bt.DeleteIndexEntry(index.PageNum, key, cmp)
+}
+
+// indexKeyCompare orders the entries of an index against a key by the
+// collation and direction of each column
+func (db *DB) indexKeyCompare(index *Table) (btree.KeyCompare, error) {
+	colls, desc, err := db.IndexKeyOrder(index)
+	if err != nil {
+		return nil, err
+	}
+	return func(rec *record.Record, key []any) int {
+		return record.CompareKey(rec, key, colls, desc)
+	}, nil
+}
+
+// targetSource finds the table an UPDATE or DELETE writes to
+func (db *DB) targetSource(name, alias string) (*rowSource, error) {
+	table, err := db.lookupTable(name)
+	if err != nil {
+		return nil, err
+	}
+	if isInternalTable(table.Name) {
+		return nil, fmt.Errorf("table %s may not be modified", table.Name)
+	}
+	if alias == "" {
+		alias = table.Name
+	}
+	return &rowSource{name: alias, table: table}, nil
+}
+
+// matchingRowIDs lists the rows of a table satisfying where, read through
+// the same planner as SELECT. Collecting them first keeps the scan from
+// seeing the changes made to them.
+func (db *DB) matchingRowIDs(src *rowSource, where parser.Expr) ([]int64, error) {
+	sources := []*rowSource{src}
+	if err := bindExpr(where, sources); err != nil {
+		return nil, err
+	}
+	if call := findAggregate(where); call != nil {
+		return nil, fmt.Errorf("misuse of aggregate function %s()", call.Name)
+	}
+	subqueries, err := db.planSubqueries(&scope{sources: sources}, where)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only the rowid is needed, so an index holding the columns of where
+	// covers the scan
+	used := []map[int]bool{{}}
+	usedColumns(used, where)
+	plan, err := db.planJoin(sources, where, used)
+	if err != nil {
+		return nil, err
+	}
+	rowIDs := make([]int64, 0)
+	ctx := &evalContext{
+		db:         db,
+		rows:       make([]*Row, 1),
+		subqueries: subqueries,
+		results:    make(map[*selectPlan]*Result),
+	}
+	err = db.scanSources(ctx, plan, func() (bool, error) {
+		rowIDs = append(rowIDs, ctx.rows[0].RowID)
+		return true, nil
+	})
+	return rowIDs, err
+}
+
+// fetchRow reads the row with the given rowid, or nil when there is none
+func (db *DB) fetchRow(table *Table, rowID int64) (*Row, error) {
+	c := db.bt.NewCursor(table.PageNum)
+	found, err := c.SeekRowID(rowID)
+	if err != nil || !found || int64(c.Cell().RowID) != rowID {
+		return nil, err
+	}
+	return db.tableRow(table, c.Cell())
+}
+
+// tableRecord lists the values stored in a row's record. The rowid alias
+// column is stored as NULL and virtual generated columns are left out.
+func tableRecord(table *Table, row *Row) []any {
+	values := make([]any, 0, len(table.Columns))
+	for i, col := range table.Columns {
+		switch {
+		case col.RecordIdx < 0:
+		case i == table.RowIDAlias:
+			values = append(values, nil)
+		default:
+			values = append(values, row.Values[i])
+		}
+	}
+	return values
+}
+
+// indexKey computes the index entry for a row: the indexed values followed
+// by the rowid. The key is empty when a partial index leaves the row out.
+func (db *DB) indexKey(index *Table, row *Row) ([]any, error) {
+	ctx := &evalContext{db: db, rows: []*Row{row}}
+	if index.Where != nil {
+		ok, err := ctx.EvalBool(index.Where)
+		if err != nil || !ok {
+			return []any{}, err
+		}
+	}
+
+	key := make([]any, 0, len(index.IndexColumns)+1)
+	for _, col := range index.IndexColumns {
+		switch col.Col {
+		case RowIDColumn:
+			key = append(key, row.RowID)
+		case ExprColumn:
+			v, err := ctx.Eval(col.Expr)
+			if err != nil {
+				return nil, err
+			}
+			key = append(key, v)
+		default:
+			key = append(key, row.Values[col.Col])
+		}
+	}
+	return append(key, row.RowID), nil
+}
+
+// uniqueConflict returns the rowid of another row whose entry in a unique
+// index has the same indexed values as key, skipping the entry for self.
+// Entries containing NULL never conflict.
+func (db *DB) uniqueConflict(index *Table, key []any, self int64) (int64, bool, error) {
+	if !index.Unique || len(key) == 0 {
+		return 0, false, nil
+	}
+	prefix := key[:len(key)-1]
+	for _, v := range prefix {
+		if v == nil {
+			return 0, false, nil
+		}
+	}
+
+	colls, desc, err := db.IndexKeyOrder(index)
+	if err != nil {
+		return 0, false, err
+	}
+	c := db.bt.NewCursor(index.PageNum)
+	ok, err := c.SeekKey(func(rec *record.Record) int {
+		return record.CompareKey(rec, prefix, colls, desc)
+	})
+	for ; ok && err == nil; ok, err = c.Next() {
+		rec := c.Cell().Record
+		if record.CompareKey(rec, prefix, colls, desc) != 0 {
+			return 0, false, nil
+		}
+		rowID, _ := rec.Value(len(rec.ColumnTypes) - 1).(int64)
+		if rowID != self {
+			return rowID, true, nil
+		}
+	}
+	return 0, false, err
+}
+
+func uniqueError(table *Table, index *Table) error {
+	names := make([]string, len(index.IndexColumns))
+	for i, col := range index.IndexColumns {
+		if col.Col == ExprColumn {
+			return fmt.Errorf("UNIQUE constraint failed: index '%s'", index.Name)
+		}
+		names[i] = table.Name + "." + col.Name
+	}
+	return fmt.Errorf("UNIQUE constraint failed: %s", strings.Join(names, ", "))
+}
+
+// ----------------------------------------------------------------------------